@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/app"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/database"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/service"
+)
+
+// lifecycle applies the rules in LIFECYCLE_RULES: media nobody has watched
+// for a while is moved to cold storage, and cold media that was requested
+// again is moved back. Run it from cron.
+func main() {
+	dryRun := flag.Bool("dry-run", false, "print what would be moved without moving anything")
+	flag.Parse()
+
+	if err := config.LoadEnv(); err != nil {
+		log.Printf("Warning: Error loading .env file: %v", err)
+	}
+
+	cfg := config.New()
+
+	db, err := database.InitWithHost(cfg.Database, cfg.Host)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	storageProvider, err := app.NewStorageProvider(cfg, db)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	defer storageProvider.Close()
+
+	lifecycle := service.NewLifecycleService(db.DB, storageProvider, service.LifecycleOptions{
+		Rules:       cfg.Lifecycle.Rules,
+		ColdClass:   cfg.Storage.ColdClass,
+		RestoreDays: cfg.Lifecycle.RestoreDays,
+		DryRun:      *dryRun,
+	})
+
+	result, err := lifecycle.Run(context.Background())
+	if err != nil {
+		log.Fatalf("Lifecycle run stopped: %v", err)
+	}
+
+	log.Printf("Moved %d objects to cold storage and %d back, %d still restoring, %d failed",
+		result.Cooled, result.Warmed, result.Waiting, result.Failed)
+
+	if result.Failed > 0 {
+		os.Exit(1)
+	}
+}
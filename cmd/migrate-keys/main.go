@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/app"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/database"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/service"
+)
+
+// migrate-keys moves media stored under the old "{user}/{filename}" keys to
+// the key scheme set by STORAGE_KEY_SCHEME and updates their records.
+func main() {
+	dryRun := flag.Bool("dry-run", false, "print the new keys without moving anything")
+	flag.Parse()
+
+	if err := config.LoadEnv(); err != nil {
+		log.Printf("Warning: Error loading .env file: %v", err)
+	}
+
+	cfg := config.New()
+
+	db, err := database.InitWithHost(cfg.Database, cfg.Host)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	storageProvider, err := app.NewStorageProvider(cfg, db)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	defer storageProvider.Close()
+
+	result, err := service.NewKeyMigrator(db.DB, storageProvider, *dryRun).Run(context.Background())
+	if err != nil {
+		log.Fatalf("Key migration stopped: %v", err)
+	}
+
+	if *dryRun {
+		log.Printf("Dry run: %d media would be migrated, %d failed", result.Migrated, result.Failed)
+		return
+	}
+	log.Printf("Migrated %d media, %d failed", result.Migrated, result.Failed)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/app"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/database"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/service"
+)
+
+// reconcile-storage compares the objects in storage with the media, blob and
+// upload records pointing at them. It reports orphaned objects, records whose
+// object is gone, wrong blob reference counts and abandoned uploads, and can
+// quarantine orphans or repair what is safe to repair. Run it from cron.
+func main() {
+	mode := flag.String("mode", service.ReconcileReport, "report, quarantine (move orphaned objects aside) or fix (also repair records)")
+	grace := flag.Duration("grace", 24*time.Hour, "ignore objects and records changed more recently than this")
+	prefix := flag.String("quarantine-prefix", "quarantine/", "key prefix orphaned objects are moved under")
+	output := flag.String("json", "", "also write the report as JSON to this file, - for stdout")
+	flag.Parse()
+
+	if err := config.LoadEnv(); err != nil {
+		log.Printf("Warning: Error loading .env file: %v", err)
+	}
+
+	cfg := config.New()
+
+	db, err := database.InitWithHost(cfg.Database, cfg.Host)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	storageProvider, err := app.NewStorageProvider(cfg, db)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	defer storageProvider.Close()
+
+	reconciler := service.NewReconciler(db.DB, storageProvider, service.ReconcileOptions{
+		Mode:             *mode,
+		GracePeriod:      *grace,
+		QuarantinePrefix: *prefix,
+		StagingDir:       cfg.Upload.StagingDir,
+	})
+
+	result, err := reconciler.Run(context.Background())
+	if result != nil {
+		for _, issue := range result.Issues {
+			line := issue.Kind + " " + issue.Key
+			if issue.Record != "" {
+				line += " (" + issue.Record + ")"
+			}
+			if issue.Detail != "" {
+				line += ": " + issue.Detail
+			}
+			switch {
+			case issue.Error != "":
+				line += " -> failed: " + issue.Error
+			case issue.Action != "":
+				line += " -> " + issue.Action
+			}
+			log.Println(line)
+		}
+
+		if *output != "" {
+			writeReport(*output, result)
+		}
+	}
+	if err != nil {
+		log.Fatalf("Reconciliation stopped: %v", err)
+	}
+
+	log.Printf("Checked %d objects, %d media keys and %d blobs: %d issues, %d failed to fix",
+		result.Objects, result.Keys, result.Blobs, len(result.Issues), result.Failed())
+
+	if result.Failed() > 0 {
+		os.Exit(1)
+	}
+}
+
+func writeReport(path string, result *service.ReconcileResult) {
+	out := os.Stdout
+	if path != "-" {
+		file, err := os.Create(path)
+		if err != nil {
+			log.Fatalf("Failed to write report: %v", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		log.Fatalf("Failed to write report: %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/database"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/repository"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/storage"
+)
+
+// rotate-keys re-wraps every stored data key with the active master key, the
+// first entry of ENCRYPTION_MASTER_KEYS or ENCRYPTION_KEY_FILE. Keep the old
+// master keys configured until it has finished.
+func main() {
+	if err := config.LoadEnv(); err != nil {
+		log.Printf("Warning: Error loading .env file: %v", err)
+	}
+
+	cfg := config.New()
+
+	keyring, err := storage.NewKeyring(cfg.Storage.Encryption)
+	if err != nil {
+		log.Fatalf("Failed to load master keys: %v", err)
+	}
+
+	db, err := database.InitWithHost(cfg.Database, cfg.Host)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	keys := repository.NewObjectKeyRepository(repository.New(db))
+
+	rotated, err := storage.RotateKeys(context.Background(), keyring, keys)
+	if err != nil {
+		log.Fatalf("Key rotation failed after %d keys: %v", rotated, err)
+	}
+
+	log.Printf("Re-wrapped %d data keys with master key %q", rotated, keyring.ActiveKeyID())
+}
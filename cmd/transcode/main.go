@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/app"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/database"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/service"
+)
+
+// transcode packages uploaded media for HLS and DASH with ffmpeg, using the
+// renditions in HLS_RENDITIONS. Transcode jobs in cmd/worker package new
+// files as they come; this packages whatever is left pending or failed, e.g.
+// media uploaded before the worker ran. Run it from cron, or keep it running
+// with -watch.
+func main() {
+	concurrency := flag.Int("concurrency", 1, "number of media to transcode at once")
+	watch := flag.Duration("watch", 0, "keep running, looking for new media at this interval")
+	flag.Parse()
+
+	if err := config.LoadEnv(); err != nil {
+		log.Printf("Warning: Error loading .env file: %v", err)
+	}
+
+	cfg := config.New()
+
+	db, err := database.InitWithHost(cfg.Database, cfg.Host)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	storageProvider, err := app.NewStorageProvider(cfg, db)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	defer storageProvider.Close()
+
+	// A package cut short is picked up again by a later run
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	packages := service.NewPackagingService(db.DB, storageProvider, cfg.Process)
+
+	for {
+		result, err := packages.Run(ctx, *concurrency)
+		if err != nil && ctx.Err() == nil {
+			log.Fatalf("Transcode run stopped: %v", err)
+		}
+
+		log.Printf("Packaged %d media, %d failed", result.Packaged, result.Failed)
+
+		if *watch <= 0 {
+			if result.Failed > 0 {
+				os.Exit(1)
+			}
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(*watch):
+		}
+	}
+}
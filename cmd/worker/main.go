@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os/signal"
+	"syscall"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/app"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/database"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/service"
+)
+
+// worker runs the background jobs queued by the API: verifying direct
+// uploads, probing, thumbnails, transcoding and releasing the storage of
+// deleted media. Run as many as needed; each job is leased by one worker at a
+// time.
+func main() {
+	name := flag.String("name", service.WorkerName("worker"), "name of this worker in the jobs it leases")
+	flag.Parse()
+
+	if err := config.LoadEnv(); err != nil {
+		log.Printf("Warning: Error loading .env file: %v", err)
+	}
+
+	cfg := config.New()
+	if err := service.CheckProbe(cfg.Process); err != nil {
+		log.Fatalf("Failed to start worker: %v", err)
+	}
+
+	db, err := database.InitWithHost(cfg.Database, cfg.Host)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	storageProvider, err := app.NewStorageProvider(cfg, db)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	defer storageProvider.Close()
+
+	// Jobs cut short are handed back to the queue for another worker
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	jobs := service.NewMediaJobs(db.DB, storageProvider, cfg)
+
+	log.Printf("Worker %s started", *name)
+	if err := jobs.Queue().Work(ctx, *name); err != nil {
+		log.Fatalf("Worker stopped: %v", err)
+	}
+	log.Printf("Worker %s stopped", *name)
+}
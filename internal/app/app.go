@@ -1,10 +1,15 @@
 package app
 
 import (
+	"context"
+	"errors"
+
 	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
 	"github.com/Shubham-Thakur06/go-streaming-platform/internal/database"
 	"github.com/Shubham-Thakur06/go-streaming-platform/internal/handlers"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/repository"
 	"github.com/Shubham-Thakur06/go-streaming-platform/internal/server"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/service"
 	"github.com/Shubham-Thakur06/go-streaming-platform/internal/storage"
 )
 
@@ -17,12 +22,24 @@ type App struct {
 }
 
 func New(cfg *config.Config) (*App, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if err := service.CheckProbe(cfg.Process); err != nil {
+		return nil, err
+	}
+
+	// Encrypted objects can only be decrypted by the server
+	if cfg.Storage.Encryption.Enabled && cfg.Stream.Mode != "proxy" {
+		return nil, errors.New("storage encryption requires STREAM_MODE=proxy")
+	}
+
 	db, err := database.InitWithHost(cfg.Database, cfg.Host)
 	if err != nil {
 		return nil, err
 	}
 
-	storageProvider, err := storage.NewProvider(cfg.Storage)
+	storageProvider, err := NewStorageProvider(cfg, db)
 	if err != nil {
 		return nil, err
 	}
@@ -42,10 +59,40 @@ func New(cfg *config.Config) (*App, error) {
 	return app, nil
 }
 
+// NewStorageProvider builds the configured storage backend and connects the
+// parts of it that keep state in the database.
+func NewStorageProvider(cfg *config.Config, db *database.DB) (*storage.StorageProvider, error) {
+	storageProvider, err := storage.NewProvider(context.Background(), cfg.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	// Mirrored storage records replication state in the database
+	if mirror := storageProvider.Mirror(); mirror != nil {
+		mirror.SetTracker(repository.NewReplicaRepository(repository.New(db)))
+	}
+
+	// Encrypted storage keeps the wrapped data keys in the database
+	if encrypted := storageProvider.Encryption(); encrypted != nil {
+		encrypted.SetKeyStore(repository.NewObjectKeyRepository(repository.New(db)))
+	}
+
+	// The CDN serves objects with the backend as its origin
+	if cfg.Stream.Mode == "cdn" {
+		cdn, err := storage.NewCDN(cfg.Stream.CDN)
+		if err != nil {
+			return nil, err
+		}
+		storageProvider.SetCDN(cdn)
+	}
+
+	return storageProvider, nil
+}
+
 func (a *App) Run() error {
 	return a.Server.Start()
 }
 
 func (a *App) Shutdown() error {
-	return nil
+	return a.StorageProvider.Close()
 }
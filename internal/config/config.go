@@ -1,18 +1,27 @@
 package config
 
 import (
+	"fmt"
+	"log"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Storage  StorageConfig
-	JWT      JWTConfig
-	Host     HostConfig
+	Server    ServerConfig
+	Database  DatabaseConfig
+	Storage   StorageConfig
+	Upload    UploadConfig
+	Quota     QuotaConfig
+	Lifecycle LifecycleConfig
+	Process   ProcessConfig
+	Stream    StreamConfig
+	Jobs      JobConfig
+	JWT       JWTConfig
+	Host      HostConfig
 }
 
 type ServerConfig struct {
@@ -30,10 +39,18 @@ type DatabaseConfig struct {
 }
 
 type StorageConfig struct {
-	Provider string // "aws", "azure", "gcp"
-	AWS      AWSConfig
-	Azure    AzureConfig
-	GCP      GCPConfig
+	Provider         string // "aws", "azure", "gcp", "local", "memory", "mirror"
+	UploadTimeout    int    // in seconds, 0 disables the limit
+	OperationTimeout int    // in seconds, applies to non-upload calls
+	KeyScheme        string // object key template, e.g. "{user}/{media_id}/{sanitized_name}"
+	ColdClass        string // storage class cold media is moved to, e.g. "GLACIER"
+	ColdProvider     string // provider cold media is moved to instead of changing class
+	AWS              AWSConfig
+	Azure            AzureConfig
+	GCP              GCPConfig
+	Local            LocalConfig
+	Mirror           MirrorConfig
+	Encryption       EncryptionConfig
 }
 
 type AWSConfig struct {
@@ -41,12 +58,18 @@ type AWSConfig struct {
 	SecretAccessKey string
 	Region          string
 	BucketName      string
+	// Endpoint of an S3-compatible store, e.g. http://127.0.0.1:9000 for MinIO
+	Endpoint           string
+	ForcePathStyle     bool   // address buckets as endpoint/bucket instead of bucket.endpoint
+	InsecureSkipVerify bool   // accept any TLS certificate, for development only
+	PublicBaseURL      string // optional, base of the URLs stored for objects
 }
 
 type AzureConfig struct {
 	AccountName   string
 	AccountKey    string
 	ContainerName string
+	Endpoint      string // optional, e.g. http://127.0.0.1:10000/devstoreaccount1 for Azurite
 }
 
 type GCPConfig struct {
@@ -55,6 +78,108 @@ type GCPConfig struct {
 	CredentialsFile string
 }
 
+type LocalConfig struct {
+	RootDir    string
+	BaseURL    string // public URL of this server, used to build file URLs
+	SigningKey string // HMAC key for presigned stream URLs
+}
+
+// UploadConfig controls resumable (tus) and direct-to-storage uploads.
+type UploadConfig struct {
+	StagingDir      string // holds the not-yet-flushed tail of each upload
+	PartSize        int64  // in bytes, at least 5 MiB
+	MaxSize         int64  // in bytes, 0 means unlimited
+	DirectPartSize  int64  // in bytes, direct uploads above this are sent in parts
+	DirectURLExpiry int    // in seconds, lifetime of presigned upload URLs
+}
+
+// QuotaConfig is the storage quota of users without one of their own.
+type QuotaConfig struct {
+	Bytes int64 // 0 means unlimited
+	Files int64 // 0 means unlimited
+}
+
+// LifecycleConfig controls when media is moved to cold storage and how it
+// is brought back.
+type LifecycleConfig struct {
+	Rules       []string // e.g. "no_views:90d", "age:365d"; media matching any rule cools down
+	RestoreDays int      // days a restored archive copy stays readable
+	RetryAfter  int      // in seconds, suggested wait while cold media warms up
+}
+
+// ProcessConfig controls the processing of uploaded files with local
+// ffmpeg tools.
+type ProcessConfig struct {
+	Probe         bool   // inspect uploads with ffprobe
+	FFprobePath   string // ffprobe binary, looked up in PATH without a directory
+	ProbeTimeout  int    // in seconds
+	RejectCorrupt bool   // refuse files ffprobe cannot read instead of flagging them; probes inside the upload request
+
+	Thumbnails       bool     // pull thumbnail candidates from uploaded videos with ffmpeg
+	FFmpegPath       string   // ffmpeg binary, looked up in PATH without a directory
+	ThumbnailMode    string   // "offsets" takes the frame at each offset, "scene" the first new shot after it
+	ThumbnailOffsets []string // one candidate each, in seconds or percent of the duration, e.g. "30", "25%"
+	ThumbnailWidths  []int    // sizes every candidate is stored in, the widest is the poster
+	SceneThreshold   float64  // scene score from 0 to 1 that counts as a new shot
+	ThumbnailTimeout int      // in seconds, per candidate
+
+	Transcode         bool     // package media for HLS and DASH, done by cmd/worker
+	Renditions        []string // "name:WIDTHxHEIGHT:video kbps:audio kbps", e.g. "720p:1280x720:2800:128"
+	SegmentFormat     string   // "fmp4" or "ts"
+	SegmentSeconds    int      // target length of a segment
+	AudioBitrate      int      // in kbps, for audio-only media
+	VideoPreset       string   // x264 preset, faster ones give bigger files
+	TranscodeTimeout  int      // in seconds, per media
+	TranscodeAttempts int      // failures before a media is left to progressive streaming
+}
+
+// JobConfig controls the background job queue worked by cmd/worker.
+type JobConfig struct {
+	Concurrency  []string // "type:n" pairs per worker process, e.g. "media.transcode:2"; other types run one at a time
+	MaxAttempts  int      // runs before a job is dead-lettered
+	Backoff      int      // in seconds, wait before the first retry, doubled for each one after
+	MaxBackoff   int      // in seconds
+	Lease        int      // in seconds, renewed while a job runs; a job whose lease ran out is taken over
+	PollInterval int      // in seconds, between looks for due jobs while idle
+	Retention    int      // in hours, succeeded jobs are kept this long
+}
+
+type StreamConfig struct {
+	Mode string // "presigned" hands out backend URLs, "proxy" streams through the server, "cdn" hands out CDN URLs
+	CDN  CDNConfig
+}
+
+// CDNConfig configures delivery through a CDN in front of the storage
+// backend, which stays the origin. URLs and cookies are signed CloudFront
+// style when a key pair is set.
+type CDNConfig struct {
+	BaseURL        string // e.g. https://d111111abcdef8.cloudfront.net, objects are served at BaseURL/key
+	KeyPairID      string // public key ID, leave empty for a distribution without signing
+	PrivateKey     string // PEM encoded RSA private key
+	PrivateKeyFile string // or a file holding it
+	Policy         string // "canned" or "custom"
+	URLExpiry      int    // in seconds
+	RestrictIP     bool   // custom policy only, limit access to the requesting client's IP
+	SignedCookies  bool   // sign cookies covering a path prefix instead of each URL
+	CookieDomain   string // e.g. .example.com, shared by this server and the distribution
+}
+
+// MirrorConfig configures the "mirror" provider, which writes every object to a
+// primary backend and replicates it to the secondaries.
+type MirrorConfig struct {
+	Primary     string
+	Secondaries []string
+	Mode        string // "sync" or "async"
+	Workers     int
+}
+
+// EncryptionConfig enables client-side envelope encryption of stored objects.
+type EncryptionConfig struct {
+	Enabled    bool
+	MasterKeys []string // "id:base64-key" pairs, the first one wraps new data keys
+	KeyFile    string   // optional file with one "id:base64-key" pair per line
+}
+
 type JWTConfig struct {
 	SecretKey string
 	Expiry    int // in hours
@@ -85,26 +210,119 @@ func New() *Config {
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
 		},
 		Storage: StorageConfig{
-			Provider: getEnv("STORAGE_PROVIDER", "aws"),
+			Provider:         getEnv("STORAGE_PROVIDER", "aws"),
+			UploadTimeout:    getEnvAsInt("STORAGE_UPLOAD_TIMEOUT_SECONDS", 0),
+			OperationTimeout: getEnvAsInt("STORAGE_OPERATION_TIMEOUT_SECONDS", 30),
+			KeyScheme:        getEnv("STORAGE_KEY_SCHEME", "{user}/{media_id}/{sanitized_name}"),
+			ColdClass:        getEnv("STORAGE_COLD_CLASS", ""),
+			ColdProvider:     getEnv("STORAGE_COLD_PROVIDER", ""),
 			AWS: AWSConfig{
-				AccessKeyID:     getEnv("AWS_ACCESS_KEY_ID", ""),
-				SecretAccessKey: getEnv("AWS_SECRET_ACCESS_KEY", ""),
-				Region:          getEnv("AWS_REGION", "us-east-1"),
-				BucketName:      getEnv("AWS_BUCKET_NAME", ""),
+				AccessKeyID:        getEnv("AWS_ACCESS_KEY_ID", ""),
+				SecretAccessKey:    getEnv("AWS_SECRET_ACCESS_KEY", ""),
+				Region:             getEnv("AWS_REGION", "us-east-1"),
+				BucketName:         getEnv("AWS_BUCKET_NAME", ""),
+				Endpoint:           getEnv("AWS_ENDPOINT", ""),
+				ForcePathStyle:     getEnvAsBool("AWS_FORCE_PATH_STYLE", false),
+				InsecureSkipVerify: getEnvAsBool("AWS_INSECURE_SKIP_VERIFY", false),
+				PublicBaseURL:      getEnv("AWS_PUBLIC_BASE_URL", ""),
 			},
 			Azure: AzureConfig{
 				AccountName:   getEnv("AZURE_ACCOUNT_NAME", ""),
 				AccountKey:    getEnv("AZURE_ACCOUNT_KEY", ""),
 				ContainerName: getEnv("AZURE_CONTAINER_NAME", ""),
+				Endpoint:      getEnv("AZURE_ENDPOINT", ""),
 			},
 			GCP: GCPConfig{
 				ProjectID:       getEnv("GCP_PROJECT_ID", ""),
 				BucketName:      getEnv("GCP_BUCKET_NAME", ""),
 				CredentialsFile: getEnv("GCP_CREDENTIALS_FILE", ""),
 			},
+			Local: LocalConfig{
+				RootDir:    getEnv("LOCAL_STORAGE_ROOT", "./data/storage"),
+				BaseURL:    getEnv("LOCAL_STORAGE_BASE_URL", "http://localhost:8080"),
+				SigningKey: getEnv("LOCAL_STORAGE_SIGNING_KEY", defaultSigningKey),
+			},
+			Mirror: MirrorConfig{
+				Primary:     getEnv("MIRROR_PRIMARY", ""),
+				Secondaries: getEnvAsSlice("MIRROR_SECONDARIES", nil),
+				Mode:        getEnv("MIRROR_MODE", "async"),
+				Workers:     getEnvAsInt("MIRROR_WORKERS", 4),
+			},
+			Encryption: EncryptionConfig{
+				Enabled:    getEnvAsBool("ENCRYPTION_ENABLED", false),
+				MasterKeys: getEnvAsSlice("ENCRYPTION_MASTER_KEYS", nil),
+				KeyFile:    getEnv("ENCRYPTION_KEY_FILE", ""),
+			},
+		},
+		Upload: UploadConfig{
+			StagingDir:      getEnv("UPLOAD_STAGING_DIR", "./data/uploads"),
+			PartSize:        int64(getEnvAsInt("UPLOAD_PART_SIZE_MB", 8)) << 20,
+			MaxSize:         int64(getEnvAsInt("UPLOAD_MAX_SIZE_MB", 0)) << 20,
+			DirectPartSize:  int64(getEnvAsInt("DIRECT_UPLOAD_PART_SIZE_MB", 64)) << 20,
+			DirectURLExpiry: getEnvAsInt("DIRECT_UPLOAD_URL_EXPIRY_SECONDS", 3600),
+		},
+		Quota: QuotaConfig{
+			Bytes: int64(getEnvAsInt("USER_QUOTA_MB", 0)) << 20,
+			Files: int64(getEnvAsInt("USER_QUOTA_FILES", 0)),
+		},
+		Lifecycle: LifecycleConfig{
+			Rules:       getEnvAsSlice("LIFECYCLE_RULES", nil),
+			RestoreDays: getEnvAsInt("LIFECYCLE_RESTORE_DAYS", 7),
+			RetryAfter:  getEnvAsInt("LIFECYCLE_RETRY_AFTER_SECONDS", 60),
+		},
+		Process: ProcessConfig{
+			Probe:         getEnvAsBool("PROBE_ENABLED", true),
+			FFprobePath:   getEnv("FFPROBE_PATH", "ffprobe"),
+			ProbeTimeout:  getEnvAsInt("PROBE_TIMEOUT_SECONDS", 60),
+			RejectCorrupt: getEnvAsBool("PROBE_REJECT_CORRUPT", true),
+
+			Thumbnails:       getEnvAsBool("THUMBNAILS_ENABLED", true),
+			FFmpegPath:       getEnv("FFMPEG_PATH", "ffmpeg"),
+			ThumbnailMode:    getEnv("THUMBNAIL_MODE", "offsets"),
+			ThumbnailOffsets: getEnvAsSlice("THUMBNAIL_OFFSETS", []string{"10%", "25%", "50%", "75%"}),
+			ThumbnailWidths:  getEnvAsIntSlice("THUMBNAIL_WIDTHS", []int{160, 320, 640, 1280}),
+			SceneThreshold:   getEnvAsFloat("THUMBNAIL_SCENE_THRESHOLD", 0.3),
+			ThumbnailTimeout: getEnvAsInt("THUMBNAIL_TIMEOUT_SECONDS", 60),
+
+			Transcode: getEnvAsBool("TRANSCODE_ENABLED", true),
+			Renditions: getEnvAsSlice("HLS_RENDITIONS", []string{
+				"1080p:1920x1080:5000:192",
+				"720p:1280x720:2800:128",
+				"480p:854x480:1400:128",
+				"360p:640x360:800:96",
+			}),
+			SegmentFormat:     getEnv("HLS_SEGMENT_FORMAT", "fmp4"),
+			SegmentSeconds:    getEnvAsInt("HLS_SEGMENT_SECONDS", 6),
+			AudioBitrate:      getEnvAsInt("HLS_AUDIO_BITRATE", 128),
+			VideoPreset:       getEnv("TRANSCODE_PRESET", "veryfast"),
+			TranscodeTimeout:  getEnvAsInt("TRANSCODE_TIMEOUT_SECONDS", 7200),
+			TranscodeAttempts: getEnvAsInt("TRANSCODE_MAX_ATTEMPTS", 3),
+		},
+		Stream: StreamConfig{
+			Mode: getEnv("STREAM_MODE", "presigned"),
+			CDN: CDNConfig{
+				BaseURL:        getEnv("CDN_BASE_URL", ""),
+				KeyPairID:      getEnv("CDN_KEY_PAIR_ID", ""),
+				PrivateKey:     getEnv("CDN_PRIVATE_KEY", ""),
+				PrivateKeyFile: getEnv("CDN_PRIVATE_KEY_FILE", ""),
+				Policy:         getEnv("CDN_POLICY", "canned"),
+				URLExpiry:      getEnvAsInt("CDN_URL_EXPIRY_SECONDS", 3600),
+				RestrictIP:     getEnvAsBool("CDN_RESTRICT_IP", false),
+				SignedCookies:  getEnvAsBool("CDN_SIGNED_COOKIES", false),
+				CookieDomain:   getEnv("CDN_COOKIE_DOMAIN", ""),
+			},
+		},
+		Jobs: JobConfig{
+			Concurrency:  getEnvAsSlice("JOB_CONCURRENCY", nil),
+			MaxAttempts:  getEnvAsInt("JOB_MAX_ATTEMPTS", 5),
+			Backoff:      getEnvAsInt("JOB_BACKOFF_SECONDS", 30),
+			MaxBackoff:   getEnvAsInt("JOB_MAX_BACKOFF_SECONDS", 3600),
+			Lease:        getEnvAsInt("JOB_LEASE_SECONDS", 300),
+			PollInterval: getEnvAsInt("JOB_POLL_SECONDS", 2),
+			Retention:    getEnvAsInt("JOB_RETENTION_HOURS", 168),
 		},
 		JWT: JWTConfig{
-			SecretKey: getEnv("JWT_SECRET_KEY", "your-secret-key"),
+			SecretKey: getEnv("JWT_SECRET_KEY", defaultSecretKey),
 			Expiry:    getEnvAsInt("JWT_EXPIRY_HOURS", 24),
 		},
 		Host: HostConfig{
@@ -115,6 +333,32 @@ func New() *Config {
 	}
 }
 
+// Keys used when none is set. They are public, so anyone can sign with them.
+const (
+	defaultSecretKey  = "your-secret-key"
+	defaultSigningKey = "your-signing-key"
+)
+
+// encryptionChunkSize is the size of the chunks encrypted objects are sealed
+// in. Every part of an encrypted upload but the last must be a multiple of it.
+const encryptionChunkSize = 64 << 10
+
+// Validate checks the settings every process needs before it starts, and
+// warns about defaults that are unsafe outside development. Storage settings
+// are checked by the storage driver.
+func (c *Config) Validate() error {
+	if c.Storage.Encryption.Enabled && c.Upload.PartSize%encryptionChunkSize != 0 {
+		return fmt.Errorf("upload part size of %d bytes must be a multiple of 64 KiB with ENCRYPTION_ENABLED=true", c.Upload.PartSize)
+	}
+	if c.JWT.SecretKey == defaultSecretKey {
+		log.Printf("Warning: JWT_SECRET_KEY is not set; tokens are signed with the default key")
+	}
+	if c.Storage.Provider == "local" && c.Storage.Local.SigningKey == defaultSigningKey {
+		log.Printf("Warning: LOCAL_STORAGE_SIGNING_KEY is not set; stream URLs are signed with the default key")
+	}
+	return nil
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -130,3 +374,51 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsSlice(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+func getEnvAsIntSlice(key string, defaultValue []int) []int {
+	items := getEnvAsSlice(key, nil)
+	if items == nil {
+		return defaultValue
+	}
+
+	var values []int
+	for _, item := range items {
+		if intValue, err := strconv.Atoi(item); err == nil {
+			values = append(values, intValue)
+		}
+	}
+	return values
+}
@@ -53,11 +53,31 @@ func InitWithHost(dbCfg config.DatabaseConfig, hostCfg config.HostConfig) (*DB,
 }
 
 func migrateDB(db *gorm.DB) error {
-	return db.AutoMigrate(
+	err := db.AutoMigrate(
 		&models.User{},
 		&models.Media{},
 		&models.UserActivity{},
+		&models.Upload{},
+		&models.UploadPart{},
+		&models.Blob{},
+		&models.Replica{},
+		&models.ObjectKey{},
+		&models.MigrationObject{},
+		&models.DirectUpload{},
+		&models.MediaVersion{},
+		&models.Thumbnail{},
+		&models.StreamPackage{},
+		&models.Job{},
 	)
+	if err != nil {
+		return err
+	}
+
+	// Blobs were unique by checksum alone before they were scoped per user
+	if db.Migrator().HasIndex(&models.Blob{}, "idx_blobs_checksum") {
+		return db.Migrator().DropIndex(&models.Blob{}, "idx_blobs_checksum")
+	}
+	return nil
 }
 
 // CreateInitialHost creates the initial host user if it doesn't exist
@@ -67,7 +87,9 @@ func CreateInitialHost(db *gorm.DB, hostConfig config.HostConfig) error {
 
 	if count > 0 {
 		log.Println("Host user already exists, skipping creation")
-		return nil
+		// The configured host is the admin, also in databases created
+		// before users had roles
+		return db.Model(&models.User{}).Where("username = ?", hostConfig.Username).Update("is_admin", true).Error
 	}
 
 	// Hash the password
@@ -81,6 +103,7 @@ func CreateInitialHost(db *gorm.DB, hostConfig config.HostConfig) error {
 		Username: hostConfig.Username,
 		Email:    hostConfig.Email,
 		Password: hashedPassword,
+		IsAdmin:  true,
 	}
 
 	if err := db.Create(&host).Error; err != nil {
@@ -0,0 +1,68 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/service"
+)
+
+func TestPrivateMediaNeedsSignedLink(t *testing.T) {
+	env := newTestEnv(t)
+	content := []byte("private bytes")
+
+	resp := env.uploadWith(map[string]string{"title": "Private", "is_public": "false"}, "private.mp4", content)
+	env.expectStatus(resp, http.StatusCreated)
+	var created mediaEnvelope
+	env.decode(resp, &created)
+	contentPath := fmt.Sprintf("/api/v1/media/%s/content", created.Media.ID)
+
+	resp = env.do(http.MethodGet, contentPath, nil, nil)
+	env.expectStatus(resp, http.StatusForbidden)
+
+	// Anonymous callers get no link
+	streamPath := fmt.Sprintf("/api/v1/media/%s/stream", created.Media.ID)
+	resp = env.do(http.MethodGet, streamPath, nil, nil)
+	env.expectStatus(resp, http.StatusForbidden)
+	resp = env.do(http.MethodGet, streamPath, nil, map[string]string{"Authorization": "Bearer " + env.createUser("stranger")})
+	env.expectStatus(resp, http.StatusForbidden)
+
+	// The link handed out to the owner is signed and works without a token
+	resp = env.do(http.MethodGet, streamPath, nil, map[string]string{"Authorization": "Bearer " + env.token})
+	env.expectStatus(resp, http.StatusOK)
+	var stream struct {
+		StreamURL string `json:"stream_url"`
+	}
+	env.decode(resp, &stream)
+
+	resp = env.do(http.MethodGet, stream.StreamURL[len(env.url):], nil, nil)
+	env.expectStatus(resp, http.StatusOK)
+	body, _ := io.ReadAll(resp.Body)
+	if !bytes.Equal(body, content) {
+		t.Fatalf("signed link returned %q, want %q", body, content)
+	}
+
+	signed, _ := url.Parse(stream.StreamURL)
+	query := signed.Query()
+	query.Set("signature", "0"+query.Get("signature")[1:])
+	resp = env.do(http.MethodGet, contentPath+"?"+query.Encode(), nil, nil)
+	env.expectStatus(resp, http.StatusForbidden)
+
+	expired := time.Now().Add(-time.Minute).Unix()
+	query.Set("expires", strconv.FormatInt(expired, 10))
+	query.Set("signature", service.SignMediaAccess(created.Media.ID, expired, env.cfg.JWT))
+	resp = env.do(http.MethodGet, contentPath+"?"+query.Encode(), nil, nil)
+	env.expectStatus(resp, http.StatusForbidden)
+
+	// The owner needs no link
+	resp = env.do(http.MethodGet, contentPath, nil, map[string]string{"Authorization": "Bearer " + env.token})
+	env.expectStatus(resp, http.StatusOK)
+}
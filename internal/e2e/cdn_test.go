@@ -0,0 +1,144 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+)
+
+// cloudFrontEncoding is the base64 variant CloudFront expects in URLs and
+// cookies.
+var cloudFrontEncoding = strings.NewReplacer("-", "+", "_", "=", "~", "/")
+
+func TestCDNSignedDelivery(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	privateKey := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+
+	// verify checks that signature, in CloudFront's base64, signs policy
+	verify := func(t *testing.T, policy []byte, signature string) {
+		t.Helper()
+		sig, err := base64.StdEncoding.DecodeString(cloudFrontEncoding.Replace(signature))
+		if err != nil {
+			t.Fatalf("signature %q is not base64: %v", signature, err)
+		}
+		digest := sha1.Sum(policy)
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, digest[:], sig); err != nil {
+			t.Fatalf("signature does not match policy %s: %v", policy, err)
+		}
+	}
+
+	cdnEnv := func(t *testing.T, cdn config.CDNConfig) (*testEnv, string) {
+		cdn.BaseURL = "https://cdn.example.com/"
+		cdn.KeyPairID = "K2JCJMDEHXQW5F"
+		cdn.PrivateKey = privateKey
+		cdn.URLExpiry = 300
+		env := newTestEnv(t, func(cfg *config.Config) {
+			cfg.Stream = config.StreamConfig{Mode: "cdn", CDN: cdn}
+		})
+
+		resp := env.upload("Delivered", "delivered.mp4", []byte("delivered bytes"))
+		env.expectStatus(resp, http.StatusCreated)
+		var created mediaEnvelope
+		env.decode(resp, &created)
+
+		var media models.Media
+		env.db.First(&media, "id = ?", created.Media.ID)
+		return env, media.Filename
+	}
+	streamURL := func(env *testEnv, id string) (*url.URL, *http.Response) {
+		resp := env.do(http.MethodGet, "/api/v1/media/"+id+"/stream", nil, nil)
+		env.expectStatus(resp, http.StatusOK)
+		var stream struct {
+			StreamURL string `json:"stream_url"`
+		}
+		env.decode(resp, &stream)
+		parsed, err := url.Parse(stream.StreamURL)
+		if err != nil {
+			env.t.Fatalf("invalid stream URL %q", stream.StreamURL)
+		}
+		return parsed, resp
+	}
+	mediaID := func(env *testEnv) string {
+		var media models.Media
+		env.db.First(&media)
+		return media.ID.String()
+	}
+
+	t.Run("canned URL", func(t *testing.T) {
+		env, filename := cdnEnv(t, config.CDNConfig{Policy: "canned"})
+		signed, _ := streamURL(env, mediaID(env))
+
+		resource := "https://cdn.example.com/" + filename
+		query := signed.Query()
+		if unsigned := strings.SplitN(signed.String(), "?", 2)[0]; unsigned != resource {
+			t.Fatalf("stream URL is %s, want the CDN URL of %s", unsigned, filename)
+		}
+		if query.Get("Key-Pair-Id") != "K2JCJMDEHXQW5F" || query.Get("Policy") != "" {
+			t.Fatalf("canned URL carries %v", query)
+		}
+		policy := fmt.Sprintf(`{"Statement":[{"Resource":"%s","Condition":{"DateLessThan":{"AWS:EpochTime":%s}}}]}`, resource, query.Get("Expires"))
+		verify(t, []byte(policy), query.Get("Signature"))
+	})
+
+	t.Run("custom URL restricted to the client", func(t *testing.T) {
+		env, _ := cdnEnv(t, config.CDNConfig{Policy: "custom", RestrictIP: true})
+		signed, _ := streamURL(env, mediaID(env))
+
+		query := signed.Query()
+		policy, err := base64.StdEncoding.DecodeString(cloudFrontEncoding.Replace(query.Get("Policy")))
+		if err != nil {
+			t.Fatalf("policy is not base64: %v", err)
+		}
+		if !strings.Contains(string(policy), `"AWS:SourceIp":"127.0.0.1/32"`) {
+			t.Fatalf("policy %s does not restrict the client IP", policy)
+		}
+		verify(t, policy, query.Get("Signature"))
+	})
+
+	t.Run("signed cookies", func(t *testing.T) {
+		env, filename := cdnEnv(t, config.CDNConfig{Policy: "custom", SignedCookies: true, CookieDomain: ".example.com"})
+		plain, resp := streamURL(env, mediaID(env))
+
+		if plain.RawQuery != "" || plain.String() != "https://cdn.example.com/"+filename {
+			t.Fatalf("stream URL is %s, want the plain CDN URL", plain)
+		}
+		cookies := map[string]*http.Cookie{}
+		for _, cookie := range resp.Cookies() {
+			cookies[cookie.Name] = cookie
+		}
+		for _, name := range []string{"CloudFront-Policy", "CloudFront-Signature", "CloudFront-Key-Pair-Id"} {
+			if cookies[name] == nil {
+				t.Fatalf("response did not set %s: %v", name, resp.Header.Values("Set-Cookie"))
+			}
+		}
+		if domain := cookies["CloudFront-Policy"].Domain; domain != "example.com" {
+			t.Fatalf("cookies are for %q, want example.com", domain)
+		}
+
+		policy, err := base64.StdEncoding.DecodeString(cloudFrontEncoding.Replace(cookies["CloudFront-Policy"].Value))
+		if err != nil {
+			t.Fatalf("policy is not base64: %v", err)
+		}
+		if !strings.Contains(string(policy), `"Resource":"https://cdn.example.com/`+filename+`*"`) {
+			t.Fatalf("policy %s does not cover the object", policy)
+		}
+		verify(t, policy, cookies["CloudFront-Signature"].Value)
+	})
+}
@@ -0,0 +1,167 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/service"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/storage"
+	"github.com/google/uuid"
+)
+
+// sendDirectUpload creates a pending media with its direct upload, the way
+// CreateDirectUpload does, and stores content as the client would have. The
+// memory provider cannot presign the requests the client would send.
+func (e *testEnv) sendDirectUpload(content []byte) *models.DirectUpload {
+	e.t.Helper()
+
+	var host models.User
+	if err := e.db.Where("username = ?", e.cfg.Host.Username).First(&host).Error; err != nil {
+		e.t.Fatalf("failed to find host: %v", err)
+	}
+
+	mediaID := uuid.New()
+	upload := models.DirectUpload{
+		MediaID:      mediaID,
+		Filename:     "uploads/" + mediaID.String(),
+		OriginalName: "direct.mp4",
+		ContentType:  "video/mp4",
+		Size:         int64(len(content)),
+		Status:       models.DirectUploadSending,
+	}
+	media := models.Media{
+		ID:       mediaID,
+		Title:    "Direct",
+		Filename: upload.Filename,
+		FileSize: upload.Size,
+		FileType: "mp4",
+		UserID:   host.ID,
+		IsPublic: true,
+		Status:   models.MediaPending,
+	}
+	if err := e.db.Create(&media).Error; err != nil {
+		e.t.Fatalf("failed to create media: %v", err)
+	}
+	if err := e.db.Create(&upload).Error; err != nil {
+		e.t.Fatalf("failed to create upload: %v", err)
+	}
+
+	if _, err := e.storageProvider.UploadFile(context.Background(), bytes.NewReader(content), upload.Filename, upload.ContentType); err != nil {
+		e.t.Fatalf("failed to store upload: %v", err)
+	}
+	return &upload
+}
+
+func (e *testEnv) completeDirectUpload(upload *models.DirectUpload) *http.Response {
+	return e.do(http.MethodPost, fmt.Sprintf("/api/v1/media/uploads/%s/complete", upload.MediaID), nil,
+		map[string]string{"Authorization": "Bearer " + e.token})
+}
+
+func TestDirectUploadVerifiedByJob(t *testing.T) {
+	env := newTestEnv(t)
+	content := append([]byte{0, 0, 0, 0x18}, []byte("ftypmp42 direct upload bytes")...)
+	upload := env.sendDirectUpload(content)
+
+	resp := env.completeDirectUpload(upload)
+	env.expectStatus(resp, http.StatusAccepted)
+	var completed struct {
+		Upload struct {
+			Status string `json:"status"`
+		} `json:"upload"`
+	}
+	env.decode(resp, &completed)
+	if completed.Upload.Status != models.DirectUploadVerifying {
+		t.Fatalf("upload is %q, want %q", completed.Upload.Status, models.DirectUploadVerifying)
+	}
+
+	// Completing again while the job is queued does not queue another
+	resp = env.completeDirectUpload(upload)
+	env.expectStatus(resp, http.StatusAccepted)
+	var queued int64
+	env.db.Model(&models.Job{}).Where("type = ?", service.JobVerifyUpload).Count(&queued)
+	if queued != 1 {
+		t.Fatalf("%d verification jobs queued, want 1", queued)
+	}
+
+	var media models.Media
+	env.db.First(&media, "id = ?", upload.MediaID)
+	if media.Status != models.MediaPending {
+		t.Fatalf("media is %q before the job ran, want %q", media.Status, models.MediaPending)
+	}
+
+	env.runJobs()
+
+	env.db.First(&media, "id = ?", upload.MediaID)
+	sum := sha256.Sum256(content)
+	if media.Status != models.MediaReady || media.Checksum != hex.EncodeToString(sum[:]) {
+		t.Fatalf("media is %q with checksum %q after the job ran", media.Status, media.Checksum)
+	}
+	if err := env.db.First(&models.DirectUpload{}, "media_id = ?", upload.MediaID).Error; err == nil {
+		t.Fatal("upload was kept after the media became ready")
+	}
+	if _, err := env.storageProvider.Stat(context.Background(), upload.Filename); !errors.Is(err, storage.ErrObjectNotFound) {
+		t.Fatalf("temporary object was kept: %v", err)
+	}
+
+	resp = env.do(http.MethodGet, fmt.Sprintf("/api/v1/media/%s/content", upload.MediaID), nil, nil)
+	env.expectStatus(resp, http.StatusOK)
+}
+
+func TestDirectUploadRejected(t *testing.T) {
+	env := newTestEnv(t)
+
+	// A size the backend reports wrong is refused before any job
+	upload := env.sendDirectUpload([]byte("short"))
+	env.db.Model(upload).Update("size", 1024)
+	upload.Size = 1024
+	resp := env.completeDirectUpload(upload)
+	env.expectStatus(resp, http.StatusUnprocessableEntity)
+
+	// Content that is not media is refused by the job
+	upload = env.sendDirectUpload([]byte("this is plain text, not a video"))
+	resp = env.completeDirectUpload(upload)
+	env.expectStatus(resp, http.StatusAccepted)
+
+	env.runJobs()
+
+	var rejected models.DirectUpload
+	if err := env.db.First(&rejected, "media_id = ?", upload.MediaID).Error; err != nil {
+		t.Fatalf("failed to load upload: %v", err)
+	}
+	if rejected.Status != models.DirectUploadRejected || !strings.Contains(rejected.Error, "text/plain") {
+		t.Fatalf("upload is %q (%q), want it rejected as text", rejected.Status, rejected.Error)
+	}
+	if _, err := env.storageProvider.Stat(context.Background(), upload.Filename); !errors.Is(err, storage.ErrObjectNotFound) {
+		t.Fatalf("rejected object was kept: %v", err)
+	}
+	var media models.Media
+	env.db.First(&media, "id = ?", upload.MediaID)
+	if media.Status != models.MediaPending {
+		t.Fatalf("media is %q after its file was rejected, want %q", media.Status, models.MediaPending)
+	}
+
+	// The client sends the file again and completes once more
+	content := append([]byte{0, 0, 0, 0x18}, []byte("ftypmp42 direct upload bytes")...)
+	env.db.Model(&rejected).Update("size", len(content))
+	if _, err := env.storageProvider.UploadFile(context.Background(), bytes.NewReader(content), upload.Filename, upload.ContentType); err != nil {
+		t.Fatalf("failed to store upload: %v", err)
+	}
+	resp = env.completeDirectUpload(upload)
+	env.expectStatus(resp, http.StatusAccepted)
+	env.runJobs()
+
+	env.db.First(&media, "id = ?", upload.MediaID)
+	if media.Status != models.MediaReady {
+		t.Fatalf("media is %q after the file was sent again, want %q", media.Status, models.MediaReady)
+	}
+}
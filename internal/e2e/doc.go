@@ -0,0 +1,10 @@
+// Package e2e holds end-to-end tests that boot the API server against an
+// embedded PostgreSQL and the in-memory storage provider. They download a
+// PostgreSQL build on first use, so they only run with the e2e build tag:
+//
+//	go test -tags e2e ./internal/e2e/...
+//
+// The provider checks also run against an S3-compatible store, such as a
+// local MinIO, when E2E_S3_ENDPOINT, E2E_S3_BUCKET, E2E_S3_ACCESS_KEY_ID and
+// E2E_S3_SECRET_ACCESS_KEY are set.
+package e2e
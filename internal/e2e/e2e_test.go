@@ -0,0 +1,452 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/database"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/handlers"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/interfaces"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/repository"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/server"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/service"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var dbConfig config.DatabaseConfig
+
+func TestMain(m *testing.M) {
+	port, err := freePort()
+	if err != nil {
+		log.Fatalf("failed to find a free port: %v", err)
+	}
+
+	runtimeDir, err := os.MkdirTemp("", "e2e-postgres-")
+	if err != nil {
+		log.Fatalf("failed to create postgres directory: %v", err)
+	}
+
+	dbConfig = config.DatabaseConfig{
+		Host:     "localhost",
+		Port:     strconv.Itoa(int(port)),
+		User:     "postgres",
+		Password: "postgres",
+		DBName:   "streaming_platform",
+		SSLMode:  "disable",
+	}
+
+	postgres := embeddedpostgres.NewDatabase(embeddedpostgres.DefaultConfig().
+		Port(port).
+		Username(dbConfig.User).
+		Password(dbConfig.Password).
+		Database(dbConfig.DBName).
+		RuntimePath(runtimeDir).
+		Logger(io.Discard))
+
+	if err := postgres.Start(); err != nil {
+		log.Fatalf("failed to start embedded postgres: %v", err)
+	}
+
+	code := m.Run()
+
+	postgres.Stop()
+	os.RemoveAll(runtimeDir)
+	os.Exit(code)
+}
+
+// testEnv is a running API server backed by a fresh MemoryProvider.
+type testEnv struct {
+	t               *testing.T
+	url             string
+	cfg             *config.Config
+	db              *database.DB
+	memory          *storage.MemoryProvider
+	cold            *storage.MemoryProvider // cold tier, when cfg.Storage.ColdProvider is set
+	storageProvider *storage.StorageProvider
+	token           string
+}
+
+// newTestEnv starts a server with the default test configuration, changed by
+// options before anything is built from it.
+func newTestEnv(t *testing.T, options ...func(cfg *config.Config)) *testEnv {
+	t.Helper()
+
+	cfg := &config.Config{
+		Database: dbConfig,
+		Storage: config.StorageConfig{
+			Provider:         "memory",
+			OperationTimeout: 30,
+			KeyScheme:        "blobs/{checksum}",
+		},
+		Upload: config.UploadConfig{
+			StagingDir: t.TempDir(),
+			PartSize:   5 << 20,
+		},
+		Stream: config.StreamConfig{Mode: "proxy"},
+		JWT:    config.JWTConfig{SecretKey: "e2e-secret", Expiry: 1},
+		Host: config.HostConfig{
+			Username: "host",
+			Password: "host123",
+			Email:    "host@example.com",
+		},
+	}
+	for _, option := range options {
+		option(cfg)
+	}
+
+	db, err := database.InitWithHost(cfg.Database, cfg.Host)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := truncateTables(db); err != nil {
+			t.Errorf("failed to clean up database: %v", err)
+		}
+		if sqlDB, err := db.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	memory := storage.NewMemoryProvider()
+	var backend interfaces.Provider = memory
+	var cold *storage.MemoryProvider
+	if cfg.Storage.ColdProvider != "" {
+		cold = storage.NewMemoryProvider()
+		backend = storage.NewTieredProvider(memory, cold)
+	}
+	storageProvider, err := storage.NewProviderWith(backend, cfg.Storage)
+	if err != nil {
+		t.Fatalf("failed to create storage provider: %v", err)
+	}
+	if encrypted := storageProvider.Encryption(); encrypted != nil {
+		encrypted.SetKeyStore(repository.NewObjectKeyRepository(repository.New(db)))
+	}
+	if cfg.Stream.Mode == "cdn" {
+		cdn, err := storage.NewCDN(cfg.Stream.CDN)
+		if err != nil {
+			t.Fatalf("failed to create CDN: %v", err)
+		}
+		storageProvider.SetCDN(cdn)
+	}
+
+	srv := server.New(cfg, db, storageProvider, handlers.New(db, cfg, storageProvider))
+	httpServer := httptest.NewServer(srv.Handler())
+	t.Cleanup(httpServer.Close)
+
+	env := &testEnv{
+		t:               t,
+		url:             httpServer.URL,
+		cfg:             cfg,
+		db:              db,
+		memory:          memory,
+		cold:            cold,
+		storageProvider: storageProvider,
+	}
+	env.token = env.login(cfg.Host.Username, cfg.Host.Password)
+	return env
+}
+
+// truncateTables empties every table, so no test sees rows of another. The
+// host user is created again by the next test.
+func truncateTables(db *database.DB) error {
+	var tables []string
+	err := db.Raw("SELECT quote_ident(tablename) FROM pg_tables WHERE schemaname = current_schema()").Scan(&tables).Error
+	if err != nil || len(tables) == 0 {
+		return err
+	}
+	return db.Exec("TRUNCATE " + strings.Join(tables, ", ") + " CASCADE").Error
+}
+
+func (e *testEnv) login(username, password string) string {
+	body, _ := json.Marshal(map[string]string{"username": username, "password": password})
+	resp := e.do(http.MethodPost, "/api/v1/auth/login", bytes.NewReader(body), map[string]string{"Content-Type": "application/json"})
+	e.expectStatus(resp, http.StatusOK)
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	e.decode(resp, &login)
+	return login.Token
+}
+
+// upload posts a public media file and returns the created media.
+func (e *testEnv) upload(title, filename string, content []byte) *http.Response {
+	return e.uploadWith(map[string]string{"title": title, "is_public": "true"}, filename, content)
+}
+
+// uploadWith posts a media file with the given form fields.
+func (e *testEnv) uploadWith(fields map[string]string, filename string, content []byte) *http.Response {
+	return e.uploadAs(e.token, fields, filename, content)
+}
+
+// uploadAs posts a media file for the user token belongs to.
+func (e *testEnv) uploadAs(token string, fields map[string]string, filename string, content []byte) *http.Response {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for key, value := range fields {
+		form.WriteField(key, value)
+	}
+	part, _ := form.CreateFormFile("file", filename)
+	part.Write(content)
+	form.Close()
+
+	return e.do(http.MethodPost, "/api/v1/media/upload", &body, map[string]string{
+		"Content-Type":  form.FormDataContentType(),
+		"Authorization": "Bearer " + token,
+	})
+}
+
+// createUser adds a user who is not an admin and returns their token.
+func (e *testEnv) createUser(username string) string {
+	e.t.Helper()
+
+	password := username + "-password"
+	hashed, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	user := models.User{Username: username, Email: username + "@example.com", Password: string(hashed)}
+	if err := e.db.Create(&user).Error; err != nil {
+		e.t.Fatalf("failed to create user: %v", err)
+	}
+	return e.login(username, password)
+}
+
+// runJobs runs the queued jobs, and the jobs they queue, the way cmd/worker
+// would, until none is due. A failed job waits out its backoff and is left.
+func (e *testEnv) runJobs() {
+	e.t.Helper()
+
+	queue := service.NewMediaJobs(e.db.DB, e.storageProvider, e.cfg).Queue()
+	jobTypes := []string{service.JobVerifyUpload, service.JobProbe, service.JobThumbnails, service.JobTranscode, service.JobCleanup, service.JobDeleteObjects}
+	for ran := true; ran; {
+		ran = false
+		for _, jobType := range jobTypes {
+			more, err := queue.RunNext(context.Background(), "e2e", jobType)
+			if err != nil {
+				e.t.Fatalf("failed to run %s job: %v", jobType, err)
+			}
+			ran = ran || more
+		}
+	}
+}
+
+func (e *testEnv) do(method, path string, body io.Reader, headers map[string]string) *http.Response {
+	e.t.Helper()
+
+	req, err := http.NewRequest(method, e.url+path, body)
+	if err != nil {
+		e.t.Fatalf("failed to build request: %v", err)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		e.t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	e.t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func (e *testEnv) expectStatus(resp *http.Response, status int) {
+	e.t.Helper()
+	if resp.StatusCode != status {
+		body, _ := io.ReadAll(resp.Body)
+		e.t.Fatalf("%s %s: got status %d, want %d: %s", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, status, body)
+	}
+}
+
+func (e *testEnv) decode(resp *http.Response, v interface{}) {
+	e.t.Helper()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		e.t.Fatalf("failed to decode response: %v", err)
+	}
+}
+
+type mediaEnvelope struct {
+	Media handlers.MediaResponse `json:"media"`
+}
+
+func TestMediaLifecycle(t *testing.T) {
+	env := newTestEnv(t)
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+
+	resp := env.upload("Episode 1", "episode1.mp4", content)
+	env.expectStatus(resp, http.StatusCreated)
+	var created mediaEnvelope
+	env.decode(resp, &created)
+
+	if created.Media.Checksum == "" {
+		t.Fatal("uploaded media has no checksum")
+	}
+	stored, ok := env.memory.Object(created.Media.Filename)
+	if !ok || !bytes.Equal(stored, content) {
+		t.Fatalf("object %q was not stored intact", created.Media.Filename)
+	}
+
+	// List
+	resp = env.do(http.MethodGet, "/api/v1/media", nil, nil)
+	env.expectStatus(resp, http.StatusOK)
+	var list struct {
+		Media []handlers.MediaResponse `json:"media"`
+	}
+	env.decode(resp, &list)
+	if len(list.Media) != 1 || list.Media[0].ID != created.Media.ID {
+		t.Fatalf("list returned %+v, want the uploaded media", list.Media)
+	}
+
+	// Stream
+	resp = env.do(http.MethodGet, fmt.Sprintf("/api/v1/media/%s/stream", created.Media.ID), nil, nil)
+	env.expectStatus(resp, http.StatusOK)
+	var stream struct {
+		StreamURL string `json:"stream_url"`
+	}
+	env.decode(resp, &stream)
+
+	env.memory.StartRecording()
+	resp = env.do(http.MethodGet, stream.StreamURL[len(env.url):], nil, map[string]string{"Range": "bytes=100-199"})
+	env.expectStatus(resp, http.StatusPartialContent)
+	body, _ := io.ReadAll(resp.Body)
+	if !bytes.Equal(body, content[100:200]) {
+		t.Fatalf("range returned %q, want %q", body, content[100:200])
+	}
+
+	for _, call := range env.memory.Calls() {
+		if call.Operation == "Open" && call.Size > 100 {
+			t.Fatalf("range request read %d bytes from storage, want at most 100", call.Size)
+		}
+	}
+	env.memory.StopRecording()
+
+	// Delete
+	resp = env.do(http.MethodDelete, "/api/v1/media/"+created.Media.ID.String(), nil, map[string]string{"Authorization": "Bearer " + env.token})
+	env.expectStatus(resp, http.StatusOK)
+
+	// Storage is released by the worker
+	if keys := env.memory.Keys(); len(keys) != 1 {
+		t.Fatalf("objects deleted by the request: %v", keys)
+	}
+	env.runJobs()
+	if keys := env.memory.Keys(); len(keys) != 0 {
+		t.Fatalf("objects left after delete: %v", keys)
+	}
+
+	resp = env.do(http.MethodGet, "/api/v1/media/"+created.Media.ID.String(), nil, nil)
+	env.expectStatus(resp, http.StatusNotFound)
+}
+
+func TestDuplicateUploadsShareObject(t *testing.T) {
+	env := newTestEnv(t)
+	content := []byte("same bytes, different titles")
+
+	var ids []string
+	for _, title := range []string{"First", "Second"} {
+		resp := env.upload(title, "clip.mp4", content)
+		env.expectStatus(resp, http.StatusCreated)
+		var created mediaEnvelope
+		env.decode(resp, &created)
+		ids = append(ids, created.Media.ID.String())
+	}
+
+	if keys := env.memory.Keys(); len(keys) != 1 {
+		t.Fatalf("got objects %v, want one shared object", keys)
+	}
+
+	resp := env.do(http.MethodDelete, "/api/v1/media/"+ids[0], nil, map[string]string{"Authorization": "Bearer " + env.token})
+	env.expectStatus(resp, http.StatusOK)
+	env.runJobs()
+	if keys := env.memory.Keys(); len(keys) != 1 {
+		t.Fatalf("shared object removed while still referenced")
+	}
+
+	resp = env.do(http.MethodDelete, "/api/v1/media/"+ids[1], nil, map[string]string{"Authorization": "Bearer " + env.token})
+	env.expectStatus(resp, http.StatusOK)
+	env.runJobs()
+	if keys := env.memory.Keys(); len(keys) != 0 {
+		t.Fatalf("objects left after last delete: %v", keys)
+	}
+}
+
+func TestPerUserKeysShareContentPerUser(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Storage.KeyScheme = "{user}/{media_id}/{sanitized_name}"
+	})
+	other := env.createUser("other")
+	content := []byte("same bytes, different owners")
+
+	for _, token := range []string{env.token, env.token, other} {
+		resp := env.uploadAs(token, map[string]string{"title": "Clip"}, "clip.mp4", content)
+		env.expectStatus(resp, http.StatusCreated)
+	}
+
+	if keys := env.memory.Keys(); len(keys) != 2 || strings.Split(keys[0], "/")[0] == strings.Split(keys[1], "/")[0] {
+		t.Fatalf("got objects %v, want one per user", keys)
+	}
+}
+
+func TestUploadStorageFailure(t *testing.T) {
+	env := newTestEnv(t)
+
+	env.memory.SetFaults(storage.Faults{ErrorRate: 1, Operations: []string{"UploadFile"}})
+	resp := env.upload("Broken", "broken.mp4", []byte("never stored"))
+	env.expectStatus(resp, http.StatusInternalServerError)
+
+	env.memory.SetFaults(storage.Faults{PartialWrite: 4})
+	resp = env.upload("Truncated", "truncated.mp4", []byte("cut off mid upload"))
+	env.expectStatus(resp, http.StatusInternalServerError)
+
+	env.memory.SetFaults(storage.Faults{})
+	if keys := env.memory.Keys(); len(keys) != 0 {
+		t.Fatalf("failed uploads left objects behind: %v", keys)
+	}
+
+	resp = env.do(http.MethodGet, "/api/v1/media", nil, nil)
+	env.expectStatus(resp, http.StatusOK)
+	var list struct {
+		Media []handlers.MediaResponse `json:"media"`
+	}
+	env.decode(resp, &list)
+	if len(list.Media) != 0 {
+		t.Fatalf("failed uploads created media: %+v", list.Media)
+	}
+
+	// A duplicate whose object cannot be checked is not taken as stored
+	resp = env.upload("Stored", "stored.mp4", []byte("stored once"))
+	env.expectStatus(resp, http.StatusCreated)
+	env.memory.SetFaults(storage.Faults{ErrorRate: 1, Operations: []string{"Stat"}})
+	resp = env.upload("Unchecked", "unchecked.mp4", []byte("stored once"))
+	env.expectStatus(resp, http.StatusInternalServerError)
+	env.memory.SetFaults(storage.Faults{})
+
+	var blob models.Blob
+	if err := env.db.First(&blob).Error; err != nil || blob.RefCount != 1 {
+		t.Fatalf("blob has %d references (%v), want 1", blob.RefCount, err)
+	}
+}
+
+func freePort() (uint32, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return uint32(listener.Addr().(*net.TCPAddr).Port), nil
+}
@@ -0,0 +1,196 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/interfaces"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/repository"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/storage"
+)
+
+const sealedChunk = 64<<10 + 28
+
+func newEncryptedEnv(t *testing.T) *testEnv {
+	masterKey := make([]byte, 32)
+	rand.Read(masterKey)
+	return newTestEnv(t, func(cfg *config.Config) {
+		cfg.Storage.Encryption = config.EncryptionConfig{
+			Enabled:    true,
+			MasterKeys: []string{"e2e:" + base64.StdEncoding.EncodeToString(masterKey)},
+		}
+	})
+}
+
+func randomBytes(n int) []byte {
+	data := make([]byte, n)
+	rand.Read(data)
+	return data
+}
+
+// readObject reads a range of an object through the provider.
+func (e *testEnv) readObject(filename string, offset, length int64) ([]byte, error) {
+	body, err := e.storageProvider.Open(context.Background(), filename, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+func (e *testEnv) expectObject(filename string, offset, length int64, want []byte) {
+	e.t.Helper()
+	got, err := e.readObject(filename, offset, length)
+	if err != nil {
+		e.t.Fatalf("failed to read %s: %v", filename, err)
+	}
+	if !bytes.Equal(got, want) {
+		e.t.Fatalf("%s[%d:+%d] differs from what was written (%d bytes, want %d)", filename, offset, length, len(got), len(want))
+	}
+}
+
+func TestEncryptedObjectsRoundTrip(t *testing.T) {
+	env := newEncryptedEnv(t)
+	ctx := context.Background()
+
+	content := randomBytes(150000)
+	if _, err := env.storageProvider.UploadFile(ctx, bytes.NewReader(content), "objects/a", "application/octet-stream"); err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	env.expectObject("objects/a", 0, -1, content)
+	env.expectObject("objects/a", 70000, 100, content[70000:70100])
+	env.expectObject("objects/a", 140000, 10000, content[140000:])
+
+	// A failed overwrite leaves the previous object readable
+	env.memory.SetFaults(storage.Faults{PartialWrite: 1000})
+	if _, err := env.storageProvider.UploadFile(ctx, bytes.NewReader(randomBytes(1000)), "objects/a", "application/octet-stream"); err == nil {
+		t.Fatal("upload succeeded despite the injected fault")
+	}
+	env.memory.SetFaults(storage.Faults{})
+	env.expectObject("objects/a", 0, -1, content)
+
+	replaced := randomBytes(2 << 16)
+	if _, err := env.storageProvider.UploadFile(ctx, bytes.NewReader(replaced), "objects/a", "application/octet-stream"); err != nil {
+		t.Fatalf("overwrite failed: %v", err)
+	}
+	env.expectObject("objects/a", 0, -1, replaced)
+	for _, key := range env.memory.Keys() {
+		if strings.HasPrefix(key, ".replacing/") {
+			t.Fatalf("temporary object %s was left behind", key)
+		}
+	}
+
+	if err := env.storageProvider.Copy(ctx, "objects/a", "objects/copy"); err != nil {
+		t.Fatalf("copy failed: %v", err)
+	}
+	env.expectObject("objects/copy", 0, -1, replaced)
+
+	// Multipart uploads of full parts and with a short last part
+	for _, size := range []int{4 << 16, 5<<16 + 100} {
+		uploadID, err := env.storageProvider.CreateMultipartUpload(ctx, "objects/parts", "application/octet-stream")
+		if err != nil {
+			t.Fatalf("failed to start multipart upload: %v", err)
+		}
+
+		content := randomBytes(size)
+		var parts []interfaces.CompletedPart
+		for number, start := 1, 0; start < size; number, start = number+1, start+2<<16 {
+			part := content[start:min(start+2<<16, size)]
+			etag, err := env.storageProvider.UploadPart(ctx, "objects/parts", uploadID, number, bytes.NewReader(part), int64(len(part)))
+			if err != nil {
+				t.Fatalf("failed to upload part %d: %v", number, err)
+			}
+			parts = append(parts, interfaces.CompletedPart{PartNumber: number, ETag: etag})
+		}
+		if _, err := env.storageProvider.CompleteMultipartUpload(ctx, "objects/parts", uploadID, "application/octet-stream", parts); err != nil {
+			t.Fatalf("failed to complete multipart upload: %v", err)
+		}
+
+		env.expectObject("objects/parts", 0, -1, content)
+		env.expectObject("objects/parts", int64(size-10), 10, content[size-10:])
+		info, err := env.storageProvider.Stat(ctx, "objects/parts")
+		if err != nil || info.Size != int64(size) {
+			t.Fatalf("stat reported %v (%v), want %d bytes", info, err, size)
+		}
+	}
+}
+
+func TestEncryptedObjectsRejectTampering(t *testing.T) {
+	env := newEncryptedEnv(t)
+	ctx := context.Background()
+
+	content := randomBytes(3 << 16)
+	if _, err := env.storageProvider.UploadFile(ctx, bytes.NewReader(content), "objects/a", "application/octet-stream"); err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	stored, _ := env.memory.Object("objects/a")
+
+	tamper := func(name string, data []byte) {
+		t.Helper()
+		if _, err := env.memory.UploadFile(ctx, bytes.NewReader(data), "objects/a", "application/octet-stream"); err != nil {
+			t.Fatalf("failed to store %s object: %v", name, err)
+		}
+		if _, err := env.readObject("objects/a", 0, -1); err == nil {
+			t.Fatalf("%s object was read without error", name)
+		}
+	}
+
+	tamper("truncated", stored[:2*sealedChunk])
+	if _, err := env.readObject("objects/a", 1<<16, 1<<16); err == nil {
+		t.Fatal("range at the end of the truncated object was read without error")
+	}
+
+	reordered := append(append([]byte(nil), stored[sealedChunk:2*sealedChunk]...), stored[:sealedChunk]...)
+	tamper("reordered", append(reordered, stored[2*sealedChunk:]...))
+
+	// A data key does not unlock another object's name
+	keys := repository.NewObjectKeyRepository(repository.New(env.db))
+	key, err := keys.FindKey(ctx, "objects/a")
+	if err != nil {
+		t.Fatalf("failed to find data key: %v", err)
+	}
+	key.Filename = "objects/b"
+	if err := keys.SaveKey(ctx, *key); err != nil {
+		t.Fatalf("failed to save data key: %v", err)
+	}
+	env.memory.UploadFile(ctx, bytes.NewReader(stored), "objects/b", "application/octet-stream")
+	if _, err := env.readObject("objects/b", 0, -1); err == nil {
+		t.Fatal("object was read with a data key moved from another object")
+	}
+}
+
+func TestEncryptedResumableUpload(t *testing.T) {
+	env := newEncryptedEnv(t)
+	part := int(env.cfg.Upload.PartSize)
+	content := randomBytes(2*part + 1000)
+	path := env.createUpload("sealed.mp4", len(content))
+
+	for _, end := range []int{part + 100, len(content)} {
+		start := env.uploadOffset(path)
+		resp := env.patchUpload(path, start, content[start:end])
+		env.expectStatus(resp, http.StatusNoContent)
+		if end == len(content) {
+			var media models.Media
+			env.db.First(&media, "id = ?", resp.Header.Get("X-Media-ID"))
+			env.expectObject(media.Filename, 0, -1, content)
+			env.expectObject(media.Filename, int64(part-10), 20, content[part-10:part+10])
+		}
+	}
+
+	// Parts must hold whole chunks for their numbering to hold
+	cfg := *env.cfg
+	cfg.Upload.PartSize = 5<<20 + 1000
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("a part size that is not a multiple of the chunk size passed validation")
+	}
+}
@@ -0,0 +1,106 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/service"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/storage"
+)
+
+func TestLifecycleMovesUnwatchedMedia(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Storage.ColdProvider = "memory"
+		cfg.Lifecycle = config.LifecycleConfig{Rules: []string{"no_views:7d"}, RestoreDays: 1, RetryAfter: 60}
+	})
+	ctx := context.Background()
+	content := []byte("nobody watches this")
+
+	resp := env.upload("Unwatched", "unwatched.mp4", content)
+	env.expectStatus(resp, http.StatusCreated)
+	var unwatched mediaEnvelope
+	env.decode(resp, &unwatched)
+
+	resp = env.upload("Watched", "watched.mp4", []byte("everyone watches this"))
+	env.expectStatus(resp, http.StatusCreated)
+	var watched mediaEnvelope
+	env.decode(resp, &watched)
+
+	old := time.Now().AddDate(0, 0, -30)
+	recent := time.Now().Add(-time.Hour)
+	env.db.Model(&models.Media{}).Where("id = ?", unwatched.Media.ID).Update("created_at", old)
+	env.db.Model(&models.Media{}).Where("id = ?", watched.Media.ID).Updates(map[string]interface{}{"created_at": old, "last_viewed_at": recent})
+
+	lifecycle := service.NewLifecycleService(env.db.DB, env.storageProvider, service.LifecycleOptions{
+		Rules:       env.cfg.Lifecycle.Rules,
+		RestoreDays: env.cfg.Lifecycle.RestoreDays,
+	})
+	result, err := lifecycle.Run(ctx)
+	if err != nil {
+		t.Fatalf("lifecycle run failed: %v", err)
+	}
+	if result.Cooled != 1 || result.Failed != 0 {
+		t.Fatalf("lifecycle run moved %d objects and failed %d, want 1 moved", result.Cooled, result.Failed)
+	}
+
+	var media models.Media
+	env.db.First(&media, "id = ?", unwatched.Media.ID)
+	if media.StorageTier != models.TierCold {
+		t.Fatalf("unwatched media is %q, want %q", media.StorageTier, models.TierCold)
+	}
+	if _, err := env.memory.Stat(ctx, media.Filename); !errors.Is(err, storage.ErrObjectNotFound) {
+		t.Fatalf("object was kept on the hot tier: %v", err)
+	}
+	if _, err := env.cold.Stat(ctx, media.Filename); err != nil {
+		t.Fatalf("object is not on the cold tier: %v", err)
+	}
+	var kept models.Media
+	env.db.First(&kept, "id = ?", watched.Media.ID)
+	if kept.StorageTier != models.TierHot {
+		t.Fatalf("watched media is %q, want %q", kept.StorageTier, models.TierHot)
+	}
+
+	// Cold media is still served from the cold tier, and asking for it
+	// starts to warm it
+	resp = env.do(http.MethodGet, "/api/v1/media/"+unwatched.Media.ID.String()+"/stream", nil, nil)
+	env.expectStatus(resp, http.StatusOK)
+	var stream struct {
+		StreamURL string `json:"stream_url"`
+	}
+	env.decode(resp, &stream)
+	resp = env.do(http.MethodGet, stream.StreamURL[len(env.url):], nil, nil)
+	env.expectStatus(resp, http.StatusOK)
+	body, _ := io.ReadAll(resp.Body)
+	if !bytes.Equal(body, content) {
+		t.Fatalf("cold media served %q, want %q", body, content)
+	}
+	env.db.First(&media, "id = ?", unwatched.Media.ID)
+	if media.StorageTier != models.TierWarming {
+		t.Fatalf("requested cold media is %q, want %q", media.StorageTier, models.TierWarming)
+	}
+
+	// The next run brings it back
+	result, err = lifecycle.Run(ctx)
+	if err != nil {
+		t.Fatalf("lifecycle run failed: %v", err)
+	}
+	if result.Warmed != 1 {
+		t.Fatalf("lifecycle run warmed %d objects, want 1", result.Warmed)
+	}
+	env.db.First(&media, "id = ?", unwatched.Media.ID)
+	if media.StorageTier != models.TierHot {
+		t.Fatalf("warmed media is %q, want %q", media.StorageTier, models.TierHot)
+	}
+	if _, err := env.memory.Stat(ctx, media.Filename); err != nil {
+		t.Fatalf("object is not back on the hot tier: %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/service"
+)
+
+// fakeFFprobe stands in for ffprobe. It only reads input restricted to local
+// files of known formats, and takes a file starting with GOOD for a 1080p
+// H.264 video with stereo AAC audio, and one starting with SONG for stereo
+// AAC audio alone.
+const fakeFFprobe = `#!/bin/sh
+prev=
+for arg in "$@"; do
+	case "$prev" in
+	-protocol_whitelist) protocols=$arg ;;
+	-format_whitelist) formats=$arg ;;
+	-i) input=$arg ;;
+	esac
+	prev=$arg
+done
+if [ "$protocols" != "file,pipe" ] || [ -z "$formats" ]; then
+	echo "$input: input is not restricted" >&2
+	exit 1
+fi
+case "$(head -c 4 "$input")" in
+GOOD) cat <<'EOF'
+{"streams":[{"codec_type":"video","codec_name":"h264","width":1920,"height":1080,"avg_frame_rate":"30000/1001","duration":"12.6"},{"codec_type":"audio","codec_name":"aac","channels":2,"channel_layout":"stereo"}],"format":{"format_name":"mov,mp4,m4a,3gp,3g2,mj2","duration":"12.612000","bit_rate":"4500000"}}
+EOF
+	;;
+SONG) cat <<'EOF'
+{"streams":[{"codec_type":"audio","codec_name":"aac","channels":2,"channel_layout":"stereo","duration":"12.6"}],"format":{"format_name":"mov,mp4,m4a,3gp,3g2,mj2","duration":"12.612000","bit_rate":"128000"}}
+EOF
+	;;
+*)
+	echo "$input: Invalid data found when processing input" >&2
+	exit 1
+esac
+`
+
+// writeTool writes script as an executable named name and returns its path.
+func writeTool(t *testing.T, name, script string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+// probed configures probing with the fake ffprobe.
+func probed(rejectCorrupt bool) func(cfg *config.Config) {
+	return func(cfg *config.Config) {
+		cfg.Process.Probe = true
+		cfg.Process.ProbeTimeout = 10
+		cfg.Process.RejectCorrupt = rejectCorrupt
+	}
+}
+
+func TestProbeUploads(t *testing.T) {
+	ffprobe := writeTool(t, "ffprobe", fakeFFprobe)
+
+	t.Run("rejecting corrupt files", func(t *testing.T) {
+		env := newTestEnv(t, probed(true), func(cfg *config.Config) {
+			cfg.Process.FFprobePath = ffprobe
+		})
+
+		resp := env.upload("Probed", "probed.mp4", []byte("GOOD video"))
+		env.expectStatus(resp, http.StatusCreated)
+		var created mediaEnvelope
+		env.decode(resp, &created)
+		media := created.Media
+		if media.Duration != 13 || media.VideoCodec != "h264" || media.AudioCodec != "aac" || media.Width != 1920 || media.Height != 1080 {
+			t.Fatalf("probed media is %+v", media)
+		}
+		if media.Channels != 2 || media.Bitrate != 4500000 || media.ProbeStatus != models.ProbeOK {
+			t.Fatalf("probed media info is %+v", media.MediaInfo)
+		}
+
+		resp = env.upload("Corrupt", "corrupt.mp4", []byte("not a video"))
+		env.expectStatus(resp, http.StatusUnprocessableEntity)
+		var stored int64
+		env.db.Model(&models.Media{}).Count(&stored)
+		if stored != 1 {
+			t.Fatalf("%d media stored, want the corrupt file refused", stored)
+		}
+	})
+
+	t.Run("flagging corrupt files", func(t *testing.T) {
+		env := newTestEnv(t, probed(false), func(cfg *config.Config) {
+			cfg.Process.FFprobePath = ffprobe
+		})
+
+		// The upload is stored right away and probed by a job
+		resp := env.upload("Corrupt", "corrupt.mp4", []byte("not a video"))
+		env.expectStatus(resp, http.StatusCreated)
+		var created mediaEnvelope
+		env.decode(resp, &created)
+		if created.Media.ProbeStatus != "" {
+			t.Fatalf("media is %q before its probe ran", created.Media.ProbeStatus)
+		}
+
+		env.runJobs()
+		var media models.Media
+		env.db.First(&media, "id = ?", created.Media.ID)
+		if media.ProbeStatus != models.ProbeCorrupt {
+			t.Fatalf("corrupt media is %q, want %q", media.ProbeStatus, models.ProbeCorrupt)
+		}
+	})
+}
+
+func TestProbeWithoutFFprobe(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "ffprobe")
+
+	// Processes refuse to start
+	if err := service.CheckProbe(config.ProcessConfig{Probe: true, FFprobePath: missing}); err == nil {
+		t.Fatal("missing ffprobe passed the startup check")
+	}
+	if err := service.CheckProbe(config.ProcessConfig{FFprobePath: missing}); err != nil {
+		t.Fatalf("startup check with probing off failed: %v", err)
+	}
+
+	// Should it go missing later, nothing is stored unchecked
+	t.Run("rejecting corrupt files", func(t *testing.T) {
+		env := newTestEnv(t, probed(true), func(cfg *config.Config) {
+			cfg.Process.FFprobePath = missing
+		})
+		resp := env.upload("Unchecked", "unchecked.mp4", []byte("GOOD video"))
+		env.expectStatus(resp, http.StatusInternalServerError)
+		var stored int64
+		env.db.Model(&models.Media{}).Count(&stored)
+		if stored != 0 {
+			t.Fatalf("%d media stored without ffprobe", stored)
+		}
+	})
+
+	t.Run("flagging corrupt files", func(t *testing.T) {
+		env := newTestEnv(t, probed(false), func(cfg *config.Config) {
+			cfg.Process.FFprobePath = missing
+		})
+		resp := env.upload("Unchecked", "unchecked.mp4", []byte("GOOD video"))
+		env.expectStatus(resp, http.StatusCreated)
+		var created mediaEnvelope
+		env.decode(resp, &created)
+		env.runJobs()
+
+		var media models.Media
+		env.db.First(&media, "id = ?", created.Media.ID)
+		if media.ProbeStatus != "" {
+			t.Fatalf("media stored without ffprobe is %q, want it unprobed", media.ProbeStatus)
+		}
+	})
+}
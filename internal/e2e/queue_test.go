@@ -0,0 +1,246 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/service"
+	"github.com/google/uuid"
+)
+
+// testQueue builds a queue on the test database with a lease of a minute and
+// a backoff of a minute doubling up to ten.
+func (e *testEnv) testQueue() *service.JobQueue {
+	return service.NewJobQueue(e.db.DB, config.JobConfig{
+		MaxAttempts: 3,
+		Backoff:     60,
+		MaxBackoff:  600,
+		Lease:       60,
+	})
+}
+
+func (e *testEnv) enqueue(queue *service.JobQueue, jobType string, payload interface{}, opts service.JobOptions) *models.Job {
+	e.t.Helper()
+
+	job, err := queue.Enqueue(context.Background(), nil, jobType, payload, opts)
+	if err != nil {
+		e.t.Fatalf("failed to enqueue %s job: %v", jobType, err)
+	}
+	return job
+}
+
+func (e *testEnv) job(id uuid.UUID) models.Job {
+	e.t.Helper()
+
+	var job models.Job
+	if err := e.db.First(&job, "id = ?", id).Error; err != nil {
+		e.t.Fatalf("failed to load job %s: %v", id, err)
+	}
+	return job
+}
+
+func TestJobQueueLeasesEachJobOnce(t *testing.T) {
+	env := newTestEnv(t)
+	queue := env.testQueue()
+
+	var mu sync.Mutex
+	runs := map[int]int{}
+	queue.Register("e2e.count", func(ctx context.Context, payload []byte) error {
+		var n int
+		if err := json.Unmarshal(payload, &n); err != nil {
+			return err
+		}
+		mu.Lock()
+		runs[n]++
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	})
+	for i := 0; i < 20; i++ {
+		env.enqueue(queue, "e2e.count", i, service.JobOptions{})
+	}
+
+	// Two workers drain the queue together
+	var wg sync.WaitGroup
+	for _, worker := range []string{"worker-a", "worker-b"} {
+		wg.Add(1)
+		go func(worker string) {
+			defer wg.Done()
+			for {
+				ran, err := queue.RunNext(context.Background(), worker, "e2e.count")
+				if err != nil {
+					t.Errorf("%s failed to lease: %v", worker, err)
+					return
+				}
+				if !ran {
+					return
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	for i := 0; i < 20; i++ {
+		if runs[i] != 1 {
+			t.Fatalf("job %d ran %d times, want once", i, runs[i])
+		}
+	}
+	var succeeded int64
+	env.db.Model(&models.Job{}).Where("type = ? AND status = ? AND attempts = 1", "e2e.count", models.JobSucceeded).Count(&succeeded)
+	if succeeded != 20 {
+		t.Fatalf("%d jobs succeeded on their first attempt, want 20", succeeded)
+	}
+}
+
+func TestJobQueueTakesOverExpiredLease(t *testing.T) {
+	env := newTestEnv(t)
+	queue := env.testQueue()
+
+	ran := 0
+	queue.Register("e2e.lease", func(ctx context.Context, payload []byte) error {
+		ran++
+		return nil
+	})
+
+	// abandon leaves job running under a worker whose lease ran out
+	abandon := func(job *models.Job, attempts int) {
+		t.Helper()
+		err := env.db.Model(&models.Job{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+			"status":       models.JobRunning,
+			"attempts":     attempts,
+			"locked_by":    "dead-worker",
+			"locked_until": time.Now().Add(-time.Second),
+		}).Error
+		if err != nil {
+			t.Fatalf("failed to abandon job: %v", err)
+		}
+	}
+
+	// A lease that has not run out is left alone
+	job := env.enqueue(queue, "e2e.lease", "taken over", service.JobOptions{MaxAttempts: 2})
+	abandon(job, 1)
+	env.db.Model(&models.Job{}).Where("id = ?", job.ID).Update("locked_until", time.Now().Add(time.Minute))
+	if more, err := queue.RunNext(context.Background(), "e2e", "e2e.lease"); err != nil || more {
+		t.Fatalf("job under a live lease was run: %t, %v", more, err)
+	}
+
+	// One that ran out is taken over while attempts are left
+	abandon(job, 1)
+	if more, err := queue.RunNext(context.Background(), "e2e", "e2e.lease"); err != nil || !more {
+		t.Fatalf("expired lease was not taken over: %t, %v", more, err)
+	}
+	if got := env.job(job.ID); ran != 1 || got.Status != models.JobSucceeded || got.Attempts != 2 || got.LockedBy != "" {
+		t.Fatalf("taken over job ran %d times and is %s after %d attempts, locked by %q", ran, got.Status, got.Attempts, got.LockedBy)
+	}
+
+	// and dead-lettered on its last attempt
+	job = env.enqueue(queue, "e2e.lease", "dead-lettered", service.JobOptions{MaxAttempts: 2})
+	abandon(job, 2)
+	if more, err := queue.RunNext(context.Background(), "e2e", "e2e.lease"); err != nil || more {
+		t.Fatalf("job out of attempts was run: %t, %v", more, err)
+	}
+	got := env.job(job.ID)
+	if ran != 1 || got.Status != models.JobDead || got.LastError != "worker stopped responding" || got.FinishedAt == nil {
+		t.Fatalf("abandoned job on its last attempt is %s (%q)", got.Status, got.LastError)
+	}
+}
+
+func TestJobQueueBacksOffThenDeadLetters(t *testing.T) {
+	env := newTestEnv(t)
+	queue := env.testQueue()
+	queue.Register("e2e.fail", func(ctx context.Context, payload []byte) error {
+		return errors.New("always fails")
+	})
+	job := env.enqueue(queue, "e2e.fail", nil, service.JobOptions{})
+
+	// runDue makes the job due and runs it
+	runDue := func() models.Job {
+		t.Helper()
+		env.db.Model(&models.Job{}).Where("id = ?", job.ID).Update("run_at", time.Now().Add(-time.Second))
+		if more, err := queue.RunNext(context.Background(), "e2e", "e2e.fail"); err != nil || !more {
+			t.Fatalf("due job did not run: %t, %v", more, err)
+		}
+		return env.job(job.ID)
+	}
+
+	// Each failure waits out a doubling backoff
+	for attempt, backoff := range []time.Duration{time.Minute, 2 * time.Minute} {
+		failed := runDue()
+		wait := time.Until(failed.RunAt)
+		if failed.Status != models.JobPending || failed.Attempts != attempt+1 || failed.LastError != "always fails" {
+			t.Fatalf("job after attempt %d is %s after %d attempts (%q)", attempt+1, failed.Status, failed.Attempts, failed.LastError)
+		}
+		if wait < backoff-5*time.Second || wait > backoff+backoff/10 {
+			t.Fatalf("attempt %d is retried in %s, want %s plus jitter", attempt+1, wait, backoff)
+		}
+		if more, err := queue.RunNext(context.Background(), "e2e", "e2e.fail"); err != nil || more {
+			t.Fatalf("job ran during its backoff: %t, %v", more, err)
+		}
+	}
+
+	// and the last one dead-letters it
+	dead := runDue()
+	if dead.Status != models.JobDead || dead.Attempts != 3 || dead.FinishedAt == nil {
+		t.Fatalf("job after its last attempt is %s after %d attempts", dead.Status, dead.Attempts)
+	}
+}
+
+func TestAdminRetriesDeadJob(t *testing.T) {
+	env := newTestEnv(t)
+	queue := env.testQueue()
+	admin := map[string]string{"Authorization": "Bearer " + env.token}
+
+	dead := env.enqueue(queue, "e2e.retry", nil, service.JobOptions{})
+	done := env.enqueue(queue, "e2e.retry", nil, service.JobOptions{})
+	env.db.Model(&models.Job{}).Where("id = ?", dead.ID).Updates(map[string]interface{}{
+		"status":      models.JobDead,
+		"attempts":    3,
+		"last_error":  "always fails",
+		"finished_at": time.Now(),
+	})
+	env.db.Model(&models.Job{}).Where("id = ?", done.ID).Updates(map[string]interface{}{
+		"status":      models.JobSucceeded,
+		"attempts":    1,
+		"finished_at": time.Now(),
+	})
+
+	resp := env.do(http.MethodPost, "/api/v1/admin/jobs/"+dead.ID.String()+"/retry", nil, admin)
+	env.expectStatus(resp, http.StatusOK)
+	retried := env.job(dead.ID)
+	if retried.Status != models.JobPending || retried.Attempts != 0 || retried.FinishedAt != nil || retried.RunAt.After(time.Now()) {
+		t.Fatalf("retried job is %s after %d attempts, due at %s", retried.Status, retried.Attempts, retried.RunAt)
+	}
+
+	// Only dead and pending jobs can be retried, and only by an admin
+	resp = env.do(http.MethodPost, "/api/v1/admin/jobs/"+done.ID.String()+"/retry", nil, admin)
+	env.expectStatus(resp, http.StatusConflict)
+	resp = env.do(http.MethodPost, "/api/v1/admin/jobs/"+uuid.New().String()+"/retry", nil, admin)
+	env.expectStatus(resp, http.StatusNotFound)
+	user := env.createUser("viewer")
+	resp = env.do(http.MethodPost, "/api/v1/admin/jobs/"+dead.ID.String()+"/retry", nil, map[string]string{"Authorization": "Bearer " + user})
+	env.expectStatus(resp, http.StatusForbidden)
+
+	// The listing is bounded
+	resp = env.do(http.MethodGet, "/api/v1/admin/jobs?type=e2e.retry&limit=1000", nil, admin)
+	env.expectStatus(resp, http.StatusOK)
+	var listed struct {
+		Jobs       []models.Job `json:"jobs"`
+		Pagination struct {
+			Limit int   `json:"limit"`
+			Total int64 `json:"total"`
+		} `json:"pagination"`
+	}
+	env.decode(resp, &listed)
+	if listed.Pagination.Limit != 100 || listed.Pagination.Total != 2 || len(listed.Jobs) != 2 {
+		t.Fatalf("listing of 2 jobs asking for 1000 gave %d with limit %d", len(listed.Jobs), listed.Pagination.Limit)
+	}
+}
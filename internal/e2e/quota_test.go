@@ -0,0 +1,134 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/service"
+)
+
+func TestQuotaEnforced(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Quota = config.QuotaConfig{Bytes: 64, Files: 2}
+	})
+	token := env.createUser("quota")
+	var user models.User
+	env.db.First(&user, "username = ?", "quota")
+
+	resp := env.uploadAs(token, map[string]string{"title": "One"}, "one.mp4", bytes.Repeat([]byte("a"), 40))
+	env.expectStatus(resp, http.StatusCreated)
+
+	// Over the byte quota
+	resp = env.uploadAs(token, map[string]string{"title": "Two"}, "two.mp4", bytes.Repeat([]byte("b"), 40))
+	env.expectStatus(resp, http.StatusRequestEntityTooLarge)
+
+	resp = env.uploadAs(token, map[string]string{"title": "Two"}, "two.mp4", bytes.Repeat([]byte("b"), 20))
+	env.expectStatus(resp, http.StatusCreated)
+
+	// Over the file quota
+	resp = env.uploadAs(token, map[string]string{"title": "Three"}, "three.mp4", []byte("c"))
+	env.expectStatus(resp, http.StatusRequestEntityTooLarge)
+
+	resp = env.do(http.MethodGet, "/api/v1/profile/usage", nil, map[string]string{"Authorization": "Bearer " + token})
+	env.expectStatus(resp, http.StatusOK)
+	var reported struct {
+		Usage service.Usage `json:"usage"`
+	}
+	env.decode(resp, &reported)
+	usage := reported.Usage
+	if usage.Bytes != 60 || usage.Files != 2 || len(usage.ByType) != 1 || usage.ByType[0].FileType != "mp4" {
+		t.Fatalf("usage is %+v, want 60 bytes in 2 mp4 files", usage)
+	}
+	if usage.Quota.Bytes != 64 || usage.Quota.Files != 2 {
+		t.Fatalf("quota is %+v, want the configured default", usage.Quota)
+	}
+
+	// An admin override lifts the file limit
+	body := bytes.NewReader([]byte(`{"quota_bytes": 0, "quota_files": 0}`))
+	resp = env.do(http.MethodPut, fmt.Sprintf("/api/v1/admin/users/%s/quota", user.ID), body, map[string]string{
+		"Authorization": "Bearer " + env.token,
+		"Content-Type":  "application/json",
+	})
+	env.expectStatus(resp, http.StatusOK)
+
+	resp = env.uploadAs(token, map[string]string{"title": "Three"}, "three.mp4", bytes.Repeat([]byte("c"), 100))
+	env.expectStatus(resp, http.StatusCreated)
+
+	// Only the admin may change quotas
+	resp = env.do(http.MethodPut, fmt.Sprintf("/api/v1/admin/users/%s/quota", user.ID), bytes.NewReader([]byte(`{}`)), map[string]string{
+		"Authorization": "Bearer " + token,
+		"Content-Type":  "application/json",
+	})
+	env.expectStatus(resp, http.StatusForbidden)
+}
+
+func TestQuotaHoldsUnderConcurrentUploads(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Quota = config.QuotaConfig{Files: 1}
+	})
+	token := env.createUser("racer")
+
+	// Every upload passes the check made before its body is read; only one
+	// may be recorded
+	const uploads = 4
+	statuses := make(chan int, uploads)
+	var wg sync.WaitGroup
+	for i := 0; i < uploads; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp := env.uploadAs(token, map[string]string{"title": "Race"}, "race.mp4", []byte(fmt.Sprintf("race %d", i)))
+			statuses <- resp.StatusCode
+		}(i)
+	}
+	wg.Wait()
+	close(statuses)
+
+	created := 0
+	for status := range statuses {
+		switch status {
+		case http.StatusCreated:
+			created++
+		case http.StatusRequestEntityTooLarge:
+		default:
+			t.Fatalf("concurrent upload returned %d", status)
+		}
+	}
+	var stored int64
+	env.db.Model(&models.Media{}).Joins("JOIN users ON users.id = media.user_id").Where("users.username = ?", "racer").Count(&stored)
+	if created != 1 || stored != 1 {
+		t.Fatalf("%d uploads succeeded and %d media stored under a quota of one file", created, stored)
+	}
+}
+
+func TestListUsersPageIsBounded(t *testing.T) {
+	env := newTestEnv(t)
+	for i := 0; i < 3; i++ {
+		env.createUser(fmt.Sprintf("paged%d", i))
+	}
+
+	resp := env.do(http.MethodGet, "/api/v1/admin/users?limit=100000&page=-1", nil, map[string]string{"Authorization": "Bearer " + env.token})
+	env.expectStatus(resp, http.StatusOK)
+	var listed struct {
+		Users      []models.User `json:"users"`
+		Pagination struct {
+			Page  int   `json:"page"`
+			Limit int   `json:"limit"`
+			Total int64 `json:"total"`
+		} `json:"pagination"`
+	}
+	env.decode(resp, &listed)
+	if listed.Pagination.Page != 1 || listed.Pagination.Limit != 100 {
+		t.Fatalf("pagination is %+v, want page 1 of at most 100", listed.Pagination)
+	}
+	if len(listed.Users) != 4 || listed.Pagination.Total != 4 {
+		t.Fatalf("listed %d of %d users, want the host and 3 more", len(listed.Users), listed.Pagination.Total)
+	}
+}
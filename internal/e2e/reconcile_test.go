@@ -0,0 +1,128 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/service"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/storage"
+)
+
+func TestReconcileStorage(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	resp := env.upload("Kept", "kept.mp4", []byte("kept bytes"))
+	env.expectStatus(resp, http.StatusCreated)
+	var kept mediaEnvelope
+	env.decode(resp, &kept)
+
+	resp = env.upload("Lost", "lost.mp4", []byte("lost bytes"))
+	env.expectStatus(resp, http.StatusCreated)
+	var lost mediaEnvelope
+	env.decode(resp, &lost)
+
+	var keptMedia, lostMedia models.Media
+	env.db.First(&keptMedia, "id = ?", kept.Media.ID)
+	env.db.First(&lostMedia, "id = ?", lost.Media.ID)
+
+	// An upload whose record was never saved, a delete whose record was
+	// kept and a reference count that drifted
+	if _, err := env.storageProvider.UploadFile(ctx, bytes.NewReader([]byte("orphan")), "blobs/orphan", "video/mp4"); err != nil {
+		t.Fatalf("failed to store orphan: %v", err)
+	}
+	if err := env.storageProvider.DeleteFile(ctx, lostMedia.Filename); err != nil {
+		t.Fatalf("failed to delete object: %v", err)
+	}
+	env.db.Model(&models.Blob{}).Where("filename = ?", keptMedia.Filename).Update("ref_count", 3)
+
+	reconcile := func(mode string) *service.ReconcileResult {
+		t.Helper()
+		result, err := service.NewReconciler(env.db.DB, env.storageProvider, service.ReconcileOptions{Mode: mode}).Run(ctx)
+		if err != nil {
+			t.Fatalf("%s run failed: %v", mode, err)
+		}
+		if result.Failed() > 0 {
+			t.Fatalf("%s run failed to act on %+v", mode, result.Issues)
+		}
+		return result
+	}
+	issue := func(result *service.ReconcileResult, kind, key string) *service.ReconcileIssue {
+		for i := range result.Issues {
+			if result.Issues[i].Kind == kind && result.Issues[i].Key == key {
+				return &result.Issues[i]
+			}
+		}
+		t.Fatalf("no %s issue for %s in %+v", kind, key, result.Issues)
+		return nil
+	}
+
+	// A report changes nothing
+	result := reconcile(service.ReconcileReport)
+	for _, found := range []*service.ReconcileIssue{
+		issue(result, service.IssueOrphanObject, "blobs/orphan"),
+		issue(result, service.IssueMissingObject, lostMedia.Filename),
+		issue(result, service.IssueRefCount, keptMedia.Filename),
+	} {
+		if found.Action != "" {
+			t.Fatalf("report acted on %+v", found)
+		}
+	}
+	if _, err := env.storageProvider.Stat(ctx, "blobs/orphan"); err != nil {
+		t.Fatalf("report moved the orphan: %v", err)
+	}
+
+	// Quarantine moves the orphan aside but leaves records alone
+	result = reconcile(service.ReconcileQuarantine)
+	issue(result, service.IssueOrphanObject, "blobs/orphan")
+	if _, err := env.storageProvider.Stat(ctx, "blobs/orphan"); !errors.Is(err, storage.ErrObjectNotFound) {
+		t.Fatalf("orphan was not moved: %v", err)
+	}
+	if _, err := env.storageProvider.Stat(ctx, "quarantine/blobs/orphan"); err != nil {
+		t.Fatalf("orphan was not quarantined: %v", err)
+	}
+	env.db.First(&lostMedia, "id = ?", lost.Media.ID)
+	if lostMedia.Status != models.MediaReady {
+		t.Fatalf("quarantine changed the media to %q", lostMedia.Status)
+	}
+
+	// Fix repairs the records
+	reconcile(service.ReconcileFix)
+	env.db.First(&lostMedia, "id = ?", lost.Media.ID)
+	if lostMedia.Status != models.MediaMissing {
+		t.Fatalf("media without an object is %q, want %q", lostMedia.Status, models.MediaMissing)
+	}
+	var blob models.Blob
+	env.db.First(&blob, "filename = ?", keptMedia.Filename)
+	if blob.RefCount != 1 {
+		t.Fatalf("reference count is %d after the fix, want 1", blob.RefCount)
+	}
+
+	// Missing media are hidden until their object is back
+	resp = env.do(http.MethodGet, "/api/v1/media/"+lost.Media.ID.String(), nil, nil)
+	env.expectStatus(resp, http.StatusNotFound)
+
+	if _, err := env.storageProvider.UploadFile(ctx, bytes.NewReader([]byte("lost bytes")), lostMedia.Filename, "video/mp4"); err != nil {
+		t.Fatalf("failed to put the object back: %v", err)
+	}
+	result = reconcile(service.ReconcileFix)
+	issue(result, service.IssueMissingObject, lostMedia.Filename)
+	env.db.First(&lostMedia, "id = ?", lost.Media.ID)
+	if lostMedia.Status != models.MediaReady {
+		t.Fatalf("media whose object is back is %q, want %q", lostMedia.Status, models.MediaReady)
+	}
+
+	// A clean tree has nothing to report but the quarantined orphan
+	result = reconcile(service.ReconcileReport)
+	for _, found := range result.Issues {
+		if found.Key != "quarantine/blobs/orphan" {
+			t.Fatalf("issue left after fixing: %+v", found)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/storage"
+)
+
+// TestS3CompatibleProvider runs the provider checks against a real
+// S3-compatible store, such as the MinIO of the README, when E2E_S3_ENDPOINT
+// names one. E2E_S3_BUCKET must already exist.
+func TestS3CompatibleProvider(t *testing.T) {
+	endpoint := os.Getenv("E2E_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("E2E_S3_ENDPOINT is not set")
+	}
+
+	provider, err := storage.NewAWSProvider(config.AWSConfig{
+		AccessKeyID:        os.Getenv("E2E_S3_ACCESS_KEY_ID"),
+		SecretAccessKey:    os.Getenv("E2E_S3_SECRET_ACCESS_KEY"),
+		Region:             "us-east-1",
+		BucketName:         os.Getenv("E2E_S3_BUCKET"),
+		Endpoint:           endpoint,
+		ForcePathStyle:     true,
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+	checkProvider(t, provider)
+}
+
+// TestS3CompatibleAddressing checks how the provider addresses a store on a
+// custom endpoint, against a stand-in that only accepts uploads.
+func TestS3CompatibleAddressing(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	store := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.Host+r.URL.Path)
+		mu.Unlock()
+		w.Header().Set("ETag", `"etag"`)
+	}))
+	defer store.Close()
+	host := strings.TrimPrefix(store.URL, "https://")
+
+	newProvider := func(cfg config.AWSConfig) *storage.AWSProvider {
+		t.Helper()
+		cfg.AccessKeyID = "key"
+		cfg.SecretAccessKey = "secret"
+		cfg.Region = "us-east-1"
+		cfg.BucketName = "media"
+		cfg.Endpoint = store.URL
+		provider, err := storage.NewAWSProvider(cfg)
+		if err != nil {
+			t.Fatalf("failed to create provider: %v", err)
+		}
+		return provider
+	}
+	ctx := context.Background()
+
+	// A self-signed certificate is refused unless told otherwise
+	provider := newProvider(config.AWSConfig{ForcePathStyle: true})
+	if _, err := provider.UploadFile(ctx, bytes.NewReader([]byte("x")), "a.mp4", "video/mp4"); err == nil {
+		t.Fatal("upload to a store with a self-signed certificate succeeded")
+	}
+
+	provider = newProvider(config.AWSConfig{ForcePathStyle: true, InsecureSkipVerify: true})
+	storageURL, err := provider.UploadFile(ctx, bytes.NewReader([]byte("x")), "videos/a.mp4", "video/mp4")
+	if err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	if want := store.URL + "/media/videos/a.mp4"; storageURL != want {
+		t.Fatalf("path-style object is at %s, want %s", storageURL, want)
+	}
+	mu.Lock()
+	last := requests[len(requests)-1]
+	mu.Unlock()
+	if want := "PUT " + host + "/media/videos/a.mp4"; last != want {
+		t.Fatalf("path-style upload sent %q, want %q", last, want)
+	}
+
+	// Virtual-hosted addressing puts the bucket in the host name
+	provider = newProvider(config.AWSConfig{})
+	if url, _ := provider.GetFileURL(ctx, "videos/a.mp4"); url != "https://media."+host+"/videos/a.mp4" {
+		t.Fatalf("virtual-hosted object is at %s", url)
+	}
+
+	provider = newProvider(config.AWSConfig{ForcePathStyle: true, PublicBaseURL: "https://cdn.example.com/media/"})
+	if url, _ := provider.GetFileURL(ctx, "videos/a.mp4"); url != "https://cdn.example.com/media/videos/a.mp4" {
+		t.Fatalf("object behind the public base URL is at %s", url)
+	}
+}
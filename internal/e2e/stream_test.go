@@ -0,0 +1,183 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/handlers"
+	"github.com/google/uuid"
+)
+
+// fakePackager stands in for ffmpeg packaging for HLS. It only reads input
+// restricted to local files of known formats, and writes a playlist of one
+// segment for every stream of the stream map, with an init segment for fMP4.
+const fakePackager = `#!/bin/sh
+prev=
+for arg in "$@"; do
+	case "$prev" in
+	-protocol_whitelist) protocols=$arg ;;
+	-format_whitelist) formats=$arg ;;
+	-i) input=$arg ;;
+	-var_stream_map) streams=$arg ;;
+	-hls_segment_filename) segments=$arg ;;
+	-master_pl_name) master=$arg ;;
+	esac
+	prev=$arg
+done
+if [ "$protocols" != "file,pipe" ] || [ -z "$formats" ]; then
+	echo "$input: input is not restricted" >&2
+	exit 1
+fi
+output=$(dirname "$(dirname "$prev")")
+extension=${segments##*.}
+echo "#EXTM3U" > "$output/$master"
+for stream in $streams; do
+	name=${stream##*name:}
+	mkdir -p "$output/$name"
+	printf 'segment of %s' "$name" > "$output/$name/seg_00000.$extension"
+	printf '#EXTM3U\n#EXT-X-TARGETDURATION:6\n' > "$output/$name/index.m3u8"
+	if [ "$extension" = m4s ]; then
+		printf 'init of %s' "$name" > "$output/$name/init.mp4"
+		printf '#EXT-X-MAP:URI="init.mp4"\n' >> "$output/$name/index.m3u8"
+	fi
+	printf '#EXTINF:6.000,\nseg_00000.%s\n#EXT-X-ENDLIST\n' "$extension" >> "$output/$name/index.m3u8"
+	printf '#EXT-X-STREAM-INF:BANDWIDTH=1000000\n%s/index.m3u8\n' "$name" >> "$output/$master"
+done
+`
+
+// packaged configures packaging with the fake ffprobe and packager.
+func packaged(t *testing.T, segmentFormat string) func(cfg *config.Config) {
+	ffprobe := writeTool(t, "ffprobe", fakeFFprobe)
+	ffmpeg := writeTool(t, "ffmpeg", fakePackager)
+	return func(cfg *config.Config) {
+		probed(true)(cfg)
+		cfg.Process.FFprobePath = ffprobe
+		cfg.Process.FFmpegPath = ffmpeg
+		cfg.Process.Transcode = true
+		cfg.Process.Renditions = []string{"360p:640x360:800:96", "720p:1280x720:2800:128"}
+		cfg.Process.SegmentFormat = segmentFormat
+		cfg.Process.SegmentSeconds = 6
+		cfg.Process.AudioBitrate = 128
+		cfg.Process.VideoPreset = "veryfast"
+		cfg.Process.TranscodeTimeout = 60
+		cfg.Process.TranscodeAttempts = 2
+	}
+}
+
+// streamFile fetches a file of the stream package of media id and returns
+// its content.
+func (e *testEnv) streamFile(id uuid.UUID, file string) string {
+	e.t.Helper()
+
+	resp := e.do(http.MethodGet, "/api/v1/media/"+id.String()+"/"+file, nil, nil)
+	e.expectStatus(resp, http.StatusOK)
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestHLSPackaging(t *testing.T) {
+	env := newTestEnv(t, packaged(t, "ts"))
+
+	resp := env.upload("Packaged", "packaged.mp4", []byte("GOOD video"))
+	env.expectStatus(resp, http.StatusCreated)
+	var created mediaEnvelope
+	env.decode(resp, &created)
+	id := created.Media.ID
+
+	// Progressive until the package is made
+	stream := func() (string, string) {
+		t.Helper()
+		resp := env.do(http.MethodGet, "/api/v1/media/"+id.String()+"/stream", nil, nil)
+		env.expectStatus(resp, http.StatusOK)
+		var stream struct {
+			StreamURL string `json:"stream_url"`
+			Format    string `json:"format"`
+		}
+		env.decode(resp, &stream)
+		return stream.Format, stream.StreamURL
+	}
+	if format, _ := stream(); format != "progressive" {
+		t.Fatalf("unpackaged media streams as %s", format)
+	}
+
+	env.runJobs()
+	format, streamURL := stream()
+	if format != "hls" || !strings.HasSuffix(streamURL, "/api/v1/media/"+id.String()+"/hls/master.m3u8") {
+		t.Fatalf("packaged media streams as %s from %s", format, streamURL)
+	}
+
+	master := env.streamFile(id, "hls/master.m3u8")
+	for _, rendition := range []string{"360p", "720p"} {
+		if !strings.Contains(master, rendition+"/index.m3u8") {
+			t.Fatalf("master playlist has no %s rendition:\n%s", rendition, master)
+		}
+	}
+	// Proxy mode keeps segments relative to their playlist
+	if playlist := env.streamFile(id, "hls/360p/index.m3u8"); !strings.Contains(playlist, "\nseg_00000.ts\n") {
+		t.Fatalf("360p playlist does not list its segment:\n%s", playlist)
+	}
+	if segment := env.streamFile(id, "hls/360p/seg_00000.ts"); segment != "segment of 360p" {
+		t.Fatalf("360p segment is %q", segment)
+	}
+
+	// Files outside the package are refused
+	resp = env.do(http.MethodGet, "/api/v1/media/"+id.String()+"/hls/../360p/index.m3u8", nil, nil)
+	if resp.StatusCode == http.StatusOK {
+		t.Fatal("a path leaving the package was served")
+	}
+	resp = env.do(http.MethodGet, "/api/v1/media/"+id.String()+"/hls/1080p/index.m3u8", nil, nil)
+	env.expectStatus(resp, http.StatusNotFound)
+}
+
+func TestDASHManifest(t *testing.T) {
+	env := newTestEnv(t, packaged(t, "fmp4"))
+
+	resp := env.upload("Song", "song.mp3", []byte("SONG audio"))
+	env.expectStatus(resp, http.StatusCreated)
+	var created mediaEnvelope
+	env.decode(resp, &created)
+	id := created.Media.ID
+	env.runJobs()
+
+	resp = env.do(http.MethodGet, "/api/v1/media/"+id.String()+"/stream?format=dash", nil, nil)
+	env.expectStatus(resp, http.StatusOK)
+	var stream struct {
+		StreamURL string                  `json:"stream_url"`
+		Formats   []handlers.StreamFormat `json:"formats"`
+	}
+	env.decode(resp, &stream)
+	if !strings.HasSuffix(stream.StreamURL, "/api/v1/media/"+id.String()+"/dash/manifest.mpd") {
+		t.Fatalf("DASH stream is at %s", stream.StreamURL)
+	}
+	var formats []string
+	for _, format := range stream.Formats {
+		formats = append(formats, format.Format)
+	}
+	if strings.Join(formats, ",") != "hls,dash,progressive" {
+		t.Fatalf("media streams as %v, want hls, dash and progressive", formats)
+	}
+
+	manifest := env.streamFile(id, "dash/manifest.mpd")
+	for _, want := range []string{`sourceURL="audio/init.mp4"`, `media="audio/seg_00000.m4s"`} {
+		if !strings.Contains(manifest, want) {
+			t.Fatalf("manifest has no %s:\n%s", want, manifest)
+		}
+	}
+	if segment := env.streamFile(id, "dash/audio/seg_00000.m4s"); segment != "segment of audio" {
+		t.Fatalf("audio segment is %q", segment)
+	}
+	if init := env.streamFile(id, "hls/audio/init.mp4"); init != "init of audio" {
+		t.Fatalf("audio init segment is %q", init)
+	}
+
+	// Each format only reads its own files
+	for _, file := range []string{"dash/master.m3u8", "dash/audio/index.m3u8", "hls/manifest.mpd", "hls/source"} {
+		resp = env.do(http.MethodGet, "/api/v1/media/"+id.String()+"/"+file, nil, nil)
+		env.expectStatus(resp, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,166 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/handlers"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/google/uuid"
+)
+
+// fakeFFmpeg stands in for ffmpeg taking thumbnails. It only reads input
+// restricted to local files of known formats, and writes the frame at %s to
+// every JPEG it is asked for.
+const fakeFFmpeg = `#!/bin/sh
+prev=
+for arg in "$@"; do
+	case "$prev" in
+	-protocol_whitelist) protocols=$arg ;;
+	-format_whitelist) formats=$arg ;;
+	-i) input=$arg ;;
+	esac
+	case "$arg" in
+	*.jpg) outputs="$outputs $arg" ;;
+	esac
+	prev=$arg
+done
+if [ "$protocols" != "file,pipe" ] || [ -z "$formats" ]; then
+	echo "$input: input is not restricted" >&2
+	exit 1
+fi
+for output in $outputs; do
+	cp %s "$output"
+done
+`
+
+// pngImage is a blank picture of the given size.
+func pngImage(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("failed to encode image: %v", err)
+	}
+	return encoded.Bytes()
+}
+
+func (e *testEnv) listThumbnails(id uuid.UUID) []handlers.ThumbnailResponse {
+	e.t.Helper()
+
+	resp := e.do(http.MethodGet, fmt.Sprintf("/api/v1/media/%s/thumbnails", id), nil, map[string]string{"Authorization": "Bearer " + e.token})
+	e.expectStatus(resp, http.StatusOK)
+	var listed struct {
+		Thumbnails []handlers.ThumbnailResponse `json:"thumbnails"`
+	}
+	e.decode(resp, &listed)
+	return listed.Thumbnails
+}
+
+func TestThumbnails(t *testing.T) {
+	frame := filepath.Join(t.TempDir(), "frame.png")
+	if err := os.WriteFile(frame, pngImage(t, 64, 36), 0o644); err != nil {
+		t.Fatalf("failed to write frame: %v", err)
+	}
+	ffprobe := writeTool(t, "ffprobe", fakeFFprobe)
+	ffmpeg := writeTool(t, "ffmpeg", fmt.Sprintf(fakeFFmpeg, frame))
+
+	env := newTestEnv(t, probed(true), func(cfg *config.Config) {
+		cfg.Process.FFprobePath = ffprobe
+		cfg.Process.Thumbnails = true
+		cfg.Process.FFmpegPath = ffmpeg
+		cfg.Process.ThumbnailMode = "offsets"
+		cfg.Process.ThumbnailOffsets = []string{"25%", "50%"}
+		cfg.Process.ThumbnailWidths = []int{160, 320}
+		cfg.Process.ThumbnailTimeout = 10
+		cfg.Storage.KeyScheme = "{user}/{media_id}/{sanitized_name}"
+	})
+
+	resp := env.upload("Pictured", "pictured.mp4", []byte("GOOD first cut"))
+	env.expectStatus(resp, http.StatusCreated)
+	var created mediaEnvelope
+	env.decode(resp, &created)
+	id := created.Media.ID
+	env.runJobs()
+
+	// checkCandidates expects the generated candidates and the selected one
+	checkCandidates := func(generated []int, selected int) {
+		t.Helper()
+		var listed []int
+		for _, thumbnail := range env.listThumbnails(id) {
+			if !thumbnail.Custom {
+				listed = append(listed, thumbnail.Candidate)
+			}
+			if thumbnail.Selected != (thumbnail.Candidate == selected) {
+				t.Fatalf("candidate %d selected is %t, want candidate %d selected", thumbnail.Candidate, thumbnail.Selected, selected)
+			}
+			if len(thumbnail.Sizes) == 0 {
+				t.Fatalf("candidate %d has no sizes", thumbnail.Candidate)
+			}
+		}
+		if fmt.Sprint(listed) != fmt.Sprint(generated) {
+			t.Fatalf("generated candidates are %v, want %v", listed, generated)
+		}
+	}
+	checkCandidates([]int{1, 2}, 1)
+
+	// Thumbnails are named by the key scheme and the media points at the
+	// route serving them
+	var thumbnails []models.Thumbnail
+	env.db.Where("media_id = ?", id).Find(&thumbnails)
+	for _, thumbnail := range thumbnails {
+		want := fmt.Sprintf("%s/%s-thumbnail-%d-%d/", created.Media.UserID, id, thumbnail.Candidate, thumbnail.Width)
+		if !strings.HasPrefix(thumbnail.Filename, want) {
+			t.Fatalf("thumbnail is stored under %s, want a key starting with %s", thumbnail.Filename, want)
+		}
+	}
+	resp = env.do(http.MethodGet, fmt.Sprintf("/api/v1/media/%s", id), nil, nil)
+	env.expectStatus(resp, http.StatusOK)
+	var fetched mediaEnvelope
+	env.decode(resp, &fetched)
+	if want := env.url + fmt.Sprintf("/api/v1/media/%s/thumbnail", id); fetched.Media.ThumbnailURL != want {
+		t.Fatalf("thumbnail_url is %q, want %q", fetched.Media.ThumbnailURL, want)
+	}
+
+	resp = env.do(http.MethodGet, fmt.Sprintf("/api/v1/media/%s/thumbnail", id), nil, map[string]string{"Authorization": "Bearer " + env.token})
+	env.expectStatus(resp, http.StatusOK)
+	if contentType := resp.Header.Get("Content-Type"); contentType != "image/png" {
+		t.Fatalf("thumbnail is served as %q", contentType)
+	}
+
+	// An uploaded image stays selected through later changes to the file
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "poster.png")
+	part.Write(pngImage(t, 640, 360))
+	form.Close()
+	resp = env.do(http.MethodPost, fmt.Sprintf("/api/v1/media/%s/thumbnails", id), &body, map[string]string{
+		"Content-Type":  form.FormDataContentType(),
+		"Authorization": "Bearer " + env.token,
+	})
+	env.expectStatus(resp, http.StatusCreated)
+	checkCandidates([]int{1, 2}, 3)
+
+	// A new file replaces the generated candidates
+	resp = env.replaceFile(id, "pictured.mp4", []byte("GOOD second cut"))
+	env.expectStatus(resp, http.StatusOK)
+	env.runJobs()
+	checkCandidates([]int{4, 5}, 3)
+
+	// and so does the file a rollback brings back
+	resp = env.do(http.MethodPost, fmt.Sprintf("/api/v1/media/%s/versions/1/rollback", id), nil, map[string]string{"Authorization": "Bearer " + env.token})
+	env.expectStatus(resp, http.StatusOK)
+	env.runJobs()
+	checkCandidates([]int{6, 7}, 3)
+}
@@ -0,0 +1,157 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/storage"
+)
+
+// createUpload starts a resumable upload of length bytes and returns its path.
+func (e *testEnv) createUpload(filename string, length int) string {
+	e.t.Helper()
+
+	encode := base64.StdEncoding.EncodeToString
+	resp := e.do(http.MethodPost, "/api/v1/uploads", nil, map[string]string{
+		"Authorization":   "Bearer " + e.token,
+		"Tus-Resumable":   "1.0.0",
+		"Upload-Length":   strconv.Itoa(length),
+		"Upload-Metadata": "filename " + encode([]byte(filename)) + ",title " + encode([]byte("Resumed")),
+	})
+	e.expectStatus(resp, http.StatusCreated)
+	return resp.Header.Get("Location")
+}
+
+// patchUpload sends chunk at offset.
+func (e *testEnv) patchUpload(path string, offset int, chunk []byte) *http.Response {
+	return e.do(http.MethodPatch, path, bytes.NewReader(chunk), map[string]string{
+		"Authorization": "Bearer " + e.token,
+		"Tus-Resumable": "1.0.0",
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": strconv.Itoa(offset),
+	})
+}
+
+// uploadOffset reads the offset of an upload.
+func (e *testEnv) uploadOffset(path string) int {
+	e.t.Helper()
+
+	resp := e.do(http.MethodHead, path, nil, map[string]string{
+		"Authorization": "Bearer " + e.token,
+		"Tus-Resumable": "1.0.0",
+	})
+	e.expectStatus(resp, http.StatusOK)
+	offset, _ := strconv.Atoi(resp.Header.Get("Upload-Offset"))
+	return offset
+}
+
+// checkUploaded expects the media created by an upload to hold content.
+func (e *testEnv) checkUploaded(resp *http.Response, content []byte) {
+	e.t.Helper()
+
+	e.expectStatus(resp, http.StatusNoContent)
+	id := resp.Header.Get("X-Media-ID")
+	if id == "" {
+		e.t.Fatal("finished upload returned no media")
+	}
+
+	var media models.Media
+	e.db.First(&media, "id = ?", id)
+	sum := sha256.Sum256(content)
+	if media.Checksum != hex.EncodeToString(sum[:]) || media.FileSize != int64(len(content)) {
+		e.t.Fatalf("media has checksum %s and size %d, want those of the uploaded file", media.Checksum, media.FileSize)
+	}
+	stored, _ := e.memory.Object(media.Filename)
+	if !bytes.Equal(stored, content) {
+		e.t.Fatalf("stored object of %d bytes differs from the uploaded file", len(stored))
+	}
+	for _, key := range e.memory.Keys() {
+		if strings.HasPrefix(key, "uploads/") {
+			e.t.Fatalf("temporary object %s was left behind", key)
+		}
+	}
+}
+
+func TestResumableUploadResendsLostStaging(t *testing.T) {
+	env := newTestEnv(t)
+	part := int(env.cfg.Upload.PartSize)
+	content := make([]byte, part+1000)
+	rand.New(rand.NewSource(1)).Read(content)
+	path := env.createUpload("resumed.mp4", len(content))
+
+	// loseStaging stands in for a request landing on another server
+	loseStaging := func() {
+		t.Helper()
+		files, _ := filepath.Glob(filepath.Join(env.cfg.Upload.StagingDir, "*"))
+		if len(files) == 0 {
+			t.Fatal("no chunks are staged")
+		}
+		for _, file := range files {
+			os.Remove(file)
+		}
+	}
+
+	resp := env.patchUpload(path, 0, content[:3<<20])
+	env.expectStatus(resp, http.StatusNoContent)
+
+	// Chunks staged before the first part are sent again from the start
+	loseStaging()
+	resp = env.patchUpload(path, 3<<20, content[3<<20:part+500])
+	env.expectStatus(resp, http.StatusConflict)
+	if offset := env.uploadOffset(path); offset != 0 {
+		t.Fatalf("upload without its staged chunks resumes at %d, want 0", offset)
+	}
+	resp = env.patchUpload(path, 0, content[:part+500])
+	env.expectStatus(resp, http.StatusNoContent)
+
+	// and those after it from the end of the part
+	loseStaging()
+	resp = env.patchUpload(path, part+500, content[part+500:])
+	env.expectStatus(resp, http.StatusConflict)
+	if offset := env.uploadOffset(path); offset != part {
+		t.Fatalf("upload without its staged chunks resumes at %d, want %d", offset, part)
+	}
+	env.checkUploaded(env.patchUpload(path, part, content[part:]), content)
+}
+
+func TestResumableUploadFinishesAfterFailure(t *testing.T) {
+	env := newTestEnv(t)
+	content := []byte("resumable upload that fails once assembled")
+	path := env.createUpload("retried.mp4", len(content))
+
+	// The multipart upload is completed but the object cannot be moved
+	env.memory.SetFaults(storage.Faults{ErrorRate: 1, Operations: []string{"Copy"}})
+	resp := env.patchUpload(path, 0, content)
+	env.expectStatus(resp, http.StatusInternalServerError)
+	env.memory.SetFaults(storage.Faults{})
+
+	var upload models.Upload
+	env.db.First(&upload)
+	if !upload.Completed || upload.MediaID != nil {
+		t.Fatalf("upload failing after assembly is completed %t with media %v", upload.Completed, upload.MediaID)
+	}
+	if offset := env.uploadOffset(path); offset != len(content) {
+		t.Fatalf("failed upload is at %d, want %d", offset, len(content))
+	}
+
+	// An empty chunk at the end finishes it
+	env.checkUploaded(env.patchUpload(path, len(content), nil), content)
+
+	var pending int64
+	env.db.Model(&models.Upload{}).Where("media_id IS NULL").Count(&pending)
+	if pending != 0 {
+		t.Fatalf("%d uploads still hold a quota reservation", pending)
+	}
+}
@@ -0,0 +1,114 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/handlers"
+	"github.com/google/uuid"
+)
+
+// replaceFile uploads content as the new file of media id.
+func (e *testEnv) replaceFile(id uuid.UUID, filename string, content []byte) *http.Response {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", filename)
+	part.Write(content)
+	form.Close()
+
+	return e.do(http.MethodPut, fmt.Sprintf("/api/v1/media/%s/file", id), &body, map[string]string{
+		"Content-Type":  form.FormDataContentType(),
+		"Authorization": "Bearer " + e.token,
+	})
+}
+
+func (e *testEnv) listVersions(id uuid.UUID) []handlers.VersionResponse {
+	e.t.Helper()
+
+	resp := e.do(http.MethodGet, fmt.Sprintf("/api/v1/media/%s/versions", id), nil, map[string]string{"Authorization": "Bearer " + e.token})
+	e.expectStatus(resp, http.StatusOK)
+	var listed struct {
+		Versions []handlers.VersionResponse `json:"versions"`
+	}
+	e.decode(resp, &listed)
+	return listed.Versions
+}
+
+func TestReplaceAndRollBackFile(t *testing.T) {
+	env := newTestEnv(t)
+	files := [][]byte{[]byte("first cut"), []byte("second cut"), []byte("third cut")}
+
+	resp := env.upload("Edited", "cut.mp4", files[0])
+	env.expectStatus(resp, http.StatusCreated)
+	var created mediaEnvelope
+	env.decode(resp, &created)
+	id := created.Media.ID
+
+	// A view is kept across replacements
+	resp = env.do(http.MethodGet, "/api/v1/media/"+id.String(), nil, nil)
+	env.expectStatus(resp, http.StatusOK)
+
+	for _, content := range files[1:] {
+		resp = env.replaceFile(id, "cut.mp4", content)
+		env.expectStatus(resp, http.StatusOK)
+	}
+	var replaced mediaEnvelope
+	env.decode(resp, &replaced)
+	if replaced.Media.ID != id || replaced.Media.ViewCount != 1 {
+		t.Fatalf("replaced media is %s with %d views, want %s with 1", replaced.Media.ID, replaced.Media.ViewCount, id)
+	}
+
+	checkVersions := func(current int) {
+		t.Helper()
+		versions := env.listVersions(id)
+		if len(versions) != 3 {
+			t.Fatalf("listed %d versions, want 3", len(versions))
+		}
+		for i, version := range versions {
+			if want := 3 - i; version.Version != want {
+				t.Fatalf("version %d listed at position %d, want newest first: %+v", version.Version, i, versions)
+			}
+			if version.Current != (version.Version == current) {
+				t.Fatalf("version %d current is %t, want version %d current", version.Version, version.Current, current)
+			}
+		}
+	}
+	checkContent := func(want []byte) {
+		t.Helper()
+		resp := env.do(http.MethodGet, fmt.Sprintf("/api/v1/media/%s/content", id), nil, nil)
+		env.expectStatus(resp, http.StatusOK)
+		body, _ := io.ReadAll(resp.Body)
+		if !bytes.Equal(body, want) {
+			t.Fatalf("media serves %q, want %q", body, want)
+		}
+	}
+
+	checkVersions(3)
+	checkContent(files[2])
+
+	// Rolling back to the first file keeps the third as a version
+	resp = env.do(http.MethodPost, fmt.Sprintf("/api/v1/media/%s/versions/1/rollback", id), nil, map[string]string{"Authorization": "Bearer " + env.token})
+	env.expectStatus(resp, http.StatusOK)
+	checkVersions(1)
+	checkContent(files[0])
+
+	resp = env.do(http.MethodPost, fmt.Sprintf("/api/v1/media/%s/versions/7/rollback", id), nil, map[string]string{"Authorization": "Bearer " + env.token})
+	env.expectStatus(resp, http.StatusNotFound)
+
+	// A prior version can be deleted, the current one cannot
+	resp = env.do(http.MethodDelete, fmt.Sprintf("/api/v1/media/%s/versions/2", id), nil, map[string]string{"Authorization": "Bearer " + env.token})
+	env.expectStatus(resp, http.StatusOK)
+	if versions := env.listVersions(id); len(versions) != 2 || versions[0].Version != 3 || versions[1].Version != 1 {
+		t.Fatalf("versions after deleting 2 are %+v", versions)
+	}
+	resp = env.do(http.MethodDelete, fmt.Sprintf("/api/v1/media/%s/versions/1", id), nil, map[string]string{"Authorization": "Bearer " + env.token})
+	if resp.StatusCode == http.StatusOK {
+		t.Fatal("deleting the current version succeeded")
+	}
+}
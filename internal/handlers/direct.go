@@ -0,0 +1,448 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/interfaces"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/middleware"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/service"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxUploadParts is the most parts S3 accepts in one multipart upload.
+const maxUploadParts = 10000
+
+type CreateDirectUploadRequest struct {
+	Title       string `json:"title" binding:"required"`
+	Description string `json:"description"`
+	Genre       string `json:"genre"`
+	Tags        string `json:"tags"`
+	IsPublic    *bool  `json:"is_public"` // public unless false
+	Filename    string `json:"filename" binding:"required"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size" binding:"required,gt=0"`
+}
+
+type CompleteDirectUploadRequest struct {
+	Parts []CompletedPartRequest `json:"parts" binding:"dive"`
+}
+
+type CompletedPartRequest struct {
+	PartNumber int    `json:"part_number" binding:"required,gt=0"`
+	ETag       string `json:"etag"`
+}
+
+type PresignedRequestResponse struct {
+	PartNumber int               `json:"part_number,omitempty"`
+	Method     string            `json:"method"`
+	URL        string            `json:"url"`
+	Headers    map[string]string `json:"headers,omitempty"`
+}
+
+// DirectUploadResponse tells the client where to send the file: either one
+// request for the whole file, or one request per part of PartSize bytes. An
+// upload being verified has nowhere to send it.
+type DirectUploadResponse struct {
+	MediaID   uuid.UUID                  `json:"media_id"`
+	Size      int64                      `json:"size"`
+	Status    string                     `json:"status"`
+	Error     string                     `json:"error,omitempty"` // why the last completed file was rejected
+	PartSize  int64                      `json:"part_size,omitempty"`
+	Upload    *PresignedRequestResponse  `json:"upload,omitempty"`
+	Parts     []PresignedRequestResponse `json:"parts,omitempty"`
+	ExpiresAt string                     `json:"expires_at,omitempty"`
+}
+
+// CreateDirectUpload creates a pending media record and returns presigned
+// requests that upload its file straight to the storage backend. Files larger
+// than the direct upload part size are sent as a multipart upload.
+func (h *MediaHandler) CreateDirectUpload(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": service.ErrUnauthorized.Error()})
+		return
+	}
+
+	var req CreateDirectUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	originalName := filepath.Base(req.Filename)
+	ext := strings.ToLower(filepath.Ext(originalName))
+	if !isAllowedMediaType(ext) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File type not allowed"})
+		return
+	}
+
+	if h.cfg.Upload.MaxSize > 0 && req.Size > h.cfg.Upload.MaxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Upload exceeds maximum size"})
+		return
+	}
+
+	if !checkQuota(c, h.quotas, user, req.Size, 1) {
+		return
+	}
+
+	contentType := req.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(ext)
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	if !service.IsMediaContentType(contentType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Content type must be audio or video"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	mediaID := uuid.New()
+	upload := models.DirectUpload{
+		MediaID:      mediaID,
+		Filename:     "uploads/" + mediaID.String(),
+		OriginalName: originalName,
+		ContentType:  contentType,
+		Size:         req.Size,
+		Status:       models.DirectUploadSending,
+	}
+
+	if partSize := h.directPartSize(req.Size); req.Size > partSize {
+		multipartID, err := h.storageProvider.CreateMultipartUpload(ctx, upload.Filename, contentType)
+		if err != nil {
+			if errors.Is(err, storage.ErrMultipartNotSupported) {
+				c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+				return
+			}
+			fmt.Println("Failed to create multipart upload", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload"})
+			return
+		}
+		upload.MultipartID = multipartID
+		upload.PartSize = partSize
+	}
+
+	response, err := h.presignDirectUpload(ctx, &upload)
+	if err != nil {
+		h.abortDirectUpload(ctx, &upload)
+		if errors.Is(err, storage.ErrDirectUploadNotSupported) {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		}
+		fmt.Println("Failed to presign upload", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload"})
+		return
+	}
+
+	media := models.Media{
+		ID:          mediaID,
+		Title:       req.Title,
+		Description: req.Description,
+		Filename:    upload.Filename,
+		FileSize:    req.Size,
+		FileType:    strings.TrimPrefix(ext, "."),
+		Genre:       req.Genre,
+		Tags:        req.Tags,
+		UserID:      user.ID,
+		IsPublic:    req.IsPublic == nil || *req.IsPublic,
+		Status:      models.MediaPending,
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := h.quotas.Reserve(tx, user, req.Size, 1); err != nil {
+			return err
+		}
+		if err := tx.Create(&media).Error; err != nil {
+			return err
+		}
+		return tx.Create(&upload).Error
+	})
+	if err != nil {
+		h.abortDirectUpload(ctx, &upload)
+		respondQuotaError(c, err, "Failed to save media record")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"media":  h.toMediaResponse(c, &media),
+		"upload": response,
+	})
+}
+
+// GetDirectUpload returns the state of a pending upload along with fresh
+// presigned requests, for clients whose URLs expired before they were done or
+// whose file was rejected.
+func (h *MediaHandler) GetDirectUpload(c *gin.Context) {
+	media, upload, ok := h.findDirectUpload(c)
+	if !ok {
+		return
+	}
+
+	response, err := h.presignDirectUpload(c.Request.Context(), upload)
+	if err != nil {
+		fmt.Println("Failed to presign upload", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to presign upload"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"media":  h.toMediaResponse(c, media),
+		"upload": response,
+	})
+}
+
+// CompleteDirectUpload checks that the uploaded object exists and matches the
+// declared size and type, then queues a job that hashes and probes it, moves
+// it to its content-addressed key and marks the media ready. The client polls
+// the upload or the media to find out how it went. A rejected file is deleted
+// so the client can upload it again.
+func (h *MediaHandler) CompleteDirectUpload(c *gin.Context) {
+	var req CompleteDirectUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	media, upload, ok := h.findDirectUpload(c)
+	if !ok {
+		return
+	}
+
+	unlock, ok := h.lock(c, media.ID)
+	if !ok {
+		return
+	}
+	defer unlock()
+
+	// Reload under the lock in case another request just completed it
+	media, upload, ok = h.findDirectUpload(c)
+	if !ok {
+		return
+	}
+	if upload.Status == models.DirectUploadVerifying {
+		c.JSON(http.StatusAccepted, gin.H{
+			"message": "Upload is being verified",
+			"media":   h.toMediaResponse(c, media),
+			"upload":  toDirectUploadStatus(upload),
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	if upload.MultipartID != "" {
+		if err := h.assembleParts(ctx, upload, req.Parts); err != nil {
+			fmt.Println("Failed to complete multipart upload", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Uploaded parts could not be assembled: " + err.Error()})
+			return
+		}
+	}
+
+	if err := h.directUploads.Check(ctx, upload); err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "File has not been uploaded"})
+			return
+		}
+		if errors.Is(err, service.ErrUploadRejected) {
+			if resetErr := h.directUploads.Reset(ctx, upload, err); resetErr != nil {
+				fmt.Println("Failed to reset direct upload", resetErr)
+			}
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		fmt.Println("Failed to verify upload", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify upload"})
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(upload).Updates(map[string]interface{}{
+			"status": models.DirectUploadVerifying,
+			"error":  "",
+		}).Error
+		if err != nil {
+			return err
+		}
+		return h.jobs.VerifyUpload(ctx, tx, upload)
+	})
+	if err != nil {
+		fmt.Println("Failed to queue upload verification", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify upload"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Upload is being verified",
+		"media":   h.toMediaResponse(c, media),
+		"upload":  toDirectUploadStatus(upload),
+	})
+}
+
+// deleteDirectUpload removes a pending media record along with anything the
+// client has uploaded for it so far.
+func (h *MediaHandler) deleteDirectUpload(c *gin.Context, media *models.Media) {
+	ctx := c.Request.Context()
+
+	var upload models.DirectUpload
+	err := h.db.Where("media_id = ?", media.ID).First(&upload).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete media"})
+		return
+	}
+	if err == nil {
+		h.abortDirectUpload(ctx, &upload)
+	}
+
+	if err := h.storageProvider.DeleteFile(ctx, media.Filename); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file from storage"})
+		return
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("media_id = ?", media.ID).Delete(&models.DirectUpload{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(media).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete media record"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Media deleted successfully",
+	})
+}
+
+func (h *MediaHandler) findDirectUpload(c *gin.Context) (*models.Media, *models.DirectUpload, bool) {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": service.ErrUnauthorized.Error()})
+		return nil, nil, false
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid media ID"})
+		return nil, nil, false
+	}
+
+	var media models.Media
+	err = h.db.Where("id = ? AND user_id = ? AND status = ?", id, user.ID, models.MediaPending).First(&media).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return nil, nil, false
+	}
+
+	var upload models.DirectUpload
+	if err := h.db.Where("media_id = ?", media.ID).First(&upload).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return nil, nil, false
+	}
+
+	return &media, &upload, true
+}
+
+func (h *MediaHandler) presignDirectUpload(ctx context.Context, upload *models.DirectUpload) (*DirectUploadResponse, error) {
+	response := toDirectUploadStatus(upload)
+	if upload.Status == models.DirectUploadVerifying {
+		return response, nil
+	}
+
+	expiresIn := int64(h.cfg.Upload.DirectURLExpiry)
+	response.ExpiresAt = time.Now().UTC().Add(time.Duration(expiresIn) * time.Second).Format("2006-01-02T15:04:05Z")
+
+	if upload.MultipartID == "" {
+		request, err := h.storageProvider.PresignUpload(ctx, upload.Filename, upload.ContentType, expiresIn)
+		if err != nil {
+			return nil, err
+		}
+		response.Upload = toPresignedRequestResponse(0, request)
+		return response, nil
+	}
+
+	response.PartSize = upload.PartSize
+	parts := int((upload.Size + upload.PartSize - 1) / upload.PartSize)
+	for partNumber := 1; partNumber <= parts; partNumber++ {
+		request, err := h.storageProvider.PresignUploadPart(ctx, upload.Filename, upload.MultipartID, partNumber, expiresIn)
+		if err != nil {
+			return nil, err
+		}
+		response.Parts = append(response.Parts, *toPresignedRequestResponse(partNumber, request))
+	}
+	return response, nil
+}
+
+// assembleParts completes the multipart upload. The upload ID is cleared
+// afterwards so a retried completion goes straight to verification.
+func (h *MediaHandler) assembleParts(ctx context.Context, upload *models.DirectUpload, requested []CompletedPartRequest) error {
+	expected := int((upload.Size + upload.PartSize - 1) / upload.PartSize)
+	if len(requested) != expected {
+		return fmt.Errorf("expected %d parts, got %d", expected, len(requested))
+	}
+
+	parts := make([]interfaces.CompletedPart, len(requested))
+	for i, part := range requested {
+		if part.PartNumber != i+1 {
+			return fmt.Errorf("parts must be numbered 1 to %d in order", expected)
+		}
+		parts[i] = interfaces.CompletedPart{PartNumber: part.PartNumber, ETag: part.ETag}
+	}
+
+	if _, err := h.storageProvider.CompleteMultipartUpload(ctx, upload.Filename, upload.MultipartID, upload.ContentType, parts); err != nil {
+		return err
+	}
+
+	upload.MultipartID = ""
+	return h.db.Model(upload).Update("multipart_id", "").Error
+}
+
+func (h *MediaHandler) abortDirectUpload(ctx context.Context, upload *models.DirectUpload) {
+	if upload.MultipartID == "" {
+		return
+	}
+	if err := h.storageProvider.AbortMultipartUpload(context.WithoutCancel(ctx), upload.Filename, upload.MultipartID); err != nil {
+		fmt.Println("Failed to abort multipart upload", err)
+	}
+}
+
+// directPartSize picks the part size for a file: the configured size, raised
+// when the file would otherwise need more parts than S3 allows.
+func (h *MediaHandler) directPartSize(size int64) int64 {
+	partSize := max(h.cfg.Upload.DirectPartSize, minPartSize)
+	if minimum := (size + maxUploadParts - 1) / maxUploadParts; partSize < minimum {
+		partSize = minimum
+	}
+	return partSize
+}
+
+func toDirectUploadStatus(upload *models.DirectUpload) *DirectUploadResponse {
+	return &DirectUploadResponse{
+		MediaID: upload.MediaID,
+		Size:    upload.Size,
+		Status:  upload.Status,
+		Error:   upload.Error,
+	}
+}
+
+func toPresignedRequestResponse(partNumber int, request *interfaces.PresignedRequest) *PresignedRequestResponse {
+	return &PresignedRequestResponse{
+		PartNumber: partNumber,
+		Method:     request.Method,
+		URL:        request.URL,
+		Headers:    request.Headers,
+	}
+}
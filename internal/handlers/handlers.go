@@ -1,19 +1,46 @@
 package handlers
 
 import (
+	"strconv"
+
 	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
 	"github.com/Shubham-Thakur06/go-streaming-platform/internal/database"
 	"github.com/Shubham-Thakur06/go-streaming-platform/internal/storage"
+	"github.com/gin-gonic/gin"
 )
 
 type Handlers struct {
-	User  *UserHandler
-	Media *MediaHandler
+	User    *UserHandler
+	Media   *MediaHandler
+	File    *FileHandler
+	Upload  *UploadHandler
+	Storage *StorageHandler
+	Job     *JobHandler
 }
 
 func New(db *database.DB, cfg *config.Config, storageProvider *storage.StorageProvider) *Handlers {
 	return &Handlers{
-		User:  NewUserHandler(db.DB, cfg),
-		Media: NewMediaHandler(db.DB, cfg, storageProvider),
+		User:    NewUserHandler(db.DB, cfg),
+		Media:   NewMediaHandler(db.DB, cfg, storageProvider),
+		File:    NewFileHandler(storageProvider),
+		Upload:  NewUploadHandler(db.DB, cfg, storageProvider),
+		Storage: NewStorageHandler(db.DB),
+		Job:     NewJobHandler(db.DB, cfg),
+	}
+}
+
+// maxPageSize is the most rows a listing returns per page.
+const maxPageSize = 100
+
+// pagination reads the page and limit query parameters, clamped so a
+// request cannot ask for an unbounded page.
+func pagination(c *gin.Context, defaultLimit int) (page, limit, offset int) {
+	page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ = strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLimit)))
+	page = max(page, 1)
+	if limit < 1 {
+		limit = defaultLimit
 	}
+	limit = min(limit, maxPageSize)
+	return page, limit, (page - 1) * limit
 }
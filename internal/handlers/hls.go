@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/service"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ServeHLS sends a playlist or segment of the stream package of a media.
+func (h *MediaHandler) ServeHLS(c *gin.Context) {
+	h.serveStreamFile(c, FormatHLS)
+}
+
+// ServeDASH sends the manifest or a segment of the stream package of a media.
+func (h *MediaHandler) ServeDASH(c *gin.Context) {
+	h.serveStreamFile(c, FormatDASH)
+}
+
+// serveStreamFile sends a file of the stream package of a media read in
+// format. Media playlists and the DASH manifest point at segments the way the
+// stream mode hands out files: through the server in proxy mode, as CDN URLs
+// in cdn mode and as presigned backend URLs otherwise. Only proxy mode serves
+// segments here.
+func (h *MediaHandler) serveStreamFile(c *gin.Context, format string) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid media ID"})
+		return
+	}
+
+	// Links to private media carry their signature ahead of the file, so
+	// the relative URLs in playlists keep it
+	file := strings.TrimPrefix(c.Param("file"), "/")
+	var expires, signature string
+	if signed, ok := strings.CutPrefix(file, "signed/"); ok {
+		parts := strings.SplitN(signed, "/", 3)
+		if len(parts) != 3 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid stream file"})
+			return
+		}
+		expires, signature, file = parts[0], parts[1], parts[2]
+	}
+	if file == "" || path.Clean(file) != file || strings.HasPrefix(file, "../") || file == ".." {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid stream file"})
+		return
+	}
+	if !streamFiles[format][path.Ext(file)] {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stream file not found"})
+		return
+	}
+
+	var media models.Media
+	if err := h.db.Where("id = ? AND status = ?", id, models.MediaReady).First(&media).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": service.ErrMediaNotFound.Error()})
+		return
+	}
+
+	if !h.authorizeMedia(c, &media, expires, signature) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	pkg, err := h.packages.Ready(ctx, &media)
+	if err != nil {
+		fmt.Println("Failed to find stream package", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read stream"})
+		return
+	}
+	if pkg == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stream package not found"})
+		return
+	}
+
+	if contentType, ok := manifestTypes[path.Ext(file)]; ok {
+		manifest, err := h.packages.Manifest(ctx, pkg, file, h.segmentSigner(c, &media))
+		if err != nil {
+			if errors.Is(err, storage.ErrObjectNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Stream file not found"})
+				return
+			}
+			fmt.Println("Failed to read manifest", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read stream"})
+			return
+		}
+
+		// Signed URLs in a manifest expire, so it must not be reused
+		c.Header("Cache-Control", "no-store")
+		c.Data(http.StatusOK, contentType, manifest)
+		return
+	}
+
+	if h.cfg.Stream.Mode != "proxy" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stream file not found"})
+		return
+	}
+
+	key := pkg.Prefix + file
+	info, err := h.storageProvider.Stat(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Stream file not found"})
+			return
+		}
+		fmt.Println("Failed to stat stream file", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read stream"})
+		return
+	}
+
+	reader := h.storageProvider.NewObjectReader(ctx, key, info.Size)
+	defer reader.Close()
+
+	// Segments live under a prefix of their version and never change
+	if media.IsPublic {
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		c.Header("Cache-Control", "private, max-age=31536000, immutable")
+	}
+	if info.ContentType != "" {
+		c.Header("Content-Type", info.ContentType)
+	}
+	if info.ETag != "" {
+		c.Header("ETag", quoteETag(info.ETag))
+	}
+
+	http.ServeContent(c.Writer, c.Request, "", info.LastModified, reader)
+}
+
+// streamFiles are the extensions of the files each format reads from a
+// package. fMP4 segments are shared, MPEG-TS ones only play over HLS.
+var streamFiles = map[string]map[string]bool{
+	FormatHLS:  {".m3u8": true, ".ts": true, ".m4s": true, ".mp4": true},
+	FormatDASH: {".mpd": true, ".m4s": true, ".mp4": true},
+}
+
+// manifestTypes are the content types of the files serveStreamFile rewrites.
+var manifestTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".mpd":  "application/dash+xml",
+}
+
+// segmentSigner returns how segment keys become URLs in the playlists sent
+// to this client. Proxy mode keeps them relative to the playlist.
+func (h *MediaHandler) segmentSigner(c *gin.Context, media *models.Media) func(key string) (string, error) {
+	switch h.cfg.Stream.Mode {
+	case "proxy":
+		return nil
+	case "cdn":
+		if cdn := h.storageProvider.CDN(); cdn != nil {
+			return func(key string) (string, error) {
+				return cdn.SignURL(key, c.ClientIP())
+			}
+		}
+	}
+
+	// Long enough to play the whole media from the start
+	expiry := int64(3600 + media.Duration)
+	return func(key string) (string, error) {
+		return h.storageProvider.GeneratePresignedURL(c.Request.Context(), key, expiry)
+	}
+}
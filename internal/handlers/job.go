@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// JobHandler lets admins look into the background job queue and retry jobs
+// that failed.
+type JobHandler struct {
+	db    *gorm.DB
+	queue *service.JobQueue
+}
+
+func NewJobHandler(db *gorm.DB, cfg *config.Config) *JobHandler {
+	return &JobHandler{
+		db:    db,
+		queue: service.NewJobQueue(db, cfg.Jobs),
+	}
+}
+
+// ListJobs lists jobs, newest first, optionally filtered by status and type.
+func (h *JobHandler) ListJobs(c *gin.Context) {
+	page, limit, offset := pagination(c, 50)
+	status := c.Query("status")
+	jobType := c.Query("type")
+
+	query := h.db.Model(&models.Job{})
+
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if jobType != "" {
+		query = query.Where("type = ?", jobType)
+	}
+
+	var jobs []models.Job
+	var total int64
+
+	query.Count(&total)
+	if err := query.Offset(offset).Limit(limit).Order("created_at DESC").Find(&jobs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch jobs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"jobs": jobs,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// GetJobStats counts jobs by type and status, so a growing backlog or dead
+// jobs can be spotted.
+func (h *JobHandler) GetJobStats(c *gin.Context) {
+	var rows []struct {
+		Type   string
+		Status string
+		Count  int64
+	}
+	err := h.db.Model(&models.Job{}).
+		Select("type, status, COUNT(*) AS count").
+		Group("type, status").
+		Scan(&rows).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count jobs"})
+		return
+	}
+
+	stats := make(map[string]map[string]int64)
+	for _, row := range rows {
+		if stats[row.Type] == nil {
+			stats[row.Type] = map[string]int64{
+				models.JobPending:   0,
+				models.JobRunning:   0,
+				models.JobSucceeded: 0,
+				models.JobDead:      0,
+			}
+		}
+		stats[row.Type][row.Status] = row.Count
+	}
+
+	c.JSON(http.StatusOK, gin.H{"stats": stats})
+}
+
+func (h *JobHandler) GetJob(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	var job models.Job
+	if err := h.db.Where("id = ?", id).First(&job).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": service.ErrJobNotFound.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job": job})
+}
+
+// RetryJob runs a dead job again with a fresh set of attempts, or a pending
+// one waiting out its backoff right away.
+func (h *JobHandler) RetryJob(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	job, err := h.queue.Retry(c.Request.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrJobNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrJobNotRetryable):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			fmt.Println("Failed to retry job", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retry job"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Job queued for retry",
+		"job":     job,
+	})
+}
+
+// RetryDeadJobs retries every dead job, or only those of the type given in
+// the query.
+func (h *JobHandler) RetryDeadJobs(c *gin.Context) {
+	retried, err := h.queue.RetryDead(c.Request.Context(), c.Query("type"))
+	if err != nil {
+		fmt.Println("Failed to retry jobs", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retry jobs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("%d jobs queued for retry", retried),
+		"retried": retried,
+	})
+}
@@ -1,11 +1,18 @@
 package handlers
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
 	"github.com/Shubham-Thakur06/go-streaming-platform/internal/middleware"
@@ -21,6 +28,16 @@ type MediaHandler struct {
 	db              *gorm.DB
 	cfg             *config.Config
 	storageProvider *storage.StorageProvider
+	blobs           *service.BlobStore
+	quotas          *service.QuotaService
+	lifecycle       *service.LifecycleService
+	versions        *service.VersionService
+	probes          *service.ProbeService
+	thumbnails      *service.ThumbnailService
+	packages        *service.PackagingService
+	jobs            *service.MediaJobs
+	directUploads   *service.DirectUploadService
+	locks           *service.Locker // held while a direct upload completes or the file is replaced
 }
 
 func NewMediaHandler(db *gorm.DB, cfg *config.Config, storageProvider *storage.StorageProvider) *MediaHandler {
@@ -28,15 +45,70 @@ func NewMediaHandler(db *gorm.DB, cfg *config.Config, storageProvider *storage.S
 		db:              db,
 		cfg:             cfg,
 		storageProvider: storageProvider,
+		blobs:           service.NewBlobStore(db, storageProvider),
+		quotas:          service.NewQuotaService(db, cfg.Quota),
+		lifecycle: service.NewLifecycleService(db, storageProvider, service.LifecycleOptions{
+			ColdClass:   cfg.Storage.ColdClass,
+			RestoreDays: cfg.Lifecycle.RestoreDays,
+		}),
+		versions:      service.NewVersionService(db, storageProvider),
+		probes:        service.NewProbeService(storageProvider, cfg.Process),
+		thumbnails:    service.NewThumbnailService(db, storageProvider, cfg.Process),
+		packages:      service.NewPackagingService(db, storageProvider, cfg.Process),
+		jobs:          service.NewMediaJobs(db, storageProvider, cfg),
+		directUploads: service.NewDirectUploadService(db, storageProvider, cfg.Process),
+		locks:         service.NewLocker(db),
 	}
 }
 
+// formFieldsAllowance is how much of an upload request may be form fields and
+// multipart framing rather than file content.
+const formFieldsAllowance = 64 << 10
+
+var allowedMediaTypes = []string{".mp3", ".mp4", ".wav", ".avi", ".mov", ".mkv"}
+
+func isAllowedMediaType(ext string) bool {
+	for _, allowedType := range allowedMediaTypes {
+		if ext == allowedType {
+			return true
+		}
+	}
+	return false
+}
+
+// checkQuota responds and returns false when user cannot store that many
+// more files, taking size bytes in all.
+func checkQuota(c *gin.Context, quotas *service.QuotaService, user *models.User, size int64, files int64) bool {
+	err := quotas.Check(c.Request.Context(), user, size, files)
+	if errors.Is(err, service.ErrQuotaExceeded) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return false
+	}
+	if err != nil {
+		fmt.Println("Failed to check storage quota", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check storage quota"})
+		return false
+	}
+	return true
+}
+
+// respondQuotaError responds to a record that could not be saved, telling a
+// quota that ran out meanwhile apart from other failures.
+func respondQuotaError(c *gin.Context, err error, message string) {
+	if errors.Is(err, service.ErrQuotaExceeded) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	}
+	fmt.Println(message, err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
+
 type UploadMediaRequest struct {
 	Title       string `form:"title" binding:"required"`
 	Description string `form:"description"`
 	Genre       string `form:"genre"`
 	Tags        string `form:"tags"`
-	IsPublic    bool   `form:"is_public"`
+	IsPublic    *bool  `form:"is_public"` // public unless false
 }
 
 type MediaResponse struct {
@@ -45,6 +117,7 @@ type MediaResponse struct {
 	Description  string    `json:"description"`
 	Filename     string    `json:"filename"`
 	FileSize     int64     `json:"file_size"`
+	Checksum     string    `json:"checksum"`
 	FileType     string    `json:"file_type"`
 	Genre        string    `json:"genre"`
 	Tags         string    `json:"tags"`
@@ -53,8 +126,12 @@ type MediaResponse struct {
 	ThumbnailURL string    `json:"thumbnail_url"`
 	IsPublic     bool      `json:"is_public"`
 	ViewCount    int       `json:"view_count"`
+	Status       string    `json:"status"`
+	StorageTier  string    `json:"storage_tier"`
+	Version      int       `json:"version"`
 	UserID       uuid.UUID `json:"user_id"`
 	CreatedAt    string    `json:"created_at"`
+	models.MediaInfo
 }
 
 func (h *MediaHandler) UploadMedia(c *gin.Context) {
@@ -64,6 +141,12 @@ func (h *MediaHandler) UploadMedia(c *gin.Context) {
 		return
 	}
 
+	// Refuse before the body is read when its length is known. Part of it
+	// is form fields, so the file itself is checked again below.
+	if c.Request.ContentLength > 0 && !checkQuota(c, h.quotas, user, max(c.Request.ContentLength-formFieldsAllowance, 0), 1) {
+		return
+	}
+
 	var req UploadMediaRequest
 	if err := c.ShouldBind(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -77,22 +160,12 @@ func (h *MediaHandler) UploadMedia(c *gin.Context) {
 	}
 
 	// Validate file type
-	allowedTypes := []string{".mp3", ".mp4", ".wav", ".avi", ".mov", ".mkv"}
 	ext := strings.ToLower(filepath.Ext(file.Filename))
-	isAllowed := false
-	for _, allowedType := range allowedTypes {
-		if ext == allowedType {
-			isAllowed = true
-			break
-		}
-	}
-	if !isAllowed {
+	if !isAllowedMediaType(ext) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "File type not allowed"})
 		return
 	}
 
-	filename := fmt.Sprintf("%s/%s", user.ID.String(), file.Filename)
-
 	src, err := file.Open()
 	if err != nil {
 		fmt.Println("Failed to open file", err)
@@ -101,39 +174,139 @@ func (h *MediaHandler) UploadMedia(c *gin.Context) {
 	}
 	defer src.Close()
 
+	// The form file is already buffered by the server, so hash it before
+	// uploading and skip the upload entirely when the content is stored
+	hash := sha256.New()
+	size, err := io.Copy(hash, src)
+	if err != nil {
+		fmt.Println("Failed to read file", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	if !checkQuota(c, h.quotas, user, size, 1) {
+		return
+	}
+
+	// Probe before storing, so a rejected file is never uploaded
+	probe, ok := h.probeUpload(c, src)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
 	contentType := file.Header.Get("Content-Type")
-	storageURL, err := h.storageProvider.UploadFile(src, filename, contentType)
+	mediaID := uuid.New()
+	blob := models.Blob{
+		Checksum:    hex.EncodeToString(hash.Sum(nil)),
+		Size:        size,
+		ContentType: contentType,
+	}
+
+	key := h.storageProvider.ObjectKey(storage.KeyParams{
+		UserID:   user.ID.String(),
+		MediaID:  mediaID.String(),
+		Checksum: blob.Checksum,
+		Filename: file.Filename,
+	})
+
+	err = h.blobs.Put(ctx, user.ID, &blob, key, func(key string) error {
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		_, err := h.storageProvider.UploadFile(ctx, src, key, contentType)
+		return err
+	})
 	if err != nil {
 		fmt.Println("Failed to upload file", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload file"})
 		return
 	}
 
+	storageURL, err := h.storageProvider.GetFileURL(ctx, blob.Filename)
+	if err != nil {
+		h.blobs.ReleaseDetached(ctx, blob.Filename)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload file"})
+		return
+	}
+
 	// Create media record
 	media := models.Media{
+		ID:          mediaID,
 		Title:       req.Title,
 		Description: req.Description,
-		Filename:    filename,
-		FileSize:    file.Size,
+		Filename:    blob.Filename,
+		FileSize:    size,
+		Checksum:    blob.Checksum,
 		FileType:    strings.TrimPrefix(ext, "."),
 		Genre:       req.Genre,
 		Tags:        req.Tags,
 		StorageURL:  storageURL,
 		UserID:      user.ID,
-		IsPublic:    req.IsPublic,
+		IsPublic:    req.IsPublic == nil || *req.IsPublic,
+		StorageTier: h.blobs.Tier(ctx, blob.Filename),
+	}
+	if probe != nil {
+		probe.Apply(&media)
 	}
 
-	if err := h.db.Create(&media).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save media record"})
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := h.quotas.Reserve(tx, user, size, 1); err != nil {
+			return err
+		}
+		if err := tx.Create(&media).Error; err != nil {
+			return err
+		}
+		return h.jobs.Process(ctx, tx, &media)
+	})
+	if err != nil {
+		h.blobs.ReleaseDetached(ctx, blob.Filename)
+		respondQuotaError(c, err, "Failed to save media record")
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Media uploaded successfully",
-		"media":   h.toMediaResponse(&media),
+		"media":   h.toMediaResponse(c, &media),
 	})
 }
 
+// probeUpload inspects an uploaded file, responding and returning false when
+// it is rejected. The result is nil when the file was not probed, or is left
+// for a job to probe.
+func (h *MediaHandler) probeUpload(c *gin.Context, file io.ReadSeeker) (*service.ProbeResult, bool) {
+	if h.probes.Deferred() {
+		return nil, true
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		fmt.Println("Failed to read file", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return nil, false
+	}
+
+	probe, err := h.probes.Probe(c.Request.Context(), file)
+	if errors.Is(err, service.ErrCorruptMedia) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if err != nil {
+		fmt.Println("Failed to probe file", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to probe file"})
+		return nil, false
+	}
+	return probe, true
+}
+
+// processMedia queues the probing, thumbnails and packaging of the current
+// file of a media. A failure is only logged, the media is usable without
+// them.
+func (h *MediaHandler) processMedia(c *gin.Context, media *models.Media) {
+	if err := h.jobs.Process(c.Request.Context(), nil, media); err != nil {
+		fmt.Println("Failed to queue media processing", err)
+	}
+}
+
 func (h *MediaHandler) GetMedia(c *gin.Context) {
 	mediaID := c.Param("id")
 	id, err := uuid.Parse(mediaID)
@@ -143,16 +316,19 @@ func (h *MediaHandler) GetMedia(c *gin.Context) {
 	}
 
 	var media models.Media
-	if err := h.db.Preload("User").Where("id = ?", id).First(&media).Error; err != nil {
+	if err := h.db.Preload("User").Where("id = ? AND status = ?", id, models.MediaReady).First(&media).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": service.ErrMediaNotFound.Error()})
 		return
 	}
 
 	// Increment view count
-	h.db.Model(&media).Update("view_count", media.ViewCount+1)
+	h.db.Model(&media).Updates(map[string]interface{}{
+		"view_count":     media.ViewCount + 1,
+		"last_viewed_at": time.Now(),
+	})
 
 	c.JSON(http.StatusOK, gin.H{
-		"media": h.toMediaResponse(&media),
+		"media": h.toMediaResponse(c, &media),
 	})
 }
 
@@ -163,7 +339,7 @@ func (h *MediaHandler) ListMedia(c *gin.Context) {
 	search := c.Query("search")
 
 	offset := (page - 1) * limit
-	query := h.db.Model(&models.Media{}).Preload("User").Where("is_public = ?", true)
+	query := h.db.Model(&models.Media{}).Preload("User").Where("is_public = ? AND status = ?", true, models.MediaReady)
 
 	if genre != "" {
 		query = query.Where("genre = ?", genre)
@@ -185,7 +361,7 @@ func (h *MediaHandler) ListMedia(c *gin.Context) {
 
 	var response []MediaResponse
 	for _, m := range media {
-		response = append(response, h.toMediaResponse(&m))
+		response = append(response, h.toMediaResponse(c, &m))
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -198,6 +374,9 @@ func (h *MediaHandler) ListMedia(c *gin.Context) {
 	})
 }
 
+// GetStreamURL hands out the URL to play a media in the format asked for
+// with ?format=hls|dash|progressive, adaptive streaming by default once the
+// media is packaged. Every format it can be played in is listed alongside.
 func (h *MediaHandler) GetStreamURL(c *gin.Context) {
 	mediaID := c.Param("id")
 	id, err := uuid.Parse(mediaID)
@@ -206,25 +385,210 @@ func (h *MediaHandler) GetStreamURL(c *gin.Context) {
 		return
 	}
 
+	format := c.Query("format")
+	if format != "" && format != FormatHLS && format != FormatDASH && format != FormatProgressive {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format, must be hls, dash or progressive"})
+		return
+	}
+
 	var media models.Media
-	if err := h.db.Where("id = ?", id).First(&media).Error; err != nil {
+	if err := h.db.Where("id = ? AND status = ?", id, models.MediaReady).First(&media).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": service.ErrMediaNotFound.Error()})
 		return
 	}
 
-	// Generate presigned URL for streaming (1 hour expiry)
-	streamURL, err := h.storageProvider.GeneratePresignedURL(media.Filename, 3600)
+	// The links handed out below are signed, so only those who may read the
+	// media get them
+	if !h.authorizeMedia(c, &media, c.Query("expires"), c.Query("signature")) {
+		return
+	}
+
+	h.db.Model(&media).UpdateColumn("last_viewed_at", time.Now())
+
+	pkg, err := h.packages.Ready(c.Request.Context(), &media)
 	if err != nil {
+		fmt.Println("Failed to find stream package", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate stream URL"})
 		return
 	}
+	if format == "" {
+		format = FormatProgressive
+		if pkg != nil {
+			format = FormatHLS
+		}
+	}
+
+	formats, err := h.streamFormats(c, &media, pkg, format)
+	if err != nil {
+		fmt.Println("Failed to generate stream URL", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate stream URL"})
+		return
+	}
+
+	streamURL := ""
+	for _, available := range formats {
+		if available.Format == format {
+			streamURL = available.URL
+		}
+	}
+
+	// Cold media may have to be restored before it can be read. Packages
+	// always stay hot.
+	if streamURL == "" && format == FormatProgressive {
+		ready, err := h.lifecycle.Warm(c.Request.Context(), &media)
+		if err != nil {
+			fmt.Println("Failed to restore media from cold storage", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore media from cold storage"})
+			return
+		}
+		if !ready {
+			c.Header("Retry-After", strconv.Itoa(h.cfg.Lifecycle.RetryAfter))
+			c.JSON(http.StatusAccepted, gin.H{
+				"status":      models.TierWarming,
+				"retry_after": h.cfg.Lifecycle.RetryAfter,
+				"formats":     formats,
+				"media":       h.toMediaResponse(c, &media),
+			})
+			return
+		}
+
+		streamURL, err = h.progressiveURL(c, &media, true)
+		if err != nil {
+			fmt.Println("Failed to generate stream URL", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate stream URL"})
+			return
+		}
+		formats = append(formats, StreamFormat{Format: FormatProgressive, URL: streamURL})
+	}
+
+	if streamURL == "" {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Stream format not available",
+			"formats": formats,
+		})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"stream_url": streamURL,
-		"media":      h.toMediaResponse(&media),
+		"format":     format,
+		"formats":    formats,
+		"media":      h.toMediaResponse(c, &media),
 	})
 }
 
+// StreamMedia proxies a media object from storage. Range, If-Range, HEAD and
+// conditional requests are handled by http.ServeContent, which reads only the
+// requested bytes from the provider.
+// Private media are only served through a signed link or to their owner.
+func (h *MediaHandler) StreamMedia(c *gin.Context) {
+	mediaID := c.Param("id")
+	id, err := uuid.Parse(mediaID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid media ID"})
+		return
+	}
+
+	var media models.Media
+	if err := h.db.Where("id = ? AND status = ?", id, models.MediaReady).First(&media).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": service.ErrMediaNotFound.Error()})
+		return
+	}
+
+	if !h.authorizeMedia(c, &media, c.Query("expires"), c.Query("signature")) {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	ready, err := h.lifecycle.Warm(ctx, &media)
+	if err != nil {
+		fmt.Println("Failed to restore media from cold storage", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore media from cold storage"})
+		return
+	}
+	if !ready {
+		c.Header("Retry-After", strconv.Itoa(h.cfg.Lifecycle.RetryAfter))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Media is being restored from cold storage"})
+		return
+	}
+
+	info, err := h.storageProvider.Stat(ctx, media.Filename)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Media file not found in storage"})
+			return
+		}
+		fmt.Println("Failed to stat media file", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read media file"})
+		return
+	}
+
+	reader := h.storageProvider.NewObjectReader(ctx, media.Filename, info.Size)
+	defer reader.Close()
+
+	contentType := info.ContentType
+	if contentType == "" || contentType == "application/octet-stream" {
+		if byExt := mime.TypeByExtension("." + media.FileType); byExt != "" {
+			contentType = byExt
+		}
+	}
+	if contentType != "" {
+		c.Header("Content-Type", contentType)
+	}
+	if info.ETag != "" {
+		c.Header("ETag", quoteETag(info.ETag))
+	}
+
+	http.ServeContent(c.Writer, c.Request, "", info.LastModified, reader)
+}
+
+// signedMediaQuery returns the query of a link to the files of a private
+// media. Like a presigned URL it expires, once the media has had time to play
+// from the start. Public media need none and get nil.
+func (h *MediaHandler) signedMediaQuery(media *models.Media) url.Values {
+	if media.IsPublic {
+		return nil
+	}
+
+	expires := time.Now().Add(time.Duration(3600+media.Duration) * time.Second).Unix()
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", service.SignMediaAccess(media.ID, expires, h.cfg.JWT))
+	return query
+}
+
+// authorizeMedia responds and returns false when the request may not read the
+// files of a media. Private media need a signed link or the owner's token.
+func (h *MediaHandler) authorizeMedia(c *gin.Context, media *models.Media, expires string, signature string) bool {
+	if media.IsPublic {
+		return true
+	}
+
+	if expires != "" || signature != "" {
+		err := service.VerifyMediaAccess(media.ID, expires, signature, h.cfg.JWT)
+		if errors.Is(err, storage.ErrURLExpired) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "URL has expired"})
+			return false
+		}
+		if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid signature"})
+			return false
+		}
+		return true
+	}
+
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		claims, err := service.ValidateToken(token, h.cfg.JWT)
+		if err == nil && claims.UserID == media.UserID.String() {
+			return true
+		}
+	}
+
+	c.JSON(http.StatusForbidden, gin.H{"error": service.ErrAccessDenied.Error()})
+	return false
+}
+
 func (h *MediaHandler) DeleteMedia(c *gin.Context) {
 	user := middleware.GetCurrentUser(c)
 	if user == nil {
@@ -245,15 +609,22 @@ func (h *MediaHandler) DeleteMedia(c *gin.Context) {
 		return
 	}
 
-	// Delete from cloud storage
-	if err := h.storageProvider.DeleteFile(media.Filename); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file from storage"})
+	if media.Status == models.MediaPending {
+		h.deleteDirectUpload(c, &media)
 		return
 	}
 
-	// Delete from database
-	if err := h.db.Delete(&media).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete media record"})
+	// Storage is released by a worker, with a job queued with the deletion
+	// so it is never lost or run for a media that was not deleted
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&media).Error; err != nil {
+			return err
+		}
+		return h.jobs.Cleanup(c.Request.Context(), tx, &media)
+	})
+	if err != nil {
+		fmt.Println("Failed to delete media", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete media"})
 		return
 	}
 
@@ -262,22 +633,70 @@ func (h *MediaHandler) DeleteMedia(c *gin.Context) {
 	})
 }
 
-func (h *MediaHandler) toMediaResponse(media *models.Media) MediaResponse {
+func (h *MediaHandler) toMediaResponse(c *gin.Context, media *models.Media) MediaResponse {
+	// Older records hold the backend URL of the image. Every selected
+	// thumbnail is served by the same route, which checks access; the links
+	// from the thumbnail listing are signed for private media.
+	thumbnailURL := ""
+	if media.ThumbnailURL != "" {
+		thumbnailURL = requestBaseURL(c) + service.ThumbnailPath(media.ID)
+	}
+
 	return MediaResponse{
 		ID:           media.ID,
 		Title:        media.Title,
 		Description:  media.Description,
 		Filename:     media.Filename,
 		FileSize:     media.FileSize,
+		Checksum:     media.Checksum,
 		FileType:     media.FileType,
 		Genre:        media.Genre,
 		Tags:         media.Tags,
 		Duration:     media.Duration,
 		StorageURL:   media.StorageURL,
-		ThumbnailURL: media.ThumbnailURL,
+		ThumbnailURL: thumbnailURL,
 		IsPublic:     media.IsPublic,
 		ViewCount:    media.ViewCount,
+		Status:       media.Status,
+		StorageTier:  media.StorageTier,
+		Version:      media.Version,
 		UserID:       media.UserID,
 		CreatedAt:    media.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		MediaInfo:    media.MediaInfo,
+	}
+}
+
+// requestBaseURL returns the scheme and host the client used to reach us.
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// quoteETag makes sure an entity tag is quoted as HTTP requires; not every
+// backend returns it that way.
+func quoteETag(etag string) string {
+	if strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/"`) {
+		return etag
+	}
+	return `"` + etag + `"`
+}
+
+// lock takes the lock on the file of a media, held while a direct upload
+// completes or the file is replaced. It responds and returns false when the
+// lock could not be taken.
+func (h *MediaHandler) lock(c *gin.Context, id uuid.UUID) (unlock func(), ok bool) {
+	unlock, ok, err := h.locks.TryLock(c.Request.Context(), "media", id)
+	if err != nil {
+		fmt.Println("Failed to lock media", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lock media"})
+		return nil, false
+	}
+	if !ok {
+		c.JSON(http.StatusLocked, gin.H{"error": "Media file is already being changed"})
+		return nil, false
 	}
+	return unlock, true
 }
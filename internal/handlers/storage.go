@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// StorageHandler exposes storage operations state to operators.
+type StorageHandler struct {
+	db *gorm.DB
+}
+
+func NewStorageHandler(db *gorm.DB) *StorageHandler {
+	return &StorageHandler{
+		db: db,
+	}
+}
+
+// ListReplicas lists mirror copies, optionally filtered by status, so lagging
+// or failed copies can be spotted. It is for admins: the object keys of every
+// user are listed.
+func (h *StorageHandler) ListReplicas(c *gin.Context) {
+	page, limit, offset := pagination(c, 50)
+	status := c.Query("status")
+	backend := c.Query("backend")
+
+	query := h.db.Model(&models.Replica{})
+
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if backend != "" {
+		query = query.Where("backend = ?", backend)
+	}
+
+	var replicas []models.Replica
+	var total int64
+
+	query.Count(&total)
+	if err := query.Offset(offset).Limit(limit).Order("updated_at ASC").Find(&replicas).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch replicas"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"replicas": replicas,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
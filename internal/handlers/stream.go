@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// Formats a media can be streamed in.
+const (
+	FormatHLS         = "hls"
+	FormatDASH        = "dash"
+	FormatProgressive = "progressive"
+)
+
+// StreamFormat is one way to play a media, with the URL of its manifest, or
+// of the file itself for progressive streaming.
+type StreamFormat struct {
+	Format string `json:"format"`
+	URL    string `json:"url"`
+}
+
+// streamFormats lists the formats a media can be played in right away,
+// adaptive ones first. Only the chosen format gets CDN signed cookies, since
+// a response can set one of them.
+func (h *MediaHandler) streamFormats(c *gin.Context, media *models.Media, pkg *models.StreamPackage, chosen string) ([]StreamFormat, error) {
+	formats := []StreamFormat{}
+
+	if pkg != nil {
+		adaptive := []string{FormatHLS}
+		if pkg.Dash {
+			adaptive = append(adaptive, FormatDASH)
+		}
+		for _, format := range adaptive {
+			manifestURL, err := h.manifestURL(c, media, pkg, format, format == chosen)
+			if err != nil {
+				return nil, err
+			}
+			formats = append(formats, StreamFormat{Format: format, URL: manifestURL})
+		}
+	}
+
+	// Cold media is listed once it can be read, asking for it restores it
+	if media.StorageTier == models.TierHot || media.StorageTier == "" {
+		fileURL, err := h.progressiveURL(c, media, chosen == FormatProgressive)
+		if err != nil {
+			return nil, err
+		}
+		formats = append(formats, StreamFormat{Format: FormatProgressive, URL: fileURL})
+	}
+
+	return formats, nil
+}
+
+// manifestURL returns the URL of the HLS master playlist or DASH manifest of a
+// package. With CDN signed cookies they are fetched from the CDN, the cookies
+// covering every object of the package; otherwise they are read through the
+// server, which signs the segment URLs in them.
+func (h *MediaHandler) manifestURL(c *gin.Context, media *models.Media, pkg *models.StreamPackage, format string, cookies bool) (string, error) {
+	name := service.MasterPlaylist
+	if format == FormatDASH {
+		name = service.DashManifest
+	}
+
+	if cdn := h.storageProvider.CDN(); cookies && h.cfg.Stream.Mode == "cdn" && cdn != nil && cdn.SignedCookies() {
+		return h.cdnCookieURL(c, pkg.Prefix, pkg.Prefix+name)
+	}
+	if query := h.signedMediaQuery(media); query != nil {
+		return fmt.Sprintf("%s/api/v1/media/%s/%s/signed/%s/%s/%s", requestBaseURL(c), media.ID, format, query.Get("expires"), query.Get("signature"), name), nil
+	}
+	return fmt.Sprintf("%s/api/v1/media/%s/%s/%s", requestBaseURL(c), media.ID, format, name), nil
+}
+
+// progressiveURL returns the URL of the media file itself, the way the stream
+// mode hands it out.
+func (h *MediaHandler) progressiveURL(c *gin.Context, media *models.Media, cookies bool) (string, error) {
+	// In proxy mode the server streams the bytes itself and the bucket stays private
+	if h.cfg.Stream.Mode == "proxy" {
+		contentURL := fmt.Sprintf("%s/api/v1/media/%s/content", requestBaseURL(c), media.ID)
+		if query := h.signedMediaQuery(media); query != nil {
+			contentURL += "?" + query.Encode()
+		}
+		return contentURL, nil
+	}
+
+	// The CDN fronts the backend, but not a cold provider still holding the object
+	if h.cfg.Stream.Mode == "cdn" && (h.storageProvider.Tiering() == nil || media.StorageTier == models.TierHot) {
+		cdn := h.storageProvider.CDN()
+		if cdn == nil {
+			return "", errors.New("no CDN configured")
+		}
+		if cookies && cdn.SignedCookies() {
+			return h.cdnCookieURL(c, media.Filename, media.Filename)
+		}
+		return cdn.SignURL(media.Filename, c.ClientIP())
+	}
+
+	// Presigned URL for streaming (1 hour expiry)
+	return h.storageProvider.GeneratePresignedURL(c.Request.Context(), media.Filename, 3600)
+}
+
+// cdnCookieURL sets signed cookies granting access to every object under
+// prefix and returns the plain CDN URL of key.
+func (h *MediaHandler) cdnCookieURL(c *gin.Context, prefix string, key string) (string, error) {
+	cdn := h.storageProvider.CDN()
+	cookies, err := cdn.SignCookies(prefix, c.ClientIP())
+	if err != nil {
+		return "", err
+	}
+	for _, cookie := range cookies {
+		http.SetCookie(c.Writer, cookie)
+	}
+	return cdn.URL(key), nil
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/middleware"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/service"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxThumbnailSize bounds a thumbnail uploaded by a host.
+const maxThumbnailSize = 10 << 20
+
+// ThumbnailResponse describes one candidate thumbnail of a media, with a URL
+// for each of its sizes.
+type ThumbnailResponse struct {
+	Candidate int             `json:"candidate"`
+	Offset    float64         `json:"offset"`
+	Custom    bool            `json:"custom"`
+	Selected  bool            `json:"selected"`
+	Sizes     []ThumbnailSize `json:"sizes"`
+}
+
+type ThumbnailSize struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	URL    string `json:"url"`
+}
+
+type SelectThumbnailRequest struct {
+	Candidate int `json:"candidate" binding:"required,min=1"`
+}
+
+// ListThumbnails lists the candidate thumbnails of a media.
+func (h *MediaHandler) ListThumbnails(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": service.ErrUnauthorized.Error()})
+		return
+	}
+
+	media, ok := h.findOwnMedia(c, user)
+	if !ok {
+		return
+	}
+
+	thumbnails, err := h.thumbnails.List(c.Request.Context(), media.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list thumbnails"})
+		return
+	}
+
+	// Sizes of a candidate are listed together, narrowest first
+	responses := []ThumbnailResponse{}
+	for _, thumbnail := range thumbnails {
+		if len(responses) == 0 || responses[len(responses)-1].Candidate != thumbnail.Candidate {
+			responses = append(responses, ThumbnailResponse{
+				Candidate: thumbnail.Candidate,
+				Offset:    thumbnail.Offset,
+				Custom:    thumbnail.Custom,
+				Selected:  thumbnail.Selected,
+			})
+		}
+
+		query := h.signedMediaQuery(media)
+		if query == nil {
+			query = url.Values{}
+		}
+		query.Set("candidate", strconv.Itoa(thumbnail.Candidate))
+		query.Set("width", strconv.Itoa(thumbnail.Width))
+
+		response := &responses[len(responses)-1]
+		response.Sizes = append(response.Sizes, ThumbnailSize{
+			Width:  thumbnail.Width,
+			Height: thumbnail.Height,
+			URL:    fmt.Sprintf("%s/api/v1/media/%s/thumbnail?%s", requestBaseURL(c), media.ID, query.Encode()),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"thumbnails": responses,
+	})
+}
+
+// UploadThumbnail stores an image of the host's choosing as the thumbnail of
+// a media.
+func (h *MediaHandler) UploadThumbnail(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": service.ErrUnauthorized.Error()})
+		return
+	}
+
+	media, ok := h.findOwnMedia(c, user)
+	if !ok {
+		return
+	}
+	if media.Status == models.MediaPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Media upload has not completed"})
+		return
+	}
+
+	if c.Request.ContentLength > maxThumbnailSize+formFieldsAllowance {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Thumbnail is too large"})
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is required"})
+		return
+	}
+	if file.Size > maxThumbnailSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Thumbnail is too large"})
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		fmt.Println("Failed to open file", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file"})
+		return
+	}
+	defer src.Close()
+
+	if err := h.thumbnails.AddCustom(c.Request.Context(), media, src); err != nil {
+		respondThumbnailError(c, err, "Failed to store thumbnail")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Thumbnail uploaded successfully",
+		"media":   h.toMediaResponse(c, media),
+	})
+}
+
+// SelectThumbnail makes one of the candidates the thumbnail of a media.
+func (h *MediaHandler) SelectThumbnail(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": service.ErrUnauthorized.Error()})
+		return
+	}
+
+	media, ok := h.findOwnMedia(c, user)
+	if !ok {
+		return
+	}
+
+	var req SelectThumbnailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.thumbnails.Select(c.Request.Context(), media, req.Candidate); err != nil {
+		respondThumbnailError(c, err, "Failed to select thumbnail")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Thumbnail selected successfully",
+		"media":   h.toMediaResponse(c, media),
+	})
+}
+
+// ServeThumbnail sends the selected thumbnail of a media, or the candidate
+// in the query, in the size closest to the requested width. Thumbnails are
+// read through the server so they work with a private bucket. Those of a
+// private media need a signed link or the owner's token.
+func (h *MediaHandler) ServeThumbnail(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid media ID"})
+		return
+	}
+
+	candidate, _ := strconv.Atoi(c.Query("candidate"))
+	width, _ := strconv.Atoi(c.Query("width"))
+
+	var media models.Media
+	if err := h.db.Where("id = ? AND status = ?", id, models.MediaReady).First(&media).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": service.ErrMediaNotFound.Error()})
+		return
+	}
+
+	if !h.authorizeMedia(c, &media, c.Query("expires"), c.Query("signature")) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	thumbnail, err := h.thumbnails.Find(ctx, media.ID, candidate, width)
+	if err != nil {
+		respondThumbnailError(c, err, "Failed to find thumbnail")
+		return
+	}
+
+	info, err := h.storageProvider.Stat(ctx, thumbnail.Filename)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": service.ErrThumbnailNotFound.Error()})
+			return
+		}
+		fmt.Println("Failed to stat thumbnail", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read thumbnail"})
+		return
+	}
+
+	reader := h.storageProvider.NewObjectReader(ctx, thumbnail.Filename, info.Size)
+	defer reader.Close()
+
+	// A candidate never changes, unlike which one is selected
+	if candidate > 0 && media.IsPublic {
+		c.Header("Cache-Control", "public, max-age=86400")
+	} else if candidate > 0 {
+		c.Header("Cache-Control", "private, max-age=86400")
+	}
+	if info.ContentType != "" {
+		c.Header("Content-Type", info.ContentType)
+	}
+	if info.ETag != "" {
+		c.Header("ETag", quoteETag(info.ETag))
+	}
+
+	http.ServeContent(c.Writer, c.Request, thumbnail.Filename, info.LastModified, reader)
+}
+
+func respondThumbnailError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrMediaNotFound), errors.Is(err, service.ErrThumbnailNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidImage):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		fmt.Println(message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
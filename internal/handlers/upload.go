@@ -0,0 +1,713 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/interfaces"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/middleware"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/service"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	tusVersion     = "1.0.0"
+	tusExtensions  = "creation,termination"
+	tusContentType = "application/offset+octet-stream"
+
+	// minPartSize is the smallest part S3 accepts for all but the last part.
+	minPartSize = 5 << 20
+)
+
+// UploadHandler implements the tus 1.0 resumable upload protocol. Chunks are
+// staged on local disk until a full part is available, then streamed into the
+// storage backend as a multipart upload under a temporary key. A part whose
+// staged chunks are not on this server is sent again from its start. The content is
+// hashed as it arrives; once the final chunk lands the object moves to its
+// content-addressed key, or is dropped in favour of an existing copy, and the
+// Media record is created.
+type UploadHandler struct {
+	db              *gorm.DB
+	cfg             *config.Config
+	storageProvider *storage.StorageProvider
+	blobs           *service.BlobStore
+	quotas          *service.QuotaService
+	probes          *service.ProbeService
+	jobs            *service.MediaJobs
+	locks           *service.Locker
+}
+
+func NewUploadHandler(db *gorm.DB, cfg *config.Config, storageProvider *storage.StorageProvider) *UploadHandler {
+	return &UploadHandler{
+		db:              db,
+		cfg:             cfg,
+		storageProvider: storageProvider,
+		blobs:           service.NewBlobStore(db, storageProvider),
+		quotas:          service.NewQuotaService(db, cfg.Quota),
+		probes:          service.NewProbeService(storageProvider, cfg.Process),
+		jobs:            service.NewMediaJobs(db, storageProvider, cfg),
+		locks:           service.NewLocker(db),
+	}
+}
+
+// Options answers tus discovery requests.
+func (h *UploadHandler) Options(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	if h.cfg.Upload.MaxSize > 0 {
+		c.Header("Tus-Max-Size", strconv.FormatInt(h.cfg.Upload.MaxSize, 10))
+	}
+}
+
+// CreateUpload handles the tus creation extension.
+func (h *UploadHandler) CreateUpload(c *gin.Context) {
+	if !h.checkTusResumable(c) {
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": service.ErrUnauthorized.Error()})
+		return
+	}
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Length must be a positive integer"})
+		return
+	}
+
+	if h.cfg.Upload.MaxSize > 0 && length > h.cfg.Upload.MaxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Upload exceeds maximum size"})
+		return
+	}
+
+	if !checkQuota(c, h.quotas, user, length, 1) {
+		return
+	}
+
+	metadata, err := parseUploadMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Upload-Metadata"})
+		return
+	}
+
+	if metadata["filename"] == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "filename metadata is required"})
+		return
+	}
+	originalName := filepath.Base(metadata["filename"])
+
+	ext := strings.ToLower(filepath.Ext(originalName))
+	if !isAllowedMediaType(ext) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File type not allowed"})
+		return
+	}
+
+	if metadata["title"] == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "title metadata is required"})
+		return
+	}
+
+	contentType := metadata["filetype"]
+	if contentType == "" {
+		contentType = mime.TypeByExtension(ext)
+	}
+
+	uploadID := uuid.New()
+	filename := "uploads/" + uploadID.String()
+
+	multipartID, err := h.storageProvider.CreateMultipartUpload(c.Request.Context(), filename, contentType)
+	if err != nil {
+		if errors.Is(err, storage.ErrMultipartNotSupported) {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		}
+		fmt.Println("Failed to create multipart upload", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload"})
+		return
+	}
+
+	isPublic := true
+	if value, ok := metadata["is_public"]; ok {
+		isPublic, _ = strconv.ParseBool(value)
+	}
+
+	upload := models.Upload{
+		ID:           uploadID,
+		UserID:       user.ID,
+		Filename:     filename,
+		OriginalName: originalName,
+		ContentType:  contentType,
+		Length:       length,
+		MultipartID:  multipartID,
+		Title:        metadata["title"],
+		Description:  metadata["description"],
+		Genre:        metadata["genre"],
+		Tags:         metadata["tags"],
+		IsPublic:     isPublic,
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := h.quotas.Reserve(tx, user, length, 1); err != nil {
+			return err
+		}
+		return tx.Create(&upload).Error
+	})
+	if err != nil {
+		h.storageProvider.AbortMultipartUpload(c.Request.Context(), filename, multipartID)
+		respondQuotaError(c, err, "Failed to save upload record")
+		return
+	}
+
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+upload.ID.String())
+	c.Status(http.StatusCreated)
+}
+
+// GetUploadOffset reports how many bytes of an upload the server has.
+func (h *UploadHandler) GetUploadOffset(c *gin.Context) {
+	if !h.checkTusResumable(c) {
+		return
+	}
+
+	upload, ok := h.findUpload(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.MediaID != nil {
+		c.Header("X-Media-ID", upload.MediaID.String())
+	}
+	c.Status(http.StatusOK)
+}
+
+// PatchUpload appends a chunk at the current offset.
+func (h *UploadHandler) PatchUpload(c *gin.Context) {
+	if !h.checkTusResumable(c) {
+		return
+	}
+
+	if c.GetHeader("Content-Type") != tusContentType {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be " + tusContentType})
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Offset must be a non-negative integer"})
+		return
+	}
+
+	upload, ok := h.findUpload(c)
+	if !ok {
+		return
+	}
+
+	unlock, ok := h.lock(c, upload.ID)
+	if !ok {
+		return
+	}
+	defer unlock()
+
+	// Reload under the lock so the offset reflects any request that just finished
+	upload, ok = h.findUpload(c)
+	if !ok {
+		return
+	}
+
+	if upload.MediaID == nil && !upload.Completed {
+		if err := h.checkStaging(upload); err != nil {
+			fmt.Println("Failed to check upload staging", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write upload chunk"})
+			return
+		}
+	}
+
+	if offset != upload.Offset {
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload-Offset does not match current offset"})
+		return
+	}
+
+	if upload.MediaID == nil {
+		err := h.appendChunk(c, upload)
+		if errors.Is(err, service.ErrCorruptMedia) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			fmt.Println("Failed to write upload chunk", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write upload chunk"})
+			return
+		}
+	}
+
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	if upload.MediaID != nil {
+		c.Header("X-Media-ID", upload.MediaID.String())
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// TerminateUpload handles the tus termination extension.
+func (h *UploadHandler) TerminateUpload(c *gin.Context) {
+	if !h.checkTusResumable(c) {
+		return
+	}
+
+	upload, ok := h.findUpload(c)
+	if !ok {
+		return
+	}
+
+	unlock, ok := h.lock(c, upload.ID)
+	if !ok {
+		return
+	}
+	defer unlock()
+
+	if upload.MediaID == nil {
+		if err := h.abortUpload(c.Request.Context(), upload); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to abort upload"})
+			return
+		}
+	}
+
+	h.removeStaging(upload.ID)
+
+	if err := h.db.Select("Parts").Delete(upload).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete upload record"})
+		return
+	}
+
+	c.Header("Tus-Resumable", tusVersion)
+	c.Status(http.StatusNoContent)
+}
+
+// appendChunk streams the request body into the staging file, flushing a part
+// to the backend each time a full part has accumulated, and completes the
+// upload once every byte has arrived.
+func (h *UploadHandler) appendChunk(c *gin.Context, upload *models.Upload) error {
+	ctx := c.Request.Context()
+	partSize := h.partSize()
+
+	if err := os.MkdirAll(h.cfg.Upload.StagingDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create staging directory: %w", err)
+	}
+
+	staging, err := h.openStaging(upload)
+	if err != nil {
+		return err
+	}
+	defer func() { staging.Close() }()
+
+	// Drop anything written after the last recorded offset, e.g. by a request
+	// that died before it could save its progress.
+	pending := upload.Offset - uploadedBytes(upload)
+	if err := staging.Truncate(pending); err != nil {
+		return fmt.Errorf("failed to truncate staging file: %w", err)
+	}
+	if _, err := staging.Seek(pending, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek staging file: %w", err)
+	}
+
+	hash := sha256.New()
+	if len(upload.HashState) > 0 {
+		if err := hash.(encoding.BinaryUnmarshaler).UnmarshalBinary(upload.HashState); err != nil {
+			return fmt.Errorf("failed to restore upload checksum: %w", err)
+		}
+	}
+
+	body := io.LimitReader(c.Request.Body, upload.Length-upload.Offset)
+	var readErr error
+	for {
+		n, err := io.CopyN(io.MultiWriter(staging, hash), body, partSize-pending)
+		pending += n
+		upload.Offset += n
+		state, marshalErr := hash.(encoding.BinaryMarshaler).MarshalBinary()
+		if marshalErr != nil {
+			return fmt.Errorf("failed to save upload checksum: %w", marshalErr)
+		}
+		upload.HashState = state
+
+		if pending == partSize {
+			if err := h.flushPart(c, upload, staging, pending); err != nil {
+				return err
+			}
+			next, openErr := h.openStaging(upload)
+			if openErr != nil {
+				return openErr
+			}
+			staging = next
+			pending = 0
+		}
+
+		if err != nil {
+			if err != io.EOF {
+				readErr = err
+			}
+			break
+		}
+	}
+
+	if err := h.saveProgress(h.db, upload); err != nil {
+		return fmt.Errorf("failed to save upload offset: %w", err)
+	}
+
+	if readErr != nil {
+		// The client went away; what we have is saved and can be resumed
+		return nil
+	}
+
+	if upload.Offset < upload.Length {
+		return nil
+	}
+
+	if pending > 0 {
+		if err := h.flushPart(c, upload, staging, pending); err != nil {
+			return err
+		}
+	}
+
+	// A multipart upload can only be completed once, so a request retrying
+	// one that failed after this point carries on from the assembled object
+	if !upload.Completed {
+		parts := make([]interfaces.CompletedPart, len(upload.Parts))
+		for i, part := range upload.Parts {
+			parts[i] = interfaces.CompletedPart{PartNumber: part.PartNumber, ETag: part.ETag}
+		}
+
+		if _, err := h.storageProvider.CompleteMultipartUpload(ctx, upload.Filename, upload.MultipartID, upload.ContentType, parts); err != nil {
+			return err
+		}
+
+		upload.Completed = true
+		if err := h.db.Model(upload).Update("completed", true).Error; err != nil {
+			return fmt.Errorf("failed to save upload completion: %w", err)
+		}
+	}
+
+	// A corrupt file cannot be resumed into a valid one, so the upload ends.
+	// A deferred probe is left to a job.
+	var probe *service.ProbeResult
+	if !h.probes.Deferred() {
+		probe, err = h.probes.ProbeObject(ctx, upload.Filename)
+		if errors.Is(err, service.ErrCorruptMedia) {
+			h.discardUpload(ctx, upload)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	mediaID := uuid.New()
+	blob := models.Blob{
+		Checksum:    hex.EncodeToString(hash.Sum(nil)),
+		Size:        upload.Length,
+		ContentType: upload.ContentType,
+	}
+
+	key := h.storageProvider.ObjectKey(storage.KeyParams{
+		UserID:   upload.UserID.String(),
+		MediaID:  mediaID.String(),
+		Checksum: blob.Checksum,
+		Filename: upload.OriginalName,
+	})
+
+	err = h.blobs.Put(ctx, upload.UserID, &blob, key, func(key string) error {
+		return h.storageProvider.Copy(ctx, upload.Filename, key)
+	})
+	if err != nil {
+		return err
+	}
+
+	storageURL, err := h.storageProvider.GetFileURL(ctx, blob.Filename)
+	if err != nil {
+		h.blobs.ReleaseDetached(ctx, blob.Filename)
+		return err
+	}
+
+	media := models.Media{
+		ID:          mediaID,
+		Title:       upload.Title,
+		Description: upload.Description,
+		Filename:    blob.Filename,
+		FileSize:    upload.Length,
+		Checksum:    blob.Checksum,
+		FileType:    strings.TrimPrefix(strings.ToLower(filepath.Ext(upload.OriginalName)), "."),
+		Genre:       upload.Genre,
+		Tags:        upload.Tags,
+		StorageURL:  storageURL,
+		UserID:      upload.UserID,
+		IsPublic:    upload.IsPublic,
+		StorageTier: h.blobs.Tier(ctx, blob.Filename),
+	}
+	if probe != nil {
+		probe.Apply(&media)
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&media).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(upload).Update("media_id", media.ID).Error; err != nil {
+			return err
+		}
+		return h.jobs.Process(ctx, tx, &media)
+	})
+	if err != nil {
+		h.blobs.ReleaseDetached(ctx, blob.Filename)
+		return fmt.Errorf("failed to save media record: %w", err)
+	}
+
+	upload.MediaID = &media.ID
+
+	// The temporary object is either copied or a duplicate by now. It is
+	// kept until the media is saved, for a retry to copy it again.
+	if err := h.storageProvider.DeleteFile(ctx, upload.Filename); err != nil {
+		fmt.Println("Failed to delete temporary upload object", err)
+	}
+	staging.Close()
+	h.removeStaging(upload.ID)
+
+	return nil
+}
+
+// discardUpload deletes a completed upload whose file was rejected.
+func (h *UploadHandler) discardUpload(ctx context.Context, upload *models.Upload) {
+	if err := h.storageProvider.DeleteFile(ctx, upload.Filename); err != nil {
+		fmt.Println("Failed to delete rejected upload object", err)
+	}
+	h.removeStaging(upload.ID)
+
+	if err := h.db.Select("Parts").Delete(upload).Error; err != nil {
+		fmt.Println("Failed to delete upload record", err)
+	}
+}
+
+// flushPart uploads the first size bytes of the staging file as the next part
+// and removes the staging file. The part keeps the checksum state at its end,
+// so the upload can be rewound to it.
+func (h *UploadHandler) flushPart(c *gin.Context, upload *models.Upload, staging *os.File, size int64) error {
+	partNumber := len(upload.Parts) + 1
+
+	etag, err := h.storageProvider.UploadPart(c.Request.Context(), upload.Filename, upload.MultipartID, partNumber, io.NewSectionReader(staging, 0, size), size)
+	if err != nil {
+		return err
+	}
+
+	part := models.UploadPart{
+		UploadID:   upload.ID,
+		PartNumber: partNumber,
+		ETag:       etag,
+		Size:       size,
+		HashState:  upload.HashState,
+	}
+
+	// Record the part and the offset together so a crash can never leave the
+	// staging file out of step with the database.
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&part).Error; err != nil {
+			return err
+		}
+		return h.saveProgress(tx, upload)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save upload part: %w", err)
+	}
+	upload.Parts = append(upload.Parts, part)
+
+	staging.Close()
+	os.Remove(staging.Name())
+
+	return nil
+}
+
+// checkStaging makes sure the staging file on this server holds every byte
+// received since the last part. When it does not, because the chunks went to
+// another server or the file was cleaned up, the upload is rewound to the end
+// of the last part and the client sends the rest again.
+func (h *UploadHandler) checkStaging(upload *models.Upload) error {
+	pending := upload.Offset - uploadedBytes(upload)
+	if pending == 0 {
+		return nil
+	}
+
+	info, err := os.Stat(h.stagingPath(upload))
+	if err == nil && info.Size() >= pending {
+		return nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read staging file: %w", err)
+	}
+
+	var state []byte
+	if len(upload.Parts) > 0 {
+		state = upload.Parts[len(upload.Parts)-1].HashState
+		if state == nil {
+			return errors.New("staged chunks are missing and the last part has no checksum state to rewind to")
+		}
+	}
+
+	fmt.Printf("Upload %s: %d staged bytes are not on this server, rewinding to the last part\n", upload.ID, pending)
+	upload.Offset -= pending
+	upload.HashState = state
+	return h.saveProgress(h.db, upload)
+}
+
+// saveProgress records the offset together with the checksum state of the
+// bytes before it.
+func (h *UploadHandler) saveProgress(tx *gorm.DB, upload *models.Upload) error {
+	return tx.Model(upload).Select("offset", "hash_state").Updates(upload).Error
+}
+
+func (h *UploadHandler) findUpload(c *gin.Context) (*models.Upload, bool) {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": service.ErrUnauthorized.Error()})
+		return nil, false
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return nil, false
+	}
+
+	var upload models.Upload
+	err = h.db.Preload("Parts", func(db *gorm.DB) *gorm.DB {
+		return db.Order("part_number")
+	}).Where("id = ? AND user_id = ?", id, user.ID).First(&upload).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return nil, false
+	}
+
+	return &upload, true
+}
+
+func (h *UploadHandler) checkTusResumable(c *gin.Context) bool {
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Unsupported tus version"})
+		return false
+	}
+	return true
+}
+
+// lock keeps other requests for the upload out, on this replica or another,
+// until unlock is called. It answers the request itself when it fails.
+func (h *UploadHandler) lock(c *gin.Context, id uuid.UUID) (unlock func(), ok bool) {
+	unlock, ok, err := h.locks.TryLock(c.Request.Context(), "upload", id)
+	if err != nil {
+		fmt.Println("Failed to lock upload", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lock upload"})
+		return nil, false
+	}
+	if !ok {
+		c.JSON(http.StatusLocked, gin.H{"error": "Upload is already in progress"})
+		return nil, false
+	}
+	return unlock, true
+}
+
+func (h *UploadHandler) partSize() int64 {
+	if h.cfg.Upload.PartSize < minPartSize {
+		return minPartSize
+	}
+	return h.cfg.Upload.PartSize
+}
+
+// abortUpload drops what the backend holds of an unfinished upload.
+func (h *UploadHandler) abortUpload(ctx context.Context, upload *models.Upload) error {
+	if !upload.Completed {
+		return h.storageProvider.AbortMultipartUpload(ctx, upload.Filename, upload.MultipartID)
+	}
+	err := h.storageProvider.DeleteFile(ctx, upload.Filename)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return nil
+	}
+	return err
+}
+
+// openStaging opens the staging file of the part upload is filling.
+func (h *UploadHandler) openStaging(upload *models.Upload) (*os.File, error) {
+	staging, err := os.OpenFile(h.stagingPath(upload), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open staging file: %w", err)
+	}
+	return staging, nil
+}
+
+// stagingPath names the staging file after the upload and the part it fills,
+// so chunks staged for one part are never taken for those of another.
+func (h *UploadHandler) stagingPath(upload *models.Upload) string {
+	return filepath.Join(h.cfg.Upload.StagingDir, fmt.Sprintf("%s.%d", upload.ID, len(upload.Parts)+1))
+}
+
+// removeStaging removes every staging file of the upload with id.
+func (h *UploadHandler) removeStaging(id uuid.UUID) {
+	files, _ := filepath.Glob(filepath.Join(h.cfg.Upload.StagingDir, id.String()+".*"))
+	for _, file := range files {
+		os.Remove(file)
+	}
+}
+
+func uploadedBytes(upload *models.Upload) int64 {
+	var total int64
+	for _, part := range upload.Parts {
+		total += part.Size
+	}
+	return total
+}
+
+// parseUploadMetadata decodes a tus Upload-Metadata header: comma-separated
+// pairs of a key and an optional base64-encoded value.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		switch len(fields) {
+		case 1:
+			metadata[fields[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, err
+			}
+			metadata[fields[0]] = string(value)
+		default:
+			return nil, fmt.Errorf("invalid metadata pair: %q", pair)
+		}
+	}
+
+	return metadata, nil
+}
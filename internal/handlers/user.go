@@ -15,14 +15,16 @@ import (
 )
 
 type UserHandler struct {
-	db  *gorm.DB
-	cfg *config.Config
+	db     *gorm.DB
+	cfg    *config.Config
+	quotas *service.QuotaService
 }
 
 func NewUserHandler(db *gorm.DB, cfg *config.Config) *UserHandler {
 	return &UserHandler{
-		db:  db,
-		cfg: cfg,
+		db:     db,
+		cfg:    cfg,
+		quotas: service.NewQuotaService(db, cfg.Quota),
 	}
 }
 
@@ -35,9 +37,17 @@ type UserResponse struct {
 	ID        uuid.UUID `json:"id"`
 	Username  string    `json:"username"`
 	Email     string    `json:"email"`
+	IsAdmin   bool      `json:"is_admin"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// SetQuotaRequest replaces a user's quota. A missing or null field restores
+// the configured default, 0 removes the limit.
+type SetQuotaRequest struct {
+	QuotaBytes *int64 `json:"quota_bytes" binding:"omitempty,gte=0"`
+	QuotaFiles *int64 `json:"quota_files" binding:"omitempty,gte=0"`
+}
+
 func (h *UserHandler) Login(c *gin.Context) {
 	var req LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -69,6 +79,7 @@ func (h *UserHandler) Login(c *gin.Context) {
 			ID:        user.ID,
 			Username:  user.Username,
 			Email:     user.Email,
+			IsAdmin:   user.IsAdmin,
 			CreatedAt: user.CreatedAt,
 		},
 	})
@@ -86,6 +97,7 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 			ID:        user.ID,
 			Username:  user.Username,
 			Email:     user.Email,
+			IsAdmin:   user.IsAdmin,
 			CreatedAt: user.CreatedAt,
 		},
 	})
@@ -127,7 +139,111 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 			ID:        user.ID,
 			Username:  user.Username,
 			Email:     user.Email,
+			IsAdmin:   user.IsAdmin,
 			CreatedAt: user.CreatedAt,
 		},
 	})
 }
+
+// GetUsage reports the storage used by the current user and their quota.
+func (h *UserHandler) GetUsage(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	usage, err := h.quotas.Usage(c.Request.Context(), user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute storage usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"usage": usage})
+}
+
+// ListUsers lists every user with their quota overrides (admin only).
+func (h *UserHandler) ListUsers(c *gin.Context) {
+	page, limit, offset := pagination(c, 50)
+	query := h.db.Model(&models.User{})
+
+	var users []models.User
+	var total int64
+
+	query.Count(&total)
+	if err := query.Offset(offset).Limit(limit).Order("created_at ASC").Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users": users,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// GetUserUsage reports the storage used by any user (admin only).
+func (h *UserHandler) GetUserUsage(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+
+	usage, err := h.quotas.Usage(c.Request.Context(), user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute storage usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"usage": usage})
+}
+
+// SetUserQuota overrides the default quota of a user (admin only). Media
+// already stored are kept when the new quota is below the usage.
+func (h *UserHandler) SetUserQuota(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+
+	var req SetQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.db.Model(user).Updates(map[string]interface{}{
+		"quota_bytes": req.QuotaBytes,
+		"quota_files": req.QuotaFiles,
+	}).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update quota"})
+		return
+	}
+	user.QuotaBytes = req.QuotaBytes
+	user.QuotaFiles = req.QuotaFiles
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Quota updated successfully",
+		"quota":   h.quotas.Quota(user),
+	})
+}
+
+func (h *UserHandler) findUser(c *gin.Context) (*models.User, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+
+	var user models.User
+	if err := h.db.Where("id = ?", id).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": service.ErrUserNotFound.Error()})
+		return nil, false
+	}
+	return &user, true
+}
@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/middleware"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/service"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// VersionResponse describes one file of a media. ReplacedAt is empty for the
+// current file.
+type VersionResponse struct {
+	Version     int    `json:"version"`
+	Current     bool   `json:"current"`
+	FileSize    int64  `json:"file_size"`
+	Checksum    string `json:"checksum"`
+	FileType    string `json:"file_type"`
+	Duration    int    `json:"duration"`
+	StorageTier string `json:"storage_tier"`
+	ReplacedAt  string `json:"replaced_at,omitempty"`
+	models.MediaInfo
+}
+
+// ReplaceMediaFile uploads a new file for a media. The media keeps its ID,
+// stats and activity; the file it had becomes a prior version.
+func (h *MediaHandler) ReplaceMediaFile(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": service.ErrUnauthorized.Error()})
+		return
+	}
+
+	media, ok := h.findOwnMedia(c, user)
+	if !ok {
+		return
+	}
+	if media.Status == models.MediaPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Media upload has not completed"})
+		return
+	}
+
+	unlock, ok := h.lock(c, media.ID)
+	if !ok {
+		return
+	}
+	defer unlock()
+
+	// A replacement adds bytes but no file
+	if c.Request.ContentLength > 0 && !checkQuota(c, h.quotas, user, max(c.Request.ContentLength-formFieldsAllowance, 0), 0) {
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is required"})
+		return
+	}
+
+	ext := strings.ToLower(filepath.Ext(file.Filename))
+	if !isAllowedMediaType(ext) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File type not allowed"})
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		fmt.Println("Failed to open file", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file"})
+		return
+	}
+	defer src.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, src)
+	if err != nil {
+		fmt.Println("Failed to read file", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	if !checkQuota(c, h.quotas, user, size, 0) {
+		return
+	}
+
+	probe, ok := h.probeUpload(c, src)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	version, err := h.versions.Next(ctx, media)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replace media file"})
+		return
+	}
+
+	contentType := file.Header.Get("Content-Type")
+	blob := models.Blob{
+		Checksum:    hex.EncodeToString(hash.Sum(nil)),
+		Size:        size,
+		ContentType: contentType,
+	}
+
+	key := h.storageProvider.ObjectKey(storage.KeyParams{
+		UserID:   user.ID.String(),
+		MediaID:  media.ID.String(),
+		Checksum: blob.Checksum,
+		Filename: file.Filename,
+		Version:  version,
+	})
+
+	err = h.blobs.Put(ctx, user.ID, &blob, key, func(key string) error {
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		_, err := h.storageProvider.UploadFile(ctx, src, key, contentType)
+		return err
+	})
+	if err != nil {
+		fmt.Println("Failed to upload file", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload file"})
+		return
+	}
+
+	storageURL, err := h.storageProvider.GetFileURL(ctx, blob.Filename)
+	if err != nil {
+		h.blobs.ReleaseDetached(ctx, blob.Filename)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload file"})
+		return
+	}
+
+	newFile := service.MediaFile{
+		Filename:    blob.Filename,
+		FileSize:    size,
+		Checksum:    blob.Checksum,
+		FileType:    strings.TrimPrefix(ext, "."),
+		StorageURL:  storageURL,
+		StorageTier: h.blobs.Tier(ctx, blob.Filename),
+	}
+	if probe != nil {
+		newFile.Duration = probe.Duration
+		newFile.Info = probe.Info
+	}
+
+	updated, err := h.versions.Replace(ctx, media.ID.String(), newFile, version, func(tx *gorm.DB) error {
+		return h.quotas.Reserve(tx, user, size, 0)
+	})
+	if err != nil {
+		h.blobs.ReleaseDetached(ctx, blob.Filename)
+		respondVersionError(c, err, "Failed to replace media file")
+		return
+	}
+
+	// Frames of the old file no longer show what the media is
+	h.processMedia(c, updated)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Media file replaced successfully",
+		"media":   h.toMediaResponse(c, updated),
+	})
+}
+
+// ListVersions lists the current and prior files of a media, newest first.
+func (h *MediaHandler) ListVersions(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": service.ErrUnauthorized.Error()})
+		return
+	}
+
+	media, ok := h.findOwnMedia(c, user)
+	if !ok {
+		return
+	}
+
+	versions, err := h.versions.List(c.Request.Context(), media.ID.String())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list versions"})
+		return
+	}
+
+	responses := []VersionResponse{}
+	if media.Status != models.MediaPending {
+		responses = append(responses, VersionResponse{
+			Version:     max(media.Version, 1),
+			Current:     true,
+			FileSize:    media.FileSize,
+			Checksum:    media.Checksum,
+			FileType:    media.FileType,
+			Duration:    media.Duration,
+			StorageTier: media.StorageTier,
+			MediaInfo:   media.MediaInfo,
+		})
+	}
+	for _, version := range versions {
+		responses = append(responses, VersionResponse{
+			Version:     version.Version,
+			FileSize:    version.FileSize,
+			Checksum:    version.Checksum,
+			FileType:    version.FileType,
+			Duration:    version.Duration,
+			StorageTier: version.StorageTier,
+			ReplacedAt:  version.CreatedAt.Format("2006-01-02T15:04:05Z"),
+			MediaInfo:   version.MediaInfo,
+		})
+	}
+
+	// A rollback can make an older version current
+	sort.Slice(responses, func(i, j int) bool { return responses[i].Version > responses[j].Version })
+
+	c.JSON(http.StatusOK, gin.H{
+		"versions": responses,
+	})
+}
+
+// RollbackVersion makes a prior version the current file again.
+func (h *MediaHandler) RollbackVersion(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": service.ErrUnauthorized.Error()})
+		return
+	}
+
+	media, ok := h.findOwnMedia(c, user)
+	if !ok {
+		return
+	}
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return
+	}
+
+	updated, err := h.versions.Rollback(c.Request.Context(), media.ID.String(), version)
+	if err != nil {
+		respondVersionError(c, err, "Failed to roll back media file")
+		return
+	}
+
+	h.processMedia(c, updated)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("Media rolled back to version %d", version),
+		"media":   h.toMediaResponse(c, updated),
+	})
+}
+
+// DeleteVersion removes a prior version, freeing its storage.
+func (h *MediaHandler) DeleteVersion(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": service.ErrUnauthorized.Error()})
+		return
+	}
+
+	media, ok := h.findOwnMedia(c, user)
+	if !ok {
+		return
+	}
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return
+	}
+
+	if err := h.versions.Delete(c.Request.Context(), media.ID.String(), version); err != nil {
+		respondVersionError(c, err, "Failed to delete version")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Version deleted successfully",
+	})
+}
+
+// findOwnMedia loads the media in the :id parameter if it belongs to user,
+// responding otherwise.
+func (h *MediaHandler) findOwnMedia(c *gin.Context, user *models.User) (*models.Media, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid media ID"})
+		return nil, false
+	}
+
+	var media models.Media
+	if err := h.db.Where("id = ? AND user_id = ?", id, user.ID).First(&media).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": service.ErrMediaNotFound.Error()})
+		return nil, false
+	}
+	return &media, true
+}
+
+func respondVersionError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrMediaNotFound), errors.Is(err, service.ErrVersionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrVersionConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrQuotaExceeded):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	default:
+		fmt.Println(message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,32 @@
+package interfaces
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrKeyNotFound is returned by a KeyStore that holds no key for a filename.
+var ErrKeyNotFound = errors.New("data key not found")
+
+// ObjectKey is the wrapped data key of one encrypted object.
+type ObjectKey struct {
+	Filename   string
+	KeyID      string // master key the data key is wrapped with
+	WrappedKey []byte
+	ChunkSize  int
+	Format     int // 0 for objects written before chunks and keys were bound
+	// PartSize and LastPart track a multipart upload while it is pending
+	PartSize int64
+	LastPart int
+}
+
+// KeyStore persists wrapped data keys apart from the objects, so master keys
+// can be rotated without rewriting any media.
+type KeyStore interface {
+	SaveKey(ctx context.Context, key ObjectKey) error
+	FindKey(ctx context.Context, filename string) (*ObjectKey, error)
+	DeleteKey(ctx context.Context, filename string) error
+	// FindKeysNotWrappedWith returns up to limit keys wrapped with any master
+	// key other than keyID.
+	FindKeysNotWrappedWith(ctx context.Context, keyID string, limit int) ([]ObjectKey, error)
+}
@@ -1,12 +1,96 @@
 package interfaces
 
 import (
+	"context"
 	"io"
+	"time"
 )
 
+// Provider is implemented by every storage backend. Each method takes the
+// caller's context so cancellation, deadlines and tracing reach the backend.
 type Provider interface {
-	UploadFile(file io.Reader, filename string, contentType string) (string, error)
-	DeleteFile(filename string) error
-	GetFileURL(filename string) (string, error)
-	GeneratePresignedURL(filename string, expiresIn int64) (string, error)
+	UploadFile(ctx context.Context, file io.Reader, filename string, contentType string) (string, error)
+	DeleteFile(ctx context.Context, filename string) error
+	GetFileURL(ctx context.Context, filename string) (string, error)
+	GeneratePresignedURL(ctx context.Context, filename string, expiresIn int64) (string, error)
+	Stat(ctx context.Context, filename string) (*ObjectInfo, error)
+	// Open reads length bytes starting at offset; a negative length reads to
+	// the end of the object.
+	Open(ctx context.Context, filename string, offset int64, length int64) (io.ReadCloser, error)
+	// List returns up to limit objects whose keys start with prefix, in key
+	// order. An empty token starts from the beginning; pass the NextToken of
+	// the previous page to continue.
+	List(ctx context.Context, prefix string, token string, limit int) (*ObjectPage, error)
+	// Copy duplicates an object under a new key, inside the backend where it
+	// can.
+	Copy(ctx context.Context, src string, dst string) error
+}
+
+// CompletedPart identifies a part previously stored with UploadPart.
+type CompletedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+// MultipartUploader is implemented by backends that can assemble an object
+// from parts uploaded in separate calls. Part numbers start at 1 and every
+// part except the last must be at least 5 MiB.
+type MultipartUploader interface {
+	CreateMultipartUpload(ctx context.Context, filename string, contentType string) (string, error)
+	UploadPart(ctx context.Context, filename string, uploadID string, partNumber int, part io.ReadSeeker, size int64) (string, error)
+	CompleteMultipartUpload(ctx context.Context, filename string, uploadID string, contentType string, parts []CompletedPart) (string, error)
+	AbortMultipartUpload(ctx context.Context, filename string, uploadID string) error
+}
+
+// PresignedRequest is a request a client can make to the backend without
+// further credentials.
+type PresignedRequest struct {
+	Method  string
+	URL     string
+	Headers map[string]string // headers the client must send as given
+}
+
+// PresignedUploader is implemented by backends that let clients upload
+// objects straight to storage, without the bytes passing through the server.
+type PresignedUploader interface {
+	// PresignUpload returns a request that stores a whole object in one PUT.
+	PresignUpload(ctx context.Context, filename string, contentType string, expiresIn int64) (*PresignedRequest, error)
+	// PresignUploadPart returns a request that stores one part of a multipart
+	// upload started with CreateMultipartUpload. The ETag header of the
+	// response identifies the part when the upload is completed.
+	PresignUploadPart(ctx context.Context, filename string, uploadID string, partNumber int, expiresIn int64) (*PresignedRequest, error)
+}
+
+// StorageClasser is implemented by backends that can move an object to a
+// cheaper storage class in place.
+type StorageClasser interface {
+	// SetStorageClass rewrites an object under class. An empty class is the
+	// backend's default, hot class.
+	SetStorageClass(ctx context.Context, filename string, class string) error
+	// Restore starts making an archived object readable, keeping it readable
+	// for at least days days where the backend restores a temporary copy. It
+	// reports whether the object can be read now.
+	Restore(ctx context.Context, filename string, days int) (bool, error)
+}
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+// ObjectSummary is one entry of an object listing.
+type ObjectSummary struct {
+	Key          string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+}
+
+// ObjectPage is one page of a listing. NextToken is empty on the last page.
+type ObjectPage struct {
+	Objects   []ObjectSummary
+	NextToken string
 }
@@ -0,0 +1,32 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+)
+
+// Replica statuses recorded by a ReplicaTracker.
+const (
+	ReplicaPending  = "pending"
+	ReplicaSynced   = "synced"
+	ReplicaFailed   = "failed"
+	ReplicaDeleting = "deleting"
+)
+
+// ReplicaState is the replication state of one object on one secondary backend.
+type ReplicaState struct {
+	Filename  string
+	Backend   string
+	Status    string
+	Attempts  int
+	LastError string
+	UpdatedAt time.Time
+}
+
+// ReplicaTracker persists replication state so lagging copies can be queried
+// and retried after a restart.
+type ReplicaTracker interface {
+	SaveReplica(ctx context.Context, state ReplicaState) error
+	DeleteReplica(ctx context.Context, filename string, backend string) error
+	FindReplicas(ctx context.Context, statuses ...string) ([]ReplicaState, error)
+}
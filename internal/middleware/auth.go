@@ -49,6 +49,19 @@ func AuthMiddleware(cfg config.JWTConfig, db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
+// AdminMiddleware lets only admins through. It runs after AuthMiddleware.
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := GetCurrentUser(c)
+		if user == nil || !user.IsAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": service.ErrAccessDenied.Error()})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 func GetCurrentUser(c *gin.Context) *models.User {
 	user, exists := c.Get("user")
 	if !exists {
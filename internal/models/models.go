@@ -8,35 +8,295 @@ import (
 )
 
 type User struct {
+	ID         uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Username   string    `json:"username" gorm:"unique;not null"`
+	Email      string    `json:"email" gorm:"unique;not null"`
+	Password   string    `json:"-" gorm:"not null"`
+	IsAdmin    bool      `json:"is_admin" gorm:"not null;default:false"`
+	QuotaBytes *int64    `json:"quota_bytes,omitempty"` // set by an admin, nil uses the default, 0 is unlimited
+	QuotaFiles *int64    `json:"quota_files,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Media      []Media   `json:"media,omitempty" gorm:"foreignKey:UserID"`
+}
+
+type Media struct {
+	ID           uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Title        string     `json:"title" gorm:"not null"`
+	Description  string     `json:"description"`
+	Filename     string     `json:"filename" gorm:"not null"`
+	FileSize     int64      `json:"file_size"`
+	Checksum     string     `json:"checksum" gorm:"index"`     // hex SHA-256 of the content, empty for legacy uploads
+	FileType     string     `json:"file_type" gorm:"not null"` // "mp3", "mp4", etc.
+	Genre        string     `json:"genre"`
+	Tags         string     `json:"tags"`     // comma-separated tags
+	Duration     int        `json:"duration"` // in seconds
+	StorageURL   string     `json:"storage_url" gorm:"not null"`
+	ThumbnailURL string     `json:"thumbnail_url"`
+	UserID       uuid.UUID  `json:"user_id" gorm:"type:uuid;not null"`
+	User         User       `json:"user,omitempty"`
+	IsPublic     bool       `json:"is_public"` // a default would make GORM drop an explicit false
+	ViewCount    int        `json:"view_count" gorm:"default:0"`
+	Status       string     `json:"status" gorm:"not null;default:ready;index"`     // MediaPending, MediaReady or MediaMissing
+	StorageTier  string     `json:"storage_tier" gorm:"not null;default:hot;index"` // TierHot, TierCold or TierWarming
+	Version      int        `json:"version" gorm:"not null;default:1"`              // number of the current file, see MediaVersion
+	LastViewedAt *time.Time `json:"last_viewed_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	MediaInfo
+}
+
+// MediaInfo is what probing a file with ffprobe found out about it, besides
+// its duration. Media uploaded while probing was off have an empty
+// ProbeStatus and zero values.
+type MediaInfo struct {
+	Container     string  `json:"container"` // ffprobe format name, e.g. "mov,mp4,m4a,3gp,3g2,mj2"
+	VideoCodec    string  `json:"video_codec"`
+	AudioCodec    string  `json:"audio_codec"`
+	Bitrate       int64   `json:"bitrate"` // bits per second
+	Width         int     `json:"width"`
+	Height        int     `json:"height"`
+	FrameRate     float64 `json:"frame_rate"`
+	Channels      int     `json:"channels"`
+	ChannelLayout string  `json:"channel_layout"` // e.g. "stereo", "5.1"
+	ProbeStatus   string  `json:"probe_status"`   // ProbeOK or ProbeCorrupt
+}
+
+const (
+	ProbeOK = "ok"
+	// ProbeCorrupt is a file ffprobe could not read as audio or video, kept
+	// because corrupt files are flagged rather than rejected.
+	ProbeCorrupt = "corrupt"
+)
+
+const (
+	// MediaPending is a media record waiting for its file to be uploaded
+	// straight to storage.
+	MediaPending = "pending"
+	MediaReady   = "ready"
+	// MediaMissing is a media record whose object could not be found in
+	// storage. It is hidden until the object is back.
+	MediaMissing = "missing"
+)
+
+const (
+	TierHot = "hot"
+	// TierCold is media whose object was moved to the cold storage class or
+	// provider. It may have to be restored before it can be streamed.
+	TierCold = "cold"
+	// TierWarming is cold media that was requested and is on its way back to
+	// the hot tier.
+	TierWarming = "warming"
+)
+
+// MediaVersion is a file a Media had before it was replaced. It keeps its
+// reference on the blob, so the object stays in storage and the media can be
+// rolled back to it.
+type MediaVersion struct {
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	MediaID     uuid.UUID `json:"media_id" gorm:"type:uuid;not null;uniqueIndex:idx_media_version"`
+	Version     int       `json:"version" gorm:"not null;uniqueIndex:idx_media_version"`
+	Filename    string    `json:"filename" gorm:"not null;index"`
+	FileSize    int64     `json:"file_size"`
+	Checksum    string    `json:"checksum" gorm:"index"`
+	FileType    string    `json:"file_type" gorm:"not null"`
+	Duration    int       `json:"duration"`
+	StorageURL  string    `json:"storage_url" gorm:"not null"`
+	StorageTier string    `json:"storage_tier" gorm:"not null;default:hot"`
+	CreatedAt   time.Time `json:"created_at"` // when the file was replaced
+	MediaInfo
+}
+
+// Thumbnail is a still image of a video in one size. A candidate is one
+// frame, stored in every configured width; the host picks which candidate
+// the media shows, which its ThumbnailURL serves.
+type Thumbnail struct {
 	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	Username  string    `json:"username" gorm:"unique;not null"`
-	Email     string    `json:"email" gorm:"unique;not null"`
-	Password  string    `json:"-" gorm:"not null"`
+	MediaID   uuid.UUID `json:"media_id" gorm:"type:uuid;not null;uniqueIndex:idx_thumbnail_size"`
+	Candidate int       `json:"candidate" gorm:"not null;uniqueIndex:idx_thumbnail_size"` // numbers are not reused
+	Width     int       `json:"width" gorm:"not null;uniqueIndex:idx_thumbnail_size"`     // of the stored image, frames are not scaled up
+	Height    int       `json:"height"`
+	Offset    float64   `json:"offset"`                         // seconds into the video the frame was looked for at
+	Custom    bool      `json:"custom" gorm:"not null"`         // uploaded by the host rather than generated
+	Selected  bool      `json:"selected" gorm:"not null"`       // shown for the media
+	Filename  string    `json:"filename" gorm:"not null;index"` // object key
+	Size      int64     `json:"size"`
 	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Media     []Media   `json:"media,omitempty" gorm:"foreignKey:UserID"`
 }
 
-type Media struct {
-	ID           uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	Title        string    `json:"title" gorm:"not null"`
-	Description  string    `json:"description"`
-	Filename     string    `json:"filename" gorm:"not null"`
-	FileSize     int64     `json:"file_size"`
-	FileType     string    `json:"file_type" gorm:"not null"` // "mp3", "mp4", etc.
-	Genre        string    `json:"genre"`
-	Tags         string    `json:"tags"`     // comma-separated tags
-	Duration     int       `json:"duration"` // in seconds
-	StorageURL   string    `json:"storage_url" gorm:"not null"`
-	ThumbnailURL string    `json:"thumbnail_url"`
-	UserID       uuid.UUID `json:"user_id" gorm:"type:uuid;not null"`
-	User         User      `json:"user,omitempty"`
-	IsPublic     bool      `json:"is_public" gorm:"default:true"`
-	ViewCount    int       `json:"view_count" gorm:"default:0"`
+// StreamPackage is the HLS version of the current file of a media: a master
+// playlist, a media playlist per rendition and their segments, stored under
+// Prefix. fMP4 packages also have a DASH manifest. It is made by
+// cmd/worker and replaced when the file changes.
+type StreamPackage struct {
+	ID            uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	MediaID       uuid.UUID `json:"media_id" gorm:"type:uuid;not null;uniqueIndex"`
+	Version       int       `json:"version" gorm:"not null"`            // media file version it is made from
+	Status        string    `json:"status" gorm:"not null;index"`       // PackagePending, PackageProcessing, PackageReady or PackageFailed
+	Prefix        string    `json:"prefix" gorm:"not null"`             // object key prefix, e.g. "streams/{media_id}/v1/"
+	SegmentFormat string    `json:"segment_format"`                     // "fmp4" or "ts"
+	Renditions    string    `json:"renditions"`                         // comma-separated names, e.g. "720p,480p"
+	Dash          bool      `json:"dash" gorm:"not null;default:false"` // whether a DASH manifest shares the fMP4 segments
+	Attempts      int       `json:"attempts" gorm:"not null;default:0"` // failed runs
+	LastError     string    `json:"last_error"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+const (
+	PackagePending    = "pending"
+	PackageProcessing = "processing"
+	PackageReady      = "ready"
+	// PackageFailed is a package that could not be made. It is retried until
+	// it runs out of attempts; the media streams progressively meanwhile.
+	PackageFailed = "failed"
+)
+
+// Job is a unit of background work, such as generating thumbnails for a
+// media, run by cmd/worker. Workers lease due jobs with FOR UPDATE SKIP
+// LOCKED, so each is run by one worker at a time.
+type Job struct {
+	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Type        string     `json:"type" gorm:"not null;index"`
+	Payload     string     `json:"payload" gorm:"type:text;not null"`                                // JSON
+	Status      string     `json:"status" gorm:"not null;index:idx_jobs_due,priority:1"`             // JobPending, JobRunning, JobSucceeded or JobDead
+	Priority    int        `json:"priority" gorm:"not null;default:0;index:idx_jobs_due,priority:2"` // higher runs first
+	RunAt       time.Time  `json:"run_at" gorm:"not null;index:idx_jobs_due,priority:3"`             // not before, pushed back after a failure
+	Attempts    int        `json:"attempts" gorm:"not null;default:0"`
+	MaxAttempts int        `json:"max_attempts" gorm:"not null"`
+	LockedBy    string     `json:"locked_by"`    // worker running the job
+	LockedUntil *time.Time `json:"locked_until"` // lease; an expired one is taken over
+	LastError   string     `json:"last_error"`
+	FinishedAt  *time.Time `json:"finished_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	// JobDead is a job that failed on every attempt. It stays until an admin
+	// retries it.
+	JobDead = "dead"
+)
+
+// DirectUpload holds what is needed to verify and finish a pending Media whose
+// file the client uploads straight to the storage backend.
+type DirectUpload struct {
+	MediaID      uuid.UUID `json:"media_id" gorm:"type:uuid;primary_key"`
+	Filename     string    `json:"filename" gorm:"not null"` // temporary object key
+	OriginalName string    `json:"original_name" gorm:"not null"`
+	ContentType  string    `json:"content_type" gorm:"not null"`
+	Size         int64     `json:"size" gorm:"not null"`
+	MultipartID  string    `json:"-"` // empty when the file is sent in one PUT
+	PartSize     int64     `json:"part_size"`
+	Status       string    `json:"status" gorm:"not null;default:uploading"` // DirectUploadSending, DirectUploadVerifying or DirectUploadRejected
+	Error        string    `json:"error,omitempty"`                          // why the last completed file was rejected
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
 
+const (
+	DirectUploadSending = "uploading"
+	// DirectUploadVerifying is a completed upload whose file a job is
+	// checking before the media becomes ready.
+	DirectUploadVerifying = "verifying"
+	// DirectUploadRejected is an upload whose file failed verification. The
+	// client may upload it again.
+	DirectUploadRejected = "rejected"
+)
+
+// Upload tracks a resumable (tus) upload until its final chunk lands and it
+// becomes a Media record.
+type Upload struct {
+	ID           uuid.UUID    `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID       uuid.UUID    `json:"user_id" gorm:"type:uuid;not null;index"`
+	Filename     string       `json:"filename" gorm:"not null"` // temporary object key
+	OriginalName string       `json:"original_name" gorm:"not null"`
+	ContentType  string       `json:"content_type"`
+	Length       int64        `json:"length" gorm:"not null"`
+	Offset       int64        `json:"offset" gorm:"not null;default:0"`
+	MultipartID  string       `json:"-" gorm:"not null"` // backend multipart upload ID
+	HashState    []byte       `json:"-"`                 // SHA-256 state of the bytes up to Offset
+	Title        string       `json:"title" gorm:"not null"`
+	Description  string       `json:"description"`
+	Genre        string       `json:"genre"`
+	Tags         string       `json:"tags"`
+	IsPublic     bool         `json:"is_public"`
+	Completed    bool         `json:"-" gorm:"not null;default:false"`     // the multipart upload is assembled under Filename
+	MediaID      *uuid.UUID   `json:"media_id,omitempty" gorm:"type:uuid"` // set once completed
+	Parts        []UploadPart `json:"-" gorm:"foreignKey:UploadID;constraint:OnDelete:CASCADE"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+}
+
+// UploadPart is a chunk of an Upload that has been stored in the backend.
+type UploadPart struct {
+	ID         uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UploadID   uuid.UUID `json:"upload_id" gorm:"type:uuid;not null;uniqueIndex:idx_upload_part"`
+	PartNumber int       `json:"part_number" gorm:"not null;uniqueIndex:idx_upload_part"`
+	ETag       string    `json:"etag" gorm:"not null"`
+	Size       int64     `json:"size" gorm:"not null"`
+	HashState  []byte    `json:"-"` // SHA-256 state of the upload up to the end of this part
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Blob is a content-addressed object shared by every Media with the same
+// checksum. It is removed from storage when RefCount drops to zero.
+type Blob struct {
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Scope       string    `json:"scope" gorm:"not null;default:'';uniqueIndex:idx_blobs_scope_checksum"` // owner under per-user key schemes
+	Checksum    string    `json:"checksum" gorm:"not null;uniqueIndex:idx_blobs_scope_checksum"`         // hex SHA-256
+	Filename    string    `json:"filename" gorm:"not null;index"`                                        // object key
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	RefCount    int       `json:"ref_count" gorm:"not null;default:0"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Replica records the state of one copy of an object on a mirror backend.
+type Replica struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Filename  string    `json:"filename" gorm:"not null;uniqueIndex:idx_replica_object"`
+	Backend   string    `json:"backend" gorm:"not null;uniqueIndex:idx_replica_object"`
+	Status    string    `json:"status" gorm:"not null;index"` // "pending", "synced", "failed", "deleting"
+	Attempts  int       `json:"attempts" gorm:"default:0"`
+	LastError string    `json:"last_error"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// MigrationObject records the progress of copying one object between storage
+// providers, so an interrupted migration resumes where it stopped.
+type MigrationObject struct {
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Filename    string    `json:"filename" gorm:"not null;uniqueIndex:idx_migration_object"`
+	Source      string    `json:"source" gorm:"not null;uniqueIndex:idx_migration_object"`
+	Destination string    `json:"destination" gorm:"not null;uniqueIndex:idx_migration_object"`
+	Status      string    `json:"status" gorm:"not null;index"` // "verified", "failed"
+	Size        int64     `json:"size"`
+	Checksum    string    `json:"checksum"` // hex SHA-256 of the stored bytes
+	LastError   string    `json:"last_error"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ObjectKey holds the wrapped data key of an encrypted object.
+type ObjectKey struct {
+	ID         uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Filename   string    `json:"filename" gorm:"not null;uniqueIndex"`
+	KeyID      string    `json:"key_id" gorm:"not null;index"` // master key used for wrapping
+	WrappedKey []byte    `json:"-" gorm:"not null"`
+	ChunkSize  int       `json:"chunk_size" gorm:"not null"`
+	Format     int       `json:"format" gorm:"not null;default:0"`
+	PartSize   int64     `json:"part_size" gorm:"not null;default:0"` // pending multipart uploads only
+	LastPart   int       `json:"last_part" gorm:"not null;default:0"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
 type UserActivity struct {
 	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
 	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;not null"`
@@ -63,9 +323,79 @@ func (media *Media) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+func (version *MediaVersion) BeforeCreate(tx *gorm.DB) error {
+	if version.ID == uuid.Nil {
+		version.ID = uuid.New()
+	}
+	return nil
+}
+
+func (pkg *StreamPackage) BeforeCreate(tx *gorm.DB) error {
+	if pkg.ID == uuid.Nil {
+		pkg.ID = uuid.New()
+	}
+	return nil
+}
+
+func (job *Job) BeforeCreate(tx *gorm.DB) error {
+	if job.ID == uuid.Nil {
+		job.ID = uuid.New()
+	}
+	return nil
+}
+
+func (thumbnail *Thumbnail) BeforeCreate(tx *gorm.DB) error {
+	if thumbnail.ID == uuid.Nil {
+		thumbnail.ID = uuid.New()
+	}
+	return nil
+}
+
 func (activity *UserActivity) BeforeCreate(tx *gorm.DB) error {
 	if activity.ID == uuid.Nil {
 		activity.ID = uuid.New()
 	}
 	return nil
 }
+
+func (upload *Upload) BeforeCreate(tx *gorm.DB) error {
+	if upload.ID == uuid.Nil {
+		upload.ID = uuid.New()
+	}
+	return nil
+}
+
+func (part *UploadPart) BeforeCreate(tx *gorm.DB) error {
+	if part.ID == uuid.Nil {
+		part.ID = uuid.New()
+	}
+	return nil
+}
+
+func (replica *Replica) BeforeCreate(tx *gorm.DB) error {
+	if replica.ID == uuid.Nil {
+		replica.ID = uuid.New()
+	}
+	return nil
+}
+
+func (key *ObjectKey) BeforeCreate(tx *gorm.DB) error {
+	if key.ID == uuid.Nil {
+		key.ID = uuid.New()
+	}
+	return nil
+}
+
+func (blob *Blob) BeforeCreate(tx *gorm.DB) error {
+	if blob.ID == uuid.Nil {
+		blob.ID = uuid.New()
+	}
+	return nil
+}
+
+func (object *MigrationObject) BeforeCreate(tx *gorm.DB) error {
+	if object.ID == uuid.Nil {
+		object.ID = uuid.New()
+	}
+	return nil
+}
@@ -1,10 +1,15 @@
 package repository
 
 import (
+	"context"
+	"errors"
+
 	"github.com/Shubham-Thakur06/go-streaming-platform/internal/database"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/interfaces"
 	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Repository struct {
@@ -66,7 +71,7 @@ func (r *MediaRepository) FindPublic(page, limit int, genre, search string) ([]m
 	var media []models.Media
 	var total int64
 
-	query := r.db.Model(&models.Media{}).Preload("User").Where("is_public = ?", true)
+	query := r.db.Model(&models.Media{}).Preload("User").Where("is_public = ? AND status = ?", true, models.MediaReady)
 
 	if genre != "" {
 		query = query.Where("genre = ?", genre)
@@ -91,3 +96,122 @@ func (r *MediaRepository) DeleteByIDAndUserID(id, userID string) error {
 func (r *MediaRepository) IncrementViewCount(id string) error {
 	return r.db.Model(&models.Media{}).Where("id = ?", id).UpdateColumn("view_count", gorm.Expr("view_count + ?", 1)).Error
 }
+
+type ReplicaRepository struct {
+	*Repository
+}
+
+func NewReplicaRepository(repo *Repository) *ReplicaRepository {
+	return &ReplicaRepository{Repository: repo}
+}
+
+func (r *ReplicaRepository) SaveReplica(ctx context.Context, state interfaces.ReplicaState) error {
+	replica := models.Replica{
+		Filename:  state.Filename,
+		Backend:   state.Backend,
+		Status:    state.Status,
+		Attempts:  state.Attempts,
+		LastError: state.LastError,
+	}
+
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "filename"}, {Name: "backend"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status", "attempts", "last_error", "updated_at"}),
+	}).Create(&replica).Error
+}
+
+func (r *ReplicaRepository) DeleteReplica(ctx context.Context, filename string, backend string) error {
+	return r.db.WithContext(ctx).Where("filename = ? AND backend = ?", filename, backend).Delete(&models.Replica{}).Error
+}
+
+func (r *ReplicaRepository) FindReplicas(ctx context.Context, statuses ...string) ([]interfaces.ReplicaState, error) {
+	var replicas []models.Replica
+
+	query := r.db.WithContext(ctx).Order("updated_at")
+	if len(statuses) > 0 {
+		query = query.Where("status IN ?", statuses)
+	}
+	if err := query.Find(&replicas).Error; err != nil {
+		return nil, err
+	}
+
+	states := make([]interfaces.ReplicaState, len(replicas))
+	for i, replica := range replicas {
+		states[i] = interfaces.ReplicaState{
+			Filename:  replica.Filename,
+			Backend:   replica.Backend,
+			Status:    replica.Status,
+			Attempts:  replica.Attempts,
+			LastError: replica.LastError,
+			UpdatedAt: replica.UpdatedAt,
+		}
+	}
+	return states, nil
+}
+
+type ObjectKeyRepository struct {
+	*Repository
+}
+
+func NewObjectKeyRepository(repo *Repository) *ObjectKeyRepository {
+	return &ObjectKeyRepository{Repository: repo}
+}
+
+func (r *ObjectKeyRepository) SaveKey(ctx context.Context, key interfaces.ObjectKey) error {
+	objectKey := models.ObjectKey{
+		Filename:   key.Filename,
+		KeyID:      key.KeyID,
+		WrappedKey: key.WrappedKey,
+		ChunkSize:  key.ChunkSize,
+		Format:     key.Format,
+		PartSize:   key.PartSize,
+		LastPart:   key.LastPart,
+	}
+
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "filename"}},
+		DoUpdates: clause.AssignmentColumns([]string{"key_id", "wrapped_key", "chunk_size", "format", "part_size", "last_part", "updated_at"}),
+	}).Create(&objectKey).Error
+}
+
+func (r *ObjectKeyRepository) FindKey(ctx context.Context, filename string) (*interfaces.ObjectKey, error) {
+	var objectKey models.ObjectKey
+	err := r.db.WithContext(ctx).Where("filename = ?", filename).First(&objectKey).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, interfaces.ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return toObjectKey(objectKey), nil
+}
+
+func (r *ObjectKeyRepository) DeleteKey(ctx context.Context, filename string) error {
+	return r.db.WithContext(ctx).Where("filename = ?", filename).Delete(&models.ObjectKey{}).Error
+}
+
+func (r *ObjectKeyRepository) FindKeysNotWrappedWith(ctx context.Context, keyID string, limit int) ([]interfaces.ObjectKey, error) {
+	var objectKeys []models.ObjectKey
+	err := r.db.WithContext(ctx).Where("key_id <> ?", keyID).Order("created_at").Limit(limit).Find(&objectKeys).Error
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]interfaces.ObjectKey, len(objectKeys))
+	for i, objectKey := range objectKeys {
+		keys[i] = *toObjectKey(objectKey)
+	}
+	return keys, nil
+}
+
+func toObjectKey(objectKey models.ObjectKey) *interfaces.ObjectKey {
+	return &interfaces.ObjectKey{
+		Filename:   objectKey.Filename,
+		KeyID:      objectKey.KeyID,
+		WrappedKey: objectKey.WrappedKey,
+		ChunkSize:  objectKey.ChunkSize,
+		Format:     objectKey.Format,
+		PartSize:   objectKey.PartSize,
+		LastPart:   objectKey.LastPart,
+	}
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
 	"github.com/Shubham-Thakur06/go-streaming-platform/internal/database"
@@ -41,10 +42,14 @@ func (s *Server) setupRoutes() {
 	// CORS middleware
 	s.router.Use(func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		c.Header("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Range, If-Range, Tus-Resumable, Upload-Length, Upload-Metadata, Upload-Offset")
+		c.Header("Access-Control-Expose-Headers", "Accept-Ranges, Content-Length, Content-Range, ETag, Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Length, Upload-Offset, X-Media-ID")
 
 		if c.Request.Method == "OPTIONS" {
+			if strings.HasPrefix(c.Request.URL.Path, "/api/v1/uploads") {
+				s.handlers.Upload.Options(c)
+			}
 			c.AbortWithStatus(204)
 			return
 		}
@@ -57,12 +62,29 @@ func (s *Server) setupRoutes() {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	})
 
+	// Local storage objects (signed URLs only)
+	if s.storageProvider.Local() != nil {
+		s.router.GET(storage.LocalFilesPath+"/*filepath", s.handlers.File.ServeFile)
+		s.router.HEAD(storage.LocalFilesPath+"/*filepath", s.handlers.File.ServeFile)
+		s.router.PUT(storage.LocalFilesPath+"/*filepath", s.handlers.File.ReceiveFile)
+	}
+
 	public := s.router.Group("/api/v1")
 	{
 		public.POST("/auth/login", s.handlers.User.Login)
 		public.GET("/media", s.handlers.Media.ListMedia)
 		public.GET("/media/:id", s.handlers.Media.GetMedia)
 		public.GET("/media/:id/stream", s.handlers.Media.GetStreamURL)
+		public.GET("/media/:id/thumbnail", s.handlers.Media.ServeThumbnail)
+		public.GET("/media/:id/hls/*file", s.handlers.Media.ServeHLS)
+		public.HEAD("/media/:id/hls/*file", s.handlers.Media.ServeHLS)
+		public.GET("/media/:id/dash/*file", s.handlers.Media.ServeDASH)
+		public.HEAD("/media/:id/dash/*file", s.handlers.Media.ServeDASH)
+
+		if s.cfg.Stream.Mode == "proxy" {
+			public.GET("/media/:id/content", s.handlers.Media.StreamMedia)
+			public.HEAD("/media/:id/content", s.handlers.Media.StreamMedia)
+		}
 	}
 	
 	// Protected routes (host authentication required)
@@ -72,11 +94,60 @@ func (s *Server) setupRoutes() {
 		// Host routes
 		protected.GET("/profile", s.handlers.User.GetProfile)
 		protected.PUT("/profile", s.handlers.User.UpdateProfile)
+		protected.GET("/profile/usage", s.handlers.User.GetUsage)
 
 		// Media management (host only)
 		protected.POST("/media/upload", s.handlers.Media.UploadMedia)
 		protected.DELETE("/media/:id", s.handlers.Media.DeleteMedia)
+
+		// File replacement and versions
+		protected.PUT("/media/:id/file", s.handlers.Media.ReplaceMediaFile)
+		protected.GET("/media/:id/versions", s.handlers.Media.ListVersions)
+		protected.POST("/media/:id/versions/:version/rollback", s.handlers.Media.RollbackVersion)
+		protected.DELETE("/media/:id/versions/:version", s.handlers.Media.DeleteVersion)
+
+		// Thumbnails
+		protected.GET("/media/:id/thumbnails", s.handlers.Media.ListThumbnails)
+		protected.POST("/media/:id/thumbnails", s.handlers.Media.UploadThumbnail)
+		protected.PUT("/media/:id/thumbnail", s.handlers.Media.SelectThumbnail)
+
+		// Direct-to-storage uploads
+		protected.POST("/media/uploads", s.handlers.Media.CreateDirectUpload)
+		protected.GET("/media/uploads/:id", s.handlers.Media.GetDirectUpload)
+		protected.POST("/media/uploads/:id/complete", s.handlers.Media.CompleteDirectUpload)
+
+		// Resumable uploads (tus 1.0)
+		protected.POST("/uploads", s.handlers.Upload.CreateUpload)
+		protected.HEAD("/uploads/:id", s.handlers.Upload.GetUploadOffset)
+		protected.PATCH("/uploads/:id", s.handlers.Upload.PatchUpload)
+		protected.DELETE("/uploads/:id", s.handlers.Upload.TerminateUpload)
 	}
+
+	// Admin routes
+	admin := s.router.Group("/api/v1/admin")
+	admin.Use(middleware.AuthMiddleware(s.cfg.JWT, s.db.DB), middleware.AdminMiddleware())
+	{
+		admin.GET("/users", s.handlers.User.ListUsers)
+		admin.GET("/users/:id/usage", s.handlers.User.GetUserUsage)
+		admin.PUT("/users/:id/quota", s.handlers.User.SetUserQuota)
+
+		// Background jobs
+		admin.GET("/jobs", s.handlers.Job.ListJobs)
+		admin.GET("/jobs/stats", s.handlers.Job.GetJobStats)
+		admin.GET("/jobs/:id", s.handlers.Job.GetJob)
+		admin.POST("/jobs/:id/retry", s.handlers.Job.RetryJob)
+		admin.POST("/jobs/retry", s.handlers.Job.RetryDeadJobs)
+
+		// Storage operations
+		if s.storageProvider.Mirror() != nil {
+			admin.GET("/storage/replicas", s.handlers.Storage.ListReplicas)
+		}
+	}
+}
+
+// Handler returns the HTTP handler serving the API.
+func (s *Server) Handler() http.Handler {
+	return s.router
 }
 
 func (s *Server) Start() error {
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/storage"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BlobStore keeps one object per distinct content. Media records point at a
+// blob through their checksum and object key, and the blob row counts those
+// references. Under a key scheme with {user} content is only shared between
+// the uploads of one user, whose objects stay under their own prefix.
+type BlobStore struct {
+	db              *gorm.DB
+	storageProvider *storage.StorageProvider
+}
+
+func NewBlobStore(db *gorm.DB, storageProvider *storage.StorageProvider) *BlobStore {
+	return &BlobStore{
+		db:              db,
+		storageProvider: storageProvider,
+	}
+}
+
+// Put takes a reference for owner on the blob with blob.Checksum. When the
+// content is not stored yet the blob is created under key and upload is
+// called to store the object. blob is filled in with the stored row.
+func (s *BlobStore) Put(ctx context.Context, owner uuid.UUID, blob *models.Blob, key string, upload func(key string) error) error {
+	if s.storageProvider.KeysPerUser() {
+		blob.Scope = owner.String()
+	}
+
+	created, err := s.acquire(ctx, blob, key)
+	if err != nil {
+		return fmt.Errorf("failed to reference blob: %w", err)
+	}
+
+	// A row without an object is left behind when the first upload of this
+	// content failed or is still running; uploading the same bytes again is
+	// harmless. Any other error leaves it unknown whether the object exists.
+	if !created {
+		_, err := s.storageProvider.Stat(ctx, blob.Filename)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, storage.ErrObjectNotFound) {
+			s.ReleaseDetached(ctx, blob.Filename)
+			return fmt.Errorf("failed to check blob object: %w", err)
+		}
+	}
+
+	if err := upload(blob.Filename); err != nil {
+		s.ReleaseDetached(ctx, blob.Filename)
+		return err
+	}
+
+	return nil
+}
+
+// Tier returns the storage tier of the object under filename, as recorded on
+// the media already sharing it. New media take it over so they stay in step
+// with their object.
+func (s *BlobStore) Tier(ctx context.Context, filename string) string {
+	var tiers []string
+	err := s.db.WithContext(ctx).Model(&models.Media{}).
+		Where("filename = ?", filename).Limit(1).
+		Pluck("storage_tier", &tiers).Error
+	if err != nil || len(tiers) == 0 {
+		return models.TierHot
+	}
+	return tiers[0]
+}
+
+// acquire increments the reference count of the blob, creating it under key
+// with a count of one if it does not exist. It reports whether the row was
+// created.
+func (s *BlobStore) acquire(ctx context.Context, blob *models.Blob, key string) (bool, error) {
+	var created bool
+	var err error
+
+	// Two first uploads of the same content race on the unique index; the
+	// loser retries and finds the winner's row.
+	for attempt := 0; attempt < 2; attempt++ {
+		err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var existing models.Blob
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("scope = ? AND checksum = ?", blob.Scope, blob.Checksum).First(&existing).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				blob.Filename = key
+				blob.RefCount = 1
+				created = true
+				return tx.Create(blob).Error
+			}
+			if err != nil {
+				return err
+			}
+
+			existing.RefCount++
+			if err := tx.Model(&existing).Update("ref_count", existing.RefCount).Error; err != nil {
+				return err
+			}
+			*blob = existing
+			created = false
+			return nil
+		})
+		if err == nil {
+			return created, nil
+		}
+	}
+
+	return false, err
+}
+
+// Release drops a reference to the blob stored under filename inside tx.
+// The object is deleted from storage with the last reference, while the row
+// is still locked so no new reference can race with the deletion.
+func (s *BlobStore) Release(ctx context.Context, tx *gorm.DB, filename string) error {
+	orphaned, err := s.Drop(tx, filename)
+	if err != nil || !orphaned {
+		return err
+	}
+
+	if err := s.storageProvider.DeleteFile(ctx, filename); err != nil {
+		return fmt.Errorf("failed to delete blob from storage: %w", err)
+	}
+	return nil
+}
+
+// Drop drops a reference to the blob stored under filename inside tx without
+// touching storage. It reports whether that was the last reference, in which
+// case the row is gone and the object is left to DeleteOrphan.
+func (s *BlobStore) Drop(tx *gorm.DB, filename string) (bool, error) {
+	var blob models.Blob
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("filename = ?", filename).First(&blob).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if blob.RefCount > 1 {
+		return false, tx.Model(&blob).Update("ref_count", blob.RefCount-1).Error
+	}
+	return true, tx.Delete(&blob).Error
+}
+
+// DeleteOrphan deletes the object under filename once no blob refers to it.
+// An object already gone counts as deleted, and one the same content was
+// stored under again since is kept.
+func (s *BlobStore) DeleteOrphan(ctx context.Context, filename string) error {
+	var refs int64
+	if err := s.db.WithContext(ctx).Model(&models.Blob{}).Where("filename = ?", filename).Count(&refs).Error; err != nil {
+		return err
+	}
+	if refs > 0 {
+		return nil
+	}
+
+	err := s.storageProvider.DeleteFile(ctx, filename)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return nil
+	}
+	return err
+}
+
+// ReleaseDetached drops a reference taken for a record that was never saved.
+// It runs even if ctx has been cancelled.
+func (s *BlobStore) ReleaseDetached(ctx context.Context, filename string) error {
+	ctx = context.WithoutCancel(ctx)
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return s.Release(ctx, tx, filename)
+	})
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/storage"
+	"gorm.io/gorm"
+)
+
+// DirectUploadService checks the files clients upload straight to the storage
+// backend and turns them into ready media. Completing an upload only compares
+// what the backend reports about the object; reading it back to hash and
+// probe it is left to a media.verify_upload job.
+type DirectUploadService struct {
+	db              *gorm.DB
+	storageProvider *storage.StorageProvider
+	probes          *ProbeService
+	blobs           *BlobStore
+}
+
+func NewDirectUploadService(db *gorm.DB, storageProvider *storage.StorageProvider, cfg config.ProcessConfig) *DirectUploadService {
+	return &DirectUploadService{
+		db:              db,
+		storageProvider: storageProvider,
+		probes:          NewProbeService(storageProvider, cfg),
+		blobs:           NewBlobStore(db, storageProvider),
+	}
+}
+
+// Check compares the stored object with the size and type declared for the
+// upload, without reading it. It fails with storage.ErrObjectNotFound when
+// nothing was uploaded and with ErrUploadRejected on a mismatch.
+func (s *DirectUploadService) Check(ctx context.Context, upload *models.DirectUpload) error {
+	info, err := s.storageProvider.Stat(ctx, upload.Filename)
+	if err != nil {
+		return err
+	}
+
+	if info.Size != upload.Size {
+		return fmt.Errorf("%w: size is %d bytes, expected %d", ErrUploadRejected, info.Size, upload.Size)
+	}
+	if info.ContentType != "" && info.ContentType != upload.ContentType {
+		return fmt.Errorf("%w: content type is %s, expected %s", ErrUploadRejected, info.ContentType, upload.ContentType)
+	}
+	return nil
+}
+
+// Verify reads the stored object back and returns its SHA-256, along with
+// what probing found out about it. A deferred probe is left to a job of its
+// own. Content that is not audio or video fails with ErrUploadRejected.
+func (s *DirectUploadService) Verify(ctx context.Context, upload *models.DirectUpload) (string, *ProbeResult, error) {
+	if err := s.Check(ctx, upload); err != nil {
+		return "", nil, err
+	}
+
+	body, err := s.storageProvider.Open(ctx, upload.Filename, 0, -1)
+	if err != nil {
+		return "", nil, err
+	}
+	defer body.Close()
+
+	// Sniff the first bytes while hashing everything
+	head := make([]byte, 512)
+	n, err := io.ReadFull(body, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", nil, err
+	}
+	if detected := http.DetectContentType(head[:n]); !IsMediaContentType(detected) {
+		return "", nil, fmt.Errorf("%w: content looks like %s", ErrUploadRejected, detected)
+	}
+
+	hash := sha256.New()
+	hash.Write(head[:n])
+
+	// Probe the object as it is read for hashing, then hash what probing
+	// left
+	rest := io.TeeReader(body, hash)
+	var probe *ProbeResult
+	if !s.probes.Deferred() {
+		probe, err = s.probes.Probe(ctx, io.MultiReader(bytes.NewReader(head[:n]), rest))
+		if errors.Is(err, ErrCorruptMedia) {
+			return "", nil, fmt.Errorf("%w: %v", ErrUploadRejected, err)
+		}
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	if _, err := io.Copy(io.Discard, rest); err != nil {
+		return "", nil, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), probe, nil
+}
+
+// Reset deletes a rejected object and records why it was rejected. A
+// multipart upload is started again so fresh part URLs can be requested.
+func (s *DirectUploadService) Reset(ctx context.Context, upload *models.DirectUpload, reason error) error {
+	if err := s.storageProvider.DeleteFile(ctx, upload.Filename); err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{
+		"status": models.DirectUploadRejected,
+		"error":  reason.Error(),
+	}
+	if upload.PartSize > 0 {
+		multipartID, err := s.storageProvider.CreateMultipartUpload(ctx, upload.Filename, upload.ContentType)
+		if err != nil {
+			return err
+		}
+		updates["multipart_id"] = multipartID
+	}
+	return s.db.WithContext(ctx).Model(upload).Updates(updates).Error
+}
+
+// Finish moves a verified object to its content-addressed key and marks its
+// media ready. process queues the work on the file inside the same
+// transaction. Nothing is kept when the media was deleted in the meantime.
+func (s *DirectUploadService) Finish(ctx context.Context, upload *models.DirectUpload, checksum string, probe *ProbeResult,
+	process func(tx *gorm.DB, media *models.Media) error) error {
+	var media models.Media
+	err := s.db.WithContext(ctx).Where("id = ? AND status = ?", upload.MediaID, models.MediaPending).First(&media).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	blob := models.Blob{
+		Checksum:    checksum,
+		Size:        upload.Size,
+		ContentType: upload.ContentType,
+	}
+
+	key := s.storageProvider.ObjectKey(storage.KeyParams{
+		UserID:   media.UserID.String(),
+		MediaID:  media.ID.String(),
+		Checksum: checksum,
+		Filename: upload.OriginalName,
+	})
+
+	err = s.blobs.Put(ctx, media.UserID, &blob, key, func(key string) error {
+		return s.storageProvider.Copy(ctx, upload.Filename, key)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store upload: %w", err)
+	}
+
+	storageURL, err := s.storageProvider.GetFileURL(ctx, blob.Filename)
+	if err != nil {
+		s.blobs.ReleaseDetached(ctx, blob.Filename)
+		return err
+	}
+
+	tier := s.blobs.Tier(ctx, blob.Filename)
+	updates := map[string]interface{}{
+		"filename":     blob.Filename,
+		"checksum":     blob.Checksum,
+		"storage_url":  storageURL,
+		"status":       models.MediaReady,
+		"storage_tier": tier,
+	}
+	if probe != nil {
+		for column, value := range probe.Columns() {
+			updates[column] = value
+		}
+	}
+
+	finished := false
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		updated := tx.Model(&media).Where("status = ?", models.MediaPending).Updates(updates)
+		if updated.Error != nil {
+			return updated.Error
+		}
+		// Deleted while it was verified
+		if updated.RowsAffected == 0 {
+			return nil
+		}
+		if err := tx.Delete(upload).Error; err != nil {
+			return err
+		}
+
+		media.Filename = blob.Filename
+		media.Checksum = blob.Checksum
+		media.StorageURL = storageURL
+		media.Status = models.MediaReady
+		media.StorageTier = tier
+		if probe != nil {
+			probe.Apply(&media)
+		}
+		finished = true
+		return process(tx, &media)
+	})
+	if err != nil || !finished {
+		s.blobs.ReleaseDetached(ctx, blob.Filename)
+		return err
+	}
+
+	// The temporary object is either copied or a duplicate by now
+	if err := s.storageProvider.DeleteFile(ctx, upload.Filename); err != nil {
+		log.Printf("media %s: failed to delete temporary upload object: %v", media.ID, err)
+	}
+	return nil
+}
+
+// IsMediaContentType accepts audio and video types, and binary content that
+// could not be identified more closely.
+func IsMediaContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "audio/") || strings.HasPrefix(mediaType, "video/") ||
+		mediaType == "application/ogg" || mediaType == "application/octet-stream"
+}
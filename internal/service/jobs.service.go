@@ -0,0 +1,344 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/storage"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Job types run by cmd/worker.
+const (
+	JobProbe      = "media.probe"
+	JobThumbnails = "media.thumbnails"
+	JobTranscode  = "media.transcode"
+	JobCleanup    = "media.cleanup"
+	// JobDeleteObjects deletes what a deleted media left in storage once
+	// the records referring to it are gone.
+	JobDeleteObjects = "media.delete_objects"
+	// JobVerifyUpload reads back a completed direct upload before its media
+	// becomes ready.
+	JobVerifyUpload = "media.verify_upload"
+)
+
+// mediaJob names the file of a media a job works on. A job for a file that
+// has since been replaced does nothing; the new file has jobs of its own.
+type mediaJob struct {
+	MediaID uuid.UUID `json:"media_id"`
+	Version int       `json:"version"`
+}
+
+// uploadJob names the direct upload of a pending media.
+type uploadJob struct {
+	MediaID uuid.UUID `json:"media_id"`
+}
+
+// cleanupJob is what is left of a deleted media to release.
+type cleanupJob struct {
+	MediaID  uuid.UUID `json:"media_id"`
+	Filename string    `json:"filename"`
+	Checksum string    `json:"checksum"`
+}
+
+// objectsJob lists the objects a deleted media left in storage: single
+// objects, and prefixes of stream packages.
+type objectsJob struct {
+	MediaID  uuid.UUID `json:"media_id"`
+	Keys     []string  `json:"keys"`
+	Prefixes []string  `json:"prefixes"`
+}
+
+// MediaJobs queues the work that follows an upload or a deletion and runs it
+// in cmd/worker: verifying direct uploads, probing when corrupt files are
+// not rejected up front, thumbnails, transcoding and deleting what a media
+// leaves in storage.
+type MediaJobs struct {
+	db              *gorm.DB
+	storageProvider *storage.StorageProvider
+	cfg             config.ProcessConfig
+	queue           *JobQueue
+	probes          *ProbeService
+	thumbnails      *ThumbnailService
+	packages        *PackagingService
+	versions        *VersionService
+	blobs           *BlobStore
+	uploads         *DirectUploadService
+}
+
+func NewMediaJobs(db *gorm.DB, storageProvider *storage.StorageProvider, cfg *config.Config) *MediaJobs {
+	j := &MediaJobs{
+		db:              db,
+		storageProvider: storageProvider,
+		cfg:             cfg.Process,
+		queue:           NewJobQueue(db, cfg.Jobs),
+		probes:          NewProbeService(storageProvider, cfg.Process),
+		thumbnails:      NewThumbnailService(db, storageProvider, cfg.Process),
+		packages:        NewPackagingService(db, storageProvider, cfg.Process),
+		versions:        NewVersionService(db, storageProvider),
+		blobs:           NewBlobStore(db, storageProvider),
+		uploads:         NewDirectUploadService(db, storageProvider, cfg.Process),
+	}
+
+	j.queue.Register(JobProbe, j.probe)
+	j.queue.Register(JobThumbnails, j.generateThumbnails)
+	j.queue.Register(JobTranscode, j.transcode)
+	j.queue.Register(JobCleanup, j.cleanup)
+	j.queue.Register(JobDeleteObjects, j.deleteObjects)
+	j.queue.Register(JobVerifyUpload, j.verifyUpload)
+	return j
+}
+
+// Queue returns the queue the jobs are kept in, with the media job types
+// registered.
+func (j *MediaJobs) Queue() *JobQueue {
+	return j.queue
+}
+
+// Process queues the work on the current file of media inside tx, or on its
+// own when tx is nil. An unprobed file is probed first, and the probe job
+// queues the rest.
+func (j *MediaJobs) Process(ctx context.Context, tx *gorm.DB, media *models.Media) error {
+	payload := mediaJob{MediaID: media.ID, Version: max(media.Version, 1)}
+
+	if j.probes.Deferred() && media.ProbeStatus == "" {
+		_, err := j.queue.Enqueue(ctx, tx, JobProbe, payload, JobOptions{})
+		return err
+	}
+	return j.processProbed(ctx, tx, media)
+}
+
+// processProbed queues the work that needs to know what the file is.
+func (j *MediaJobs) processProbed(ctx context.Context, tx *gorm.DB, media *models.Media) error {
+	payload := mediaJob{MediaID: media.ID, Version: max(media.Version, 1)}
+
+	if j.cfg.Thumbnails && hasPicture(media) {
+		if _, err := j.queue.Enqueue(ctx, tx, JobThumbnails, payload, JobOptions{}); err != nil {
+			return err
+		}
+	}
+
+	return j.Transcode(ctx, tx, media)
+}
+
+// Transcode queues only the packaging of the current file of media, inside
+// tx or on its own when tx is nil.
+func (j *MediaJobs) Transcode(ctx context.Context, tx *gorm.DB, media *models.Media) error {
+	if !j.cfg.Transcode || media.ProbeStatus == models.ProbeCorrupt {
+		return nil
+	}
+
+	// Viewers may already be waiting on public media
+	opts := JobOptions{MaxAttempts: j.cfg.TranscodeAttempts}
+	if media.IsPublic {
+		opts.Priority = 10
+	}
+	_, err := j.queue.Enqueue(ctx, tx, JobTranscode, mediaJob{MediaID: media.ID, Version: max(media.Version, 1)}, opts)
+	return err
+}
+
+// Cleanup queues the release of the prior versions, thumbnails, stream
+// package and file of media inside tx, the transaction deleting it.
+func (j *MediaJobs) Cleanup(ctx context.Context, tx *gorm.DB, media *models.Media) error {
+	_, err := j.queue.Enqueue(ctx, tx, JobCleanup, cleanupJob{
+		MediaID:  media.ID,
+		Filename: media.Filename,
+		Checksum: media.Checksum,
+	}, JobOptions{})
+	return err
+}
+
+// VerifyUpload queues the verification of a completed direct upload inside
+// tx, the transaction marking it DirectUploadVerifying.
+func (j *MediaJobs) VerifyUpload(ctx context.Context, tx *gorm.DB, upload *models.DirectUpload) error {
+	_, err := j.queue.Enqueue(ctx, tx, JobVerifyUpload, uploadJob{MediaID: upload.MediaID}, JobOptions{})
+	return err
+}
+
+// load reads the media a job is for, or returns nil when it is gone or its
+// file has changed since the job was queued.
+func (j *MediaJobs) load(ctx context.Context, payload []byte) (*models.Media, error) {
+	var job mediaJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return nil, err
+	}
+
+	var media models.Media
+	err := j.db.WithContext(ctx).Where("id = ? AND status = ?", job.MediaID, models.MediaReady).First(&media).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if max(media.Version, 1) != job.Version {
+		return nil, nil
+	}
+	return &media, nil
+}
+
+// probe records what ffprobe finds out about a stored file, then queues the
+// rest of its processing. A file ffprobe cannot read is flagged corrupt.
+func (j *MediaJobs) probe(ctx context.Context, payload []byte) error {
+	media, err := j.load(ctx, payload)
+	if err != nil || media == nil {
+		return err
+	}
+
+	probe, err := j.probes.ProbeObject(ctx, media.Filename)
+	if err != nil {
+		return fmt.Errorf("failed to probe file: %w", err)
+	}
+
+	return j.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if probe != nil {
+			updated := tx.Model(&models.Media{}).
+				Where("id = ? AND version = ?", media.ID, media.Version).
+				Updates(probe.Columns())
+			if updated.Error != nil {
+				return updated.Error
+			}
+			// Replaced while it was probed
+			if updated.RowsAffected == 0 {
+				return nil
+			}
+			probe.Apply(media)
+		}
+
+		return j.processProbed(ctx, tx, media)
+	})
+}
+
+// verifyUpload hashes and probes a completed direct upload and makes its
+// media ready. A rejected file is deleted and the reason kept on the upload,
+// so the client can find out and upload it again.
+func (j *MediaJobs) verifyUpload(ctx context.Context, payload []byte) error {
+	var job uploadJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return err
+	}
+
+	var upload models.DirectUpload
+	err := j.db.WithContext(ctx).Where("media_id = ? AND status = ?", job.MediaID, models.DirectUploadVerifying).First(&upload).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	checksum, probe, err := j.uploads.Verify(ctx, &upload)
+	if errors.Is(err, ErrUploadRejected) || errors.Is(err, storage.ErrObjectNotFound) {
+		log.Printf("media %s: direct upload rejected: %v", upload.MediaID, err)
+		return j.uploads.Reset(ctx, &upload, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to verify upload: %w", err)
+	}
+
+	return j.uploads.Finish(ctx, &upload, checksum, probe, func(tx *gorm.DB, media *models.Media) error {
+		return j.Process(ctx, tx, media)
+	})
+}
+
+func (j *MediaJobs) generateThumbnails(ctx context.Context, payload []byte) error {
+	media, err := j.load(ctx, payload)
+	if err != nil || media == nil {
+		return err
+	}
+	return j.thumbnails.GenerateObject(ctx, media)
+}
+
+func (j *MediaJobs) transcode(ctx context.Context, payload []byte) error {
+	media, err := j.load(ctx, payload)
+	if err != nil || media == nil {
+		return err
+	}
+
+	if err := j.packages.Enqueue(ctx, media); err != nil {
+		return err
+	}
+	return j.packages.Package(ctx, media)
+}
+
+// cleanup deletes the records a deleted media left behind and drops its
+// references on shared blobs. Storage is only touched once that has
+// committed, by the JobDeleteObjects job queued with it, so no transaction is
+// held open while objects are deleted.
+func (j *MediaJobs) cleanup(ctx context.Context, payload []byte) error {
+	var job cleanupJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return err
+	}
+
+	err := j.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		mediaID := job.MediaID.String()
+		objects := objectsJob{MediaID: job.MediaID}
+
+		versions, err := j.versions.Release(tx, mediaID)
+		if err != nil {
+			return err
+		}
+		thumbnails, err := j.thumbnails.Release(tx, mediaID)
+		if err != nil {
+			return err
+		}
+		objects.Keys = append(versions, thumbnails...)
+		if objects.Prefixes, err = j.packages.Release(tx, mediaID); err != nil {
+			return err
+		}
+
+		// Files uploaded before blobs existed belong to the media alone
+		orphaned := job.Checksum == ""
+		if !orphaned {
+			if orphaned, err = j.blobs.Drop(tx, job.Filename); err != nil {
+				return err
+			}
+		}
+		if orphaned {
+			objects.Keys = append(objects.Keys, job.Filename)
+		}
+
+		if len(objects.Keys) == 0 && len(objects.Prefixes) == 0 {
+			return nil
+		}
+		_, err = j.queue.Enqueue(ctx, tx, JobDeleteObjects, objects, JobOptions{})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("media %s: records released", job.MediaID)
+	return nil
+}
+
+// deleteObjects deletes the objects listed by cleanup. Objects already gone
+// count as deleted, so a retry picks up where a failed run stopped. A blob
+// the same content was stored under again since is kept.
+func (j *MediaJobs) deleteObjects(ctx context.Context, payload []byte) error {
+	var job objectsJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return err
+	}
+
+	for _, key := range job.Keys {
+		if err := j.blobs.DeleteOrphan(ctx, key); err != nil {
+			return fmt.Errorf("failed to delete %s from storage: %w", key, err)
+		}
+	}
+	for _, prefix := range job.Prefixes {
+		if err := j.packages.deleteObjects(ctx, prefix); err != nil {
+			return fmt.Errorf("failed to delete stream package from storage: %w", err)
+		}
+	}
+
+	log.Printf("media %s: storage released", job.MediaID)
+	return nil
+}
@@ -0,0 +1,308 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/storage"
+	"gorm.io/gorm"
+)
+
+// Kinds of LifecycleRule.
+const (
+	RuleNoViews = "no_views" // not viewed for the rule's duration
+	RuleAge     = "age"      // uploaded longer ago than the rule's duration
+)
+
+// ErrColdStorageNotConfigured is returned when lifecycle rules are run with
+// neither a cold storage class nor a cold provider to move media to.
+var ErrColdStorageNotConfigured = errors.New("no cold storage configured: set STORAGE_COLD_CLASS or STORAGE_COLD_PROVIDER")
+
+// LifecycleRule moves media to cold storage once it has gone After without a
+// view, or is older than After, depending on Kind.
+type LifecycleRule struct {
+	Kind  string
+	After time.Duration
+}
+
+// ParseLifecycleRules parses rules written as "kind:duration", such as
+// "no_views:90d" or "age:1y". Durations take d, w and y suffixes besides the
+// ones time.ParseDuration accepts.
+func ParseLifecycleRules(specs []string) ([]LifecycleRule, error) {
+	var rules []LifecycleRule
+	for _, spec := range specs {
+		kind, value, ok := strings.Cut(spec, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid lifecycle rule %q: want kind:duration", spec)
+		}
+		if kind != RuleNoViews && kind != RuleAge {
+			return nil, fmt.Errorf("invalid lifecycle rule %q: kind must be %s or %s", spec, RuleNoViews, RuleAge)
+		}
+
+		after, err := parseRuleDuration(value)
+		if err != nil || after <= 0 {
+			return nil, fmt.Errorf("invalid lifecycle rule %q: bad duration", spec)
+		}
+		rules = append(rules, LifecycleRule{Kind: kind, After: after})
+	}
+	return rules, nil
+}
+
+func parseRuleDuration(value string) (time.Duration, error) {
+	units := map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+		"y": 365 * 24 * time.Hour,
+	}
+	for suffix, unit := range units {
+		if n, ok := strings.CutSuffix(value, suffix); ok {
+			count, err := strconv.Atoi(n)
+			if err != nil {
+				return 0, err
+			}
+			return time.Duration(count) * unit, nil
+		}
+	}
+	return time.ParseDuration(value)
+}
+
+// LifecycleOptions configures a LifecycleService.
+type LifecycleOptions struct {
+	Rules []string
+	// ColdClass is the storage class cold media is moved to. It is not used
+	// when a cold provider is configured.
+	ColdClass string
+	// RestoreDays is how long a restored archive copy stays readable. Media
+	// viewed within this many days are never moved to cold storage.
+	RestoreDays int
+	DryRun      bool
+}
+
+// LifecycleResult summarises a lifecycle run.
+type LifecycleResult struct {
+	Cooled  int // objects moved to cold storage
+	Warmed  int // objects moved back to hot storage
+	Waiting int // objects still being restored by the backend
+	Failed  int
+}
+
+// LifecycleService moves the objects of media nobody watches to cold storage
+// and brings them back once they are requested again. Objects go either to
+// a cheaper storage class of the same backend or to a separate cold provider.
+// The tier is recorded on every media sharing the object.
+type LifecycleService struct {
+	db              *gorm.DB
+	storageProvider *storage.StorageProvider
+	opts            LifecycleOptions
+}
+
+func NewLifecycleService(db *gorm.DB, storageProvider *storage.StorageProvider, opts LifecycleOptions) *LifecycleService {
+	if opts.RestoreDays < 1 {
+		opts.RestoreDays = 1
+	}
+
+	return &LifecycleService{
+		db:              db,
+		storageProvider: storageProvider,
+		opts:            opts,
+	}
+}
+
+// Warm makes sure media can be read, starting to bring it back from cold
+// storage if needed. It reports false while the backend is still restoring
+// the object.
+func (s *LifecycleService) Warm(ctx context.Context, media *models.Media) (bool, error) {
+	if media.StorageTier == models.TierHot || media.StorageTier == "" {
+		return true, nil
+	}
+
+	if media.StorageTier == models.TierCold {
+		err := s.db.WithContext(ctx).Model(&models.Media{}).
+			Where("filename = ? AND storage_tier = ?", media.Filename, models.TierCold).
+			Update("storage_tier", models.TierWarming).Error
+		if err != nil {
+			return false, err
+		}
+		media.StorageTier = models.TierWarming
+	}
+
+	// A cold provider serves reads until the object is moved back
+	if s.storageProvider.Tiering() != nil {
+		return true, nil
+	}
+
+	ready, err := s.storageProvider.Restore(ctx, media.Filename, s.opts.RestoreDays)
+	if errors.Is(err, storage.ErrStorageClassNotSupported) {
+		return true, nil
+	}
+	return ready, err
+}
+
+// Run brings warming media back to hot storage, then moves the media that
+// match a rule to cold storage. A failure is logged and counted and does not
+// stop the run.
+func (s *LifecycleService) Run(ctx context.Context) (*LifecycleResult, error) {
+	rules, err := ParseLifecycleRules(s.opts.Rules)
+	if err != nil {
+		return nil, err
+	}
+	if s.storageProvider.Tiering() == nil && s.opts.ColdClass == "" {
+		return nil, ErrColdStorageNotConfigured
+	}
+
+	result := &LifecycleResult{}
+	if err := s.warm(ctx, result); err != nil {
+		return result, err
+	}
+	if err := s.cool(ctx, result, rules); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// warm moves the objects of warming media back to hot storage.
+func (s *LifecycleService) warm(ctx context.Context, result *LifecycleResult) error {
+	var filenames []string
+	err := s.db.WithContext(ctx).Model(&models.Media{}).
+		Where("storage_tier = ?", models.TierWarming).
+		Distinct("filename").Order("filename").
+		Pluck("filename", &filenames).Error
+	if err != nil {
+		return err
+	}
+
+	for _, filename := range filenames {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if s.opts.DryRun {
+			log.Printf("%s: would move to hot storage", filename)
+			continue
+		}
+
+		ready, err := s.moveToHot(ctx, filename)
+		if err != nil {
+			log.Printf("%s: failed to move to hot storage: %v", filename, err)
+			result.Failed++
+			continue
+		}
+		if !ready {
+			result.Waiting++
+			continue
+		}
+
+		if err := s.setTier(ctx, filename, models.TierHot); err != nil {
+			log.Printf("%s: failed to update media records: %v", filename, err)
+			result.Failed++
+			continue
+		}
+		log.Printf("%s: moved to hot storage", filename)
+		result.Warmed++
+	}
+	return nil
+}
+
+// cool moves the objects of media matching any rule to cold storage. An
+// object is moved only when every media sharing it is hot and matches.
+func (s *LifecycleService) cool(ctx context.Context, result *LifecycleResult, rules []LifecycleRule) error {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	lastUsed := "MAX(COALESCE(last_viewed_at, created_at))"
+
+	var conditions []string
+	var args []interface{}
+	for _, rule := range rules {
+		switch rule.Kind {
+		case RuleNoViews:
+			conditions = append(conditions, lastUsed+" < ?")
+		case RuleAge:
+			conditions = append(conditions, "MAX(created_at) < ?")
+		}
+		args = append(args, now.Add(-rule.After))
+	}
+
+	var filenames []string
+	err := s.db.WithContext(ctx).Model(&models.Media{}).
+		Where("status = ?", models.MediaReady).
+		Group("filename").
+		Having("SUM(CASE WHEN storage_tier = ? THEN 0 ELSE 1 END) = 0", models.TierHot).
+		Having(lastUsed+" < ?", now.AddDate(0, 0, -s.opts.RestoreDays)).
+		Having("("+strings.Join(conditions, " OR ")+")", args...).
+		Order("filename").
+		Pluck("filename", &filenames).Error
+	if err != nil {
+		return err
+	}
+
+	for _, filename := range filenames {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if s.opts.DryRun {
+			log.Printf("%s: would move to cold storage", filename)
+			continue
+		}
+
+		if err := s.moveToCold(ctx, filename); err != nil {
+			log.Printf("%s: failed to move to cold storage: %v", filename, err)
+			result.Failed++
+			continue
+		}
+
+		if err := s.setTier(ctx, filename, models.TierCold); err != nil {
+			log.Printf("%s: failed to update media records: %v", filename, err)
+			result.Failed++
+			continue
+		}
+		log.Printf("%s: moved to cold storage", filename)
+		result.Cooled++
+	}
+	return nil
+}
+
+func (s *LifecycleService) moveToCold(ctx context.Context, filename string) error {
+	if tiering := s.storageProvider.Tiering(); tiering != nil {
+		return tiering.MoveToCold(ctx, filename)
+	}
+	return s.storageProvider.SetStorageClass(ctx, filename, s.opts.ColdClass)
+}
+
+// moveToHot reports false while an archived object is still being restored.
+func (s *LifecycleService) moveToHot(ctx context.Context, filename string) (bool, error) {
+	if tiering := s.storageProvider.Tiering(); tiering != nil {
+		return true, tiering.MoveToHot(ctx, filename)
+	}
+
+	ready, err := s.storageProvider.Restore(ctx, filename, s.opts.RestoreDays)
+	if err != nil || !ready {
+		return false, err
+	}
+	return true, s.storageProvider.SetStorageClass(ctx, filename, "")
+}
+
+// setTier records tier on every media and media version sharing the object,
+// including media added while the object was being moved.
+func (s *LifecycleService) setTier(ctx context.Context, filename string, tier string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Media{}).
+			Where("filename = ? AND storage_tier <> ?", filename, tier).
+			Update("storage_tier", tier).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.MediaVersion{}).
+			Where("filename = ? AND storage_tier <> ?", filename, tier).
+			Update("storage_tier", tier).Error
+	})
+}
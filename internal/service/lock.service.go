@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"hash/fnv"
+	"log"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Locker takes Postgres advisory locks, so requests served by different API
+// replicas exclude each other. A lock is held on a connection of its own and
+// goes away with it, so a replica that dies never leaves one behind.
+type Locker struct {
+	db *gorm.DB
+}
+
+func NewLocker(db *gorm.DB) *Locker {
+	return &Locker{db: db}
+}
+
+// TryLock takes the lock on id within kind without waiting. It returns false
+// when another request holds it; otherwise unlock must be called once done.
+func (l *Locker) TryLock(ctx context.Context, kind string, id uuid.UUID) (unlock func(), ok bool, err error) {
+	sqlDB, err := l.db.DB()
+	if err != nil {
+		return nil, false, err
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to take %s lock: %w", kind, err)
+	}
+
+	key := lockKey(kind, id)
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&ok); err != nil {
+		conn.Close()
+		return nil, false, fmt.Errorf("failed to take %s lock: %w", kind, err)
+	}
+	if !ok {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	return func() {
+		// The request may be gone by now, the lock must still be let go
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", key); err != nil {
+			// Back in the pool the connection would keep holding the lock,
+			// so it is thrown away and the lock goes with it
+			log.Printf("Failed to release %s lock, dropping its connection: %v", kind, err)
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}, true, nil
+}
+
+// lockKey maps a lock to the 64-bit key Postgres takes. A collision makes
+// TryLock fail for an unrelated request while the other holds the lock.
+func lockKey(kind string, id uuid.UUID) int64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(kind))
+	hash.Write(id[:])
+	return int64(hash.Sum64())
+}
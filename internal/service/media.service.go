@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"io"
 
 	"github.com/google/uuid"
@@ -16,13 +17,13 @@ func NewMediaService(service *Service) *MediaService {
 	return &MediaService{Service: service}
 }
 
-func (s *MediaService) UploadMedia(file io.Reader, filename, title, description, genre, tags string, userID string, isPublic bool) (*models.Media, error) {
+func (s *MediaService) UploadMedia(ctx context.Context, file io.Reader, filename, title, description, genre, tags string, userID string, isPublic bool) (*models.Media, error) {
 	parsedUserID, err := uuid.Parse(userID)
 	if err != nil {
 		return nil, ErrInvalidCredentials
 	}
 
-	storageURL, err := s.storageProvider.UploadFile(file, filename, "application/octet-stream")
+	storageURL, err := s.storageProvider.UploadFile(ctx, file, filename, "application/octet-stream")
 	if err != nil {
 		return nil, err
 	}
@@ -61,7 +62,7 @@ func (s *MediaService) ListPublicMedia(page, limit int, genre, search string) ([
 }
 
 // DeleteMedia deletes media by ID and user ID
-func (s *MediaService) DeleteMedia(id, userID string) error {
+func (s *MediaService) DeleteMedia(ctx context.Context, id, userID string) error {
 	// Delete from storage
 	media, err := s.mediaRepo.FindByID(id)
 	if err != nil {
@@ -77,18 +78,18 @@ func (s *MediaService) DeleteMedia(id, userID string) error {
 		return ErrAccessDenied
 	}
 
-	if err := s.storageProvider.DeleteFile(media.Filename); err != nil {
+	if err := s.storageProvider.DeleteFile(ctx, media.Filename); err != nil {
 		return err
 	}
 
 	return s.mediaRepo.DeleteByIDAndUserID(id, userID)
 }
 
-func (s *MediaService) GenerateStreamURL(id string) (string, error) {
+func (s *MediaService) GenerateStreamURL(ctx context.Context, id string) (string, error) {
 	media, err := s.mediaRepo.FindByID(id)
 	if err != nil {
 		return "", ErrMediaNotFound
 	}
 
-	return s.storageProvider.GeneratePresignedURL(media.Filename, 10800) // 3 hour expiry
+	return s.storageProvider.GeneratePresignedURL(ctx, media.Filename, 10800) // 3 hour expiry
 }
@@ -0,0 +1,321 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/interfaces"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	MigrationVerified = "verified"
+	MigrationFailed   = "failed"
+)
+
+// MigrationOptions configures a StorageMigrator run.
+type MigrationOptions struct {
+	Source      string // registered driver names
+	Destination string
+	Concurrency int
+	DryRun      bool
+	// VerifyChecksum also compares the source bytes with Media.Checksum. It
+	// only applies when objects are stored unencrypted.
+	VerifyChecksum bool
+}
+
+// MigrationResult summarises a migration run.
+type MigrationResult struct {
+	Objects int
+	Copied  int
+	Skipped int // verified by an earlier run
+	Failed  int
+	Bytes   int64
+}
+
+// StorageMigrator copies every object referenced by a media record from one
+// storage provider to another under the same key. Each copy is read back and
+// compared by SHA-256 before the records' StorageURL is rewritten, and
+// progress is kept in the migration_objects table so a rerun only retries
+// what is left.
+type StorageMigrator struct {
+	db          *gorm.DB
+	source      interfaces.Provider
+	destination interfaces.Provider
+	opts        MigrationOptions
+}
+
+func NewStorageMigrator(db *gorm.DB, source, destination interfaces.Provider, opts MigrationOptions) *StorageMigrator {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+
+	return &StorageMigrator{
+		db:          db,
+		source:      source,
+		destination: destination,
+		opts:        opts,
+	}
+}
+
+// migrationObject is an object key together with the checksum recorded for it.
+type migrationObject struct {
+	Filename string
+	Checksum string
+}
+
+func (m *StorageMigrator) Run(ctx context.Context) (MigrationResult, error) {
+	var result MigrationResult
+
+	var objects []migrationObject
+	err := m.db.WithContext(ctx).Model(&models.Media{}).
+		Select("filename, MAX(checksum) AS checksum").
+		Where("status = ?", models.MediaReady).
+		Group("filename").Order("filename").
+		Scan(&objects).Error
+	if err != nil {
+		return result, err
+	}
+
+	// Prior versions of media keep their objects too
+	var versions []migrationObject
+	err = m.db.WithContext(ctx).Model(&models.MediaVersion{}).
+		Select("filename, MAX(checksum) AS checksum").
+		Group("filename").Order("filename").
+		Scan(&versions).Error
+	if err != nil {
+		return result, err
+	}
+
+	listed := make(map[string]bool, len(objects))
+	for _, object := range objects {
+		listed[object.Filename] = true
+	}
+	for _, object := range versions {
+		if !listed[object.Filename] {
+			objects = append(objects, object)
+		}
+	}
+
+	// So do thumbnails, which have no checksum to verify against
+	var thumbnails []string
+	if err := m.db.WithContext(ctx).Model(&models.Thumbnail{}).Order("filename").Pluck("filename", &thumbnails).Error; err != nil {
+		return result, err
+	}
+	for _, filename := range thumbnails {
+		objects = append(objects, migrationObject{Filename: filename})
+	}
+
+	// And stream packages, whose objects are found by listing their prefix
+	var prefixes []string
+	err = m.db.WithContext(ctx).Model(&models.StreamPackage{}).
+		Where("status = ?", models.PackageReady).
+		Order("prefix").Pluck("prefix", &prefixes).Error
+	if err != nil {
+		return result, err
+	}
+	for _, prefix := range prefixes {
+		token := ""
+		for {
+			page, err := m.source.List(ctx, prefix, token, 0)
+			if err != nil {
+				return result, fmt.Errorf("failed to list stream package %s: %w", prefix, err)
+			}
+			for _, object := range page.Objects {
+				objects = append(objects, migrationObject{Filename: object.Key})
+			}
+			if page.NextToken == "" {
+				break
+			}
+			token = page.NextToken
+		}
+	}
+
+	var verified []string
+	err = m.db.WithContext(ctx).Model(&models.MigrationObject{}).
+		Where("source = ? AND destination = ? AND status = ?", m.opts.Source, m.opts.Destination, MigrationVerified).
+		Pluck("filename", &verified).Error
+	if err != nil {
+		return result, err
+	}
+
+	done := make(map[string]bool, len(verified))
+	for _, filename := range verified {
+		done[filename] = true
+	}
+
+	result.Objects = len(objects)
+
+	var mu sync.Mutex
+	jobs := make(chan migrationObject)
+	var wg sync.WaitGroup
+
+	for i := 0; i < m.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for object := range jobs {
+				size, err := m.migrate(ctx, object)
+
+				mu.Lock()
+				if err != nil {
+					log.Printf("%s: %v", object.Filename, err)
+					result.Failed++
+				} else {
+					result.Copied++
+					result.Bytes += size
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, object := range objects {
+		if done[object.Filename] {
+			result.Skipped++
+			continue
+		}
+
+		select {
+		case jobs <- object:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return result, ctx.Err()
+}
+
+// migrate copies and verifies one object, returning its size.
+func (m *StorageMigrator) migrate(ctx context.Context, object migrationObject) (int64, error) {
+	info, err := m.source.Stat(ctx, object.Filename)
+	if err != nil {
+		return 0, m.fail(ctx, object, fmt.Errorf("failed to stat source object: %w", err))
+	}
+
+	if m.opts.DryRun {
+		log.Printf("%s: would copy %d bytes", object.Filename, info.Size)
+		return info.Size, nil
+	}
+
+	sourceSum, size, err := m.copy(ctx, object.Filename, info.ContentType)
+	if err != nil {
+		return 0, m.fail(ctx, object, err)
+	}
+
+	if m.opts.VerifyChecksum && object.Checksum != "" && sourceSum != object.Checksum {
+		return 0, m.fail(ctx, object, errors.New("source object does not match the recorded checksum"))
+	}
+
+	destinationSum, destinationSize, err := m.hash(ctx, m.destination, object.Filename)
+	if err != nil {
+		return 0, m.fail(ctx, object, fmt.Errorf("failed to read back copy: %w", err))
+	}
+	if destinationSum != sourceSum || destinationSize != size {
+		return 0, m.fail(ctx, object, errors.New("copy does not match the source"))
+	}
+
+	storageURL, err := m.destination.GetFileURL(ctx, object.Filename)
+	if err != nil {
+		return 0, m.fail(ctx, object, err)
+	}
+
+	// Point the records at the new copy and mark it done in one step
+	err = m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Media{}).Where("filename = ?", object.Filename).Update("storage_url", storageURL).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.MediaVersion{}).Where("filename = ?", object.Filename).Update("storage_url", storageURL).Error; err != nil {
+			return err
+		}
+		return m.save(tx, object, MigrationVerified, size, sourceSum, "")
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to update media records: %w", err)
+	}
+
+	log.Printf("%s: copied %d bytes", object.Filename, size)
+	return size, nil
+}
+
+// copy streams an object from source to destination and returns the SHA-256
+// and size of what was read.
+func (m *StorageMigrator) copy(ctx context.Context, filename string, contentType string) (string, int64, error) {
+	body, err := m.source.Open(ctx, filename, 0, -1)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read source object: %w", err)
+	}
+	defer body.Close()
+
+	hash := sha256.New()
+	counter := &countingReader{r: io.TeeReader(body, hash)}
+
+	if _, err := m.destination.UploadFile(ctx, counter, filename, contentType); err != nil {
+		return "", 0, fmt.Errorf("failed to write copy: %w", err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), counter.n, nil
+}
+
+func (m *StorageMigrator) hash(ctx context.Context, reader interfaces.Provider, filename string) (string, int64, error) {
+	body, err := reader.Open(ctx, filename, 0, -1)
+	if err != nil {
+		return "", 0, err
+	}
+	defer body.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, body)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// fail records a failed object and returns err.
+func (m *StorageMigrator) fail(ctx context.Context, object migrationObject, err error) error {
+	if !m.opts.DryRun {
+		m.save(m.db.WithContext(context.WithoutCancel(ctx)), object, MigrationFailed, 0, "", err.Error())
+	}
+	return err
+}
+
+func (m *StorageMigrator) save(tx *gorm.DB, object migrationObject, status string, size int64, checksum string, lastError string) error {
+	progress := models.MigrationObject{
+		Filename:    object.Filename,
+		Source:      m.opts.Source,
+		Destination: m.opts.Destination,
+		Status:      status,
+		Size:        size,
+		Checksum:    checksum,
+		LastError:   lastError,
+	}
+
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "filename"}, {Name: "source"}, {Name: "destination"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status", "size", "checksum", "last_error", "updated_at"}),
+	}).Create(&progress).Error
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
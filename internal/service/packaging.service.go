@@ -0,0 +1,976 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/storage"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Segment formats of a package.
+const (
+	SegmentFMP4 = "fmp4" // fragmented MP4, with an init.mp4 per rendition
+	SegmentTS   = "ts"   // MPEG-TS, for old players
+)
+
+// MasterPlaylist is the name of the playlist listing the renditions of a
+// package.
+const MasterPlaylist = "master.m3u8"
+
+// DashManifest is the name of the DASH manifest of an fMP4 package.
+const DashManifest = "manifest.mpd"
+
+// audioRendition names the only rendition of audio-only media.
+const audioRendition = "audio"
+
+// Rendition is one rung of the HLS bitrate ladder. Video is scaled to fit
+// within Width and Height, keeping its aspect ratio.
+type Rendition struct {
+	Name         string
+	Width        int
+	Height       int
+	VideoBitrate int // in kbps
+	AudioBitrate int // in kbps
+}
+
+var renditionName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ParseRenditions parses renditions written as
+// "name:WIDTHxHEIGHT:video kbps:audio kbps", such as "720p:1280x720:2800:128".
+func ParseRenditions(specs []string) ([]Rendition, error) {
+	var renditions []Rendition
+	seen := make(map[string]bool)
+	for _, spec := range specs {
+		fields := strings.Split(spec, ":")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("invalid rendition %q: want name:WIDTHxHEIGHT:video kbps:audio kbps", spec)
+		}
+
+		name := fields[0]
+		if !renditionName.MatchString(name) || name == audioRendition {
+			return nil, fmt.Errorf("invalid rendition name %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate rendition %q", name)
+		}
+		seen[name] = true
+
+		width, height, ok := strings.Cut(fields[1], "x")
+		rendition := Rendition{Name: name}
+		var errs [4]error
+		rendition.Width, errs[0] = strconv.Atoi(width)
+		rendition.Height, errs[1] = strconv.Atoi(height)
+		rendition.VideoBitrate, errs[2] = strconv.Atoi(fields[2])
+		rendition.AudioBitrate, errs[3] = strconv.Atoi(fields[3])
+		if !ok || errors.Join(errs[:]...) != nil ||
+			rendition.Width <= 0 || rendition.Height <= 0 || rendition.VideoBitrate <= 0 || rendition.AudioBitrate <= 0 {
+			return nil, fmt.Errorf("invalid rendition %q: sizes and bitrates must be positive numbers", spec)
+		}
+
+		renditions = append(renditions, rendition)
+	}
+
+	if len(renditions) == 0 {
+		return nil, errors.New("no renditions configured")
+	}
+
+	// Highest first, the order players see them in the master playlist
+	sort.SliceStable(renditions, func(i, j int) bool {
+		return renditions[i].Height > renditions[j].Height
+	})
+	return renditions, nil
+}
+
+// PackagingResult counts what a packaging run did.
+type PackagingResult struct {
+	Packaged int
+	Failed   int
+}
+
+// PackagingService packages the files of media for HLS with a local ffmpeg
+// binary: video becomes a ladder of H.264/AAC renditions, audio a single AAC
+// rendition. fMP4 packages get a DASH manifest over the same segments.
+// Packages are made outside of requests, by transcode jobs or Run, and
+// stored through the storage provider under streams/{media_id}/v{version}/.
+type PackagingService struct {
+	db              *gorm.DB
+	storageProvider *storage.StorageProvider
+	cfg             config.ProcessConfig
+}
+
+func NewPackagingService(db *gorm.DB, storageProvider *storage.StorageProvider, cfg config.ProcessConfig) *PackagingService {
+	return &PackagingService{
+		db:              db,
+		storageProvider: storageProvider,
+		cfg:             cfg,
+	}
+}
+
+// Enqueue marks the current file of media to be packaged. The package of an
+// earlier file is deleted, so the media streams progressively until the new
+// one is ready. A package of the same file is left alone unless it failed.
+func (s *PackagingService) Enqueue(ctx context.Context, media *models.Media) error {
+	if !s.cfg.Transcode || media.ProbeStatus == models.ProbeCorrupt {
+		return nil
+	}
+
+	version := max(media.Version, 1)
+	prefix := packagePrefix(media.ID, version)
+
+	var pkg models.StreamPackage
+	err := s.db.WithContext(ctx).Where("media_id = ?", media.ID).First(&pkg).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return s.db.WithContext(ctx).Create(&models.StreamPackage{
+			MediaID: media.ID,
+			Version: version,
+			Status:  models.PackagePending,
+			Prefix:  prefix,
+		}).Error
+	}
+	if err != nil {
+		return err
+	}
+	if pkg.Version == version && pkg.Status != models.PackageFailed {
+		return nil
+	}
+
+	if pkg.Prefix != prefix {
+		if err := s.deleteObjects(ctx, pkg.Prefix); err != nil {
+			return err
+		}
+	}
+
+	return s.db.WithContext(ctx).Model(&pkg).Updates(map[string]interface{}{
+		"version":        version,
+		"status":         models.PackagePending,
+		"prefix":         prefix,
+		"segment_format": "",
+		"renditions":     "",
+		"dash":           false,
+		"attempts":       0,
+		"last_error":     "",
+	}).Error
+}
+
+// Ready returns the package of the current file of media, or nil when there
+// is none ready.
+func (s *PackagingService) Ready(ctx context.Context, media *models.Media) (*models.StreamPackage, error) {
+	var pkg models.StreamPackage
+	err := s.db.WithContext(ctx).
+		Where("media_id = ? AND version = ? AND status = ?", media.ID, max(media.Version, 1), models.PackageReady).
+		First(&pkg).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pkg, nil
+}
+
+// Release deletes the package of a media inside tx, as part of deleting the
+// media. It returns the prefixes of the packages, whose objects are left in
+// storage for the caller to delete once tx commits.
+func (s *PackagingService) Release(tx *gorm.DB, mediaID string) ([]string, error) {
+	var packages []models.StreamPackage
+	if err := tx.Where("media_id = ?", mediaID).Find(&packages).Error; err != nil {
+		return nil, err
+	}
+	if len(packages) == 0 {
+		return nil, nil
+	}
+
+	if err := tx.Where("media_id = ?", mediaID).Delete(&models.StreamPackage{}).Error; err != nil {
+		return nil, err
+	}
+	prefixes := make([]string, 0, len(packages))
+	for _, pkg := range packages {
+		prefixes = append(prefixes, pkg.Prefix)
+	}
+	return prefixes, nil
+}
+
+// Manifest reads a playlist or the DASH manifest of pkg. The URIs of segments
+// in media playlists and the manifest are replaced by what sign returns for
+// their object keys; other URIs are relative and left alone. A nil sign
+// leaves the file as it is.
+func (s *PackagingService) Manifest(ctx context.Context, pkg *models.StreamPackage, name string, sign func(key string) (string, error)) ([]byte, error) {
+	key := pkg.Prefix + name
+	body, err := s.storageProvider.Open(ctx, key, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if sign == nil || bytes.Contains(data, []byte("#EXT-X-STREAM-INF")) {
+		return data, nil
+	}
+	if path.Ext(name) == ".mpd" {
+		return rewriteManifest(data, pkg.Prefix, sign)
+	}
+	return rewritePlaylist(data, path.Dir(key), sign)
+}
+
+// Package makes the package Enqueue queued for the current file of media and
+// records the outcome. It does nothing when there is no such package to
+// make, e.g. because it is ready or another transcoder is making it.
+func (s *PackagingService) Package(ctx context.Context, media *models.Media) error {
+	renditions, err := s.renditions()
+	if err != nil {
+		return err
+	}
+
+	stale := time.Now().Add(-time.Duration(s.cfg.TranscodeTimeout) * time.Second)
+	claimed := s.db.WithContext(ctx).Model(&models.StreamPackage{}).
+		Where("media_id = ? AND version = ?", media.ID, max(media.Version, 1)).
+		Where("status IN ? OR (status = ? AND updated_at < ?)",
+			[]string{models.PackagePending, models.PackageFailed}, models.PackageProcessing, stale).
+		Updates(map[string]interface{}{"status": models.PackageProcessing, "updated_at": time.Now()})
+	if claimed.Error != nil {
+		return claimed.Error
+	}
+	if claimed.RowsAffected == 0 {
+		return nil
+	}
+
+	var pkg models.StreamPackage
+	if err := s.db.WithContext(ctx).Where("media_id = ?", media.ID).First(&pkg).Error; err != nil {
+		return err
+	}
+	return s.process(ctx, &pkg, renditions)
+}
+
+// Run packages every pending media, and failed ones with attempts left, with
+// up to concurrency at a time. A failed package is retried once per run.
+func (s *PackagingService) Run(ctx context.Context, concurrency int) (PackagingResult, error) {
+	var result PackagingResult
+
+	renditions, err := s.renditions()
+	if err != nil {
+		return result, err
+	}
+
+	started := time.Now()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var runErr error
+
+	for i := 0; i < max(concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				pkg, err := s.claim(ctx, started)
+				if err != nil {
+					mu.Lock()
+					runErr = err
+					mu.Unlock()
+					return
+				}
+				if pkg == nil {
+					return
+				}
+
+				err = s.process(ctx, pkg, renditions)
+
+				mu.Lock()
+				if err != nil {
+					log.Printf("media %s: packaging failed: %v", pkg.MediaID, err)
+					result.Failed++
+				} else {
+					log.Printf("media %s: packaged", pkg.MediaID)
+					result.Packaged++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if runErr != nil {
+		return result, runErr
+	}
+	return result, ctx.Err()
+}
+
+// renditions checks the packaging settings and that ffmpeg is installed,
+// returning the configured renditions.
+func (s *PackagingService) renditions() ([]Rendition, error) {
+	renditions, err := ParseRenditions(s.cfg.Renditions)
+	if err != nil {
+		return nil, err
+	}
+	if s.cfg.SegmentFormat != SegmentFMP4 && s.cfg.SegmentFormat != SegmentTS {
+		return nil, fmt.Errorf("invalid segment format %q: must be %s or %s", s.cfg.SegmentFormat, SegmentFMP4, SegmentTS)
+	}
+	if _, err := exec.LookPath(s.cfg.FFmpegPath); err != nil {
+		return nil, fmt.Errorf("ffmpeg not found: %w", err)
+	}
+	return renditions, nil
+}
+
+// claim takes the next package to make, or returns nil when there is none.
+// Packages left processing for longer than the timeout belong to a
+// transcoder that died and are taken over.
+func (s *PackagingService) claim(ctx context.Context, started time.Time) (*models.StreamPackage, error) {
+	stale := time.Now().Add(-time.Duration(s.cfg.TranscodeTimeout) * time.Second)
+	due := func(db *gorm.DB) *gorm.DB {
+		return db.Where("status = ? OR (status = ? AND attempts < ? AND updated_at < ?) OR (status = ? AND updated_at < ?)",
+			models.PackagePending,
+			models.PackageFailed, s.cfg.TranscodeAttempts, started,
+			models.PackageProcessing, stale)
+	}
+
+	for {
+		var pkg models.StreamPackage
+		err := s.db.WithContext(ctx).Scopes(due).Order("updated_at").First(&pkg).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Another transcoder may have claimed it in the meantime
+		claimed := s.db.WithContext(ctx).Model(&models.StreamPackage{}).Scopes(due).
+			Where("id = ? AND version = ?", pkg.ID, pkg.Version).
+			Updates(map[string]interface{}{"status": models.PackageProcessing, "updated_at": time.Now()})
+		if claimed.Error != nil {
+			return nil, claimed.Error
+		}
+		if claimed.RowsAffected == 1 {
+			pkg.Status = models.PackageProcessing
+			return &pkg, nil
+		}
+	}
+}
+
+// process makes a claimed package and records the outcome.
+func (s *PackagingService) process(ctx context.Context, pkg *models.StreamPackage, renditions []Rendition) error {
+	made, dash, err := s.build(ctx, pkg, renditions)
+	if err != nil {
+		s.deleteObjects(context.WithoutCancel(ctx), pkg.Prefix)
+		s.db.WithContext(context.WithoutCancel(ctx)).Model(&models.StreamPackage{}).
+			Where("id = ? AND version = ? AND status = ?", pkg.ID, pkg.Version, models.PackageProcessing).
+			Updates(map[string]interface{}{
+				"status":     models.PackageFailed,
+				"attempts":   gorm.Expr("attempts + 1"),
+				"last_error": err.Error(),
+			})
+		return err
+	}
+
+	var names []string
+	for _, r := range made {
+		names = append(names, r.Name)
+	}
+
+	done := s.db.WithContext(ctx).Model(&models.StreamPackage{}).
+		Where("id = ? AND version = ? AND status = ?", pkg.ID, pkg.Version, models.PackageProcessing).
+		Updates(map[string]interface{}{
+			"status":         models.PackageReady,
+			"segment_format": s.cfg.SegmentFormat,
+			"renditions":     strings.Join(names, ","),
+			"dash":           dash,
+			"last_error":     "",
+		})
+	if done.Error != nil {
+		return done.Error
+	}
+
+	// The file was replaced while it was packaged
+	if done.RowsAffected == 0 {
+		s.deleteObjects(ctx, pkg.Prefix)
+		return errors.New("media file changed during packaging")
+	}
+	return nil
+}
+
+// build transcodes the media file of pkg and uploads the result, returning
+// the renditions made and whether there is a DASH manifest.
+func (s *PackagingService) build(ctx context.Context, pkg *models.StreamPackage, renditions []Rendition) ([]Rendition, bool, error) {
+	var media models.Media
+	err := s.db.WithContext(ctx).Where("id = ? AND status = ?", pkg.MediaID, models.MediaReady).First(&media).Error
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to load media: %w", err)
+	}
+	if max(media.Version, 1) != pkg.Version {
+		return nil, false, errors.New("media file changed before packaging")
+	}
+
+	dir, err := os.MkdirTemp("", "package-*")
+	if err != nil {
+		return nil, false, err
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "source")
+	body, err := s.storageProvider.Open(ctx, media.Filename, 0, -1)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read media file: %w", err)
+	}
+	err = writeFile(source, body)
+	body.Close()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read media file: %w", err)
+	}
+
+	output := filepath.Join(dir, "package")
+	made, err := s.transcode(ctx, &media, source, output, renditions)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// DASH players read the same fMP4 segments, HLS still works without it
+	dash := false
+	if s.cfg.SegmentFormat == SegmentFMP4 {
+		if err := writeManifest(output, made, s.cfg.SegmentSeconds); err != nil {
+			log.Printf("media %s: no DASH manifest: %v", media.ID, err)
+		} else {
+			dash = true
+		}
+	}
+
+	err = filepath.WalkDir(output, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(output, file)
+		if err != nil {
+			return err
+		}
+		return s.upload(ctx, file, pkg.Prefix+filepath.ToSlash(rel))
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to upload package: %w", err)
+	}
+	return made, dash, nil
+}
+
+// transcode runs ffmpeg on source, writing the master playlist to output and
+// each rendition to a directory of its own. It returns the renditions made.
+func (s *PackagingService) transcode(ctx context.Context, media *models.Media, source string, output string, renditions []Rendition) ([]Rendition, error) {
+	video := hasPicture(media)
+	// Unprobed files are assumed to have sound
+	audio := media.AudioCodec != "" || media.ProbeStatus == ""
+	if !video && !audio {
+		return nil, errors.New("media has no audio or video stream")
+	}
+
+	if video {
+		renditions = fitRenditions(renditions, media.Height)
+	} else {
+		renditions = []Rendition{{Name: audioRendition, AudioBitrate: s.cfg.AudioBitrate}}
+	}
+
+	if err := os.MkdirAll(output, 0o700); err != nil {
+		return nil, err
+	}
+
+	// fMP4 segments are CMAF tracks, which hold a single stream. Audio is
+	// then a rendition of its own that every video rendition plays with,
+	// which is also how DASH players expect it.
+	shared := video && audio && s.cfg.SegmentFormat == SegmentFMP4
+
+	args := append([]string{"-v", "error", "-y"}, inputArgs(mediaFormats, source)...)
+	var streams []string
+
+	if video {
+		graph := fmt.Sprintf("[0:v]split=%d", len(renditions))
+		for i := range renditions {
+			graph += fmt.Sprintf("[v%d]", i)
+		}
+		for i, r := range renditions {
+			graph += fmt.Sprintf(";[v%d]scale=w=%d:h=%d:force_original_aspect_ratio=decrease:force_divisible_by=2[r%d]", i, r.Width, r.Height, i)
+		}
+		args = append(args, "-filter_complex", graph)
+	}
+
+	for i, r := range renditions {
+		var stream []string
+		if video {
+			args = append(args,
+				"-map", fmt.Sprintf("[r%d]", i),
+				fmt.Sprintf("-c:v:%d", i), "libx264",
+				fmt.Sprintf("-b:v:%d", i), fmt.Sprintf("%dk", r.VideoBitrate),
+				fmt.Sprintf("-maxrate:v:%d", i), fmt.Sprintf("%dk", r.VideoBitrate*107/100),
+				fmt.Sprintf("-bufsize:v:%d", i), fmt.Sprintf("%dk", r.VideoBitrate*3/2))
+			stream = append(stream, fmt.Sprintf("v:%d", i))
+		}
+		if audio && !shared {
+			args = append(args, audioArgs(i, r.AudioBitrate)...)
+			stream = append(stream, fmt.Sprintf("a:%d", i))
+		}
+		if shared {
+			stream = append(stream, "agroup:"+audioRendition)
+		}
+		streams = append(streams, strings.Join(append(stream, "name:"+r.Name), ","))
+	}
+
+	if shared {
+		args = append(args, audioArgs(0, s.cfg.AudioBitrate)...)
+		streams = append(streams, fmt.Sprintf("a:0,agroup:%s,name:%s", audioRendition, audioRendition))
+		renditions = append(renditions[:len(renditions):len(renditions)], Rendition{Name: audioRendition, AudioBitrate: s.cfg.AudioBitrate})
+	}
+
+	if video {
+		// Keyframes on segment boundaries, so every rendition switches cleanly
+		args = append(args,
+			"-preset", s.cfg.VideoPreset,
+			"-pix_fmt", "yuv420p",
+			"-sc_threshold", "0",
+			"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", s.cfg.SegmentSeconds))
+	}
+
+	segment := "seg_%05d.ts"
+	args = append(args,
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(s.cfg.SegmentSeconds),
+		"-hls_playlist_type", "vod",
+		"-hls_flags", "independent_segments")
+	if s.cfg.SegmentFormat == SegmentFMP4 {
+		segment = "seg_%05d.m4s"
+		args = append(args, "-hls_segment_type", "fmp4", "-hls_fmp4_init_filename", "init.mp4")
+	} else {
+		args = append(args, "-hls_segment_type", "mpegts")
+	}
+	args = append(args,
+		"-hls_segment_filename", filepath.Join(output, "%v", segment),
+		"-master_pl_name", MasterPlaylist,
+		"-var_stream_map", strings.Join(streams, " "),
+		filepath.Join(output, "%v", "index.m3u8"))
+
+	runCtx, cancel := context.WithTimeout(ctx, time.Duration(s.cfg.TranscodeTimeout)*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(runCtx, s.cfg.FFmpegPath, args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if runCtx.Err() != nil {
+		return nil, errors.New("transcoding timed out")
+	}
+	if err != nil {
+		// ffmpeg names the file first, which is only a temporary path
+		return nil, errors.New(strings.TrimPrefix(firstLine(stderr.String(), err.Error()), source+": "))
+	}
+
+	if _, err := os.Stat(filepath.Join(output, MasterPlaylist)); err != nil {
+		return nil, errors.New("ffmpeg wrote no master playlist")
+	}
+	return renditions, nil
+}
+
+// audioArgs encodes the audio of the source as the index-th audio stream of
+// the output, in stereo AAC.
+func audioArgs(index int, bitrate int) []string {
+	return []string{
+		"-map", "0:a:0",
+		fmt.Sprintf("-c:a:%d", index), "aac",
+		fmt.Sprintf("-b:a:%d", index), fmt.Sprintf("%dk", bitrate),
+		fmt.Sprintf("-ac:a:%d", index), "2",
+	}
+}
+
+func (s *PackagingService) upload(ctx context.Context, file string, key string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = s.storageProvider.UploadFile(ctx, f, key, packageContentType(key))
+	return err
+}
+
+// deleteObjects deletes every object under prefix. Objects deleted by
+// someone else in the meantime are skipped.
+func (s *PackagingService) deleteObjects(ctx context.Context, prefix string) error {
+	token := ""
+	for {
+		page, err := s.storageProvider.List(ctx, prefix, token, 0)
+		if err != nil {
+			return err
+		}
+		for _, object := range page.Objects {
+			err := s.storageProvider.DeleteFile(ctx, object.Key)
+			if err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+				return err
+			}
+		}
+		if page.NextToken == "" {
+			return nil
+		}
+		token = page.NextToken
+	}
+}
+
+// fitRenditions drops renditions taller than the video, since scaling up
+// adds bytes but no detail. The smallest one is always kept. An unknown
+// height keeps them all.
+func fitRenditions(renditions []Rendition, height int) []Rendition {
+	if height == 0 {
+		return renditions
+	}
+
+	var fit []Rendition
+	for _, r := range renditions {
+		if r.Height <= height {
+			fit = append(fit, r)
+		}
+	}
+	if len(fit) == 0 {
+		return renditions[len(renditions)-1:]
+	}
+	return fit
+}
+
+// rewritePlaylist replaces the URIs in a media playlist, which are relative
+// to dir, with what sign returns for their keys.
+func rewritePlaylist(data []byte, dir string, sign func(key string) (string, error)) ([]byte, error) {
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			// The init segment of fMP4 renditions
+			start := strings.Index(line, `URI="`)
+			if start >= 0 {
+				start += len(`URI="`)
+				end := strings.IndexByte(line[start:], '"')
+				if end < 0 {
+					return nil, errors.New("malformed EXT-X-MAP tag")
+				}
+				signed, err := sign(path.Join(dir, line[start:start+end]))
+				if err != nil {
+					return nil, err
+				}
+				line = line[:start] + signed + line[start+end:]
+			}
+		case line != "" && !strings.HasPrefix(line, "#"):
+			signed, err := sign(path.Join(dir, line))
+			if err != nil {
+				return nil, err
+			}
+			line = signed
+		}
+
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	return out.Bytes(), scanner.Err()
+}
+
+// packagePrefix is where the package of one version of a media is stored.
+func packagePrefix(mediaID uuid.UUID, version int) string {
+	return fmt.Sprintf("streams/%s/v%d/", mediaID, version)
+}
+
+// PackagePrefixOf returns the package prefix an object key falls under, or
+// "" when it is not part of a package.
+func PackagePrefixOf(key string) string {
+	parts := strings.SplitN(key, "/", 4)
+	if len(parts) < 4 || parts[0] != "streams" {
+		return ""
+	}
+	return strings.Join(parts[:3], "/") + "/"
+}
+
+func packageContentType(key string) string {
+	switch path.Ext(key) {
+	case ".m3u8":
+		return "application/vnd.apple.mpegurl"
+	case ".m4s":
+		return "video/iso.segment"
+	case ".mp4":
+		return "video/mp4"
+	case ".mpd":
+		return "application/dash+xml"
+	case ".ts":
+		return "video/mp2t"
+	}
+	return "application/octet-stream"
+}
+
+// mpd is the subset of a DASH manifest written for packages: a static
+// presentation whose representations list their segments, so the file names
+// ffmpeg chose for HLS need not follow a template.
+type mpd struct {
+	XMLName       xml.Name  `xml:"urn:mpeg:dash:schema:mpd:2011 MPD"`
+	Profiles      string    `xml:"profiles,attr"`
+	Type          string    `xml:"type,attr"`
+	Duration      string    `xml:"mediaPresentationDuration,attr"`
+	MinBufferTime string    `xml:"minBufferTime,attr"`
+	Period        mpdPeriod `xml:"Period"`
+}
+
+type mpdPeriod struct {
+	ID             string             `xml:"id,attr"`
+	AdaptationSets []mpdAdaptationSet `xml:"AdaptationSet"`
+}
+
+type mpdAdaptationSet struct {
+	ID               int                 `xml:"id,attr"`
+	ContentType      string              `xml:"contentType,attr"`
+	MimeType         string              `xml:"mimeType,attr"`
+	SegmentAlignment bool                `xml:"segmentAlignment,attr"`
+	StartWithSAP     int                 `xml:"startWithSAP,attr"`
+	Representations  []mpdRepresentation `xml:"Representation"`
+}
+
+type mpdRepresentation struct {
+	ID            string         `xml:"id,attr"`
+	Codecs        string         `xml:"codecs,attr"`
+	Bandwidth     int            `xml:"bandwidth,attr"`
+	Width         int            `xml:"width,attr,omitempty"`
+	Height        int            `xml:"height,attr,omitempty"`
+	AudioChannels *mpdDescriptor `xml:"AudioChannelConfiguration,omitempty"`
+	SegmentList   mpdSegmentList `xml:"SegmentList"`
+}
+
+type mpdDescriptor struct {
+	SchemeIDURI string `xml:"schemeIdUri,attr"`
+	Value       string `xml:"value,attr"`
+}
+
+type mpdSegmentList struct {
+	Timescale      int `xml:"timescale,attr"`
+	Initialization struct {
+		SourceURL string `xml:"sourceURL,attr"`
+	} `xml:"Initialization"`
+	Timeline []mpdTimelineEntry `xml:"SegmentTimeline>S"`
+	Segments []mpdSegmentURL    `xml:"SegmentURL"`
+}
+
+// mpdTimelineEntry is R+1 segments of D each, in timescale units.
+type mpdTimelineEntry struct {
+	D int64 `xml:"d,attr"`
+	R int   `xml:"r,attr,omitempty"`
+}
+
+type mpdSegmentURL struct {
+	Media string `xml:"media,attr"`
+}
+
+// writeManifest writes a DASH manifest for the fMP4 renditions in output,
+// taking the segments from their HLS playlists and the codecs from their
+// init segments.
+func writeManifest(output string, renditions []Rendition, segmentSeconds int) error {
+	video := mpdAdaptationSet{ID: 0, ContentType: "video", MimeType: "video/mp4", SegmentAlignment: true, StartWithSAP: 1}
+	audio := mpdAdaptationSet{ID: 1, ContentType: "audio", MimeType: "audio/mp4", SegmentAlignment: true, StartWithSAP: 1}
+	var duration int64
+
+	for _, r := range renditions {
+		list, length, err := readSegmentList(output, r.Name)
+		if err != nil {
+			return err
+		}
+		duration = max(duration, length)
+
+		// Shared audio and audio-only media are the renditions without video
+		if r.VideoBitrate == 0 {
+			audio.Representations = append(audio.Representations, mpdRepresentation{
+				ID:        r.Name,
+				Codecs:    "mp4a.40.2", // AAC-LC, what ffmpeg's encoder makes
+				Bandwidth: r.AudioBitrate * 1000,
+				AudioChannels: &mpdDescriptor{
+					SchemeIDURI: "urn:mpeg:dash:23003:3:audio_channel_configuration:2011",
+					Value:       "2",
+				},
+				SegmentList: list,
+			})
+			continue
+		}
+
+		init, err := os.ReadFile(filepath.Join(output, filepath.FromSlash(list.Initialization.SourceURL)))
+		if err != nil {
+			return err
+		}
+		codecs, err := avcCodecs(init)
+		if err != nil {
+			return fmt.Errorf("rendition %s: %w", r.Name, err)
+		}
+		width, height, err := trackSize(init)
+		if err != nil {
+			return fmt.Errorf("rendition %s: %w", r.Name, err)
+		}
+
+		video.Representations = append(video.Representations, mpdRepresentation{
+			ID:          r.Name,
+			Codecs:      codecs,
+			Bandwidth:   r.VideoBitrate * 1000,
+			Width:       width,
+			Height:      height,
+			SegmentList: list,
+		})
+	}
+
+	manifest := mpd{
+		Profiles:      "urn:mpeg:dash:profile:isoff-main:2011",
+		Type:          "static",
+		Duration:      fmt.Sprintf("PT%.3fS", float64(duration)/1000),
+		MinBufferTime: fmt.Sprintf("PT%dS", segmentSeconds),
+		Period:        mpdPeriod{ID: "0"},
+	}
+	for _, set := range []mpdAdaptationSet{video, audio} {
+		if len(set.Representations) > 0 {
+			manifest.Period.AdaptationSets = append(manifest.Period.AdaptationSets, set)
+		}
+	}
+
+	data, err := manifest.marshal()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(output, DashManifest), data, 0o600)
+}
+
+// readSegmentList reads the HLS playlist of a rendition as a DASH segment
+// list in milliseconds, with URLs relative to the package. It also returns
+// the length of the rendition.
+func readSegmentList(output string, name string) (mpdSegmentList, int64, error) {
+	list := mpdSegmentList{Timescale: 1000}
+
+	data, err := os.ReadFile(filepath.Join(output, name, "index.m3u8"))
+	if err != nil {
+		return list, 0, err
+	}
+
+	var total, pending int64
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			_, uri, _ := strings.Cut(line, `URI="`)
+			uri, _, _ = strings.Cut(uri, `"`)
+			list.Initialization.SourceURL = path.Join(name, uri)
+		case strings.HasPrefix(line, "#EXTINF:"):
+			seconds, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			value, err := strconv.ParseFloat(seconds, 64)
+			if err != nil {
+				return list, 0, fmt.Errorf("invalid segment duration %q", line)
+			}
+			pending = int64(math.Round(value * 1000))
+		case line != "" && !strings.HasPrefix(line, "#"):
+			list.Segments = append(list.Segments, mpdSegmentURL{Media: path.Join(name, line)})
+
+			// Runs of segments of the same length are one entry
+			if n := len(list.Timeline); n > 0 && list.Timeline[n-1].D == pending {
+				list.Timeline[n-1].R++
+			} else {
+				list.Timeline = append(list.Timeline, mpdTimelineEntry{D: pending})
+			}
+			total += pending
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return list, 0, err
+	}
+
+	if list.Initialization.SourceURL == "" || len(list.Segments) == 0 {
+		return list, 0, fmt.Errorf("rendition %s has no fMP4 segments", name)
+	}
+	return list, total, nil
+}
+
+// avcCodecs returns the RFC 6381 codecs string of the H.264 track of an init
+// segment, read from its avcC box.
+func avcCodecs(init []byte) (string, error) {
+	i := bytes.Index(init, []byte("avcC"))
+	if i < 0 || len(init) < i+8 {
+		return "", errors.New("init segment has no H.264 configuration")
+	}
+	record := init[i+4:]
+	return fmt.Sprintf("avc1.%02x%02x%02x", record[1], record[2], record[3]), nil
+}
+
+// trackSize returns the display size of the track of an init segment, the
+// last two fields of its tkhd box in 16.16 fixed point.
+func trackSize(init []byte) (int, int, error) {
+	i := bytes.Index(init, []byte("tkhd"))
+	if i < 4 {
+		return 0, 0, errors.New("init segment has no track header")
+	}
+	end := i - 4 + int(binary.BigEndian.Uint32(init[i-4:i]))
+	if end > len(init) || end < i+8 {
+		return 0, 0, errors.New("init segment has a malformed track header")
+	}
+	width := binary.BigEndian.Uint32(init[end-8:end-4]) >> 16
+	height := binary.BigEndian.Uint32(init[end-4:end]) >> 16
+	return int(width), int(height), nil
+}
+
+// rewriteManifest replaces the segment URLs of a DASH manifest, which are
+// relative to prefix, with what sign returns for their keys.
+func rewriteManifest(data []byte, prefix string, sign func(key string) (string, error)) ([]byte, error) {
+	var manifest mpd
+	if err := xml.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("malformed DASH manifest: %w", err)
+	}
+
+	for i := range manifest.Period.AdaptationSets {
+		set := &manifest.Period.AdaptationSets[i]
+		for j := range set.Representations {
+			list := &set.Representations[j].SegmentList
+
+			signed, err := sign(prefix + list.Initialization.SourceURL)
+			if err != nil {
+				return nil, err
+			}
+			list.Initialization.SourceURL = signed
+
+			for k := range list.Segments {
+				signed, err := sign(prefix + list.Segments[k].Media)
+				if err != nil {
+					return nil, err
+				}
+				list.Segments[k].Media = signed
+			}
+		}
+	}
+
+	return manifest.marshal()
+}
+
+func (m *mpd) marshal() ([]byte, error) {
+	data, err := xml.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
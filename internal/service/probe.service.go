@@ -0,0 +1,286 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/storage"
+)
+
+// ProbeResult is what ffprobe found out about a file.
+type ProbeResult struct {
+	Duration int // in seconds
+	Info     models.MediaInfo
+}
+
+// Apply copies the result onto media.
+func (r *ProbeResult) Apply(media *models.Media) {
+	media.Duration = r.Duration
+	media.MediaInfo = r.Info
+}
+
+// Columns returns the media columns holding the result, for updating a record.
+func (r *ProbeResult) Columns() map[string]interface{} {
+	return map[string]interface{}{
+		"duration":       r.Duration,
+		"container":      r.Info.Container,
+		"video_codec":    r.Info.VideoCodec,
+		"audio_codec":    r.Info.AudioCodec,
+		"bitrate":        r.Info.Bitrate,
+		"width":          r.Info.Width,
+		"height":         r.Info.Height,
+		"frame_rate":     r.Info.FrameRate,
+		"channels":       r.Info.Channels,
+		"channel_layout": r.Info.ChannelLayout,
+		"probe_status":   r.Info.ProbeStatus,
+	}
+}
+
+// ProbeService inspects uploaded files with a local ffprobe binary.
+type ProbeService struct {
+	storageProvider *storage.StorageProvider
+	cfg             config.ProcessConfig
+	missing         sync.Once
+}
+
+func NewProbeService(storageProvider *storage.StorageProvider, cfg config.ProcessConfig) *ProbeService {
+	return &ProbeService{
+		storageProvider: storageProvider,
+		cfg:             cfg,
+	}
+}
+
+// CheckProbe makes sure ffprobe can be run when uploads are probed, so a
+// process does not start storing files it cannot inspect.
+func CheckProbe(cfg config.ProcessConfig) error {
+	if !cfg.Probe {
+		return nil
+	}
+	if _, err := exec.LookPath(cfg.FFprobePath); err != nil {
+		return fmt.Errorf("ffprobe not found, install it or set PROBE_ENABLED=false: %w", err)
+	}
+	return nil
+}
+
+// Deferred reports whether uploads are probed by a job once they are stored
+// instead of in the upload request. Only rejecting corrupt files, the
+// default, needs the request to wait for ffprobe, which then runs on the API
+// server for up to the probe timeout.
+func (s *ProbeService) Deferred() bool {
+	return s.cfg.Probe && !s.cfg.RejectCorrupt
+}
+
+// Probe inspects file. It returns nil when probing is off, in which case the
+// media is stored unprobed, as it is when ffprobe has gone missing and corrupt
+// files are not rejected. A file ffprobe cannot read fails with
+// ErrCorruptMedia, or is flagged ProbeCorrupt when corrupt files are not
+// rejected.
+func (s *ProbeService) Probe(ctx context.Context, file io.Reader) (*ProbeResult, error) {
+	if !s.cfg.Probe {
+		return nil, nil
+	}
+
+	// ffprobe seeks around, e.g. to the index at the end of an MP4
+	if f, ok := file.(*os.File); ok {
+		return s.probeFile(ctx, f.Name())
+	}
+
+	tmp, err := os.CreateTemp("", "probe-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, file); err != nil {
+		return nil, fmt.Errorf("failed to buffer file for probing: %w", err)
+	}
+	return s.probeFile(ctx, tmp.Name())
+}
+
+// ProbeObject inspects a stored object, downloading it first.
+func (s *ProbeService) ProbeObject(ctx context.Context, filename string) (*ProbeResult, error) {
+	if !s.cfg.Probe {
+		return nil, nil
+	}
+
+	body, err := s.storageProvider.Open(ctx, filename, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return s.Probe(ctx, body)
+}
+
+func (s *ProbeService) probeFile(ctx context.Context, path string) (*ProbeResult, error) {
+	probeCtx, cancel := context.WithTimeout(ctx, time.Duration(s.cfg.ProbeTimeout)*time.Second)
+	defer cancel()
+
+	args := append([]string{
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format", "-show_streams",
+	}, inputArgs(mediaFormats, path)...)
+	cmd := exec.CommandContext(probeCtx, s.cfg.FFprobePath, args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+		// Without ffprobe nothing can be refused
+		if s.cfg.RejectCorrupt {
+			return nil, fmt.Errorf("%s not found: %w", s.cfg.FFprobePath, err)
+		}
+		s.missing.Do(func() {
+			log.Printf("%s not found, uploads are stored without probing", s.cfg.FFprobePath)
+		})
+		return nil, nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if probeCtx.Err() != nil {
+		return s.corrupt(errors.New("probing timed out"))
+	}
+	if err != nil {
+		// ffprobe names the file first, which is only a temporary path
+		reason := strings.TrimPrefix(firstLine(stderr.String(), err.Error()), path+": ")
+		return s.corrupt(errors.New(reason))
+	}
+
+	result, err := parseProbeOutput(output)
+	if err != nil {
+		return s.corrupt(err)
+	}
+	return result, nil
+}
+
+// mediaFormats are the ffmpeg demuxers of the accepted upload types.
+const mediaFormats = "mov,mp3,wav,avi,matroska"
+
+// inputArgs opens path as the input of ffmpeg or ffprobe, read only as a
+// local file in one of formats. Uploads are probed by content, so a playlist
+// or concat list uploaded as a video would otherwise make them open other
+// files or URLs.
+func inputArgs(formats string, path string) []string {
+	return []string{"-protocol_whitelist", "file,pipe", "-format_whitelist", formats, "-i", path}
+}
+
+func (s *ProbeService) corrupt(reason error) (*ProbeResult, error) {
+	if s.cfg.RejectCorrupt {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptMedia, reason)
+	}
+	return &ProbeResult{Info: models.MediaInfo{ProbeStatus: models.ProbeCorrupt}}, nil
+}
+
+type ffprobeOutput struct {
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"format"`
+	Streams []struct {
+		CodecType     string `json:"codec_type"`
+		CodecName     string `json:"codec_name"`
+		Width         int    `json:"width"`
+		Height        int    `json:"height"`
+		AvgFrameRate  string `json:"avg_frame_rate"`
+		RFrameRate    string `json:"r_frame_rate"`
+		Channels      int    `json:"channels"`
+		ChannelLayout string `json:"channel_layout"`
+		Duration      string `json:"duration"`
+		Disposition   struct {
+			AttachedPic int `json:"attached_pic"`
+		} `json:"disposition"`
+	} `json:"streams"`
+}
+
+// parseProbeOutput reads ffprobe's JSON. The first audio and video streams
+// describe the file; cover art attached to audio files is not video.
+func parseProbeOutput(output []byte) (*ProbeResult, error) {
+	var probe ffprobeOutput
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, fmt.Errorf("unreadable ffprobe output: %w", err)
+	}
+
+	info := models.MediaInfo{
+		Container:   probe.Format.FormatName,
+		ProbeStatus: models.ProbeOK,
+	}
+	info.Bitrate, _ = strconv.ParseInt(probe.Format.BitRate, 10, 64)
+	seconds, _ := strconv.ParseFloat(probe.Format.Duration, 64)
+
+	for _, stream := range probe.Streams {
+		switch {
+		case stream.CodecType == "video" && stream.Disposition.AttachedPic == 0 && info.VideoCodec == "":
+			info.VideoCodec = stream.CodecName
+			info.Width = stream.Width
+			info.Height = stream.Height
+			info.FrameRate = parseFrameRate(stream.AvgFrameRate)
+			if info.FrameRate == 0 {
+				info.FrameRate = parseFrameRate(stream.RFrameRate)
+			}
+		case stream.CodecType == "audio" && info.AudioCodec == "":
+			info.AudioCodec = stream.CodecName
+			info.Channels = stream.Channels
+			info.ChannelLayout = stream.ChannelLayout
+		default:
+			continue
+		}
+
+		if seconds == 0 {
+			seconds, _ = strconv.ParseFloat(stream.Duration, 64)
+		}
+	}
+
+	if info.VideoCodec == "" && info.AudioCodec == "" {
+		return nil, errors.New("no audio or video stream")
+	}
+
+	return &ProbeResult{
+		Duration: int(math.Round(seconds)),
+		Info:     info,
+	}, nil
+}
+
+// parseFrameRate reads a rate such as "30000/1001", rounded to 3 decimals.
+func parseFrameRate(rate string) float64 {
+	num, den, ok := strings.Cut(rate, "/")
+	if !ok {
+		den = "1"
+	}
+
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return math.Round(n/d*1000) / 1000
+}
+
+// firstLine returns the first line of text, or fallback when it is empty.
+func firstLine(text string, fallback string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	if line == "" {
+		return fallback
+	}
+	return line
+}
@@ -0,0 +1,479 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// JobOptions are the optional settings of an enqueued job.
+type JobOptions struct {
+	Priority    int       // higher runs first among due jobs of the same type
+	MaxAttempts int       // 0 uses JOB_MAX_ATTEMPTS
+	RunAt       time.Time // zero runs it now
+}
+
+// JobHandler runs a job with the payload it was enqueued with. A returned
+// error retries the job after a backoff, or dead-letters it once it is out of
+// attempts. ctx is cancelled when the worker stops or loses the lease.
+type JobHandler func(ctx context.Context, payload []byte) error
+
+// JobQueue is a job queue kept in the jobs table. Jobs enqueued inside a
+// transaction only become visible when it commits, so work is never queued
+// for a change that was rolled back.
+type JobQueue struct {
+	db       *gorm.DB
+	cfg      config.JobConfig
+	handlers map[string]JobHandler
+}
+
+func NewJobQueue(db *gorm.DB, cfg config.JobConfig) *JobQueue {
+	return &JobQueue{
+		db:       db,
+		cfg:      cfg,
+		handlers: make(map[string]JobHandler),
+	}
+}
+
+// Enqueue adds a job of jobType inside tx, or on its own when tx is nil.
+// payload is stored as JSON.
+func (q *JobQueue) Enqueue(ctx context.Context, tx *gorm.DB, jobType string, payload interface{}, opts JobOptions) (*models.Job, error) {
+	if tx == nil {
+		tx = q.db.WithContext(ctx)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	job := models.Job{
+		Type:        jobType,
+		Payload:     string(data),
+		Status:      models.JobPending,
+		Priority:    opts.Priority,
+		RunAt:       opts.RunAt,
+		MaxAttempts: opts.MaxAttempts,
+	}
+	if job.RunAt.IsZero() {
+		job.RunAt = time.Now()
+	}
+	if job.MaxAttempts < 1 {
+		job.MaxAttempts = max(q.cfg.MaxAttempts, 1)
+	}
+
+	if err := tx.Create(&job).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Register sets the handler run for jobs of jobType.
+func (q *JobQueue) Register(jobType string, handler JobHandler) {
+	q.handlers[jobType] = handler
+}
+
+// Retry makes a dead job, or a pending one waiting out its backoff, due now
+// with a fresh set of attempts.
+func (q *JobQueue) Retry(ctx context.Context, id uuid.UUID) (*models.Job, error) {
+	var job models.Job
+	err := q.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&job).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrJobNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if job.Status != models.JobDead && job.Status != models.JobPending {
+			return ErrJobNotRetryable
+		}
+
+		return tx.Model(&job).Updates(retryColumns()).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// RetryDead retries every dead job, or those of jobType when it is not
+// empty, returning how many there were.
+func (q *JobQueue) RetryDead(ctx context.Context, jobType string) (int64, error) {
+	query := q.db.WithContext(ctx).Model(&models.Job{}).Where("status = ?", models.JobDead)
+	if jobType != "" {
+		query = query.Where("type = ?", jobType)
+	}
+
+	result := query.Updates(retryColumns())
+	return result.RowsAffected, result.Error
+}
+
+func retryColumns() map[string]interface{} {
+	return map[string]interface{}{
+		"status":       models.JobPending,
+		"attempts":     0,
+		"run_at":       time.Now(),
+		"locked_by":    "",
+		"locked_until": nil,
+		"finished_at":  nil,
+	}
+}
+
+// Work runs the registered job types until ctx is cancelled, each with as
+// many goroutines as JOB_CONCURRENCY gives it. worker names this process in
+// the jobs it leases. Jobs running when ctx is cancelled are handed back to
+// the queue without using up an attempt.
+func (q *JobQueue) Work(ctx context.Context, worker string) error {
+	concurrency, err := ParseJobConcurrency(q.cfg.Concurrency)
+	if err != nil {
+		return err
+	}
+	if len(q.handlers) == 0 {
+		return errors.New("no job types registered")
+	}
+
+	types := make([]string, 0, len(q.handlers))
+	for jobType := range q.handlers {
+		types = append(types, jobType)
+	}
+	sort.Strings(types)
+
+	var wg sync.WaitGroup
+	for _, jobType := range types {
+		n, ok := concurrency[jobType]
+		if !ok {
+			n = 1
+		}
+		log.Printf("Working %s jobs with %d goroutines", jobType, n)
+
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				q.poll(ctx, worker, jobType)
+			}()
+		}
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		q.prune(ctx)
+	}()
+
+	wg.Wait()
+	return nil
+}
+
+// WorkerName names this process in the jobs it leases, as role@host:pid.
+func WorkerName(role string) string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s@%s:%d", role, host, os.Getpid())
+}
+
+// ParseJobConcurrency reads "type:n" pairs.
+func ParseJobConcurrency(specs []string) (map[string]int, error) {
+	concurrency := make(map[string]int, len(specs))
+	for _, spec := range specs {
+		jobType, count, ok := strings.Cut(spec, ":")
+		n, err := strconv.Atoi(count)
+		if !ok || jobType == "" || err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid job concurrency %q: must be type:n", spec)
+		}
+		concurrency[jobType] = n
+	}
+	return concurrency, nil
+}
+
+// poll leases and runs jobs of jobType one at a time, waiting the poll
+// interval whenever none is due.
+func (q *JobQueue) poll(ctx context.Context, worker string, jobType string) {
+	idle := time.Duration(max(q.cfg.PollInterval, 1)) * time.Second
+
+	for ctx.Err() == nil {
+		ran, err := q.RunNext(ctx, worker, jobType)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to lease %s job: %v", jobType, err)
+		}
+		if ran {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(idle):
+		}
+	}
+}
+
+// RunNext leases and runs the due job of jobType with the highest priority,
+// reporting whether there was one. How the job went is recorded on it; the
+// error is only about leasing.
+func (q *JobQueue) RunNext(ctx context.Context, worker string, jobType string) (bool, error) {
+	job, err := q.lease(ctx, worker, jobType)
+	if err != nil || job == nil {
+		return false, err
+	}
+	q.run(ctx, worker, job)
+	return true, nil
+}
+
+// lease takes the due job of jobType with the highest priority, or returns
+// nil when there is none. Running jobs whose lease ran out belong to a worker
+// that died and are taken over, or dead-lettered when that was their last
+// attempt.
+func (q *JobQueue) lease(ctx context.Context, worker string, jobType string) (*models.Job, error) {
+	for {
+		var job *models.Job
+		again := false
+		err := q.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			now := time.Now()
+
+			var due models.Job
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("type = ? AND ((status = ? AND run_at <= ?) OR (status = ? AND locked_until < ?))",
+					jobType, models.JobPending, now, models.JobRunning, now).
+				Order("priority DESC, run_at").
+				First(&due).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			if due.Status == models.JobRunning && due.Attempts >= due.MaxAttempts {
+				log.Printf("Job %s (%s): lease of %s ran out on the last attempt", due.ID, due.Type, due.LockedBy)
+				again = true
+				return tx.Model(&due).Updates(map[string]interface{}{
+					"status":       models.JobDead,
+					"last_error":   "worker stopped responding",
+					"locked_by":    "",
+					"locked_until": nil,
+					"finished_at":  now,
+				}).Error
+			}
+
+			until := now.Add(q.leaseDuration())
+			// Not tx.Model(&due), which would write the columns back into due
+			err = tx.Model(&models.Job{}).Where("id = ?", due.ID).Updates(map[string]interface{}{
+				"status":       models.JobRunning,
+				"attempts":     due.Attempts + 1,
+				"locked_by":    worker,
+				"locked_until": until,
+			}).Error
+			if err != nil {
+				return err
+			}
+
+			due.Status = models.JobRunning
+			due.Attempts++
+			due.LockedBy = worker
+			due.LockedUntil = &until
+			job = &due
+			return nil
+		})
+		if err != nil || !again {
+			return job, err
+		}
+	}
+}
+
+// run runs a leased job, renewing its lease meanwhile, and records the
+// outcome. It returns what the handler did.
+func (q *JobQueue) run(ctx context.Context, worker string, job *models.Job) error {
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		q.renew(jobCtx, cancel, worker, job)
+	}()
+
+	started := time.Now()
+	err := q.call(jobCtx, job)
+	cancel()
+	<-renewed
+
+	// Stopping the worker is not the job's fault
+	if err != nil && ctx.Err() != nil {
+		q.release(worker, job)
+		return err
+	}
+
+	if err != nil {
+		q.fail(worker, job, err)
+		return err
+	}
+
+	now := time.Now()
+	done := q.db.Model(&models.Job{}).
+		Where("id = ? AND locked_by = ? AND status = ?", job.ID, worker, models.JobRunning).
+		Updates(map[string]interface{}{
+			"status":       models.JobSucceeded,
+			"last_error":   "",
+			"locked_by":    "",
+			"locked_until": nil,
+			"finished_at":  now,
+		})
+	if done.Error != nil {
+		log.Printf("Job %s (%s): failed to record success: %v", job.ID, job.Type, done.Error)
+		return nil
+	}
+	if done.RowsAffected == 0 {
+		log.Printf("Job %s (%s): finished after its lease was taken over", job.ID, job.Type)
+		return nil
+	}
+	log.Printf("Job %s (%s): done in %s", job.ID, job.Type, time.Since(started).Round(time.Millisecond))
+	return nil
+}
+
+// call runs the handler of job, turning a panic into an error.
+func (q *JobQueue) call(ctx context.Context, job *models.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Job %s (%s): panic: %v\n%s", job.ID, job.Type, r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return q.handlers[job.Type](ctx, []byte(job.Payload))
+}
+
+// renew extends the lease of job until ctx is done. When the lease turns out
+// to have been taken over, cancel stops the job.
+func (q *JobQueue) renew(ctx context.Context, cancel context.CancelFunc, worker string, job *models.Job) {
+	ticker := time.NewTicker(q.leaseDuration() / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		renewed := q.db.WithContext(ctx).Model(&models.Job{}).
+			Where("id = ? AND locked_by = ? AND status = ?", job.ID, worker, models.JobRunning).
+			Update("locked_until", time.Now().Add(q.leaseDuration()))
+		if renewed.Error != nil {
+			if ctx.Err() == nil {
+				log.Printf("Job %s (%s): failed to renew lease: %v", job.ID, job.Type, renewed.Error)
+			}
+			continue
+		}
+		if renewed.RowsAffected == 0 {
+			log.Printf("Job %s (%s): lease was taken over, stopping", job.ID, job.Type)
+			cancel()
+			return
+		}
+	}
+}
+
+// fail schedules a retry of job after a backoff, or dead-letters it when it
+// is out of attempts.
+func (q *JobQueue) fail(worker string, job *models.Job, cause error) {
+	columns := map[string]interface{}{
+		"last_error":   cause.Error(),
+		"locked_by":    "",
+		"locked_until": nil,
+	}
+
+	if job.Attempts >= job.MaxAttempts {
+		log.Printf("Job %s (%s): failed on attempt %d of %d, giving up: %v", job.ID, job.Type, job.Attempts, job.MaxAttempts, cause)
+		columns["status"] = models.JobDead
+		columns["finished_at"] = time.Now()
+	} else {
+		delay := q.backoff(job.Attempts)
+		log.Printf("Job %s (%s): failed on attempt %d of %d, retrying in %s: %v", job.ID, job.Type, job.Attempts, job.MaxAttempts, delay, cause)
+		columns["status"] = models.JobPending
+		columns["run_at"] = time.Now().Add(delay)
+	}
+
+	err := q.db.Model(&models.Job{}).
+		Where("id = ? AND locked_by = ? AND status = ?", job.ID, worker, models.JobRunning).
+		Updates(columns).Error
+	if err != nil {
+		log.Printf("Job %s (%s): failed to record failure: %v", job.ID, job.Type, err)
+	}
+}
+
+// release hands a job interrupted by shutdown back to the queue, giving back
+// the attempt it used.
+func (q *JobQueue) release(worker string, job *models.Job) {
+	err := q.db.Model(&models.Job{}).
+		Where("id = ? AND locked_by = ? AND status = ?", job.ID, worker, models.JobRunning).
+		Updates(map[string]interface{}{
+			"status":       models.JobPending,
+			"attempts":     gorm.Expr("attempts - 1"),
+			"run_at":       time.Now(),
+			"locked_by":    "",
+			"locked_until": nil,
+		}).Error
+	if err != nil {
+		log.Printf("Job %s (%s): failed to hand back: %v", job.ID, job.Type, err)
+	}
+}
+
+// backoff is the wait before retrying a job that failed attempts times: the
+// base doubled for each attempt after the first, capped, plus up to a tenth
+// of jitter so jobs failing together do not retry together.
+func (q *JobQueue) backoff(attempts int) time.Duration {
+	base := time.Duration(max(q.cfg.Backoff, 1)) * time.Second
+	limit := time.Duration(max(q.cfg.MaxBackoff, q.cfg.Backoff, 1)) * time.Second
+
+	delay := base
+	for i := 1; i < attempts && delay < limit; i++ {
+		delay *= 2
+	}
+	delay = min(delay, limit)
+
+	return delay + time.Duration(rand.Int63n(int64(delay)/10+1))
+}
+
+func (q *JobQueue) leaseDuration() time.Duration {
+	return time.Duration(max(q.cfg.Lease, 3)) * time.Second
+}
+
+// prune deletes succeeded jobs older than the retention every hour until ctx
+// is cancelled. Dead jobs are kept for an admin to look at.
+func (q *JobQueue) prune(ctx context.Context) {
+	for {
+		cutoff := time.Now().Add(-time.Duration(q.cfg.Retention) * time.Hour)
+		pruned := q.db.WithContext(ctx).
+			Where("status = ? AND finished_at < ?", models.JobSucceeded, cutoff).
+			Delete(&models.Job{})
+		if pruned.Error != nil && ctx.Err() == nil {
+			log.Printf("Failed to prune jobs: %v", pruned.Error)
+		} else if pruned.RowsAffected > 0 {
+			log.Printf("Pruned %d succeeded jobs", pruned.RowsAffected)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Hour):
+		}
+	}
+}
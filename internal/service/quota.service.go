@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Quota limits what a user may store. Zero means unlimited.
+type Quota struct {
+	Bytes int64 `json:"bytes"`
+	Files int64 `json:"files"`
+}
+
+// TypeUsage is the storage used by the media of one file type.
+type TypeUsage struct {
+	FileType string `json:"file_type"`
+	Files    int64  `json:"files"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// Usage is the storage used by a user. Every media counts with its full
+// size, even when its content is shared with other media.
+type Usage struct {
+	Bytes int64 `json:"bytes"`
+	Files int64 `json:"files"`
+	// Reserved by uploads that have not finished yet
+	PendingBytes int64 `json:"pending_bytes"`
+	PendingFiles int64 `json:"pending_files"`
+	// Kept by prior versions of replaced media; they count towards the byte
+	// quota only
+	VersionBytes int64       `json:"version_bytes"`
+	Versions     int64       `json:"versions"`
+	ByType       []TypeUsage `json:"by_type"`
+	Quota        Quota       `json:"quota"`
+}
+
+// QuotaService accounts for the storage used by each user and enforces
+// their quota.
+type QuotaService struct {
+	db       *gorm.DB
+	defaults config.QuotaConfig
+}
+
+func NewQuotaService(db *gorm.DB, cfg config.QuotaConfig) *QuotaService {
+	return &QuotaService{
+		db:       db,
+		defaults: cfg,
+	}
+}
+
+// Quota returns the quota of user, falling back to the configured default.
+func (s *QuotaService) Quota(user *models.User) Quota {
+	quota := Quota{Bytes: s.defaults.Bytes, Files: s.defaults.Files}
+	if user.QuotaBytes != nil {
+		quota.Bytes = *user.QuotaBytes
+	}
+	if user.QuotaFiles != nil {
+		quota.Files = *user.QuotaFiles
+	}
+	return quota
+}
+
+func (s *QuotaService) Usage(ctx context.Context, user *models.User) (*Usage, error) {
+	return s.usage(s.db.WithContext(ctx), user)
+}
+
+func (s *QuotaService) usage(db *gorm.DB, user *models.User) (*Usage, error) {
+	usage := &Usage{ByType: []TypeUsage{}, Quota: s.Quota(user)}
+
+	err := db.Model(&models.Media{}).
+		Select("file_type, COUNT(*) AS files, COALESCE(SUM(file_size), 0) AS bytes").
+		Where("user_id = ? AND status <> ?", user.ID, models.MediaPending).
+		Group("file_type").Order("bytes DESC").
+		Scan(&usage.ByType).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range usage.ByType {
+		usage.Files += t.Files
+		usage.Bytes += t.Bytes
+	}
+
+	// Direct uploads reserve their declared size, resumable ones their length
+	var pending struct {
+		Files int64
+		Bytes int64
+	}
+	err = db.Model(&models.Media{}).
+		Select("COUNT(*) AS files, COALESCE(SUM(file_size), 0) AS bytes").
+		Where("user_id = ? AND status = ?", user.ID, models.MediaPending).
+		Scan(&pending).Error
+	if err != nil {
+		return nil, err
+	}
+	usage.PendingFiles += pending.Files
+	usage.PendingBytes += pending.Bytes
+
+	err = db.Model(&models.Upload{}).
+		Select("COUNT(*) AS files, COALESCE(SUM(length), 0) AS bytes").
+		Where("user_id = ? AND media_id IS NULL", user.ID).
+		Scan(&pending).Error
+	if err != nil {
+		return nil, err
+	}
+	usage.PendingFiles += pending.Files
+	usage.PendingBytes += pending.Bytes
+
+	var versions struct {
+		Files int64
+		Bytes int64
+	}
+	err = db.Model(&models.MediaVersion{}).
+		Select("COUNT(*) AS files, COALESCE(SUM(media_versions.file_size), 0) AS bytes").
+		Joins("JOIN media ON media.id = media_versions.media_id").
+		Where("media.user_id = ?", user.ID).
+		Scan(&versions).Error
+	if err != nil {
+		return nil, err
+	}
+	usage.Versions = versions.Files
+	usage.VersionBytes = versions.Bytes
+
+	return usage, nil
+}
+
+// Check returns an error wrapping ErrQuotaExceeded if user cannot store that
+// many more files, taking size bytes in all. Replacing the file of a media
+// adds no file. Concurrent uploads may all pass it; Reserve settles which of
+// them fit once they are about to be recorded.
+func (s *QuotaService) Check(ctx context.Context, user *models.User, size int64, files int64) error {
+	return s.check(s.db.WithContext(ctx), user, size, files)
+}
+
+// Reserve checks the quota like Check inside tx, the transaction recording
+// the new file, and keeps the row of user locked until it ends. Uploads of
+// one user then take turns, each counting what the one before it recorded.
+func (s *QuotaService) Reserve(tx *gorm.DB, user *models.User, size int64, files int64) error {
+	quota := s.Quota(user)
+	if quota.Bytes == 0 && quota.Files == 0 {
+		return nil
+	}
+
+	var locked models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", user.ID).First(&locked).Error; err != nil {
+		return fmt.Errorf("failed to lock user: %w", err)
+	}
+	return s.check(tx, user, size, files)
+}
+
+func (s *QuotaService) check(db *gorm.DB, user *models.User, size int64, files int64) error {
+	quota := s.Quota(user)
+	if quota.Bytes == 0 && quota.Files == 0 {
+		return nil
+	}
+
+	usage, err := s.usage(db, user)
+	if err != nil {
+		return fmt.Errorf("failed to compute storage usage: %w", err)
+	}
+
+	if used := usage.Bytes + usage.PendingBytes + usage.VersionBytes; quota.Bytes > 0 && used+size > quota.Bytes {
+		return fmt.Errorf("%w: %d of %d bytes used, %d more requested", ErrQuotaExceeded, used, quota.Bytes, size)
+	}
+	if used := usage.Files + usage.PendingFiles; quota.Files > 0 && used+files > quota.Files {
+		return fmt.Errorf("%w: %d of %d files used", ErrQuotaExceeded, used, quota.Files)
+	}
+
+	return nil
+}
@@ -0,0 +1,610 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/interfaces"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/storage"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Reconciliation modes. Each mode does everything the one before it does.
+const (
+	// ReconcileReport changes nothing.
+	ReconcileReport = "report"
+	// ReconcileQuarantine moves orphaned objects under the quarantine prefix.
+	ReconcileQuarantine = "quarantine"
+	// ReconcileFix also repairs records where nothing is lost: objects are
+	// restored from quarantine, media without an object are marked missing,
+	// blob reference counts are recounted and abandoned uploads are removed.
+	ReconcileFix = "fix"
+)
+
+// Kinds of ReconcileIssue.
+const (
+	IssueOrphanObject  = "orphan_object"  // object no record points at
+	IssueMissingObject = "missing_object" // record pointing at no object
+	IssueRefCount      = "ref_count"      // blob reference count is wrong
+	IssueStaleUpload   = "stale_upload"   // upload abandoned before completion
+)
+
+const reconcileBatchSize = 500
+
+// ReconcileOptions configures a Reconciler run.
+type ReconcileOptions struct {
+	Mode string
+	// GracePeriod leaves objects and records younger than this alone. Uploads
+	// store the object before its record, so a new object is not an orphan yet.
+	GracePeriod      time.Duration
+	QuarantinePrefix string
+	StagingDir       string // where resumable uploads keep unflushed chunks
+}
+
+// ReconcileIssue is one mismatch between storage and the database.
+type ReconcileIssue struct {
+	Kind   string `json:"kind"`
+	Key    string `json:"key"`              // object key
+	Record string `json:"record,omitempty"` // database rows involved
+	Detail string `json:"detail,omitempty"`
+	Action string `json:"action,omitempty"` // what was done, empty if only reported
+	Error  string `json:"error,omitempty"`  // why the action failed
+}
+
+// ReconcileResult is the report of a reconciliation run.
+type ReconcileResult struct {
+	Mode    string           `json:"mode"`
+	Objects int              `json:"objects"` // objects listed in storage
+	Keys    int              `json:"keys"`    // object keys of media checked
+	Blobs   int              `json:"blobs"`
+	Issues  []ReconcileIssue `json:"issues"`
+}
+
+// Failed counts the issues whose action failed.
+func (r *ReconcileResult) Failed() int {
+	failed := 0
+	for _, issue := range r.Issues {
+		if issue.Error != "" {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Reconciler finds what non-atomic uploads and deletes leave behind: objects
+// no record refers to, records whose object is gone, wrong blob reference
+// counts and uploads that were never completed.
+type Reconciler struct {
+	db              *gorm.DB
+	storageProvider *storage.StorageProvider
+	opts            ReconcileOptions
+	cutoff          time.Time
+}
+
+func NewReconciler(db *gorm.DB, storageProvider *storage.StorageProvider, opts ReconcileOptions) *Reconciler {
+	if opts.Mode == "" {
+		opts.Mode = ReconcileReport
+	}
+	if opts.QuarantinePrefix == "" {
+		opts.QuarantinePrefix = "quarantine/"
+	}
+
+	return &Reconciler{
+		db:              db,
+		storageProvider: storageProvider,
+		opts:            opts,
+	}
+}
+
+func (r *Reconciler) Run(ctx context.Context) (*ReconcileResult, error) {
+	switch r.opts.Mode {
+	case ReconcileReport, ReconcileQuarantine, ReconcileFix:
+	default:
+		return nil, fmt.Errorf("unknown reconciliation mode %q", r.opts.Mode)
+	}
+
+	r.cutoff = time.Now().Add(-r.opts.GracePeriod)
+	result := &ReconcileResult{Mode: r.opts.Mode, Issues: []ReconcileIssue{}}
+
+	steps := []func(context.Context, *ReconcileResult) error{
+		r.checkObjects,
+		r.checkMedia,
+		r.checkBlobs,
+		r.checkUploads,
+	}
+	for _, step := range steps {
+		if err := step(ctx, result); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// checkObjects lists the bucket and looks for objects nothing refers to.
+func (r *Reconciler) checkObjects(ctx context.Context, result *ReconcileResult) error {
+	token := ""
+	for {
+		page, err := r.storageProvider.List(ctx, "", token, 0)
+		if err != nil {
+			return fmt.Errorf("failed to list objects: %w", err)
+		}
+		result.Objects += len(page.Objects)
+
+		var candidates []interfaces.ObjectSummary
+		var keys []string
+		for _, object := range page.Objects {
+			if strings.HasPrefix(object.Key, r.opts.QuarantinePrefix) || object.LastModified.After(r.cutoff) {
+				continue
+			}
+			candidates = append(candidates, object)
+			keys = append(keys, object.Key)
+		}
+
+		referenced, err := r.referenced(ctx, keys)
+		if err != nil {
+			return err
+		}
+
+		for _, object := range candidates {
+			if referenced[object.Key] {
+				continue
+			}
+
+			issue := ReconcileIssue{
+				Kind:   IssueOrphanObject,
+				Key:    object.Key,
+				Detail: fmt.Sprintf("%d bytes, last modified %s", object.Size, object.LastModified.Format(time.RFC3339)),
+			}
+			if r.opts.Mode != ReconcileReport {
+				r.quarantine(ctx, &issue)
+			}
+			result.Issues = append(result.Issues, issue)
+		}
+
+		if page.NextToken == "" {
+			return nil
+		}
+		token = page.NextToken
+	}
+}
+
+// referenced returns which of keys a media, media version, thumbnail, blob,
+// unfinished upload or stream package points at.
+func (r *Reconciler) referenced(ctx context.Context, keys []string) (map[string]bool, error) {
+	referenced := make(map[string]bool, len(keys))
+	if len(keys) == 0 {
+		return referenced, nil
+	}
+
+	db := r.db.WithContext(ctx)
+	queries := []*gorm.DB{
+		db.Model(&models.Media{}),
+		db.Model(&models.MediaVersion{}),
+		db.Model(&models.Thumbnail{}),
+		db.Model(&models.Blob{}),
+		db.Model(&models.DirectUpload{}),
+		// A completed upload's temporary object has been deleted
+		db.Model(&models.Upload{}).Where("media_id IS NULL"),
+	}
+
+	for _, query := range queries {
+		var found []string
+		if err := query.Where("filename IN ?", keys).Pluck("filename", &found).Error; err != nil {
+			return nil, err
+		}
+		for _, key := range found {
+			referenced[key] = true
+		}
+	}
+
+	// Packages are stored as many objects under one prefix
+	prefixes := make(map[string][]string)
+	for _, key := range keys {
+		if prefix := PackagePrefixOf(key); prefix != "" {
+			prefixes[prefix] = append(prefixes[prefix], key)
+		}
+	}
+	if len(prefixes) > 0 {
+		var names, found []string
+		for prefix := range prefixes {
+			names = append(names, prefix)
+		}
+		err := db.Model(&models.StreamPackage{}).Where("prefix IN ?", names).Pluck("prefix", &found).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, prefix := range found {
+			for _, key := range prefixes[prefix] {
+				referenced[key] = true
+			}
+		}
+	}
+
+	return referenced, nil
+}
+
+// checkMedia looks up the object of every ready or missing media. Media
+// whose object is gone are marked missing, which hides them until the object
+// is back.
+func (r *Reconciler) checkMedia(ctx context.Context, result *ReconcileResult) error {
+	last := ""
+	for {
+		var keys []string
+		err := r.db.WithContext(ctx).Model(&models.Media{}).
+			Where("status IN ? AND filename > ?", []string{models.MediaReady, models.MediaMissing}, last).
+			Distinct("filename").Order("filename").Limit(reconcileBatchSize).
+			Pluck("filename", &keys).Error
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+		last = keys[len(keys)-1]
+
+		for _, key := range keys {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			result.Keys++
+
+			if err := r.checkMediaObject(ctx, key, result); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (r *Reconciler) checkMediaObject(ctx context.Context, key string, result *ReconcileResult) error {
+	var media []models.Media
+	err := r.db.WithContext(ctx).Select("id", "status").
+		Where("filename = ? AND status IN ?", key, []string{models.MediaReady, models.MediaMissing}).
+		Find(&media).Error
+	if err != nil {
+		return err
+	}
+
+	var ids []string
+	var ready, missing bool
+	for _, m := range media {
+		ids = append(ids, m.ID.String())
+		ready = ready || m.Status == models.MediaReady
+		missing = missing || m.Status == models.MediaMissing
+	}
+	record := "media " + strings.Join(ids, ", ")
+
+	exists, err := r.exists(ctx, key)
+	if err != nil {
+		log.Printf("%s: %v", key, err)
+		return nil
+	}
+
+	if exists {
+		if !missing {
+			return nil
+		}
+
+		issue := ReconcileIssue{Kind: IssueMissingObject, Key: key, Record: record, Detail: "object is present again"}
+		if r.opts.Mode == ReconcileFix {
+			r.setMediaStatus(ctx, key, models.MediaReady, &issue)
+		}
+		result.Issues = append(result.Issues, issue)
+		return nil
+	}
+
+	issue := ReconcileIssue{Kind: IssueMissingObject, Key: key, Record: record, Detail: "object does not exist"}
+	if r.opts.Mode == ReconcileFix {
+		restored := r.restore(ctx, &issue)
+		switch {
+		case issue.Error != "":
+		case restored && missing:
+			action := issue.Action
+			r.setMediaStatus(ctx, key, models.MediaReady, &issue)
+			issue.Action = action + ", " + issue.Action
+		case !restored && ready:
+			r.setMediaStatus(ctx, key, models.MediaMissing, &issue)
+		}
+	}
+	result.Issues = append(result.Issues, issue)
+	return nil
+}
+
+func (r *Reconciler) setMediaStatus(ctx context.Context, key string, status string, issue *ReconcileIssue) {
+	from := models.MediaReady
+	if status == models.MediaReady {
+		from = models.MediaMissing
+	}
+
+	err := r.db.WithContext(ctx).Model(&models.Media{}).
+		Where("filename = ? AND status = ?", key, from).
+		Update("status", status).Error
+	if err != nil {
+		issue.Error = err.Error()
+		return
+	}
+	issue.Action = "marked " + status
+}
+
+// checkBlobs compares every blob with its object and the media that refer
+// to it.
+func (r *Reconciler) checkBlobs(ctx context.Context, result *ReconcileResult) error {
+	var blobs []models.Blob
+	return r.db.WithContext(ctx).Order("checksum").FindInBatches(&blobs, reconcileBatchSize, func(tx *gorm.DB, batch int) error {
+		for i := range blobs {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			result.Blobs++
+
+			if err := r.checkBlob(ctx, &blobs[i], result); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
+func (r *Reconciler) checkBlob(ctx context.Context, blob *models.Blob, result *ReconcileResult) error {
+	// A blob is referenced before its media record is saved
+	if blob.UpdatedAt.After(r.cutoff) {
+		return nil
+	}
+
+	references, err := r.references(r.db.WithContext(ctx), blob)
+	if err != nil {
+		return err
+	}
+
+	exists, err := r.exists(ctx, blob.Filename)
+	if err != nil {
+		log.Printf("%s: %v", blob.Filename, err)
+		return nil
+	}
+
+	record := "blob " + blob.Checksum
+
+	if !exists {
+		issue := ReconcileIssue{Kind: IssueMissingObject, Key: blob.Filename, Record: record, Detail: fmt.Sprintf("object does not exist, %d media refer to it", references)}
+		// With references left the next upload of the content stores it again
+		if r.opts.Mode == ReconcileFix && !r.restore(ctx, &issue) && issue.Error == "" && references == 0 {
+			r.fixRefCount(ctx, blob, &issue)
+		}
+		result.Issues = append(result.Issues, issue)
+		return nil
+	}
+
+	if int64(blob.RefCount) != references {
+		issue := ReconcileIssue{Kind: IssueRefCount, Key: blob.Filename, Record: record, Detail: fmt.Sprintf("ref_count is %d but %d media refer to it", blob.RefCount, references)}
+		if r.opts.Mode == ReconcileFix {
+			r.fixRefCount(ctx, blob, &issue)
+		}
+		result.Issues = append(result.Issues, issue)
+	}
+
+	return nil
+}
+
+// fixRefCount sets the reference count of blob to the number of media that
+// refer to it. A blob nothing refers to is deleted and its object, if any, is
+// quarantined. The row is locked the same way BlobStore locks it.
+func (r *Reconciler) fixRefCount(ctx context.Context, blob *models.Blob, issue *ReconcileIssue) {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var locked models.Blob
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", blob.ID).First(&locked).Error; err != nil {
+			return err
+		}
+		if locked.UpdatedAt.After(r.cutoff) {
+			issue.Action = "skipped, blob changed during the run"
+			return nil
+		}
+
+		references, err := r.references(tx, &locked)
+		if err != nil {
+			return err
+		}
+
+		if references > 0 {
+			if err := tx.Model(&locked).Update("ref_count", references).Error; err != nil {
+				return err
+			}
+			issue.Action = fmt.Sprintf("set ref_count to %d", references)
+			return nil
+		}
+
+		if err := tx.Delete(&locked).Error; err != nil {
+			return err
+		}
+		issue.Action = "deleted unreferenced blob"
+
+		exists, err := r.exists(ctx, locked.Filename)
+		if err != nil || !exists {
+			return err
+		}
+		if !r.quarantine(ctx, issue) {
+			return errors.New(issue.Error)
+		}
+		issue.Action = "deleted unreferenced blob, " + issue.Action
+		return nil
+	})
+	if err != nil {
+		issue.Action = ""
+		issue.Error = err.Error()
+	}
+}
+
+// references counts the media and prior media versions that hold a
+// reference on the blob with checksum.
+func (r *Reconciler) references(db *gorm.DB, blob *models.Blob) (int64, error) {
+	var media, versions int64
+	where := "checksum = ? AND filename = ?"
+	if err := db.Model(&models.Media{}).Where(where, blob.Checksum, blob.Filename).Count(&media).Error; err != nil {
+		return 0, err
+	}
+	err := db.Model(&models.MediaVersion{}).Where(where, blob.Checksum, blob.Filename).Count(&versions).Error
+	return media + versions, err
+}
+
+// checkUploads finds direct and resumable uploads that have not been touched
+// within the grace period.
+func (r *Reconciler) checkUploads(ctx context.Context, result *ReconcileResult) error {
+	var direct []models.DirectUpload
+	if err := r.db.WithContext(ctx).Where("updated_at < ?", r.cutoff).Order("updated_at").Find(&direct).Error; err != nil {
+		return err
+	}
+
+	for i := range direct {
+		upload := &direct[i]
+		issue := ReconcileIssue{
+			Kind:   IssueStaleUpload,
+			Key:    upload.Filename,
+			Record: "media " + upload.MediaID.String(),
+			Detail: "direct upload last updated " + upload.UpdatedAt.Format(time.RFC3339),
+		}
+		if r.opts.Mode == ReconcileFix {
+			r.removeDirectUpload(ctx, upload, &issue)
+		}
+		result.Issues = append(result.Issues, issue)
+	}
+
+	var resumable []models.Upload
+	if err := r.db.WithContext(ctx).Where("media_id IS NULL AND updated_at < ?", r.cutoff).Order("updated_at").Find(&resumable).Error; err != nil {
+		return err
+	}
+
+	for i := range resumable {
+		upload := &resumable[i]
+		issue := ReconcileIssue{
+			Kind:   IssueStaleUpload,
+			Key:    upload.Filename,
+			Record: "upload " + upload.ID.String(),
+			Detail: fmt.Sprintf("resumable upload at %d of %d bytes, last updated %s", upload.Offset, upload.Length, upload.UpdatedAt.Format(time.RFC3339)),
+		}
+		if r.opts.Mode == ReconcileFix {
+			r.removeUpload(ctx, upload, &issue)
+		}
+		result.Issues = append(result.Issues, issue)
+	}
+
+	return nil
+}
+
+// removeDirectUpload deletes an abandoned direct upload with its pending media.
+func (r *Reconciler) removeDirectUpload(ctx context.Context, upload *models.DirectUpload, issue *ReconcileIssue) {
+	if upload.MultipartID != "" {
+		if err := r.storageProvider.AbortMultipartUpload(ctx, upload.Filename, upload.MultipartID); err != nil {
+			log.Printf("%s: failed to abort multipart upload: %v", upload.Filename, err)
+		}
+	}
+
+	if err := r.storageProvider.DeleteFile(ctx, upload.Filename); err != nil {
+		issue.Error = err.Error()
+		return
+	}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(upload).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ? AND status = ?", upload.MediaID, models.MediaPending).Delete(&models.Media{}).Error
+	})
+	if err != nil {
+		issue.Error = err.Error()
+		return
+	}
+	issue.Action = "deleted upload and pending media"
+}
+
+// removeUpload deletes an abandoned resumable upload, and the object it was
+// assembled into if it got that far. Its staging files are removed when the
+// run shares the API server's staging directory.
+func (r *Reconciler) removeUpload(ctx context.Context, upload *models.Upload, issue *ReconcileIssue) {
+	var err error
+	if upload.Completed {
+		if err = r.storageProvider.DeleteFile(ctx, upload.Filename); errors.Is(err, storage.ErrObjectNotFound) {
+			err = nil
+		}
+	} else {
+		err = r.storageProvider.AbortMultipartUpload(ctx, upload.Filename, upload.MultipartID)
+	}
+	if err != nil {
+		issue.Error = err.Error()
+		return
+	}
+
+	if r.opts.StagingDir != "" {
+		files, _ := filepath.Glob(filepath.Join(r.opts.StagingDir, upload.ID.String()+".*"))
+		for _, file := range files {
+			os.Remove(file)
+		}
+	}
+
+	if err := r.db.WithContext(ctx).Select("Parts").Delete(upload).Error; err != nil {
+		issue.Error = err.Error()
+		return
+	}
+	issue.Action = "aborted and deleted upload"
+}
+
+// quarantine moves the object of issue under the quarantine prefix, where it
+// can be inspected and restored or deleted by hand.
+func (r *Reconciler) quarantine(ctx context.Context, issue *ReconcileIssue) bool {
+	target := r.opts.QuarantinePrefix + issue.Key
+
+	if err := r.storageProvider.Copy(ctx, issue.Key, target); err != nil {
+		issue.Error = fmt.Sprintf("failed to quarantine: %v", err)
+		return false
+	}
+	if err := r.storageProvider.DeleteFile(ctx, issue.Key); err != nil {
+		issue.Error = fmt.Sprintf("failed to delete after quarantining: %v", err)
+		return false
+	}
+
+	issue.Action = "quarantined as " + target
+	return true
+}
+
+// restore moves a quarantined copy of the object of issue back, reporting
+// whether there was one.
+func (r *Reconciler) restore(ctx context.Context, issue *ReconcileIssue) bool {
+	source := r.opts.QuarantinePrefix + issue.Key
+
+	exists, err := r.exists(ctx, source)
+	if err != nil {
+		issue.Error = err.Error()
+		return false
+	}
+	if !exists {
+		return false
+	}
+
+	if err := r.storageProvider.Copy(ctx, source, issue.Key); err != nil {
+		issue.Error = fmt.Sprintf("failed to restore from quarantine: %v", err)
+		return true
+	}
+	if err := r.storageProvider.DeleteFile(ctx, source); err != nil {
+		log.Printf("%s: %v", source, err)
+	}
+
+	issue.Action = "restored from " + source
+	return true
+}
+
+func (r *Reconciler) exists(ctx context.Context, key string) (bool, error) {
+	_, err := r.storageProvider.Stat(ctx, key)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"path"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/storage"
+	"gorm.io/gorm"
+)
+
+// RekeyResult summarises a key migration run.
+type RekeyResult struct {
+	Migrated int
+	Failed   int
+}
+
+// KeyMigrator moves media uploaded under the old "{user}/{filename}" keys,
+// which collide when two files share a name, to content-addressed blobs
+// under the configured key scheme. Only media without a checksum are
+// touched, so an interrupted run can simply be started again. Media in cold
+// storage are left until they are warm again.
+type KeyMigrator struct {
+	db              *gorm.DB
+	storageProvider *storage.StorageProvider
+	blobs           *BlobStore
+	dryRun          bool
+}
+
+func NewKeyMigrator(db *gorm.DB, storageProvider *storage.StorageProvider, dryRun bool) *KeyMigrator {
+	return &KeyMigrator{
+		db:              db,
+		storageProvider: storageProvider,
+		blobs:           NewBlobStore(db, storageProvider),
+		dryRun:          dryRun,
+	}
+}
+
+// Run migrates every legacy media record. A failure is logged and counted
+// and does not stop the run.
+func (m *KeyMigrator) Run(ctx context.Context) (RekeyResult, error) {
+	var result RekeyResult
+
+	var legacy []models.Media
+	if err := m.db.WithContext(ctx).Where("(checksum = '' OR checksum IS NULL) AND status = ? AND storage_tier = ?", models.MediaReady, models.TierHot).Order("created_at").Find(&legacy).Error; err != nil {
+		return result, err
+	}
+
+	for i := range legacy {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		if err := m.migrate(ctx, &legacy[i]); err != nil {
+			log.Printf("media %s (%s): %v", legacy[i].ID, legacy[i].Filename, err)
+			result.Failed++
+			continue
+		}
+		result.Migrated++
+	}
+
+	return result, nil
+}
+
+func (m *KeyMigrator) migrate(ctx context.Context, media *models.Media) error {
+	oldKey := media.Filename
+
+	info, err := m.storageProvider.Stat(ctx, oldKey)
+	if err != nil {
+		return fmt.Errorf("failed to stat object: %w", err)
+	}
+
+	checksum, err := m.checksum(ctx, oldKey)
+	if err != nil {
+		return err
+	}
+
+	key := m.storageProvider.ObjectKey(storage.KeyParams{
+		UserID:   media.UserID.String(),
+		MediaID:  media.ID.String(),
+		Checksum: checksum,
+		Filename: path.Base(oldKey),
+	})
+
+	if m.dryRun {
+		log.Printf("media %s: would move %s to %s", media.ID, oldKey, key)
+		return nil
+	}
+
+	blob := models.Blob{
+		Checksum:    checksum,
+		Size:        info.Size,
+		ContentType: info.ContentType,
+	}
+
+	err = m.blobs.Put(ctx, media.UserID, &blob, key, func(key string) error {
+		return m.storageProvider.Copy(ctx, oldKey, key)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy object: %w", err)
+	}
+
+	copied, err := m.storageProvider.Stat(ctx, blob.Filename)
+	if err != nil || copied.Size != info.Size {
+		m.blobs.ReleaseDetached(ctx, blob.Filename)
+		return fmt.Errorf("copy of %s could not be verified", oldKey)
+	}
+
+	storageURL, err := m.storageProvider.GetFileURL(ctx, blob.Filename)
+	if err != nil {
+		m.blobs.ReleaseDetached(ctx, blob.Filename)
+		return err
+	}
+
+	err = m.db.WithContext(ctx).Model(media).Updates(map[string]interface{}{
+		"filename":    blob.Filename,
+		"checksum":    checksum,
+		"storage_url": storageURL,
+	}).Error
+	if err != nil {
+		m.blobs.ReleaseDetached(ctx, blob.Filename)
+		return fmt.Errorf("failed to update media record: %w", err)
+	}
+
+	log.Printf("media %s: moved %s to %s", media.ID, oldKey, blob.Filename)
+
+	return m.deleteIfUnused(ctx, oldKey)
+}
+
+// deleteIfUnused removes a legacy object once no media record, version or
+// blob still points at it. Records that overwrote each other share one old key.
+func (m *KeyMigrator) deleteIfUnused(ctx context.Context, key string) error {
+	var references int64
+	if err := m.db.WithContext(ctx).Model(&models.Media{}).Where("filename = ?", key).Count(&references).Error; err != nil {
+		return err
+	}
+	if references > 0 {
+		return nil
+	}
+
+	if err := m.db.WithContext(ctx).Model(&models.Blob{}).Where("filename = ?", key).Count(&references).Error; err != nil {
+		return err
+	}
+	if references > 0 {
+		return nil
+	}
+
+	if err := m.db.WithContext(ctx).Model(&models.MediaVersion{}).Where("filename = ?", key).Count(&references).Error; err != nil {
+		return err
+	}
+	if references > 0 {
+		return nil
+	}
+
+	if err := m.storageProvider.DeleteFile(ctx, key); err != nil {
+		return fmt.Errorf("failed to delete old object: %w", err)
+	}
+	return nil
+}
+
+func (m *KeyMigrator) checksum(ctx context.Context, key string) (string, error) {
+	body, err := m.storageProvider.Open(ctx, key, 0, -1)
+	if err != nil {
+		return "", fmt.Errorf("failed to read object: %w", err)
+	}
+	defer body.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, body); err != nil {
+		return "", fmt.Errorf("failed to read object: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -8,4 +8,13 @@ var (
 	ErrMediaNotFound      = errors.New("media not found")
 	ErrUserNotFound       = errors.New("user not found")
 	ErrUnauthorized       = errors.New("unauthorized")
+	ErrQuotaExceeded      = errors.New("storage quota exceeded")
+	ErrVersionNotFound    = errors.New("version not found")
+	ErrVersionConflict    = errors.New("media file was replaced by another request")
+	ErrCorruptMedia       = errors.New("file is not a readable audio or video file")
+	ErrThumbnailNotFound  = errors.New("thumbnail not found")
+	ErrInvalidImage       = errors.New("file is not a JPEG or PNG image")
+	ErrJobNotFound        = errors.New("job not found")
+	ErrJobNotRetryable    = errors.New("only dead or pending jobs can be retried")
+	ErrUploadRejected     = errors.New("uploaded file was rejected")
 )
@@ -0,0 +1,656 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/storage"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Ways of picking the frame of a thumbnail candidate.
+const (
+	ThumbnailModeOffsets = "offsets" // the frame at each offset
+	ThumbnailModeScene   = "scene"   // the first frame of a new shot after each offset
+)
+
+// sceneWindow is how many seconds past an offset scene mode looks for a new
+// shot before settling for the frame at the offset.
+const sceneWindow = 10
+
+// imageFormats are the ffmpeg demuxers of the custom thumbnails accepted,
+// which match the image decoders readFrame knows.
+const imageFormats = "jpeg_pipe,png_pipe"
+
+var (
+	errFFmpegMissing = errors.New("ffmpeg not found")
+	errNoFrame       = errors.New("no frame")
+)
+
+// videoTypes are the file types taken to have a picture when the file was
+// not probed.
+var videoTypes = map[string]bool{"mp4": true, "avi": true, "mov": true, "mkv": true}
+
+// ThumbnailService pulls thumbnail candidates out of videos with a local
+// ffmpeg binary and stores them in several widths through the storage
+// provider, under keys built by the configured key scheme.
+type ThumbnailService struct {
+	db              *gorm.DB
+	storageProvider *storage.StorageProvider
+	cfg             config.ProcessConfig
+	missing         sync.Once
+}
+
+func NewThumbnailService(db *gorm.DB, storageProvider *storage.StorageProvider, cfg config.ProcessConfig) *ThumbnailService {
+	return &ThumbnailService{
+		db:              db,
+		storageProvider: storageProvider,
+		cfg:             cfg,
+	}
+}
+
+// frame is one size of a candidate, written to a local file.
+type frame struct {
+	path   string
+	format string // "jpeg" or "png"
+	width  int
+	height int
+	size   int64
+}
+
+// Generate takes a candidate from file at every configured offset. The first
+// one is selected unless the host uploaded a thumbnail, and the candidates
+// generated from an earlier file of the media are removed. Nothing happens
+// when thumbnails are off, the media has no picture or ffmpeg is not
+// installed. On return media.ThumbnailURL is up to date.
+func (s *ThumbnailService) Generate(ctx context.Context, media *models.Media, file io.Reader) error {
+	if !s.cfg.Thumbnails || !hasPicture(media) {
+		return nil
+	}
+
+	// ffmpeg seeks to the offsets
+	if f, ok := file.(*os.File); ok {
+		return s.generate(ctx, media, f.Name())
+	}
+
+	tmp, err := os.CreateTemp("", "thumbnail-source-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, file); err != nil {
+		return fmt.Errorf("failed to buffer file for thumbnails: %w", err)
+	}
+	return s.generate(ctx, media, tmp.Name())
+}
+
+// GenerateObject is Generate for the stored file of media, downloading it
+// first.
+func (s *ThumbnailService) GenerateObject(ctx context.Context, media *models.Media) error {
+	if !s.cfg.Thumbnails || !hasPicture(media) {
+		return nil
+	}
+
+	body, err := s.storageProvider.Open(ctx, media.Filename, 0, -1)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	return s.Generate(ctx, media, body)
+}
+
+func (s *ThumbnailService) generate(ctx context.Context, media *models.Media, path string) error {
+	dir, err := os.MkdirTemp("", "thumbnails-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	first, err := s.nextCandidate(ctx, media.ID)
+	if err != nil {
+		return err
+	}
+
+	var thumbnails []models.Thumbnail
+	candidate := first
+	for _, offset := range s.offsets(media.Duration) {
+		frames, err := s.extract(ctx, path, offset, filepath.Join(dir, strconv.Itoa(candidate)))
+		if errors.Is(err, errFFmpegMissing) {
+			s.missing.Do(func() {
+				log.Printf("%s not found, videos are stored without thumbnails", s.cfg.FFmpegPath)
+			})
+			return nil
+		}
+		if ctx.Err() != nil {
+			s.deleteObjects(ctx, thumbnails)
+			return ctx.Err()
+		}
+		if err != nil {
+			log.Printf("media %s: no thumbnail at %gs: %v", media.ID, offset, err)
+			continue
+		}
+
+		stored, err := s.store(ctx, media, candidate, offset, false, frames)
+		if err != nil {
+			s.deleteObjects(ctx, thumbnails)
+			return err
+		}
+		thumbnails = append(thumbnails, stored...)
+		candidate++
+	}
+
+	if len(thumbnails) == 0 {
+		return errors.New("no frame could be taken from the video")
+	}
+
+	var replaced []models.Thumbnail
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockMedia(tx, media.ID); err != nil {
+			return err
+		}
+
+		err := tx.Where("media_id = ? AND custom = ? AND candidate < ?", media.ID, false, first).Find(&replaced).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(&thumbnails).Error; err != nil {
+			return err
+		}
+		if len(replaced) > 0 {
+			if err := tx.Where("media_id = ? AND custom = ? AND candidate < ?", media.ID, false, first).Delete(&models.Thumbnail{}).Error; err != nil {
+				return err
+			}
+		}
+
+		// A thumbnail the host uploaded stays selected
+		var custom int64
+		err = tx.Model(&models.Thumbnail{}).Where("media_id = ? AND custom = ? AND selected = ?", media.ID, true, true).Count(&custom).Error
+		if err != nil || custom > 0 {
+			return err
+		}
+		return s.selectCandidate(tx, media, first)
+	})
+	if err != nil {
+		s.deleteObjects(ctx, thumbnails)
+		return err
+	}
+
+	// Only now that no record points at them
+	s.deleteObjects(ctx, replaced)
+	return nil
+}
+
+// AddCustom stores an image uploaded by the host as a new candidate, in
+// every configured width, and selects it. Without ffmpeg the image is stored
+// as it is.
+func (s *ThumbnailService) AddCustom(ctx context.Context, media *models.Media, file io.Reader) error {
+	dir, err := os.MkdirTemp("", "thumbnails-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "source")
+	if err := writeFile(source, file); err != nil {
+		return err
+	}
+	original, err := readFrame(source)
+	if err != nil {
+		return ErrInvalidImage
+	}
+
+	candidate, err := s.nextCandidate(ctx, media.ID)
+	if err != nil {
+		return err
+	}
+
+	frames, err := s.scale(ctx, inputArgs(imageFormats, source), "", filepath.Join(dir, "scaled"))
+	if errors.Is(err, errFFmpegMissing) {
+		frames = []frame{*original}
+	} else if err != nil {
+		return fmt.Errorf("failed to scale thumbnail: %w", err)
+	}
+
+	thumbnails, err := s.store(ctx, media, candidate, 0, true, frames)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockMedia(tx, media.ID); err != nil {
+			return err
+		}
+		if err := tx.Create(&thumbnails).Error; err != nil {
+			return err
+		}
+		return s.selectCandidate(tx, media, candidate)
+	})
+	if err != nil {
+		s.deleteObjects(ctx, thumbnails)
+	}
+	return err
+}
+
+// Select makes a candidate the thumbnail of media.
+func (s *ThumbnailService) Select(ctx context.Context, media *models.Media, candidate int) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockMedia(tx, media.ID); err != nil {
+			return err
+		}
+		return s.selectCandidate(tx, media, candidate)
+	})
+}
+
+// List returns every size of every candidate of a media.
+func (s *ThumbnailService) List(ctx context.Context, mediaID uuid.UUID) ([]models.Thumbnail, error) {
+	var thumbnails []models.Thumbnail
+	err := s.db.WithContext(ctx).Where("media_id = ?", mediaID).Order("candidate, width").Find(&thumbnails).Error
+	return thumbnails, err
+}
+
+// Find returns the size of a candidate that fits width: the smallest one at
+// least that wide, or the widest. Candidate 0 is the selected one, width 0
+// the widest.
+func (s *ThumbnailService) Find(ctx context.Context, mediaID uuid.UUID, candidate int, width int) (*models.Thumbnail, error) {
+	query := s.db.WithContext(ctx).Where("media_id = ?", mediaID)
+	if candidate == 0 {
+		query = query.Where("selected = ?", true)
+	} else {
+		query = query.Where("candidate = ?", candidate)
+	}
+
+	var sizes []models.Thumbnail
+	if err := query.Order("width").Find(&sizes).Error; err != nil {
+		return nil, err
+	}
+	if len(sizes) == 0 {
+		return nil, ErrThumbnailNotFound
+	}
+
+	for i := range sizes {
+		if width > 0 && sizes[i].Width >= width {
+			return &sizes[i], nil
+		}
+	}
+	return &sizes[len(sizes)-1], nil
+}
+
+// Release deletes every thumbnail of a media inside tx, as part of deleting
+// the media. It returns the images, which are left in storage for the caller
+// to delete once tx commits.
+func (s *ThumbnailService) Release(tx *gorm.DB, mediaID string) ([]string, error) {
+	var thumbnails []models.Thumbnail
+	if err := tx.Where("media_id = ?", mediaID).Find(&thumbnails).Error; err != nil {
+		return nil, err
+	}
+	if len(thumbnails) == 0 {
+		return nil, nil
+	}
+
+	if err := tx.Where("media_id = ?", mediaID).Delete(&models.Thumbnail{}).Error; err != nil {
+		return nil, err
+	}
+	filenames := make([]string, 0, len(thumbnails))
+	for _, thumbnail := range thumbnails {
+		filenames = append(filenames, thumbnail.Filename)
+	}
+	return filenames, nil
+}
+
+// selectCandidate marks candidate selected inside tx and points the media at
+// the route serving it, which checks access the way streaming does.
+func (s *ThumbnailService) selectCandidate(tx *gorm.DB, media *models.Media, candidate int) error {
+	var poster models.Thumbnail
+	err := tx.Where("media_id = ? AND candidate = ?", media.ID, candidate).Order("width DESC").First(&poster).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrThumbnailNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	thumbnailURL := ThumbnailPath(media.ID)
+	err = tx.Model(&models.Thumbnail{}).Where("media_id = ?", media.ID).
+		Update("selected", gorm.Expr("candidate = ?", candidate)).Error
+	if err != nil {
+		return err
+	}
+	if err := tx.Model(media).Update("thumbnail_url", thumbnailURL).Error; err != nil {
+		return err
+	}
+
+	media.ThumbnailURL = thumbnailURL
+	return nil
+}
+
+// extract writes the frame of the candidate at offset in every width.
+func (s *ThumbnailService) extract(ctx context.Context, path string, offset float64, dir string) ([]frame, error) {
+	seek := strconv.FormatFloat(offset, 'f', 3, 64)
+
+	if s.cfg.ThumbnailMode == ThumbnailModeScene {
+		filter := fmt.Sprintf("select='gt(scene,%g)'", s.cfg.SceneThreshold)
+		frames, err := s.scale(ctx, append([]string{"-ss", seek, "-t", strconv.Itoa(sceneWindow)}, inputArgs(mediaFormats, path)...), filter, dir+"-scene")
+		if !errors.Is(err, errNoFrame) {
+			return frames, err
+		}
+	}
+
+	return s.scale(ctx, append([]string{"-ss", seek}, inputArgs(mediaFormats, path)...), "", dir)
+}
+
+// scale runs ffmpeg on the given input options, writing the first frame
+// that passes filter as a JPEG in every configured width. Frames are not
+// scaled up, so a small one yields fewer sizes.
+func (s *ThumbnailService) scale(ctx context.Context, input []string, filter string, dir string) ([]frame, error) {
+	widths := s.widths()
+	if len(widths) == 0 {
+		return nil, errors.New("no thumbnail widths configured")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	graph := "[0:v]"
+	if filter != "" {
+		graph += filter + ","
+	}
+	graph += fmt.Sprintf("split=%d", len(widths))
+	for i := range widths {
+		graph += fmt.Sprintf("[s%d]", i)
+	}
+	for i, width := range widths {
+		graph += fmt.Sprintf(";[s%d]scale=w='min(%d,iw)':h=-2[o%d]", i, width, i)
+	}
+
+	args := append([]string{"-v", "error", "-y"}, input...)
+	args = append(args, "-filter_complex", graph)
+	for i := range widths {
+		args = append(args, "-map", fmt.Sprintf("[o%d]", i), "-frames:v", "1", "-q:v", "3", "-update", "1", filepath.Join(dir, fmt.Sprintf("%d.jpg", i)))
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, time.Duration(s.cfg.ThumbnailTimeout)*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(runCtx, s.cfg.FFmpegPath, args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+		return nil, errFFmpegMissing
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if runCtx.Err() != nil {
+		return nil, errors.New("ffmpeg timed out")
+	}
+	if err != nil {
+		return nil, errors.New(firstLine(stderr.String(), err.Error()))
+	}
+
+	var frames []frame
+	for i := range widths {
+		f, err := readFrame(filepath.Join(dir, fmt.Sprintf("%d.jpg", i)))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(frames) > 0 && frames[len(frames)-1].width == f.width {
+			continue
+		}
+		frames = append(frames, *f)
+	}
+
+	// Nothing passed the filter
+	if len(frames) == 0 {
+		return nil, errNoFrame
+	}
+	return frames, nil
+}
+
+// store uploads the frames of a candidate and returns their records, not yet
+// saved.
+func (s *ThumbnailService) store(ctx context.Context, media *models.Media, candidate int, offset float64, custom bool, frames []frame) ([]models.Thumbnail, error) {
+	var thumbnails []models.Thumbnail
+	for _, f := range frames {
+		key, err := s.key(media, candidate, f)
+		if err != nil {
+			s.deleteObjects(ctx, thumbnails)
+			return nil, fmt.Errorf("failed to read thumbnail: %w", err)
+		}
+
+		thumbnail := models.Thumbnail{
+			MediaID:   media.ID,
+			Candidate: candidate,
+			Width:     f.width,
+			Height:    f.height,
+			Offset:    offset,
+			Custom:    custom,
+			Filename:  key,
+			Size:      f.size,
+		}
+
+		if err := s.upload(ctx, f, thumbnail.Filename); err != nil {
+			s.deleteObjects(ctx, thumbnails)
+			return nil, fmt.Errorf("failed to upload thumbnail: %w", err)
+		}
+		thumbnails = append(thumbnails, thumbnail)
+	}
+	return thumbnails, nil
+}
+
+// key names the object of one size of a candidate under the key scheme.
+// The thumbnail takes the place of the media's own ID and file name, and its
+// checksum covers the media, candidate and width along with the image, so it
+// never shares a key with a media file or another thumbnail of the same
+// picture.
+func (s *ThumbnailService) key(media *models.Media, candidate int, f frame) (string, error) {
+	ext := "jpg"
+	if f.format == "png" {
+		ext = "png"
+	}
+
+	file, err := os.Open(f.path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "thumbnail:%s:%d:%d:", media.ID, candidate, f.width)
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("thumbnail-%d-%d", candidate, f.width)
+	return s.storageProvider.ObjectKey(storage.KeyParams{
+		UserID:   media.UserID.String(),
+		MediaID:  media.ID.String() + "-" + name,
+		Checksum: hex.EncodeToString(hash.Sum(nil)),
+		Filename: name + "." + ext,
+	}), nil
+}
+
+// ThumbnailPath is the route serving the selected thumbnail of a media, which
+// media.ThumbnailURL points at.
+func ThumbnailPath(mediaID uuid.UUID) string {
+	return fmt.Sprintf("/api/v1/media/%s/thumbnail", mediaID)
+}
+
+func (s *ThumbnailService) upload(ctx context.Context, f frame, key string) error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = s.storageProvider.UploadFile(ctx, file, key, "image/"+f.format)
+	return err
+}
+
+// deleteObjects removes the objects of thumbnails that are not, or no
+// longer, recorded. Failures are only logged; the reconciler finds what is
+// left behind.
+func (s *ThumbnailService) deleteObjects(ctx context.Context, thumbnails []models.Thumbnail) {
+	ctx = context.WithoutCancel(ctx)
+	for _, thumbnail := range thumbnails {
+		if err := s.storageProvider.DeleteFile(ctx, thumbnail.Filename); err != nil {
+			log.Printf("failed to delete thumbnail %s: %v", thumbnail.Filename, err)
+		}
+	}
+}
+
+func (s *ThumbnailService) nextCandidate(ctx context.Context, mediaID uuid.UUID) (int, error) {
+	var latest int
+	err := s.db.WithContext(ctx).Model(&models.Thumbnail{}).Where("media_id = ?", mediaID).
+		Select("COALESCE(MAX(candidate), 0)").Scan(&latest).Error
+	return latest + 1, err
+}
+
+// offsets resolves the configured offsets against a duration in seconds.
+// Offsets past the end are moved to the last second; ones that end up the
+// same are taken once.
+func (s *ThumbnailService) offsets(duration int) []float64 {
+	var offsets []float64
+	seen := make(map[float64]bool)
+	for _, spec := range s.cfg.ThumbnailOffsets {
+		offset, err := parseOffset(spec, duration)
+		if err != nil {
+			log.Printf("ignoring thumbnail offset %q: %v", spec, err)
+			continue
+		}
+		if duration > 0 && offset >= float64(duration) {
+			offset = math.Max(float64(duration-1), 0)
+		}
+
+		offset = math.Round(offset*1000) / 1000
+		if !seen[offset] {
+			seen[offset] = true
+			offsets = append(offsets, offset)
+		}
+	}
+
+	if len(offsets) == 0 {
+		return []float64{0}
+	}
+	return offsets
+}
+
+// widths returns the configured widths, ascending.
+func (s *ThumbnailService) widths() []int {
+	var widths []int
+	for _, width := range s.cfg.ThumbnailWidths {
+		if width > 0 {
+			widths = append(widths, width)
+		}
+	}
+	sort.Ints(widths)
+	return widths
+}
+
+// parseOffset reads an offset such as "30", "30s" or "25%". A percentage of
+// an unknown duration is the start of the video.
+func parseOffset(spec string, duration int) (float64, error) {
+	if percent, ok := strings.CutSuffix(spec, "%"); ok {
+		value, err := strconv.ParseFloat(percent, 64)
+		if err != nil || value < 0 || value > 100 {
+			return 0, errors.New("percentage must be between 0 and 100")
+		}
+		return value / 100 * float64(duration), nil
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSuffix(spec, "s"), 64)
+	if err != nil || value < 0 {
+		return 0, errors.New("must be seconds or a percentage")
+	}
+	return value, nil
+}
+
+// hasPicture reports whether media is a video. Probed media say so; others
+// go by their file type.
+func hasPicture(media *models.Media) bool {
+	switch media.ProbeStatus {
+	case models.ProbeOK:
+		return media.VideoCodec != ""
+	case models.ProbeCorrupt:
+		return false
+	}
+	return videoTypes[media.FileType]
+}
+
+// readFrame reads the format and size of an image file.
+func readFrame(path string) (*frame, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	bounds, format, err := image.DecodeConfig(file)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return &frame{
+		path:   path,
+		format: format,
+		width:  bounds.Width,
+		height: bounds.Height,
+		size:   info.Size(),
+	}, nil
+}
+
+func writeFile(path string, content io.Reader) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, content); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// lockMedia locks the media row inside tx, so changes to its thumbnails do
+// not interleave.
+func lockMedia(tx *gorm.DB, mediaID uuid.UUID) error {
+	var media models.Media
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", mediaID).First(&media).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrMediaNotFound
+	}
+	return err
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/models"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/storage"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MediaFile is the stored file of a media, current or prior.
+type MediaFile struct {
+	Filename    string
+	FileSize    int64
+	Checksum    string
+	FileType    string
+	Duration    int
+	StorageURL  string
+	StorageTier string
+	Info        models.MediaInfo
+}
+
+// VersionService replaces the file of a media while keeping the ones it had
+// before as versions it can be rolled back to.
+type VersionService struct {
+	db              *gorm.DB
+	storageProvider *storage.StorageProvider
+	blobs           *BlobStore
+}
+
+func NewVersionService(db *gorm.DB, storageProvider *storage.StorageProvider) *VersionService {
+	return &VersionService{
+		db:              db,
+		storageProvider: storageProvider,
+		blobs:           NewBlobStore(db, storageProvider),
+	}
+}
+
+// List returns the prior versions of a media, newest first.
+func (s *VersionService) List(ctx context.Context, mediaID string) ([]models.MediaVersion, error) {
+	var versions []models.MediaVersion
+	err := s.db.WithContext(ctx).Where("media_id = ?", mediaID).Order("version DESC").Find(&versions).Error
+	return versions, err
+}
+
+// Next returns the version number the next file of media will get.
+func (s *VersionService) Next(ctx context.Context, media *models.Media) (int, error) {
+	return s.next(s.db.WithContext(ctx), media)
+}
+
+func (s *VersionService) next(db *gorm.DB, media *models.Media) (int, error) {
+	var latest int
+	err := db.Model(&models.MediaVersion{}).Where("media_id = ?", media.ID).
+		Select("COALESCE(MAX(version), 0)").Scan(&latest).Error
+	if err != nil {
+		return 0, err
+	}
+	return max(media.Version, latest) + 1, nil
+}
+
+// Replace makes file, stored as the given version from Next, the current
+// file of a media and keeps the previous one as a version. The reference the
+// caller holds on the blob of file passes to the media. check, when not nil,
+// runs in the same transaction before anything changes, e.g. to reserve
+// quota. The returned media is the updated record.
+func (s *VersionService) Replace(ctx context.Context, mediaID string, file MediaFile, version int, check func(tx *gorm.DB) error) (*models.Media, error) {
+	var media models.Media
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := s.lock(tx, mediaID, &media); err != nil {
+			return err
+		}
+		if check != nil {
+			if err := check(tx); err != nil {
+				return err
+			}
+		}
+
+		next, err := s.next(tx, &media)
+		if err != nil {
+			return err
+		}
+		if next != version {
+			return ErrVersionConflict
+		}
+
+		if err := tx.Create(priorVersion(&media)).Error; err != nil {
+			return err
+		}
+		return s.setFile(tx, &media, file, version)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &media, nil
+}
+
+// Rollback makes a prior version current again. The file it replaces is kept
+// as a version in turn, so a rollback can be undone.
+func (s *VersionService) Rollback(ctx context.Context, mediaID string, version int) (*models.Media, error) {
+	var media models.Media
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := s.lock(tx, mediaID, &media); err != nil {
+			return err
+		}
+
+		var target models.MediaVersion
+		err := tx.Where("media_id = ? AND version = ?", media.ID, version).First(&target).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrVersionNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		// The object may have changed tier since, along with media sharing it
+		tier := target.StorageTier
+		var tiers []string
+		err = tx.Model(&models.Media{}).Where("filename = ? AND id <> ?", target.Filename, media.ID).
+			Limit(1).Pluck("storage_tier", &tiers).Error
+		if err != nil {
+			return err
+		}
+		if len(tiers) > 0 {
+			tier = tiers[0]
+		}
+
+		if err := tx.Delete(&target).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(priorVersion(&media)).Error; err != nil {
+			return err
+		}
+
+		return s.setFile(tx, &media, MediaFile{
+			Filename:    target.Filename,
+			FileSize:    target.FileSize,
+			Checksum:    target.Checksum,
+			FileType:    target.FileType,
+			Duration:    target.Duration,
+			StorageURL:  target.StorageURL,
+			StorageTier: tier,
+			Info:        target.MediaInfo,
+		}, target.Version)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &media, nil
+}
+
+// Delete removes a prior version and releases its object.
+func (s *VersionService) Delete(ctx context.Context, mediaID string, version int) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var media models.Media
+		if err := s.lock(tx, mediaID, &media); err != nil {
+			return err
+		}
+
+		var target models.MediaVersion
+		err := tx.Where("media_id = ? AND version = ?", media.ID, version).First(&target).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrVersionNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Delete(&target).Error; err != nil {
+			return err
+		}
+		return s.release(ctx, tx, &target)
+	})
+}
+
+// Release deletes every prior version of a media inside tx, as part of
+// deleting the media. It returns the files no longer referenced, which are
+// left in storage for the caller to delete once tx commits.
+func (s *VersionService) Release(tx *gorm.DB, mediaID string) ([]string, error) {
+	var versions []models.MediaVersion
+	if err := tx.Where("media_id = ?", mediaID).Find(&versions).Error; err != nil {
+		return nil, err
+	}
+
+	var orphans []string
+	for i := range versions {
+		if err := tx.Delete(&versions[i]).Error; err != nil {
+			return nil, err
+		}
+
+		// Files uploaded before blobs existed belong to their version alone
+		orphaned := versions[i].Checksum == ""
+		if !orphaned {
+			var err error
+			if orphaned, err = s.blobs.Drop(tx, versions[i].Filename); err != nil {
+				return nil, err
+			}
+		}
+		if orphaned {
+			orphans = append(orphans, versions[i].Filename)
+		}
+	}
+	return orphans, nil
+}
+
+// release drops the version's reference on its blob. Files uploaded before
+// blobs existed are deleted directly, like the media that owned them.
+func (s *VersionService) release(ctx context.Context, tx *gorm.DB, version *models.MediaVersion) error {
+	if version.Checksum != "" {
+		return s.blobs.Release(ctx, tx, version.Filename)
+	}
+
+	if err := s.storageProvider.DeleteFile(ctx, version.Filename); err != nil {
+		return fmt.Errorf("failed to delete file from storage: %w", err)
+	}
+	return nil
+}
+
+// lock loads the media for update. Only media with a stored file have
+// versions.
+func (s *VersionService) lock(tx *gorm.DB, mediaID string, media *models.Media) error {
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND status IN ?", mediaID, []string{models.MediaReady, models.MediaMissing}).
+		First(media).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrMediaNotFound
+	}
+	return err
+}
+
+func (s *VersionService) setFile(tx *gorm.DB, media *models.Media, file MediaFile, version int) error {
+	probe := &ProbeResult{Duration: file.Duration, Info: file.Info}
+	updates := probe.Columns()
+	updates["filename"] = file.Filename
+	updates["file_size"] = file.FileSize
+	updates["checksum"] = file.Checksum
+	updates["file_type"] = file.FileType
+	updates["storage_url"] = file.StorageURL
+	updates["storage_tier"] = file.StorageTier
+	updates["version"] = version
+	updates["status"] = models.MediaReady
+
+	if err := tx.Model(media).Updates(updates).Error; err != nil {
+		return err
+	}
+
+	media.Filename = file.Filename
+	media.FileSize = file.FileSize
+	media.Checksum = file.Checksum
+	media.FileType = file.FileType
+	media.Duration = file.Duration
+	media.StorageURL = file.StorageURL
+	media.StorageTier = file.StorageTier
+	media.MediaInfo = file.Info
+	media.Version = version
+	media.Status = models.MediaReady
+	return nil
+}
+
+// priorVersion returns the version row keeping the current file of media.
+func priorVersion(media *models.Media) *models.MediaVersion {
+	return &models.MediaVersion{
+		MediaID:     media.ID,
+		Version:     max(media.Version, 1),
+		Filename:    media.Filename,
+		FileSize:    media.FileSize,
+		Checksum:    media.Checksum,
+		FileType:    media.FileType,
+		Duration:    media.Duration,
+		StorageURL:  media.StorageURL,
+		StorageTier: media.StorageTier,
+		MediaInfo:   media.MediaInfo,
+	}
+}
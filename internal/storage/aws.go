@@ -1,34 +1,78 @@
 package storage
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/interfaces"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
+func init() {
+	Register("aws", Driver{
+		Validate: func(cfg config.StorageConfig) []string {
+			return missingSettings(
+				setting{"AWS_ACCESS_KEY_ID", cfg.AWS.AccessKeyID},
+				setting{"AWS_SECRET_ACCESS_KEY", cfg.AWS.SecretAccessKey},
+				setting{"AWS_REGION", cfg.AWS.Region},
+				setting{"AWS_BUCKET_NAME", cfg.AWS.BucketName},
+			)
+		},
+		New: func(ctx context.Context, cfg config.StorageConfig) (interfaces.Provider, error) {
+			return NewAWSProvider(cfg.AWS)
+		},
+	})
+}
+
 type AWSProvider struct {
 	s3Client   *s3.S3
 	uploader   *s3manager.Uploader
 	bucketName string
+	baseURL    string // objects are at baseURL + "/" + key
 }
 
 func NewAWSProvider(cfg config.AWSConfig) (*AWSProvider, error) {
-	sess, err := session.NewSession(&aws.Config{
-		Region:      aws.String(cfg.Region),
-		Credentials: credentials.NewStaticCredentials(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
-	})
+	awsConfig := &aws.Config{
+		Region:           aws.String(cfg.Region),
+		Credentials:      credentials.NewStaticCredentials(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
+		S3ForcePathStyle: aws.Bool(cfg.ForcePathStyle),
+	}
+
+	// An explicit endpoint lets the provider talk to MinIO, Ceph or LocalStack
+	if cfg.Endpoint != "" {
+		awsConfig.Endpoint = aws.String(cfg.Endpoint)
+	}
+	if cfg.InsecureSkipVerify {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		awsConfig.HTTPClient = &http.Client{Transport: transport}
+	}
+
+	sess, err := session.NewSession(awsConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create AWS session: %w", err)
 	}
 
+	baseURL, err := awsBaseURL(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	s3Client := s3.New(sess)
 	uploader := s3manager.NewUploader(sess)
 
@@ -36,11 +80,39 @@ func NewAWSProvider(cfg config.AWSConfig) (*AWSProvider, error) {
 		s3Client:   s3Client,
 		uploader:   uploader,
 		bucketName: cfg.BucketName,
+		baseURL:    baseURL,
 	}, nil
 }
 
-func (p *AWSProvider) UploadFile(file io.Reader, filename string, contentType string) (string, error) {
-	_, err := p.uploader.Upload(&s3manager.UploadInput{
+// awsBaseURL returns where the objects of the bucket are served from:
+// AWS_PUBLIC_BASE_URL when set, otherwise the bucket's address on the
+// endpoint.
+func awsBaseURL(cfg config.AWSConfig) (string, error) {
+	if cfg.PublicBaseURL != "" {
+		return strings.TrimSuffix(cfg.PublicBaseURL, "/"), nil
+	}
+	if cfg.Endpoint == "" {
+		if cfg.ForcePathStyle {
+			return fmt.Sprintf("https://s3.%s.amazonaws.com/%s", cfg.Region, cfg.BucketName), nil
+		}
+		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com", cfg.BucketName, cfg.Region), nil
+	}
+
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return "", fmt.Errorf("invalid AWS endpoint %q: must be an absolute URL", cfg.Endpoint)
+	}
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/")
+	if cfg.ForcePathStyle {
+		endpoint.Path += "/" + cfg.BucketName
+	} else {
+		endpoint.Host = cfg.BucketName + "." + endpoint.Host
+	}
+	return endpoint.String(), nil
+}
+
+func (p *AWSProvider) UploadFile(ctx context.Context, file io.Reader, filename string, contentType string) (string, error) {
+	_, err := p.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
 		Bucket:      aws.String(p.bucketName),
 		Key:         aws.String(filename),
 		Body:        file,
@@ -50,11 +122,11 @@ func (p *AWSProvider) UploadFile(file io.Reader, filename string, contentType st
 		return "", fmt.Errorf("failed to upload file to S3: %w", err)
 	}
 
-	return p.GetFileURL(filename)
+	return p.GetFileURL(ctx, filename)
 }
 
-func (p *AWSProvider) DeleteFile(filename string) error {
-	_, err := p.s3Client.DeleteObject(&s3.DeleteObjectInput{
+func (p *AWSProvider) DeleteFile(ctx context.Context, filename string) error {
+	_, err := p.s3Client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(p.bucketName),
 		Key:    aws.String(filename),
 	})
@@ -64,15 +136,16 @@ func (p *AWSProvider) DeleteFile(filename string) error {
 	return nil
 }
 
-func (p *AWSProvider) GetFileURL(filename string) (string, error) {
-	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", p.bucketName, *p.s3Client.Config.Region, filename), nil
+func (p *AWSProvider) GetFileURL(ctx context.Context, filename string) (string, error) {
+	return p.baseURL + "/" + escapePath(filename), nil
 }
 
-func (p *AWSProvider) GeneratePresignedURL(filename string, expiresIn int64) (string, error) {
+func (p *AWSProvider) GeneratePresignedURL(ctx context.Context, filename string, expiresIn int64) (string, error) {
 	req, _ := p.s3Client.GetObjectRequest(&s3.GetObjectInput{
 		Bucket: aws.String(p.bucketName),
 		Key:    aws.String(filename),
 	})
+	req.SetContext(ctx)
 
 	url, err := req.Presign(time.Duration(expiresIn) * time.Second)
 	if err != nil {
@@ -81,3 +154,338 @@ func (p *AWSProvider) GeneratePresignedURL(filename string, expiresIn int64) (st
 
 	return url, nil
 }
+
+func (p *AWSProvider) PresignUpload(ctx context.Context, filename string, contentType string, expiresIn int64) (*interfaces.PresignedRequest, error) {
+	req, _ := p.s3Client.PutObjectRequest(&s3.PutObjectInput{
+		Bucket:      aws.String(p.bucketName),
+		Key:         aws.String(filename),
+		ContentType: aws.String(contentType),
+	})
+	req.SetContext(ctx)
+
+	return presignAWSRequest(req, expiresIn)
+}
+
+func (p *AWSProvider) PresignUploadPart(ctx context.Context, filename string, uploadID string, partNumber int, expiresIn int64) (*interfaces.PresignedRequest, error) {
+	req, _ := p.s3Client.UploadPartRequest(&s3.UploadPartInput{
+		Bucket:     aws.String(p.bucketName),
+		Key:        aws.String(filename),
+		UploadId:   aws.String(uploadID),
+		PartNumber: aws.Int64(int64(partNumber)),
+	})
+	req.SetContext(ctx)
+
+	return presignAWSRequest(req, expiresIn)
+}
+
+// presignAWSRequest signs req along with the headers it sets, which the
+// client then has to send unchanged.
+func presignAWSRequest(req *request.Request, expiresIn int64) (*interfaces.PresignedRequest, error) {
+	url, header, err := req.PresignRequest(time.Duration(expiresIn) * time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate presigned upload URL: %w", err)
+	}
+
+	headers := make(map[string]string, len(header))
+	for name := range header {
+		headers[name] = header.Get(name)
+	}
+	return &interfaces.PresignedRequest{
+		Method:  http.MethodPut,
+		URL:     url,
+		Headers: headers,
+	}, nil
+}
+
+func (p *AWSProvider) CreateMultipartUpload(ctx context.Context, filename string, contentType string) (string, error) {
+	out, err := p.s3Client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(p.bucketName),
+		Key:         aws.String(filename),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create multipart upload: %w", err)
+	}
+	return aws.StringValue(out.UploadId), nil
+}
+
+func (p *AWSProvider) UploadPart(ctx context.Context, filename string, uploadID string, partNumber int, part io.ReadSeeker, size int64) (string, error) {
+	out, err := p.s3Client.UploadPartWithContext(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(p.bucketName),
+		Key:           aws.String(filename),
+		UploadId:      aws.String(uploadID),
+		PartNumber:    aws.Int64(int64(partNumber)),
+		Body:          part,
+		ContentLength: aws.Int64(size),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload part %d: %w", partNumber, err)
+	}
+	return aws.StringValue(out.ETag), nil
+}
+
+func (p *AWSProvider) CompleteMultipartUpload(ctx context.Context, filename string, uploadID string, contentType string, parts []interfaces.CompletedPart) (string, error) {
+	completed := make([]*s3.CompletedPart, len(parts))
+	for i, part := range parts {
+		completed[i] = &s3.CompletedPart{
+			ETag:       aws.String(part.ETag),
+			PartNumber: aws.Int64(int64(part.PartNumber)),
+		}
+	}
+
+	_, err := p.s3Client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(p.bucketName),
+		Key:             aws.String(filename),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+
+	return p.GetFileURL(ctx, filename)
+}
+
+func (p *AWSProvider) AbortMultipartUpload(ctx context.Context, filename string, uploadID string) error {
+	_, err := p.s3Client.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(p.bucketName),
+		Key:      aws.String(filename),
+		UploadId: aws.String(uploadID),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to abort multipart upload: %w", err)
+	}
+	return nil
+}
+
+func (p *AWSProvider) Stat(ctx context.Context, filename string) (*interfaces.ObjectInfo, error) {
+	out, err := p.head(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return &interfaces.ObjectInfo{
+		Size:         aws.Int64Value(out.ContentLength),
+		ContentType:  aws.StringValue(out.ContentType),
+		ETag:         aws.StringValue(out.ETag),
+		LastModified: aws.TimeValue(out.LastModified),
+	}, nil
+}
+
+func (p *AWSProvider) Open(ctx context.Context, filename string, offset int64, length int64) (io.ReadCloser, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(p.bucketName),
+		Key:    aws.String(filename),
+	}
+	if offset > 0 || length >= 0 {
+		input.Range = aws.String(httpRange(offset, length))
+	}
+
+	out, err := p.s3Client.GetObjectWithContext(ctx, input)
+	if err != nil {
+		if isAWSNotFound(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("failed to read file from S3: %w", err)
+	}
+	return out.Body, nil
+}
+
+func (p *AWSProvider) List(ctx context.Context, prefix string, token string, limit int) (*interfaces.ObjectPage, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(p.bucketName),
+		Prefix: aws.String(prefix),
+	}
+	if token != "" {
+		input.ContinuationToken = aws.String(token)
+	}
+	if limit > 0 {
+		input.MaxKeys = aws.Int64(int64(limit))
+	}
+
+	out, err := p.s3Client.ListObjectsV2WithContext(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files in S3: %w", err)
+	}
+
+	page := &interfaces.ObjectPage{}
+	for _, object := range out.Contents {
+		page.Objects = append(page.Objects, interfaces.ObjectSummary{
+			Key:          aws.StringValue(object.Key),
+			Size:         aws.Int64Value(object.Size),
+			ETag:         aws.StringValue(object.ETag),
+			LastModified: aws.TimeValue(object.LastModified),
+		})
+	}
+	if aws.BoolValue(out.IsTruncated) {
+		page.NextToken = aws.StringValue(out.NextContinuationToken)
+	}
+	return page, nil
+}
+
+// CopyObject accepts objects of up to 5 GiB; bigger ones are copied in parts.
+const (
+	awsMaxCopySize  = 5 << 30
+	awsCopyPartSize = 512 << 20
+)
+
+func (p *AWSProvider) Copy(ctx context.Context, src string, dst string) error {
+	info, err := p.Stat(ctx, src)
+	if err != nil {
+		return err
+	}
+	return p.copyObject(ctx, src, dst, info, "")
+}
+
+// SetStorageClass copies the object onto itself under class. Archived
+// objects must be restored first.
+func (p *AWSProvider) SetStorageClass(ctx context.Context, filename string, class string) error {
+	if class == "" {
+		class = s3.StorageClassStandard
+	}
+
+	out, err := p.head(ctx, filename)
+	if err != nil {
+		return err
+	}
+	// S3 omits the class of STANDARD objects
+	current := aws.StringValue(out.StorageClass)
+	if current == "" {
+		current = s3.StorageClassStandard
+	}
+	if current == class {
+		return nil
+	}
+
+	info := &interfaces.ObjectInfo{
+		Size:        aws.Int64Value(out.ContentLength),
+		ContentType: aws.StringValue(out.ContentType),
+	}
+	return p.copyObject(ctx, filename, filename, info, class)
+}
+
+// Restore requests a temporary copy of a GLACIER or DEEP_ARCHIVE object.
+// Objects in other classes can always be read.
+func (p *AWSProvider) Restore(ctx context.Context, filename string, days int) (bool, error) {
+	out, err := p.head(ctx, filename)
+	if err != nil {
+		return false, err
+	}
+
+	switch aws.StringValue(out.StorageClass) {
+	case s3.StorageClassGlacier, s3.StorageClassDeepArchive:
+	default:
+		return true, nil
+	}
+
+	// x-amz-restore is set once a restore has been requested
+	if restore := aws.StringValue(out.Restore); restore != "" {
+		return strings.Contains(restore, `ongoing-request="false"`), nil
+	}
+
+	_, err = p.s3Client.RestoreObjectWithContext(ctx, &s3.RestoreObjectInput{
+		Bucket: aws.String(p.bucketName),
+		Key:    aws.String(filename),
+		RestoreRequest: &s3.RestoreRequest{
+			Days:                 aws.Int64(int64(max(days, 1))),
+			GlacierJobParameters: &s3.GlacierJobParameters{Tier: aws.String(s3.TierStandard)},
+		},
+	})
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == "RestoreAlreadyInProgress" {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to restore file in S3: %w", err)
+	}
+	return false, nil
+}
+
+func (p *AWSProvider) head(ctx context.Context, filename string) (*s3.HeadObjectOutput, error) {
+	out, err := p.s3Client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(p.bucketName),
+		Key:    aws.String(filename),
+	})
+	if err != nil {
+		if isAWSNotFound(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("failed to stat file in S3: %w", err)
+	}
+	return out, nil
+}
+
+// copyObject copies src to dst, under class when it is not empty. Objects
+// over 5 GiB are copied in parts.
+func (p *AWSProvider) copyObject(ctx context.Context, src string, dst string, info *interfaces.ObjectInfo, class string) error {
+	source := url.PathEscape(p.bucketName) + "/" + escapePath(src)
+	var storageClass *string
+	if class != "" {
+		storageClass = aws.String(class)
+	}
+
+	if info.Size > awsMaxCopySize {
+		return p.copyParts(ctx, source, dst, info, storageClass)
+	}
+
+	_, err := p.s3Client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+		Bucket:       aws.String(p.bucketName),
+		Key:          aws.String(dst),
+		CopySource:   aws.String(source),
+		StorageClass: storageClass,
+	})
+	if err != nil {
+		if isAWSNotFound(err) {
+			return ErrObjectNotFound
+		}
+		return fmt.Errorf("failed to copy file in S3: %w", err)
+	}
+	return nil
+}
+
+func (p *AWSProvider) copyParts(ctx context.Context, source string, dst string, info *interfaces.ObjectInfo, storageClass *string) error {
+	out, err := p.s3Client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:       aws.String(p.bucketName),
+		Key:          aws.String(dst),
+		ContentType:  aws.String(info.ContentType),
+		StorageClass: storageClass,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create multipart upload: %w", err)
+	}
+	uploadID := aws.StringValue(out.UploadId)
+
+	var parts []interfaces.CompletedPart
+	for offset, partNumber := int64(0), 1; offset < info.Size; offset, partNumber = offset+awsCopyPartSize, partNumber+1 {
+		out, err := p.s3Client.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+			Bucket:          aws.String(p.bucketName),
+			Key:             aws.String(dst),
+			UploadId:        aws.String(uploadID),
+			PartNumber:      aws.Int64(int64(partNumber)),
+			CopySource:      aws.String(source),
+			CopySourceRange: aws.String(httpRange(offset, min(awsCopyPartSize, info.Size-offset))),
+		})
+		if err != nil {
+			p.AbortMultipartUpload(context.WithoutCancel(ctx), dst, uploadID)
+			return fmt.Errorf("failed to copy part %d in S3: %w", partNumber, err)
+		}
+		parts = append(parts, interfaces.CompletedPart{
+			PartNumber: partNumber,
+			ETag:       aws.StringValue(out.CopyPartResult.ETag),
+		})
+	}
+
+	if _, err := p.CompleteMultipartUpload(ctx, dst, uploadID, info.ContentType, parts); err != nil {
+		p.AbortMultipartUpload(context.WithoutCancel(ctx), dst, uploadID)
+		return err
+	}
+	return nil
+}
+
+func isAWSNotFound(err error) bool {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		return aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == "NotFound"
+	}
+	return false
+}
@@ -1 +1,391 @@
 package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/interfaces"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+	"github.com/google/uuid"
+)
+
+func init() {
+	Register("azure", Driver{
+		Validate: func(cfg config.StorageConfig) []string {
+			return missingSettings(
+				setting{"AZURE_ACCOUNT_NAME", cfg.Azure.AccountName},
+				setting{"AZURE_ACCOUNT_KEY", cfg.Azure.AccountKey},
+				setting{"AZURE_CONTAINER_NAME", cfg.Azure.ContainerName},
+			)
+		},
+		New: func(ctx context.Context, cfg config.StorageConfig) (interfaces.Provider, error) {
+			return NewAzureProvider(ctx, cfg.Azure)
+		},
+	})
+}
+
+type AzureProvider struct {
+	client        *azblob.Client
+	containerName string
+}
+
+func NewAzureProvider(ctx context.Context, cfg config.AzureConfig) (*AzureProvider, error) {
+	cred, err := azblob.NewSharedKeyCredential(cfg.AccountName, cfg.AccountKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Azure credentials: %w", err)
+	}
+
+	// An explicit endpoint lets the provider talk to Azurite or sovereign clouds
+	serviceURL := cfg.Endpoint
+	if serviceURL == "" {
+		serviceURL = fmt.Sprintf("https://%s.blob.core.windows.net/", cfg.AccountName)
+	}
+
+	client, err := azblob.NewClientWithSharedKeyCredential(serviceURL, cred, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Azure blob client: %w", err)
+	}
+
+	_, err = client.CreateContainer(ctx, cfg.ContainerName, nil)
+	if err != nil && !bloberror.HasCode(err, bloberror.ContainerAlreadyExists) {
+		return nil, fmt.Errorf("failed to create Azure container: %w", err)
+	}
+
+	return &AzureProvider{
+		client:        client,
+		containerName: cfg.ContainerName,
+	}, nil
+}
+
+func (p *AzureProvider) UploadFile(ctx context.Context, file io.Reader, filename string, contentType string) (string, error) {
+	_, err := p.client.UploadStream(ctx, p.containerName, azureBlobName(filename), file, &azblob.UploadStreamOptions{
+		HTTPHeaders: &blob.HTTPHeaders{
+			BlobContentType: &contentType,
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload file to Azure: %w", err)
+	}
+
+	return p.GetFileURL(ctx, filename)
+}
+
+func (p *AzureProvider) DeleteFile(ctx context.Context, filename string) error {
+	_, err := p.client.DeleteBlob(ctx, p.containerName, azureBlobName(filename), nil)
+	if err != nil && !bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return fmt.Errorf("failed to delete file from Azure: %w", err)
+	}
+	return nil
+}
+
+func (p *AzureProvider) GetFileURL(ctx context.Context, filename string) (string, error) {
+	return p.blobClient(filename).URL(), nil
+}
+
+func (p *AzureProvider) GeneratePresignedURL(ctx context.Context, filename string, expiresIn int64) (string, error) {
+	expiry := time.Now().UTC().Add(time.Duration(expiresIn) * time.Second)
+
+	url, err := p.blobClient(filename).GetSASURL(sas.BlobPermissions{Read: true}, expiry, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate SAS URL: %w", err)
+	}
+
+	return url, nil
+}
+
+func (p *AzureProvider) PresignUpload(ctx context.Context, filename string, contentType string, expiresIn int64) (*interfaces.PresignedRequest, error) {
+	sasURL, err := p.uploadSASURL(filename, expiresIn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &interfaces.PresignedRequest{
+		Method: http.MethodPut,
+		URL:    sasURL,
+		Headers: map[string]string{
+			"x-ms-blob-type":         "BlockBlob",
+			"x-ms-blob-content-type": contentType,
+		},
+	}, nil
+}
+
+// PresignUploadPart signs a Put Block request for the block that
+// CompleteMultipartUpload commits for the part.
+func (p *AzureProvider) PresignUploadPart(ctx context.Context, filename string, uploadID string, partNumber int, expiresIn int64) (*interfaces.PresignedRequest, error) {
+	sasURL, err := p.uploadSASURL(filename, expiresIn)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("comp", "block")
+	query.Set("blockid", azureBlockID(uploadID, partNumber))
+
+	return &interfaces.PresignedRequest{
+		Method: http.MethodPut,
+		URL:    sasURL + "&" + query.Encode(),
+	}, nil
+}
+
+func (p *AzureProvider) uploadSASURL(filename string, expiresIn int64) (string, error) {
+	expiry := time.Now().UTC().Add(time.Duration(expiresIn) * time.Second)
+
+	sasURL, err := p.blobClient(filename).GetSASURL(sas.BlobPermissions{Create: true, Write: true}, expiry, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate SAS upload URL: %w", err)
+	}
+	return sasURL, nil
+}
+
+func (p *AzureProvider) blobClient(filename string) *blob.Client {
+	return p.containerClient().NewBlobClient(azureBlobName(filename))
+}
+
+func (p *AzureProvider) blockBlobClient(filename string) *blockblob.Client {
+	return p.containerClient().NewBlockBlobClient(azureBlobName(filename))
+}
+
+// azureBlobName maps an object key to a blob name. Every call goes through
+// it, so a key is stored and looked up under the same name.
+func azureBlobName(filename string) string {
+	return strings.TrimLeft(filename, "/")
+}
+
+func (p *AzureProvider) containerClient() *container.Client {
+	return p.client.ServiceClient().NewContainerClient(p.containerName)
+}
+
+// Azure has no explicit multipart session: parts are staged as uncommitted
+// blocks and the block list is committed at the end. The upload ID only
+// namespaces block IDs so concurrent uploads to one blob cannot collide.
+func (p *AzureProvider) CreateMultipartUpload(ctx context.Context, filename string, contentType string) (string, error) {
+	return uuid.NewString(), nil
+}
+
+func (p *AzureProvider) UploadPart(ctx context.Context, filename string, uploadID string, partNumber int, part io.ReadSeeker, size int64) (string, error) {
+	blockID := azureBlockID(uploadID, partNumber)
+
+	_, err := p.blockBlobClient(filename).StageBlock(ctx, blockID, streaming.NopCloser(part), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to stage block %d: %w", partNumber, err)
+	}
+	return blockID, nil
+}
+
+func (p *AzureProvider) CompleteMultipartUpload(ctx context.Context, filename string, uploadID string, contentType string, parts []interfaces.CompletedPart) (string, error) {
+	blockIDs := make([]string, len(parts))
+	for i, part := range parts {
+		blockIDs[i] = azureBlockID(uploadID, part.PartNumber)
+	}
+
+	_, err := p.blockBlobClient(filename).CommitBlockList(ctx, blockIDs, &blockblob.CommitBlockListOptions{
+		HTTPHeaders: &blob.HTTPHeaders{
+			BlobContentType: &contentType,
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to commit block list: %w", err)
+	}
+
+	return p.GetFileURL(ctx, filename)
+}
+
+// AbortMultipartUpload is a no-op: Azure discards uncommitted blocks on its own.
+func (p *AzureProvider) AbortMultipartUpload(ctx context.Context, filename string, uploadID string) error {
+	return nil
+}
+
+// azureBlockID builds a block ID; all IDs within a blob must have the same length.
+func azureBlockID(uploadID string, partNumber int) string {
+	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s-%06d", uploadID, partNumber)))
+}
+
+func (p *AzureProvider) Stat(ctx context.Context, filename string) (*interfaces.ObjectInfo, error) {
+	props, err := p.blobClient(filename).GetProperties(ctx, nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("failed to stat file in Azure: %w", err)
+	}
+
+	info := &interfaces.ObjectInfo{}
+	if props.ContentLength != nil {
+		info.Size = *props.ContentLength
+	}
+	if props.ContentType != nil {
+		info.ContentType = *props.ContentType
+	}
+	if props.ETag != nil {
+		info.ETag = string(*props.ETag)
+	}
+	if props.LastModified != nil {
+		info.LastModified = *props.LastModified
+	}
+	return info, nil
+}
+
+func (p *AzureProvider) Open(ctx context.Context, filename string, offset int64, length int64) (io.ReadCloser, error) {
+	options := &blob.DownloadStreamOptions{
+		Range: blob.HTTPRange{Offset: offset},
+	}
+	if length >= 0 {
+		options.Range.Count = length
+	}
+
+	resp, err := p.blobClient(filename).DownloadStream(ctx, options)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("failed to read file from Azure: %w", err)
+	}
+	return resp.Body, nil
+}
+
+func (p *AzureProvider) List(ctx context.Context, prefix string, token string, limit int) (*interfaces.ObjectPage, error) {
+	options := &container.ListBlobsFlatOptions{}
+	if prefix = azureBlobName(prefix); prefix != "" {
+		options.Prefix = &prefix
+	}
+	if token != "" {
+		options.Marker = &token
+	}
+	if limit > 0 {
+		maxResults := int32(limit)
+		options.MaxResults = &maxResults
+	}
+
+	resp, err := p.containerClient().NewListBlobsFlatPager(options).NextPage(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files in Azure: %w", err)
+	}
+
+	page := &interfaces.ObjectPage{}
+	if resp.NextMarker != nil {
+		page.NextToken = *resp.NextMarker
+	}
+	if resp.Segment == nil {
+		return page, nil
+	}
+
+	for _, item := range resp.Segment.BlobItems {
+		object := interfaces.ObjectSummary{Key: *item.Name}
+		if props := item.Properties; props != nil {
+			if props.ContentLength != nil {
+				object.Size = *props.ContentLength
+			}
+			if props.ETag != nil {
+				object.ETag = string(*props.ETag)
+			}
+			if props.LastModified != nil {
+				object.LastModified = *props.LastModified
+			}
+		}
+		page.Objects = append(page.Objects, object)
+	}
+	return page, nil
+}
+
+// azureCopyPollInterval is how often Copy checks on a pending server-side copy.
+const azureCopyPollInterval = 500 * time.Millisecond
+
+// Copy starts a server-side copy and waits for it to finish. Copies within one
+// storage account usually complete straight away.
+func (p *AzureProvider) Copy(ctx context.Context, src string, dst string) error {
+	destination := p.blobClient(dst)
+
+	resp, err := destination.StartCopyFromURL(ctx, p.blobClient(src).URL(), nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.CannotVerifyCopySource, bloberror.BlobNotFound) {
+			return ErrObjectNotFound
+		}
+		return fmt.Errorf("failed to copy file in Azure: %w", err)
+	}
+
+	status := resp.CopyStatus
+	for status != nil && *status == blob.CopyStatusTypePending {
+		select {
+		case <-time.After(azureCopyPollInterval):
+		case <-ctx.Done():
+			if resp.CopyID != nil {
+				destination.AbortCopyFromURL(context.WithoutCancel(ctx), *resp.CopyID, nil)
+			}
+			return ctx.Err()
+		}
+
+		props, err := destination.GetProperties(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to check Azure copy status: %w", err)
+		}
+		status = props.CopyStatus
+		if status != nil && *status != blob.CopyStatusTypePending && *status != blob.CopyStatusTypeSuccess {
+			description := ""
+			if props.CopyStatusDescription != nil {
+				description = *props.CopyStatusDescription
+			}
+			return fmt.Errorf("azure copy %s: %s", *status, description)
+		}
+	}
+	return nil
+}
+
+// SetStorageClass moves the blob to the access tier class. Archived blobs
+// must be rehydrated first.
+func (p *AzureProvider) SetStorageClass(ctx context.Context, filename string, class string) error {
+	if class == "" {
+		class = string(blob.AccessTierHot)
+	}
+
+	_, err := p.blobClient(filename).SetTier(ctx, blob.AccessTier(class), nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return ErrObjectNotFound
+		}
+		return fmt.Errorf("failed to change access tier in Azure: %w", err)
+	}
+	return nil
+}
+
+// Restore rehydrates an archived blob to the hot tier. Rehydration keeps the
+// blob hot, so days is not used.
+func (p *AzureProvider) Restore(ctx context.Context, filename string, days int) (bool, error) {
+	client := p.blobClient(filename)
+
+	props, err := client.GetProperties(ctx, nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return false, ErrObjectNotFound
+		}
+		return false, fmt.Errorf("failed to stat file in Azure: %w", err)
+	}
+
+	if props.AccessTier == nil || blob.AccessTier(*props.AccessTier) != blob.AccessTierArchive {
+		return true, nil
+	}
+	// ArchiveStatus is set while a rehydration is pending
+	if props.ArchiveStatus != nil {
+		return false, nil
+	}
+
+	priority := blob.RehydratePriorityStandard
+	_, err = client.SetTier(ctx, blob.AccessTierHot, &blob.SetTierOptions{RehydratePriority: &priority})
+	if err != nil {
+		return false, fmt.Errorf("failed to rehydrate file in Azure: %w", err)
+	}
+	return false, nil
+}
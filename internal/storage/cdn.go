@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/aws/aws-sdk-go/service/cloudfront/sign"
+)
+
+// Policies a CDN signs URLs with.
+const (
+	CDNPolicyCanned = "canned" // the exact URL until it expires
+	CDNPolicyCustom = "custom" // adds the client IP condition, and allows wildcards
+)
+
+// CDN hands out URLs of objects served by a CDN whose origin is the storage
+// backend. With a key pair it signs them, or signs cookies covering a path
+// prefix, using CloudFront canned or custom policies.
+type CDN struct {
+	baseURL       string
+	policy        string
+	expiry        time.Duration
+	restrictIP    bool
+	signedCookies bool
+	urls          *sign.URLSigner
+	cookies       *sign.CookieSigner
+}
+
+func NewCDN(cfg config.CDNConfig) (*CDN, error) {
+	baseURL := strings.TrimSuffix(cfg.BaseURL, "/")
+	base, err := url.Parse(baseURL)
+	if err != nil || base.Host == "" || (base.Scheme != "http" && base.Scheme != "https") {
+		return nil, fmt.Errorf("invalid CDN base URL %q", cfg.BaseURL)
+	}
+	if cfg.Policy != CDNPolicyCanned && cfg.Policy != CDNPolicyCustom {
+		return nil, fmt.Errorf("invalid CDN policy %q: must be %s or %s", cfg.Policy, CDNPolicyCanned, CDNPolicyCustom)
+	}
+	if cfg.RestrictIP && cfg.Policy != CDNPolicyCustom {
+		return nil, errors.New("CDN_RESTRICT_IP requires CDN_POLICY=custom")
+	}
+	if cfg.URLExpiry <= 0 {
+		return nil, errors.New("CDN URL expiry must be positive")
+	}
+
+	cdn := &CDN{
+		baseURL:       baseURL,
+		policy:        cfg.Policy,
+		expiry:        time.Duration(cfg.URLExpiry) * time.Second,
+		restrictIP:    cfg.RestrictIP,
+		signedCookies: cfg.SignedCookies,
+	}
+
+	// An unsigned distribution serves plain URLs
+	if cfg.KeyPairID == "" {
+		if cfg.SignedCookies {
+			return nil, errors.New("CDN_SIGNED_COOKIES requires CDN_KEY_PAIR_ID")
+		}
+		return cdn, nil
+	}
+
+	key, err := loadCDNKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	cookiePath := base.Path
+	if cookiePath == "" {
+		cookiePath = "/"
+	}
+
+	cdn.urls = sign.NewURLSigner(cfg.KeyPairID, key)
+	cdn.cookies = sign.NewCookieSigner(cfg.KeyPairID, key, func(opts *sign.CookieOptions) {
+		opts.Path = cookiePath
+		opts.Domain = cfg.CookieDomain
+		opts.Secure = base.Scheme == "https"
+	})
+	return cdn, nil
+}
+
+// loadCDNKey reads the RSA private key of the key pair, in PKCS #1 or PKCS #8
+// form.
+func loadCDNKey(cfg config.CDNConfig) (*rsa.PrivateKey, error) {
+	data := []byte(cfg.PrivateKey)
+	if len(data) == 0 {
+		if cfg.PrivateKeyFile == "" {
+			return nil, errors.New("CDN_KEY_PAIR_ID requires CDN_PRIVATE_KEY or CDN_PRIVATE_KEY_FILE")
+		}
+
+		var err error
+		data, err = os.ReadFile(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CDN private key: %w", err)
+		}
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("CDN private key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CDN private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("CDN private key must be an RSA key")
+	}
+	return key, nil
+}
+
+// URL returns the unsigned CDN URL of an object.
+func (c *CDN) URL(filename string) string {
+	return c.baseURL + "/" + escapePath(filename)
+}
+
+// Expiry returns how long signed URLs and cookies stay valid.
+func (c *CDN) Expiry() time.Duration {
+	return c.expiry
+}
+
+// SignedCookies reports whether clients are given signed cookies and plain
+// URLs rather than signed URLs.
+func (c *CDN) SignedCookies() bool {
+	return c.signedCookies
+}
+
+// SignURL returns a URL of the object that stays valid for the configured
+// expiry. clientIP restricts it when the custom policy asks for that.
+func (c *CDN) SignURL(filename string, clientIP string) (string, error) {
+	rawURL := c.URL(filename)
+	if c.urls == nil {
+		return rawURL, nil
+	}
+
+	expires := time.Now().Add(c.expiry)
+	if c.policy == CDNPolicyCanned {
+		return c.urls.Sign(rawURL, expires)
+	}
+	return c.urls.SignWithPolicy(rawURL, c.customPolicy(rawURL, expires, clientIP))
+}
+
+// SignCookies returns cookies granting access to every object whose key
+// starts with prefix, such as all the segments of a stream. They always use a
+// custom policy, since only those can hold a wildcard.
+func (c *CDN) SignCookies(prefix string, clientIP string) ([]*http.Cookie, error) {
+	if c.cookies == nil {
+		return nil, errors.New("CDN has no key pair to sign cookies with")
+	}
+
+	resource := c.URL(prefix) + "*"
+	return c.cookies.SignWithPolicy(c.customPolicy(resource, time.Now().Add(c.expiry), clientIP))
+}
+
+func (c *CDN) customPolicy(resource string, expires time.Time, clientIP string) *sign.Policy {
+	statement := sign.Statement{
+		Resource: resource,
+		Condition: sign.Condition{
+			DateLessThan: sign.NewAWSEpochTime(expires),
+		},
+	}
+
+	if ip := net.ParseIP(clientIP); c.restrictIP && ip != nil {
+		bits := 128
+		if ip.To4() != nil {
+			bits = 32
+		}
+		statement.Condition.IPAddress = &sign.IPAddress{SourceIP: fmt.Sprintf("%s/%d", ip, bits)}
+	}
+
+	return &sign.Policy{Statements: []sign.Statement{statement}}
+}
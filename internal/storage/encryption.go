@@ -0,0 +1,928 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/interfaces"
+)
+
+// Objects are encrypted in fixed-size chunks, each sealed on its own with a
+// random nonce, so a byte range can be served by decrypting only the chunks
+// that cover it. The stored layout of a chunk is nonce || ciphertext || tag.
+const (
+	encryptionChunkSize = 64 << 10
+	dataKeySize         = 32
+	chunkOverhead       = 12 + 16 // GCM nonce and tag
+)
+
+// Formats of encrypted objects. Since formatBound each chunk is sealed with
+// its index and whether it is the last one, and each data key with the name
+// of its object. Objects written before stay readable.
+const (
+	formatUnbound = 0
+	formatBound   = 1
+)
+
+var (
+	// ErrPresignEncrypted is returned for presigned URLs of encrypted objects,
+	// which clients could not decrypt.
+	ErrPresignEncrypted = errors.New("presigned URLs are not available for encrypted storage")
+	// ErrKeyStoreNotSet is returned when the encrypted provider is used before
+	// SetKeyStore.
+	ErrKeyStoreNotSet = errors.New("encryption key store is not configured")
+
+	errTruncated = errors.New("encrypted object ends without its final chunk")
+)
+
+// Keyring holds the master keys that wrap per-object data keys. The active
+// key wraps new data keys; the others are kept to unwrap older ones.
+type Keyring struct {
+	activeID string
+	keys     map[string]cipher.AEAD
+}
+
+// NewKeyring loads the master keys from the configuration and the key file.
+// Each entry has the form "id:base64-key" with a 32 byte key.
+func NewKeyring(cfg config.EncryptionConfig) (*Keyring, error) {
+	entries := append([]string(nil), cfg.MasterKeys...)
+
+	if cfg.KeyFile != "" {
+		data, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read encryption key file: %w", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				entries = append(entries, line)
+			}
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("encryption is enabled but no master key is configured (set ENCRYPTION_MASTER_KEYS or ENCRYPTION_KEY_FILE)")
+	}
+
+	keyring := &Keyring{keys: make(map[string]cipher.AEAD)}
+	for _, entry := range entries {
+		id, encoded, ok := strings.Cut(entry, ":")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid master key entry %q, expected id:base64-key", id)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil || len(key) != dataKeySize {
+			return nil, fmt.Errorf("master key %q must be %d bytes encoded as base64", id, dataKeySize)
+		}
+
+		if _, exists := keyring.keys[id]; exists {
+			return nil, fmt.Errorf("duplicate master key id %q", id)
+		}
+
+		aead, err := newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+		keyring.keys[id] = aead
+		if keyring.activeID == "" {
+			keyring.activeID = id
+		}
+	}
+
+	return keyring, nil
+}
+
+// ActiveKeyID returns the id of the master key used for new data keys.
+func (k *Keyring) ActiveKeyID() string {
+	return k.activeID
+}
+
+// Wrap encrypts a data key with the active master key into key. The wrapped
+// key is bound to key.Filename, so it cannot be moved to another object.
+func (k *Keyring) Wrap(key *interfaces.ObjectKey, dataKey []byte) error {
+	sealed, err := seal(k.keys[k.activeID], dataKey, wrapAD(*key))
+	if err != nil {
+		return err
+	}
+	key.KeyID, key.WrappedKey = k.activeID, sealed
+	return nil
+}
+
+// Unwrap decrypts the data key held in key.
+func (k *Keyring) Unwrap(key interfaces.ObjectKey) ([]byte, error) {
+	aead, ok := k.keys[key.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown master key %q", key.KeyID)
+	}
+
+	dataKey, err := open(aead, key.WrappedKey, wrapAD(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+// rewrap returns key wrapped anew for the object filename.
+func (k *Keyring) rewrap(key interfaces.ObjectKey, filename string) (interfaces.ObjectKey, error) {
+	dataKey, err := k.Unwrap(key)
+	if err != nil {
+		return key, err
+	}
+	key.Filename = filename
+	return key, k.Wrap(&key, dataKey)
+}
+
+// RotateKeys re-wraps every data key that is not wrapped with the active
+// master key. Objects are left untouched. It returns the number of keys
+// re-wrapped.
+func RotateKeys(ctx context.Context, keyring *Keyring, keys interfaces.KeyStore) (int, error) {
+	const batchSize = 100
+
+	rotated := 0
+	for {
+		batch, err := keys.FindKeysNotWrappedWith(ctx, keyring.ActiveKeyID(), batchSize)
+		if err != nil {
+			return rotated, err
+		}
+		if len(batch) == 0 {
+			return rotated, nil
+		}
+
+		for _, key := range batch {
+			dataKey, err := keyring.Unwrap(key)
+			if err != nil {
+				return rotated, fmt.Errorf("%s: %w", key.Filename, err)
+			}
+
+			if err := keyring.Wrap(&key, dataKey); err != nil {
+				return rotated, err
+			}
+
+			if err := keys.SaveKey(ctx, key); err != nil {
+				return rotated, err
+			}
+			rotated++
+		}
+	}
+}
+
+// EncryptedProvider encrypts objects before they reach the wrapped provider
+// and decrypts them on the way back. Data keys are kept in a KeyStore.
+type EncryptedProvider struct {
+	provider interfaces.Provider
+	keyring  *Keyring
+	keys     interfaces.KeyStore
+}
+
+func NewEncryptedProvider(provider interfaces.Provider, cfg config.EncryptionConfig) (*EncryptedProvider, error) {
+	keyring, err := NewKeyring(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EncryptedProvider{
+		provider: provider,
+		keyring:  keyring,
+	}, nil
+}
+
+// SetKeyStore sets where wrapped data keys are persisted. It must be called
+// before the provider is used.
+func (p *EncryptedProvider) SetKeyStore(keys interfaces.KeyStore) {
+	p.keys = keys
+}
+
+// Keyring returns the master keys in use.
+func (p *EncryptedProvider) Keyring() *Keyring {
+	return p.keyring
+}
+
+// Unwrap returns the provider that stores the encrypted objects.
+func (p *EncryptedProvider) Unwrap() interfaces.Provider {
+	return p.provider
+}
+
+func (p *EncryptedProvider) UploadFile(ctx context.Context, file io.Reader, filename string, contentType string) (string, error) {
+	if p.keys == nil {
+		return "", ErrKeyStoreNotSet
+	}
+
+	dataKey, key, err := p.newDataKey(filename)
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	previous, err := p.findKey(ctx, filename)
+	if err != nil {
+		return "", err
+	}
+
+	if previous == nil {
+		url, err := p.provider.UploadFile(ctx, newEncryptReader(file, aead, 0, true), filename, contentType)
+		if err != nil {
+			return "", err
+		}
+		if err := p.keys.SaveKey(ctx, *key); err != nil {
+			p.provider.DeleteFile(context.WithoutCancel(ctx), filename)
+			return "", fmt.Errorf("failed to save data key: %w", err)
+		}
+		return url, nil
+	}
+
+	// An existing object is only replaced once the new one is fully stored
+	// under a temporary name, so a failed upload leaves it readable
+	temp, err := tempObjectName()
+	if err != nil {
+		return "", err
+	}
+	defer p.provider.DeleteFile(context.WithoutCancel(ctx), temp)
+
+	if _, err := p.provider.UploadFile(ctx, newEncryptReader(file, aead, 0, true), temp, contentType); err != nil {
+		return "", err
+	}
+
+	err = p.replace(ctx, *key, previous, func() error {
+		return p.provider.Copy(ctx, temp, filename)
+	})
+	if err != nil {
+		return "", err
+	}
+	return p.provider.GetFileURL(ctx, filename)
+}
+
+func (p *EncryptedProvider) DeleteFile(ctx context.Context, filename string) error {
+	if p.keys == nil {
+		return ErrKeyStoreNotSet
+	}
+
+	if err := p.provider.DeleteFile(ctx, filename); err != nil {
+		return err
+	}
+	return p.keys.DeleteKey(ctx, filename)
+}
+
+func (p *EncryptedProvider) GetFileURL(ctx context.Context, filename string) (string, error) {
+	return p.provider.GetFileURL(ctx, filename)
+}
+
+func (p *EncryptedProvider) GeneratePresignedURL(ctx context.Context, filename string, expiresIn int64) (string, error) {
+	return "", ErrPresignEncrypted
+}
+
+func (p *EncryptedProvider) Stat(ctx context.Context, filename string) (*interfaces.ObjectInfo, error) {
+	info, err := p.provider.Stat(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	plain := *info
+	plain.Size = plaintextSize(info.Size)
+	return &plain, nil
+}
+
+func (p *EncryptedProvider) Open(ctx context.Context, filename string, offset int64, length int64) (io.ReadCloser, error) {
+	aead, key, err := p.dataKey(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read whole chunks covering the range and drop the bytes around it
+	const sealedChunk = encryptionChunkSize + chunkOverhead
+	firstChunk := offset / encryptionChunkSize
+	chunks, cipherLength := int64(-1), int64(-1)
+	if length >= 0 {
+		lastChunk := (offset + length - 1) / encryptionChunkSize
+		if length == 0 {
+			lastChunk = firstChunk
+		}
+		chunks = lastChunk - firstChunk + 1
+		// One byte more shows whether the object goes on after the range
+		cipherLength = chunks*sealedChunk + 1
+	}
+
+	body, err := p.provider.Open(ctx, filename, firstChunk*sealedChunk, cipherLength)
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted := &decryptReader{
+		src:    body,
+		aead:   aead,
+		bound:  key.Format >= formatBound,
+		index:  uint64(firstChunk),
+		chunks: chunks,
+	}
+	if _, err := io.CopyN(io.Discard, decrypted, offset-firstChunk*encryptionChunkSize); err != nil {
+		body.Close()
+		return nil, fmt.Errorf("failed to decrypt object: %w", err)
+	}
+
+	var r io.Reader = decrypted
+	if length >= 0 {
+		r = io.LimitReader(decrypted, length)
+	}
+	return &readCloser{Reader: r, Closer: body}, nil
+}
+
+func (p *EncryptedProvider) List(ctx context.Context, prefix string, token string, limit int) (*interfaces.ObjectPage, error) {
+	page, err := p.provider.List(ctx, prefix, token, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range page.Objects {
+		page.Objects[i].Size = plaintextSize(page.Objects[i].Size)
+	}
+	return page, nil
+}
+
+// Copy copies the ciphertext as is and gives the copy the same data key,
+// wrapped for its new name, so no object data is decrypted on the way.
+func (p *EncryptedProvider) Copy(ctx context.Context, src string, dst string) error {
+	if p.keys == nil {
+		return ErrKeyStoreNotSet
+	}
+
+	key, err := p.keys.FindKey(ctx, src)
+	if err != nil {
+		return fmt.Errorf("failed to find data key: %w", err)
+	}
+	previous, err := p.findKey(ctx, dst)
+	if err != nil {
+		return err
+	}
+
+	copied, err := p.keyring.rewrap(*key, dst)
+	if err != nil {
+		return err
+	}
+	return p.replace(ctx, copied, previous, func() error {
+		return p.provider.Copy(ctx, src, dst)
+	})
+}
+
+// SetStorageClass moves the ciphertext; the data key is unaffected.
+func (p *EncryptedProvider) SetStorageClass(ctx context.Context, filename string, class string) error {
+	classer, ok := p.provider.(interfaces.StorageClasser)
+	if !ok {
+		return ErrStorageClassNotSupported
+	}
+	return classer.SetStorageClass(ctx, filename, class)
+}
+
+func (p *EncryptedProvider) Restore(ctx context.Context, filename string, days int) (bool, error) {
+	classer, ok := p.provider.(interfaces.StorageClasser)
+	if !ok {
+		return false, ErrStorageClassNotSupported
+	}
+	return classer.Restore(ctx, filename, days)
+}
+
+// CreateMultipartUpload starts an upload whose parts are encrypted with a new
+// data key. The key is stored under a pending name until the upload
+// completes, so the upload can resume after a restart.
+func (p *EncryptedProvider) CreateMultipartUpload(ctx context.Context, filename string, contentType string) (string, error) {
+	uploader, ok := p.provider.(interfaces.MultipartUploader)
+	if !ok {
+		return "", ErrMultipartNotSupported
+	}
+	if p.keys == nil {
+		return "", ErrKeyStoreNotSet
+	}
+
+	uploadID, err := uploader.CreateMultipartUpload(ctx, filename, contentType)
+	if err != nil {
+		return "", err
+	}
+
+	_, key, err := p.newDataKey(pendingKeyName(uploadID))
+	if err == nil {
+		err = p.keys.SaveKey(ctx, *key)
+	}
+	if err != nil {
+		uploader.AbortMultipartUpload(context.WithoutCancel(ctx), filename, uploadID)
+		return "", fmt.Errorf("failed to save data key: %w", err)
+	}
+
+	return uploadID, nil
+}
+
+// UploadPart encrypts and uploads one part, sealing its chunks as the backend
+// reads them. Chunks are numbered across the whole object, so part 1 must
+// come first and every later part except the last must have its size, a
+// multiple of the encryption chunk size. A part that is shorter, or not such
+// a multiple, is taken as the last one.
+func (p *EncryptedProvider) UploadPart(ctx context.Context, filename string, uploadID string, partNumber int, part io.ReadSeeker, size int64) (string, error) {
+	uploader, ok := p.provider.(interfaces.MultipartUploader)
+	if !ok {
+		return "", ErrMultipartNotSupported
+	}
+
+	aead, key, err := p.dataKey(ctx, pendingKeyName(uploadID))
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case partNumber == 1:
+		key.PartSize = size
+	case key.PartSize == 0:
+		return "", fmt.Errorf("part 1 must be uploaded before part %d", partNumber)
+	case key.LastPart != 0 && partNumber > key.LastPart:
+		return "", fmt.Errorf("part %d follows the last part %d", partNumber, key.LastPart)
+	case size > key.PartSize:
+		return "", fmt.Errorf("part %d is larger than part 1", partNumber)
+	}
+
+	last := size < key.PartSize || size%encryptionChunkSize != 0
+	if last {
+		key.LastPart = partNumber
+	}
+	if err := p.keys.SaveKey(ctx, *key); err != nil {
+		return "", fmt.Errorf("failed to save data key: %w", err)
+	}
+
+	firstChunk := uint64(partNumber-1) * uint64(key.PartSize/encryptionChunkSize)
+	sealed := newSealedPart(part, size, aead, firstChunk, last)
+	etag, err := uploader.UploadPart(ctx, filename, uploadID, partNumber, sealed, sealed.Size())
+	if err != nil {
+		return "", fmt.Errorf("failed to upload encrypted part %d: %w", partNumber, err)
+	}
+	return etag, nil
+}
+
+func (p *EncryptedProvider) CompleteMultipartUpload(ctx context.Context, filename string, uploadID string, contentType string, parts []interfaces.CompletedPart) (string, error) {
+	uploader, ok := p.provider.(interfaces.MultipartUploader)
+	if !ok {
+		return "", ErrMultipartNotSupported
+	}
+	if p.keys == nil {
+		return "", ErrKeyStoreNotSet
+	}
+
+	aead, key, err := p.dataKey(ctx, pendingKeyName(uploadID))
+	if err != nil {
+		return "", err
+	}
+
+	// When every part was full, none of them ended in the final chunk, so an
+	// empty one is added as a part of its own
+	if key.LastPart == 0 {
+		partNumber := 1
+		if len(parts) > 0 {
+			partNumber = parts[len(parts)-1].PartNumber + 1
+		}
+		final, err := seal(aead, nil, chunkAD(uint64(partNumber-1)*uint64(key.PartSize/encryptionChunkSize), true))
+		if err != nil {
+			return "", err
+		}
+		etag, err := uploader.UploadPart(ctx, filename, uploadID, partNumber, bytes.NewReader(final), int64(len(final)))
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts[:len(parts):len(parts)], interfaces.CompletedPart{PartNumber: partNumber, ETag: etag})
+	}
+
+	completed, err := p.keyring.rewrap(*key, filename)
+	if err != nil {
+		return "", err
+	}
+	completed.PartSize, completed.LastPart = 0, 0
+
+	previous, err := p.findKey(ctx, filename)
+	if err != nil {
+		return "", err
+	}
+
+	var url string
+	err = p.replace(ctx, completed, previous, func() error {
+		url, err = uploader.CompleteMultipartUpload(ctx, filename, uploadID, contentType, parts)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := p.keys.DeleteKey(ctx, pendingKeyName(uploadID)); err != nil {
+		return "", fmt.Errorf("failed to delete pending data key: %w", err)
+	}
+
+	return url, nil
+}
+
+func (p *EncryptedProvider) AbortMultipartUpload(ctx context.Context, filename string, uploadID string) error {
+	uploader, ok := p.provider.(interfaces.MultipartUploader)
+	if !ok {
+		return ErrMultipartNotSupported
+	}
+	if p.keys == nil {
+		return ErrKeyStoreNotSet
+	}
+
+	if err := uploader.AbortMultipartUpload(ctx, filename, uploadID); err != nil {
+		return err
+	}
+	return p.keys.DeleteKey(ctx, pendingKeyName(uploadID))
+}
+
+// Close closes the wrapped provider.
+func (p *EncryptedProvider) Close() error {
+	if closer, ok := p.provider.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// newDataKey generates a data key and wraps it for storage under filename.
+func (p *EncryptedProvider) newDataKey(filename string) ([]byte, *interfaces.ObjectKey, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	key := &interfaces.ObjectKey{
+		Filename:  filename,
+		ChunkSize: encryptionChunkSize,
+		Format:    formatBound,
+	}
+	if err := p.keyring.Wrap(key, dataKey); err != nil {
+		return nil, nil, err
+	}
+	return dataKey, key, nil
+}
+
+// dataKey loads and unwraps the data key for filename.
+func (p *EncryptedProvider) dataKey(ctx context.Context, filename string) (cipher.AEAD, *interfaces.ObjectKey, error) {
+	if p.keys == nil {
+		return nil, nil, ErrKeyStoreNotSet
+	}
+
+	key, err := p.keys.FindKey(ctx, filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find data key: %w", err)
+	}
+	if key.ChunkSize != encryptionChunkSize {
+		return nil, nil, fmt.Errorf("unsupported encryption chunk size %d", key.ChunkSize)
+	}
+
+	dataKey, err := p.keyring.Unwrap(*key)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, key, nil
+}
+
+// findKey returns the key saved for filename, or nil when there is none.
+func (p *EncryptedProvider) findKey(ctx context.Context, filename string) (*interfaces.ObjectKey, error) {
+	key, err := p.keys.FindKey(ctx, filename)
+	if errors.Is(err, interfaces.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find data key: %w", err)
+	}
+	return key, nil
+}
+
+// replace saves key over previous, the key of the object it replaces (nil
+// when there is none), and then runs write to put the object in place. The
+// old object cannot be read in between. If write fails, previous is restored.
+func (p *EncryptedProvider) replace(ctx context.Context, key interfaces.ObjectKey, previous *interfaces.ObjectKey, write func() error) error {
+	if err := p.keys.SaveKey(ctx, key); err != nil {
+		return fmt.Errorf("failed to save data key: %w", err)
+	}
+
+	if err := write(); err != nil {
+		ctx := context.WithoutCancel(ctx)
+		if previous != nil {
+			p.keys.SaveKey(ctx, *previous)
+		} else {
+			p.keys.DeleteKey(ctx, key.Filename)
+		}
+		return err
+	}
+	return nil
+}
+
+func pendingKeyName(uploadID string) string {
+	return ".multipart/" + uploadID
+}
+
+// tempObjectName returns a name to stage a replacement object under.
+func tempObjectName() (string, error) {
+	suffix := make([]byte, 16)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return ".replacing/" + hex.EncodeToString(suffix), nil
+}
+
+// plaintextSize converts the stored size of an encrypted object back to the
+// size of its content. Only the last chunk may be short.
+func plaintextSize(size int64) int64 {
+	const sealedChunk = encryptionChunkSize + chunkOverhead
+	chunks := (size + sealedChunk - 1) / sealedChunk
+	if plain := size - chunks*chunkOverhead; plain > 0 {
+		return plain
+	}
+	return 0
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with a random nonce and prepends the nonce.
+func seal(aead cipher.AEAD, plaintext []byte, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(aead cipher.AEAD, sealed []byte, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+// chunkAD is the additional data a chunk is sealed with: its index in the
+// object and whether it is the last one, so chunks cannot be reordered or
+// dropped from the end.
+func chunkAD(index uint64, final bool) []byte {
+	ad := make([]byte, 9)
+	binary.BigEndian.PutUint64(ad, index)
+	if final {
+		ad[8] = 1
+	}
+	return ad
+}
+
+// wrapAD is the additional data a data key is wrapped with.
+func wrapAD(key interfaces.ObjectKey) []byte {
+	if key.Format < formatBound {
+		return nil
+	}
+	return []byte(key.Filename)
+}
+
+// encryptReader yields the sealed chunks of everything read from src,
+// numbered from index. When last is set, the end of src is the end of the
+// object and its chunk is sealed as the final one. An empty input still
+// produces one chunk.
+type encryptReader struct {
+	src   *bufio.Reader
+	aead  cipher.AEAD
+	index uint64
+	last  bool
+	plain []byte
+	out   []byte
+	done  bool
+}
+
+func newEncryptReader(src io.Reader, aead cipher.AEAD, index uint64, last bool) *encryptReader {
+	return &encryptReader{
+		src:   bufio.NewReaderSize(src, encryptionChunkSize),
+		aead:  aead,
+		index: index,
+		last:  last,
+		plain: make([]byte, encryptionChunkSize),
+	}
+}
+
+func (r *encryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		n, err := io.ReadFull(r.src, r.plain)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			r.done = true
+		} else if err != nil {
+			return 0, err
+		} else if _, err := r.src.Peek(1); err == io.EOF {
+			// A full chunk is the last one when nothing follows it
+			r.done = true
+		} else if err != nil {
+			return 0, err
+		}
+
+		r.out, err = seal(r.aead, r.plain[:n], chunkAD(r.index, r.done && r.last))
+		if err != nil {
+			return 0, err
+		}
+		r.index++
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// sealedPart is the sealed form of a part, produced one chunk at a time as
+// it is read. Backends may seek back to sign or retry a part; each chunk keeps
+// the nonce it was first sealed with, so reading it again yields the same
+// bytes. Only one chunk is held in memory.
+type sealedPart struct {
+	src    io.ReadSeeker
+	size   int64 // plaintext bytes
+	aead   cipher.AEAD
+	index  uint64 // index of the first chunk in the object
+	last   bool
+	nonces [][]byte
+	chunk  int // chunk held in sealed, -1 for none
+	sealed []byte
+	pos    int64 // position in the sealed part
+}
+
+func newSealedPart(src io.ReadSeeker, size int64, aead cipher.AEAD, index uint64, last bool) *sealedPart {
+	// An empty part still has one chunk
+	chunks := max((size+encryptionChunkSize-1)/encryptionChunkSize, 1)
+	return &sealedPart{
+		src:    src,
+		size:   size,
+		aead:   aead,
+		index:  index,
+		last:   last,
+		nonces: make([][]byte, chunks),
+		chunk:  -1,
+	}
+}
+
+// Size is the length of the sealed part.
+func (s *sealedPart) Size() int64 {
+	return s.size + int64(len(s.nonces))*chunkOverhead
+}
+
+func (s *sealedPart) Read(p []byte) (int, error) {
+	const sealedChunk = encryptionChunkSize + chunkOverhead
+	if s.pos >= s.Size() {
+		return 0, io.EOF
+	}
+
+	chunk := int(s.pos / sealedChunk)
+	if chunk != s.chunk {
+		if err := s.seal(chunk); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, s.sealed[s.pos-int64(chunk)*sealedChunk:])
+	s.pos += int64(n)
+	return n, nil
+}
+
+func (s *sealedPart) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		offset += s.Size()
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	s.pos = offset
+	return offset, nil
+}
+
+// seal reads chunk from src and seals it into s.sealed.
+func (s *sealedPart) seal(chunk int) error {
+	start := int64(chunk) * encryptionChunkSize
+	plain := make([]byte, min(encryptionChunkSize, s.size-start))
+	if _, err := s.src.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(s.src, plain); err != nil {
+		return fmt.Errorf("failed to read chunk %d of part: %w", chunk, err)
+	}
+
+	nonce := s.nonces[chunk]
+	if nonce == nil {
+		nonce = make([]byte, s.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return fmt.Errorf("failed to generate nonce: %w", err)
+		}
+		s.nonces[chunk] = nonce
+	}
+
+	final := s.last && chunk == len(s.nonces)-1
+	s.sealed = s.aead.Seal(append(s.sealed[:0], nonce...), nonce, plain, chunkAD(s.index+uint64(chunk), final))
+	s.chunk = chunk
+	return nil
+}
+
+// decryptReader opens the sealed chunks read from src, starting at chunk
+// index. With chunks >= 0 it reads that many and src holds one more byte when
+// the object goes on after them. A bound object must end in its final chunk.
+type decryptReader struct {
+	src    io.Reader
+	aead   cipher.AEAD
+	bound  bool
+	index  uint64
+	chunks int64
+	buf    []byte
+	plain  []byte
+	final  bool
+	done   bool
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if r.buf == nil {
+			r.buf = make([]byte, encryptionChunkSize+chunkOverhead)
+		}
+
+		n, err := io.ReadFull(r.src, r.buf)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			if n == 0 {
+				r.done = true
+				if r.bound && !r.final {
+					return 0, errTruncated
+				}
+				return 0, io.EOF
+			}
+		} else if err != nil {
+			return 0, err
+		}
+
+		r.plain, err = r.open(r.buf[:n])
+		if err != nil {
+			return 0, fmt.Errorf("failed to decrypt chunk: %w", err)
+		}
+		r.index++
+		if r.chunks > 0 {
+			r.chunks--
+		}
+		if r.chunks == 0 && r.bound && !r.final {
+			// The range is read, and a byte must follow unless it was cut off
+			if n, _ := io.ReadFull(r.src, make([]byte, 1)); n == 0 {
+				return 0, errTruncated
+			}
+		}
+		// Nothing after the final chunk belongs to the object
+		r.done = r.final || r.chunks == 0
+	}
+
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+// open opens one chunk. Whether it is the final one only shows from the
+// additional data it was sealed with.
+func (r *decryptReader) open(sealed []byte) ([]byte, error) {
+	if !r.bound {
+		return open(r.aead, sealed, nil)
+	}
+
+	plain, err := open(r.aead, sealed, chunkAD(r.index, false))
+	if err != nil {
+		plain, err = open(r.aead, sealed, chunkAD(r.index, true))
+		r.final = err == nil
+	}
+	return plain, err
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// KeyParams are the values available to a key scheme.
+type KeyParams struct {
+	UserID   string
+	MediaID  string
+	Checksum string
+	Filename string // original file name, sanitised before use
+	Version  int    // version of the media's file, 0 or 1 for the first one
+}
+
+// KeyScheme builds object keys from a template such as
+// "{user}/{media_id}/{sanitized_name}". The template must contain {checksum}
+// or {media_id} so that no two uploads can end up with the same key.
+type KeyScheme struct {
+	template string
+}
+
+var (
+	keyPlaceholder  = regexp.MustCompile(`\{[^{}]*\}`)
+	keyPlaceholders = map[string]bool{
+		"{user}":           true,
+		"{media_id}":       true,
+		"{checksum}":       true,
+		"{sanitized_name}": true,
+		"{ext}":            true,
+	}
+)
+
+func NewKeyScheme(template string) (*KeyScheme, error) {
+	template = strings.Trim(strings.TrimSpace(template), "/")
+	if template == "" {
+		return nil, fmt.Errorf("storage key scheme is empty")
+	}
+
+	for _, placeholder := range keyPlaceholder.FindAllString(template, -1) {
+		if !keyPlaceholders[placeholder] {
+			return nil, fmt.Errorf("storage key scheme has unknown placeholder %s", placeholder)
+		}
+	}
+
+	if !strings.Contains(template, "{checksum}") && !strings.Contains(template, "{media_id}") {
+		return nil, fmt.Errorf("storage key scheme %q must contain {checksum} or {media_id}", template)
+	}
+
+	return &KeyScheme{template: template}, nil
+}
+
+// PerUser reports whether keys are placed under the uploading user.
+func (s *KeyScheme) PerUser() bool {
+	return strings.Contains(s.template, "{user}")
+}
+
+// Key returns the object key for params. {media_id} gets a "-v<n>" suffix
+// from the second version of a media's file on, so a replaced file never
+// overwrites the one it replaces.
+func (s *KeyScheme) Key(params KeyParams) string {
+	name := SanitizeFilename(params.Filename)
+
+	mediaID := params.MediaID
+	if params.Version > 1 {
+		mediaID = fmt.Sprintf("%s-v%d", mediaID, params.Version)
+	}
+
+	return strings.NewReplacer(
+		"{user}", params.UserID,
+		"{media_id}", mediaID,
+		"{checksum}", params.Checksum,
+		"{sanitized_name}", name,
+		"{ext}", strings.TrimPrefix(path.Ext(name), "."),
+	).Replace(s.template)
+}
+
+// maxNameLength bounds the sanitised name, leaving room for the rest of the
+// key within the 1024 byte limit of S3.
+const maxNameLength = 128
+
+// SanitizeFilename reduces a client-supplied file name to a safe key segment:
+// directory parts are dropped, anything but ASCII letters, digits, '-', '_'
+// and '.' becomes '-', and the extension is lower-cased.
+func SanitizeFilename(filename string) string {
+	filename = path.Base(strings.ReplaceAll(filename, "\\", "/"))
+
+	ext := path.Ext(filename)
+	base := sanitizeSegment(strings.TrimSuffix(filename, ext))
+	ext = sanitizeSegment(strings.ToLower(strings.TrimPrefix(ext, ".")))
+
+	if base == "" {
+		base = "file"
+	}
+	if len(base) > maxNameLength {
+		base = strings.Trim(base[:maxNameLength], "-._")
+	}
+	if ext != "" {
+		return base + "." + ext
+	}
+	return base
+}
+
+func sanitizeSegment(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.':
+			b.WriteRune(r)
+			dash = false
+		default:
+			if !dash {
+				b.WriteByte('-')
+				dash = true
+			}
+		}
+	}
+	return strings.Trim(b.String(), "-._")
+}
@@ -0,0 +1,463 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/interfaces"
+
+	"github.com/google/uuid"
+)
+
+// LocalFilesPath is the route prefix under which the server exposes objects
+// stored by LocalProvider.
+const LocalFilesPath = "/files"
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrURLExpired       = errors.New("url expired")
+)
+
+func init() {
+	Register("local", Driver{
+		Validate: func(cfg config.StorageConfig) []string {
+			return missingSettings(
+				setting{"LOCAL_STORAGE_ROOT", cfg.Local.RootDir},
+				setting{"LOCAL_STORAGE_BASE_URL", cfg.Local.BaseURL},
+				setting{"LOCAL_STORAGE_SIGNING_KEY", cfg.Local.SigningKey},
+			)
+		},
+		New: func(ctx context.Context, cfg config.StorageConfig) (interfaces.Provider, error) {
+			return NewLocalProvider(cfg.Local)
+		},
+	})
+}
+
+// LocalProvider stores objects on the local filesystem. It is meant for
+// development and CI where no cloud account is available.
+type LocalProvider struct {
+	rootDir    string
+	baseURL    string
+	signingKey []byte
+}
+
+func NewLocalProvider(cfg config.LocalConfig) (*LocalProvider, error) {
+	rootDir, err := filepath.Abs(cfg.RootDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve local storage root: %w", err)
+	}
+
+	if err := os.MkdirAll(rootDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create local storage root: %w", err)
+	}
+
+	return &LocalProvider{
+		rootDir:    rootDir,
+		baseURL:    strings.TrimRight(cfg.BaseURL, "/"),
+		signingKey: []byte(cfg.SigningKey),
+	}, nil
+}
+
+func (p *LocalProvider) UploadFile(ctx context.Context, file io.Reader, filename string, contentType string) (string, error) {
+	fullPath, err := p.resolve(filename)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	// Write to a temporary file first so readers never see a partial object
+	tmp, err := os.CreateTemp(filepath.Dir(fullPath), ".upload-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, &contextReader{ctx: ctx, r: file}); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to close file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), fullPath); err != nil {
+		return "", fmt.Errorf("failed to move file into place: %w", err)
+	}
+
+	return p.GetFileURL(ctx, filename)
+}
+
+func (p *LocalProvider) DeleteFile(ctx context.Context, filename string) error {
+	fullPath, err := p.resolve(filename)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	return nil
+}
+
+func (p *LocalProvider) GetFileURL(ctx context.Context, filename string) (string, error) {
+	return p.baseURL + LocalFilesPath + "/" + escapePath(filename), nil
+}
+
+func (p *LocalProvider) GeneratePresignedURL(ctx context.Context, filename string, expiresIn int64) (string, error) {
+	fileURL, err := p.GetFileURL(ctx, filename)
+	if err != nil {
+		return "", err
+	}
+
+	expires := time.Now().Add(time.Duration(expiresIn) * time.Second).Unix()
+
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", p.sign(filename, expires))
+
+	return fileURL + "?" + query.Encode(), nil
+}
+
+// VerifySignature checks a signature produced by GeneratePresignedURL.
+func (p *LocalProvider) VerifySignature(filename, expires, signature string) error {
+	return verifySignature(expires, signature, func(expiresAt int64) string {
+		return p.sign(filename, expiresAt)
+	})
+}
+
+// PresignUpload returns a signed PUT to the files route. The signature covers
+// the content type, so the client has to send the one it was given.
+func (p *LocalProvider) PresignUpload(ctx context.Context, filename string, contentType string, expiresIn int64) (*interfaces.PresignedRequest, error) {
+	return p.presignPut(ctx, filename, contentType, expiresIn)
+}
+
+// PresignUploadPart returns a signed PUT of the file that holds the part.
+func (p *LocalProvider) PresignUploadPart(ctx context.Context, filename string, uploadID string, partNumber int, expiresIn int64) (*interfaces.PresignedRequest, error) {
+	partKey := path.Join(localMultipartDir, filepath.Base(uploadID), strconv.Itoa(partNumber))
+	return p.presignPut(ctx, partKey, "", expiresIn)
+}
+
+func (p *LocalProvider) presignPut(ctx context.Context, filename string, contentType string, expiresIn int64) (*interfaces.PresignedRequest, error) {
+	fileURL, err := p.GetFileURL(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	expires := time.Now().Add(time.Duration(expiresIn) * time.Second).Unix()
+
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", p.signUpload(filename, contentType, expires))
+
+	request := &interfaces.PresignedRequest{Method: http.MethodPut, URL: fileURL + "?" + query.Encode()}
+	if contentType != "" {
+		request.Headers = map[string]string{"Content-Type": contentType}
+	}
+	return request, nil
+}
+
+// VerifyUploadSignature checks a signature produced by PresignUpload or
+// PresignUploadPart against the content type the client sent.
+func (p *LocalProvider) VerifyUploadSignature(filename, contentType, expires, signature string) error {
+	return verifySignature(expires, signature, func(expiresAt int64) string {
+		return p.signUpload(filename, contentType, expiresAt)
+	})
+}
+
+func verifySignature(expires, signature string, sign func(expiresAt int64) string) error {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	if !hmac.Equal([]byte(sign(expiresAt)), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+
+	if time.Now().Unix() > expiresAt {
+		return ErrURLExpired
+	}
+
+	return nil
+}
+
+// OpenFile opens a stored object for reading.
+func (p *LocalProvider) OpenFile(filename string) (*os.File, error) {
+	fullPath, err := p.resolve(filename)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(fullPath)
+}
+
+func (p *LocalProvider) Stat(ctx context.Context, filename string) (*interfaces.ObjectInfo, error) {
+	fullPath, err := p.resolve(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if info.IsDir() {
+		return nil, ErrObjectNotFound
+	}
+
+	return &interfaces.ObjectInfo{
+		Size:         info.Size(),
+		ContentType:  mime.TypeByExtension(filepath.Ext(filename)),
+		ETag:         fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()),
+		LastModified: info.ModTime(),
+	}, nil
+}
+
+func (p *LocalProvider) Open(ctx context.Context, filename string, offset int64, length int64) (io.ReadCloser, error) {
+	file, err := p.OpenFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to seek file: %w", err)
+	}
+
+	if length < 0 {
+		return file, nil
+	}
+	return &limitedFile{Reader: io.LimitReader(file, length), file: file}, nil
+}
+
+// List walks the directory holding prefix. Tokens are the last key of the
+// previous page.
+func (p *LocalProvider) List(ctx context.Context, prefix string, token string, limit int) (*interfaces.ObjectPage, error) {
+	dir := p.rootDir
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		resolved, err := p.resolve(prefix[:i])
+		if err != nil {
+			return nil, err
+		}
+		dir = resolved
+	}
+
+	var objects []interfaces.ObjectSummary
+	err := filepath.WalkDir(dir, func(fullPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && fullPath == dir {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(p.rootDir, fullPath)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+
+		if entry.IsDir() {
+			if key == localMultipartDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), ".upload-") || !strings.HasPrefix(key, prefix) || key <= token {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		objects = append(objects, interfaces.ObjectSummary{
+			Key:          key,
+			Size:         info.Size(),
+			ETag:         fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()),
+			LastModified: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	return paginate(objects, limit), nil
+}
+
+func (p *LocalProvider) Copy(ctx context.Context, src string, dst string) error {
+	body, err := p.Open(ctx, src, 0, -1)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	_, err = p.UploadFile(ctx, body, dst, "")
+	return err
+}
+
+func (p *LocalProvider) sign(filename string, expires int64) string {
+	mac := hmac.New(sha256.New, p.signingKey)
+	mac.Write([]byte(filename))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signUpload signs a PUT. The method is part of the signed text so a download
+// URL can never be used to overwrite the object.
+func (p *LocalProvider) signUpload(filename string, contentType string, expires int64) string {
+	mac := hmac.New(sha256.New, p.signingKey)
+	mac.Write([]byte(http.MethodPut))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(filename))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(contentType))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// resolve maps an object key to a path under the root directory, rejecting
+// keys that would escape it.
+func (p *LocalProvider) resolve(filename string) (string, error) {
+	cleaned := path.Clean("/" + filename)
+	if cleaned == "/" {
+		return "", fmt.Errorf("invalid filename: %q", filename)
+	}
+
+	fullPath := filepath.Join(p.rootDir, filepath.FromSlash(cleaned))
+	if !strings.HasPrefix(fullPath, p.rootDir+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid filename: %q", filename)
+	}
+
+	return fullPath, nil
+}
+
+// limitedFile reads a bounded section of a file and closes the file.
+type limitedFile struct {
+	io.Reader
+	file *os.File
+}
+
+func (f *limitedFile) Close() error {
+	return f.file.Close()
+}
+
+// contextReader stops a copy as soon as ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+func escapePath(filename string) string {
+	segments := strings.Split(filename, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// localMultipartDir holds parts of in-progress multipart uploads, relative to
+// the root directory.
+const localMultipartDir = ".multipart"
+
+func (p *LocalProvider) CreateMultipartUpload(ctx context.Context, filename string, contentType string) (string, error) {
+	uploadID := uuid.NewString()
+	if err := os.MkdirAll(p.multipartDir(uploadID), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create multipart upload: %w", err)
+	}
+	return uploadID, nil
+}
+
+func (p *LocalProvider) UploadPart(ctx context.Context, filename string, uploadID string, partNumber int, part io.ReadSeeker, size int64) (string, error) {
+	partPath := filepath.Join(p.multipartDir(uploadID), strconv.Itoa(partNumber))
+
+	out, err := os.Create(partPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create part %d: %w", partNumber, err)
+	}
+	defer out.Close()
+
+	hash := sha256.New()
+	if _, err := io.CopyN(io.MultiWriter(out, hash), &contextReader{ctx: ctx, r: part}, size); err != nil {
+		return "", fmt.Errorf("failed to write part %d: %w", partNumber, err)
+	}
+
+	if err := out.Close(); err != nil {
+		return "", fmt.Errorf("failed to write part %d: %w", partNumber, err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (p *LocalProvider) CompleteMultipartUpload(ctx context.Context, filename string, uploadID string, contentType string, parts []interfaces.CompletedPart) (string, error) {
+	readers := make([]io.Reader, 0, len(parts))
+	for _, part := range parts {
+		f, err := os.Open(filepath.Join(p.multipartDir(uploadID), strconv.Itoa(part.PartNumber)))
+		if err != nil {
+			return "", fmt.Errorf("failed to open part %d: %w", part.PartNumber, err)
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+
+	url, err := p.UploadFile(ctx, io.MultiReader(readers...), filename, contentType)
+	if err != nil {
+		return "", err
+	}
+
+	if err := p.AbortMultipartUpload(ctx, filename, uploadID); err != nil {
+		return "", err
+	}
+
+	return url, nil
+}
+
+// AbortMultipartUpload removes the staged parts.
+func (p *LocalProvider) AbortMultipartUpload(ctx context.Context, filename string, uploadID string) error {
+	if err := os.RemoveAll(p.multipartDir(uploadID)); err != nil {
+		return fmt.Errorf("failed to remove multipart upload: %w", err)
+	}
+	return nil
+}
+
+func (p *LocalProvider) multipartDir(uploadID string) string {
+	return filepath.Join(p.rootDir, localMultipartDir, filepath.Base(uploadID))
+}
@@ -0,0 +1,442 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/interfaces"
+
+	"github.com/google/uuid"
+)
+
+// ErrInjectedFault is returned by MemoryProvider for failures injected
+// through Faults.
+var ErrInjectedFault = errors.New("injected storage fault")
+
+func init() {
+	Register("memory", Driver{
+		New: func(ctx context.Context, cfg config.StorageConfig) (interfaces.Provider, error) {
+			return NewMemoryProvider(), nil
+		},
+	})
+}
+
+// Faults configures the failures MemoryProvider simulates.
+type Faults struct {
+	// Latency is added to every call before it does anything.
+	Latency time.Duration
+	// ErrorRate is the probability, from 0 to 1, that a call fails.
+	ErrorRate float64
+	// Err is returned by failing calls. It defaults to ErrInjectedFault.
+	Err error
+	// Operations limits injected errors to the named operations, such as
+	// "UploadFile" or "Open". All operations fail when it is empty.
+	Operations []string
+	// PartialWrite makes UploadFile store only the first PartialWrite bytes
+	// of an object and then fail, like a connection dropped mid-upload.
+	PartialWrite int64
+}
+
+// Call is one recorded MemoryProvider operation.
+type Call struct {
+	Operation string
+	Filename  string
+	Size      int64 // bytes written or requested, -1 for the rest of an object
+	Err       error
+	At        time.Time
+}
+
+// MemoryProvider keeps objects in memory. It is meant for tests and local
+// experiments: faults can be injected and calls recorded.
+type MemoryProvider struct {
+	mu        sync.Mutex
+	objects   map[string]*memoryObject
+	uploads   map[string]map[int][]byte // multipart upload ID -> parts
+	faults    Faults
+	rand      *rand.Rand
+	recording bool
+	calls     []Call
+}
+
+type memoryObject struct {
+	data        []byte
+	contentType string
+	etag        string
+	modified    time.Time
+}
+
+func NewMemoryProvider() *MemoryProvider {
+	return &MemoryProvider{
+		objects: make(map[string]*memoryObject),
+		uploads: make(map[string]map[int][]byte),
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// SetFaults replaces the simulated failures. The zero value disables them.
+func (p *MemoryProvider) SetFaults(faults Faults) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.faults = faults
+}
+
+// StartRecording clears the call log and records every following call.
+func (p *MemoryProvider) StartRecording() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.recording = true
+	p.calls = nil
+}
+
+// StopRecording stops adding calls to the log.
+func (p *MemoryProvider) StopRecording() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.recording = false
+}
+
+// Calls returns the recorded calls in order.
+func (p *MemoryProvider) Calls() []Call {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Call(nil), p.calls...)
+}
+
+// Object returns a copy of a stored object's content.
+func (p *MemoryProvider) Object(filename string) ([]byte, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	object, ok := p.objects[filename]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), object.data...), true
+}
+
+// Keys returns the keys of all stored objects in sorted order.
+func (p *MemoryProvider) Keys() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	keys := make([]string, 0, len(p.objects))
+	for key := range p.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (p *MemoryProvider) UploadFile(ctx context.Context, file io.Reader, filename string, contentType string) (string, error) {
+	faults, err := p.begin(ctx, "UploadFile")
+	if err != nil {
+		return "", p.record("UploadFile", filename, 0, err)
+	}
+
+	var data []byte
+	if faults.PartialWrite > 0 {
+		data, err = io.ReadAll(io.LimitReader(&contextReader{ctx: ctx, r: file}, faults.PartialWrite))
+		if err == nil {
+			err = faultError(faults)
+		}
+	} else {
+		data, err = io.ReadAll(&contextReader{ctx: ctx, r: file})
+	}
+
+	// A partial write leaves the truncated object behind
+	if err == nil || faults.PartialWrite > 0 {
+		p.put(filename, data, contentType)
+	}
+	if err != nil {
+		return "", p.record("UploadFile", filename, int64(len(data)), err)
+	}
+
+	p.record("UploadFile", filename, int64(len(data)), nil)
+	return p.GetFileURL(ctx, filename)
+}
+
+func (p *MemoryProvider) DeleteFile(ctx context.Context, filename string) error {
+	if _, err := p.begin(ctx, "DeleteFile"); err != nil {
+		return p.record("DeleteFile", filename, 0, err)
+	}
+
+	p.mu.Lock()
+	delete(p.objects, filename)
+	p.mu.Unlock()
+
+	return p.record("DeleteFile", filename, 0, nil)
+}
+
+func (p *MemoryProvider) GetFileURL(ctx context.Context, filename string) (string, error) {
+	return "memory:///" + escapePath(filename), nil
+}
+
+func (p *MemoryProvider) GeneratePresignedURL(ctx context.Context, filename string, expiresIn int64) (string, error) {
+	if _, err := p.begin(ctx, "GeneratePresignedURL"); err != nil {
+		return "", p.record("GeneratePresignedURL", filename, 0, err)
+	}
+	p.record("GeneratePresignedURL", filename, 0, nil)
+
+	fileURL, _ := p.GetFileURL(ctx, filename)
+	expires := time.Now().Add(time.Duration(expiresIn) * time.Second).Unix()
+	return fileURL + "?" + url.Values{"expires": {strconv.FormatInt(expires, 10)}}.Encode(), nil
+}
+
+func (p *MemoryProvider) Stat(ctx context.Context, filename string) (*interfaces.ObjectInfo, error) {
+	if _, err := p.begin(ctx, "Stat"); err != nil {
+		return nil, p.record("Stat", filename, 0, err)
+	}
+
+	p.mu.Lock()
+	object, ok := p.objects[filename]
+	p.mu.Unlock()
+
+	if !ok {
+		return nil, p.record("Stat", filename, 0, ErrObjectNotFound)
+	}
+	p.record("Stat", filename, 0, nil)
+
+	return &interfaces.ObjectInfo{
+		Size:         int64(len(object.data)),
+		ContentType:  object.contentType,
+		ETag:         object.etag,
+		LastModified: object.modified,
+	}, nil
+}
+
+func (p *MemoryProvider) Open(ctx context.Context, filename string, offset int64, length int64) (io.ReadCloser, error) {
+	if _, err := p.begin(ctx, "Open"); err != nil {
+		return nil, p.record("Open", filename, length, err)
+	}
+
+	p.mu.Lock()
+	object, ok := p.objects[filename]
+	p.mu.Unlock()
+
+	if !ok {
+		return nil, p.record("Open", filename, length, ErrObjectNotFound)
+	}
+	p.record("Open", filename, length, nil)
+
+	// Objects are replaced, never modified, so the slice can be shared
+	data := object.data
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	data = data[offset:]
+	if length >= 0 && length < int64(len(data)) {
+		data = data[:length]
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (p *MemoryProvider) List(ctx context.Context, prefix string, token string, limit int) (*interfaces.ObjectPage, error) {
+	if _, err := p.begin(ctx, "List"); err != nil {
+		return nil, p.record("List", prefix, 0, err)
+	}
+
+	p.mu.Lock()
+	var objects []interfaces.ObjectSummary
+	for key, object := range p.objects {
+		if strings.HasPrefix(key, prefix) && key > token {
+			objects = append(objects, interfaces.ObjectSummary{
+				Key:          key,
+				Size:         int64(len(object.data)),
+				ETag:         object.etag,
+				LastModified: object.modified,
+			})
+		}
+	}
+	p.mu.Unlock()
+
+	p.record("List", prefix, 0, nil)
+	return paginate(objects, limit), nil
+}
+
+func (p *MemoryProvider) Copy(ctx context.Context, src string, dst string) error {
+	if _, err := p.begin(ctx, "Copy"); err != nil {
+		return p.record("Copy", src, 0, err)
+	}
+
+	p.mu.Lock()
+	object, ok := p.objects[src]
+	p.mu.Unlock()
+
+	if !ok {
+		return p.record("Copy", src, 0, ErrObjectNotFound)
+	}
+
+	p.put(dst, object.data, object.contentType)
+	return p.record("Copy", src, int64(len(object.data)), nil)
+}
+
+func (p *MemoryProvider) CreateMultipartUpload(ctx context.Context, filename string, contentType string) (string, error) {
+	if _, err := p.begin(ctx, "CreateMultipartUpload"); err != nil {
+		return "", p.record("CreateMultipartUpload", filename, 0, err)
+	}
+
+	uploadID := uuid.NewString()
+	p.mu.Lock()
+	p.uploads[uploadID] = make(map[int][]byte)
+	p.mu.Unlock()
+
+	p.record("CreateMultipartUpload", filename, 0, nil)
+	return uploadID, nil
+}
+
+func (p *MemoryProvider) UploadPart(ctx context.Context, filename string, uploadID string, partNumber int, part io.ReadSeeker, size int64) (string, error) {
+	if _, err := p.begin(ctx, "UploadPart"); err != nil {
+		return "", p.record("UploadPart", filename, size, err)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(&contextReader{ctx: ctx, r: part}, size))
+	if err != nil {
+		return "", p.record("UploadPart", filename, size, err)
+	}
+
+	p.mu.Lock()
+	parts, ok := p.uploads[uploadID]
+	if ok {
+		parts[partNumber] = data
+	}
+	p.mu.Unlock()
+
+	if !ok {
+		return "", p.record("UploadPart", filename, size, fmt.Errorf("unknown multipart upload %s", uploadID))
+	}
+
+	p.record("UploadPart", filename, size, nil)
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (p *MemoryProvider) CompleteMultipartUpload(ctx context.Context, filename string, uploadID string, contentType string, parts []interfaces.CompletedPart) (string, error) {
+	if _, err := p.begin(ctx, "CompleteMultipartUpload"); err != nil {
+		return "", p.record("CompleteMultipartUpload", filename, 0, err)
+	}
+
+	p.mu.Lock()
+	staged, ok := p.uploads[uploadID]
+	delete(p.uploads, uploadID)
+	p.mu.Unlock()
+
+	if !ok {
+		return "", p.record("CompleteMultipartUpload", filename, 0, fmt.Errorf("unknown multipart upload %s", uploadID))
+	}
+
+	var data []byte
+	for _, part := range parts {
+		chunk, ok := staged[part.PartNumber]
+		if !ok {
+			return "", p.record("CompleteMultipartUpload", filename, 0, fmt.Errorf("missing part %d", part.PartNumber))
+		}
+		data = append(data, chunk...)
+	}
+
+	p.put(filename, data, contentType)
+	p.record("CompleteMultipartUpload", filename, int64(len(data)), nil)
+	return p.GetFileURL(ctx, filename)
+}
+
+func (p *MemoryProvider) AbortMultipartUpload(ctx context.Context, filename string, uploadID string) error {
+	if _, err := p.begin(ctx, "AbortMultipartUpload"); err != nil {
+		return p.record("AbortMultipartUpload", filename, 0, err)
+	}
+
+	p.mu.Lock()
+	delete(p.uploads, uploadID)
+	p.mu.Unlock()
+
+	return p.record("AbortMultipartUpload", filename, 0, nil)
+}
+
+func (p *MemoryProvider) put(filename string, data []byte, contentType string) {
+	sum := md5.Sum(data)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.objects[filename] = &memoryObject{
+		data:        data,
+		contentType: contentType,
+		etag:        `"` + hex.EncodeToString(sum[:]) + `"`,
+		modified:    time.Now().UTC(),
+	}
+}
+
+// begin applies the configured latency and decides whether the operation
+// fails. It returns the faults in effect for the call.
+func (p *MemoryProvider) begin(ctx context.Context, operation string) (Faults, error) {
+	p.mu.Lock()
+	faults := p.faults
+	fail := faults.ErrorRate > 0 && appliesTo(faults, operation) && p.rand.Float64() < faults.ErrorRate
+	p.mu.Unlock()
+
+	if faults.Latency > 0 {
+		timer := time.NewTimer(faults.Latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return faults, ctx.Err()
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return faults, err
+	}
+	if fail {
+		return faults, faultError(faults)
+	}
+	if operation != "UploadFile" || !appliesTo(faults, operation) {
+		faults.PartialWrite = 0
+	}
+	return faults, nil
+}
+
+func (p *MemoryProvider) record(operation, filename string, size int64, err error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.recording {
+		p.calls = append(p.calls, Call{
+			Operation: operation,
+			Filename:  filename,
+			Size:      size,
+			Err:       err,
+			At:        time.Now(),
+		})
+	}
+	return err
+}
+
+func appliesTo(faults Faults, operation string) bool {
+	if len(faults.Operations) == 0 {
+		return true
+	}
+	for _, op := range faults.Operations {
+		if op == operation {
+			return true
+		}
+	}
+	return false
+}
+
+func faultError(faults Faults) error {
+	if faults.Err != nil {
+		return faults.Err
+	}
+	return ErrInjectedFault
+}
@@ -0,0 +1,631 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/interfaces"
+)
+
+const (
+	mirrorQueueSize     = 1024
+	mirrorMaxAttempts   = 5
+	mirrorRetryInterval = time.Minute
+	mirrorTaskTimeout   = 30 * time.Minute
+)
+
+func init() {
+	Register("mirror", Driver{
+		Validate: func(cfg config.StorageConfig) []string {
+			return missingSettings(
+				setting{"MIRROR_PRIMARY", cfg.Mirror.Primary},
+				setting{"MIRROR_SECONDARIES", strings.Join(cfg.Mirror.Secondaries, ",")},
+			)
+		},
+		New: func(ctx context.Context, cfg config.StorageConfig) (interfaces.Provider, error) {
+			return NewMirrorProvider(ctx, cfg)
+		},
+	})
+}
+
+type mirrorBackend struct {
+	name string
+	interfaces.Provider
+}
+
+type mirrorTask struct {
+	filename string
+	backend  mirrorBackend
+	delete   bool
+	attempts int
+}
+
+func (t mirrorTask) key() string {
+	op := "upload"
+	if t.delete {
+		op = "delete"
+	}
+	return op + ":" + t.backend.name + ":" + t.filename
+}
+
+// MirrorProvider writes every object to a primary backend and replicates it
+// to one or more secondaries, either inline ("sync") or through a background
+// queue ("async"). Reads and presigned URLs come from the primary and fall
+// back to the secondaries when it fails. Replication state is recorded through
+// a ReplicaTracker when one is attached.
+type MirrorProvider struct {
+	primary     mirrorBackend
+	secondaries []mirrorBackend
+	async       bool
+
+	mu       sync.Mutex
+	tracker  interfaces.ReplicaTracker
+	inflight map[string]bool
+
+	queue   chan mirrorTask
+	retry   chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+	closing sync.Once
+}
+
+func NewMirrorProvider(ctx context.Context, cfg config.StorageConfig) (*MirrorProvider, error) {
+	mcfg := cfg.Mirror
+
+	if mcfg.Mode != "sync" && mcfg.Mode != "async" {
+		return nil, fmt.Errorf("invalid mirror mode %q: must be sync or async", mcfg.Mode)
+	}
+
+	seen := map[string]bool{}
+	for _, name := range append([]string{mcfg.Primary}, mcfg.Secondaries...) {
+		if name == "mirror" {
+			return nil, fmt.Errorf("mirror provider cannot mirror itself")
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("storage provider %s is listed more than once", name)
+		}
+		seen[name] = true
+	}
+
+	primary, err := Open(ctx, mcfg.Primary, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &MirrorProvider{
+		primary:  mirrorBackend{name: mcfg.Primary, Provider: primary},
+		async:    mcfg.Mode == "async",
+		inflight: make(map[string]bool),
+		queue:    make(chan mirrorTask, mirrorQueueSize),
+		retry:    make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+
+	for _, name := range mcfg.Secondaries {
+		secondary, err := Open(ctx, name, cfg)
+		if err != nil {
+			return nil, err
+		}
+		p.secondaries = append(p.secondaries, mirrorBackend{name: name, Provider: secondary})
+	}
+
+	workers := mcfg.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go p.worker()
+	}
+
+	p.wg.Add(1)
+	go p.retryLoop()
+
+	return p, nil
+}
+
+// SetTracker attaches the store that records replication state and queues
+// any copies that were still pending or failed when the process last stopped.
+func (p *MirrorProvider) SetTracker(tracker interfaces.ReplicaTracker) {
+	p.mu.Lock()
+	p.tracker = tracker
+	p.mu.Unlock()
+
+	select {
+	case p.retry <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops the replication workers. Queued copies stay recorded as pending
+// and are resumed on the next start.
+func (p *MirrorProvider) Close() error {
+	p.closing.Do(func() {
+		close(p.done)
+	})
+	p.wg.Wait()
+	return nil
+}
+
+func (p *MirrorProvider) UploadFile(ctx context.Context, file io.Reader, filename string, contentType string) (string, error) {
+	if p.async {
+		url, err := p.primary.UploadFile(ctx, file, filename, contentType)
+		if err != nil {
+			return "", err
+		}
+		for _, secondary := range p.secondaries {
+			p.enqueue(ctx, mirrorTask{filename: filename, backend: secondary})
+		}
+		return url, nil
+	}
+
+	return p.uploadSync(ctx, file, filename, contentType)
+}
+
+// uploadSync streams the upload to every backend at once. A secondary that
+// fails is recorded and queued for retry rather than failing the upload.
+func (p *MirrorProvider) uploadSync(ctx context.Context, file io.Reader, filename string, contentType string) (string, error) {
+	writers := make([]*io.PipeWriter, len(p.secondaries))
+	errs := make([]error, len(p.secondaries))
+
+	var wg sync.WaitGroup
+	for i, secondary := range p.secondaries {
+		reader, writer := io.Pipe()
+		writers[i] = writer
+
+		wg.Add(1)
+		go func(i int, secondary mirrorBackend) {
+			defer wg.Done()
+			_, errs[i] = secondary.UploadFile(ctx, reader, filename, contentType)
+			reader.CloseWithError(errs[i])
+		}(i, secondary)
+	}
+
+	url, err := p.primary.UploadFile(ctx, io.TeeReader(file, &fanoutWriter{writers: writers}), filename, contentType)
+	for _, writer := range writers {
+		if err != nil {
+			writer.CloseWithError(err)
+		} else {
+			writer.Close()
+		}
+	}
+	wg.Wait()
+
+	if err != nil {
+		return "", err
+	}
+
+	for i, secondary := range p.secondaries {
+		p.record(ctx, mirrorTask{filename: filename, backend: secondary}, errs[i])
+	}
+
+	return url, nil
+}
+
+func (p *MirrorProvider) DeleteFile(ctx context.Context, filename string) error {
+	if err := p.primary.DeleteFile(ctx, filename); err != nil {
+		return err
+	}
+
+	for _, secondary := range p.secondaries {
+		task := mirrorTask{filename: filename, backend: secondary, delete: true}
+		if p.async {
+			p.enqueue(ctx, task)
+			continue
+		}
+		p.record(ctx, task, secondary.DeleteFile(ctx, filename))
+	}
+	return nil
+}
+
+func (p *MirrorProvider) GetFileURL(ctx context.Context, filename string) (string, error) {
+	return p.primary.GetFileURL(ctx, filename)
+}
+
+func (p *MirrorProvider) GeneratePresignedURL(ctx context.Context, filename string, expiresIn int64) (string, error) {
+	url, err := p.primary.GeneratePresignedURL(ctx, filename, expiresIn)
+	if err == nil {
+		return url, nil
+	}
+
+	for _, secondary := range p.secondaries {
+		if url, serr := secondary.GeneratePresignedURL(ctx, filename, expiresIn); serr == nil {
+			log.Printf("Mirror: presigning %s from %s after primary failed: %v", filename, secondary.name, err)
+			return url, nil
+		}
+	}
+	return "", err
+}
+
+// PresignUpload lets the client upload to the primary. The object reaches the
+// secondaries once it is copied to its final key.
+func (p *MirrorProvider) PresignUpload(ctx context.Context, filename string, contentType string, expiresIn int64) (*interfaces.PresignedRequest, error) {
+	uploader, ok := p.primary.Provider.(interfaces.PresignedUploader)
+	if !ok {
+		return nil, ErrDirectUploadNotSupported
+	}
+	return uploader.PresignUpload(ctx, filename, contentType, expiresIn)
+}
+
+func (p *MirrorProvider) PresignUploadPart(ctx context.Context, filename string, uploadID string, partNumber int, expiresIn int64) (*interfaces.PresignedRequest, error) {
+	uploader, ok := p.primary.Provider.(interfaces.PresignedUploader)
+	if !ok {
+		return nil, ErrDirectUploadNotSupported
+	}
+	return uploader.PresignUploadPart(ctx, filename, uploadID, partNumber, expiresIn)
+}
+
+func (p *MirrorProvider) Stat(ctx context.Context, filename string) (*interfaces.ObjectInfo, error) {
+	var info *interfaces.ObjectInfo
+	err := p.read(func(reader interfaces.Provider) error {
+		var err error
+		info, err = reader.Stat(ctx, filename)
+		return err
+	})
+	return info, err
+}
+
+func (p *MirrorProvider) Open(ctx context.Context, filename string, offset int64, length int64) (io.ReadCloser, error) {
+	var body io.ReadCloser
+	err := p.read(func(reader interfaces.Provider) error {
+		var err error
+		body, err = reader.Open(ctx, filename, offset, length)
+		return err
+	})
+	return body, err
+}
+
+func (p *MirrorProvider) List(ctx context.Context, prefix string, token string, limit int) (*interfaces.ObjectPage, error) {
+	// Tokens are backend specific, so a listing is only ever served by the
+	// primary
+	return p.primary.List(ctx, prefix, token, limit)
+}
+
+// Copy copies the object on the primary and then on each secondary. A
+// secondary that cannot copy is caught up from the primary like any other
+// failed replica.
+func (p *MirrorProvider) Copy(ctx context.Context, src string, dst string) error {
+	if err := p.primary.Copy(ctx, src, dst); err != nil {
+		return err
+	}
+
+	for _, secondary := range p.secondaries {
+		task := mirrorTask{filename: dst, backend: secondary}
+		if p.async {
+			p.enqueue(ctx, task)
+			continue
+		}
+
+		err := secondary.Copy(ctx, src, dst)
+		if err != nil {
+			err = p.replicate(ctx, task)
+		}
+		p.record(ctx, task, err)
+	}
+	return nil
+}
+
+// SetStorageClass changes the class on the primary, and on the secondaries
+// that have storage classes too. A secondary that fails is only logged: it
+// still holds the object, just in a costlier class.
+func (p *MirrorProvider) SetStorageClass(ctx context.Context, filename string, class string) error {
+	classer, ok := p.primary.Provider.(interfaces.StorageClasser)
+	if !ok {
+		return ErrStorageClassNotSupported
+	}
+	if err := classer.SetStorageClass(ctx, filename, class); err != nil {
+		return err
+	}
+
+	for _, secondary := range p.secondaries {
+		if classer, ok := secondary.Provider.(interfaces.StorageClasser); ok {
+			if err := classer.SetStorageClass(ctx, filename, class); err != nil {
+				log.Printf("Mirror: failed to change storage class of %s on %s: %v", filename, secondary.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Restore restores the object on the primary, which serves reads.
+func (p *MirrorProvider) Restore(ctx context.Context, filename string, days int) (bool, error) {
+	classer, ok := p.primary.Provider.(interfaces.StorageClasser)
+	if !ok {
+		return false, ErrStorageClassNotSupported
+	}
+	return classer.Restore(ctx, filename, days)
+}
+
+// read runs fn against the primary and then each secondary until one
+// succeeds, returning the primary's error if none do.
+func (p *MirrorProvider) read(fn func(reader interfaces.Provider) error) error {
+	err := fn(p.primary.Provider)
+	if err == nil {
+		return nil
+	}
+
+	for _, secondary := range p.secondaries {
+		if fn(secondary.Provider) == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (p *MirrorProvider) CreateMultipartUpload(ctx context.Context, filename string, contentType string) (string, error) {
+	uploader, ok := p.primary.Provider.(interfaces.MultipartUploader)
+	if !ok {
+		return "", ErrMultipartNotSupported
+	}
+	return uploader.CreateMultipartUpload(ctx, filename, contentType)
+}
+
+func (p *MirrorProvider) UploadPart(ctx context.Context, filename string, uploadID string, partNumber int, part io.ReadSeeker, size int64) (string, error) {
+	uploader, ok := p.primary.Provider.(interfaces.MultipartUploader)
+	if !ok {
+		return "", ErrMultipartNotSupported
+	}
+	return uploader.UploadPart(ctx, filename, uploadID, partNumber, part, size)
+}
+
+// CompleteMultipartUpload assembles the object on the primary, then copies it
+// to the secondaries since the parts never passed through them.
+func (p *MirrorProvider) CompleteMultipartUpload(ctx context.Context, filename string, uploadID string, contentType string, parts []interfaces.CompletedPart) (string, error) {
+	uploader, ok := p.primary.Provider.(interfaces.MultipartUploader)
+	if !ok {
+		return "", ErrMultipartNotSupported
+	}
+
+	url, err := uploader.CompleteMultipartUpload(ctx, filename, uploadID, contentType, parts)
+	if err != nil {
+		return "", err
+	}
+
+	for _, secondary := range p.secondaries {
+		task := mirrorTask{filename: filename, backend: secondary}
+		if p.async {
+			p.enqueue(ctx, task)
+			continue
+		}
+		p.record(ctx, task, p.replicate(ctx, task))
+	}
+	return url, nil
+}
+
+func (p *MirrorProvider) AbortMultipartUpload(ctx context.Context, filename string, uploadID string) error {
+	uploader, ok := p.primary.Provider.(interfaces.MultipartUploader)
+	if !ok {
+		return ErrMultipartNotSupported
+	}
+	return uploader.AbortMultipartUpload(ctx, filename, uploadID)
+}
+
+// replicate copies an object from the primary to a secondary, or deletes it
+// from the secondary.
+func (p *MirrorProvider) replicate(ctx context.Context, task mirrorTask) error {
+	if task.delete {
+		return task.backend.DeleteFile(ctx, task.filename)
+	}
+
+	info, err := p.primary.Stat(ctx, task.filename)
+	if err != nil {
+		return err
+	}
+
+	body, err := p.primary.Open(ctx, task.filename, 0, -1)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	_, err = task.backend.UploadFile(ctx, body, task.filename, info.ContentType)
+	return err
+}
+
+// enqueue records a copy as pending and hands it to the workers. If the queue
+// is full the copy stays pending and the retry loop picks it up later.
+func (p *MirrorProvider) enqueue(ctx context.Context, task mirrorTask) {
+	p.mu.Lock()
+	if p.inflight[task.key()] {
+		p.mu.Unlock()
+		return
+	}
+	p.inflight[task.key()] = true
+	p.mu.Unlock()
+
+	status := interfaces.ReplicaPending
+	if task.delete {
+		status = interfaces.ReplicaDeleting
+	}
+	p.save(ctx, interfaces.ReplicaState{
+		Filename: task.filename,
+		Backend:  task.backend.name,
+		Status:   status,
+		Attempts: task.attempts,
+	})
+
+	select {
+	case p.queue <- task:
+	default:
+		p.release(task)
+	}
+}
+
+func (p *MirrorProvider) worker() {
+	defer p.wg.Done()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case task := <-p.queue:
+			ctx, cancel := context.WithTimeout(context.Background(), mirrorTaskTimeout)
+			p.record(ctx, task, p.replicate(ctx, task))
+			cancel()
+			p.release(task)
+		}
+	}
+}
+
+// retryLoop periodically re-queues copies that are pending, failed or still
+// waiting to be deleted.
+func (p *MirrorProvider) retryLoop() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(mirrorRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		case <-p.retry:
+		}
+
+		tracker := p.currentTracker()
+		if tracker == nil {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		states, err := tracker.FindReplicas(ctx, interfaces.ReplicaPending, interfaces.ReplicaFailed, interfaces.ReplicaDeleting)
+		if err != nil {
+			log.Printf("Mirror: failed to load replica state: %v", err)
+			cancel()
+			continue
+		}
+
+		for _, state := range states {
+			if state.Attempts >= mirrorMaxAttempts {
+				continue
+			}
+			backend, ok := p.secondary(state.Backend)
+			if !ok {
+				continue
+			}
+			p.enqueue(ctx, mirrorTask{
+				filename: state.Filename,
+				backend:  backend,
+				delete:   state.Status == interfaces.ReplicaDeleting,
+				attempts: state.Attempts,
+			})
+		}
+		cancel()
+	}
+}
+
+// record stores the outcome of a copy or delete on a secondary.
+func (p *MirrorProvider) record(ctx context.Context, task mirrorTask, err error) {
+	if err == nil {
+		if task.delete {
+			p.clear(ctx, task.filename, task.backend.name)
+			return
+		}
+
+		p.save(ctx, interfaces.ReplicaState{
+			Filename: task.filename,
+			Backend:  task.backend.name,
+			Status:   interfaces.ReplicaSynced,
+			Attempts: task.attempts + 1,
+		})
+		return
+	}
+
+	log.Printf("Mirror: failed to replicate %s to %s: %v", task.filename, task.backend.name, err)
+
+	status := interfaces.ReplicaFailed
+	if task.delete {
+		status = interfaces.ReplicaDeleting
+	}
+	p.save(ctx, interfaces.ReplicaState{
+		Filename:  task.filename,
+		Backend:   task.backend.name,
+		Status:    status,
+		Attempts:  task.attempts + 1,
+		LastError: err.Error(),
+	})
+}
+
+func (p *MirrorProvider) save(ctx context.Context, state interfaces.ReplicaState) {
+	tracker := p.currentTracker()
+	if tracker == nil {
+		return
+	}
+
+	// Bookkeeping must not be lost because the request that triggered it ended
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	if err := tracker.SaveReplica(ctx, state); err != nil {
+		log.Printf("Mirror: failed to save replica state for %s on %s: %v", state.Filename, state.Backend, err)
+	}
+}
+
+func (p *MirrorProvider) clear(ctx context.Context, filename string, backend string) {
+	tracker := p.currentTracker()
+	if tracker == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	if err := tracker.DeleteReplica(ctx, filename, backend); err != nil {
+		log.Printf("Mirror: failed to clear replica state for %s on %s: %v", filename, backend, err)
+	}
+}
+
+func (p *MirrorProvider) currentTracker() interfaces.ReplicaTracker {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.tracker
+}
+
+func (p *MirrorProvider) release(task mirrorTask) {
+	p.mu.Lock()
+	delete(p.inflight, task.key())
+	p.mu.Unlock()
+}
+
+func (p *MirrorProvider) secondary(name string) (mirrorBackend, bool) {
+	for _, secondary := range p.secondaries {
+		if secondary.name == name {
+			return secondary, true
+		}
+	}
+	return mirrorBackend{}, false
+}
+
+// fanoutWriter copies writes to every pipe. A pipe whose reader has gone away
+// is dropped so one failing secondary cannot stall the others.
+type fanoutWriter struct {
+	writers []*io.PipeWriter
+	failed  []bool
+}
+
+func (w *fanoutWriter) Write(p []byte) (int, error) {
+	if w.failed == nil {
+		w.failed = make([]bool, len(w.writers))
+	}
+
+	for i, writer := range w.writers {
+		if w.failed[i] {
+			continue
+		}
+		if _, err := writer.Write(p); err != nil {
+			if !errors.Is(err, io.ErrClosedPipe) {
+				log.Printf("Mirror: dropping secondary stream: %v", err)
+			}
+			w.failed[i] = true
+		}
+	}
+	return len(p), nil
+}
@@ -1,47 +1,339 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"sort"
+	"time"
 
 	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
 	"github.com/Shubham-Thakur06/go-streaming-platform/internal/interfaces"
 )
 
+var (
+	// ErrMultipartNotSupported is returned when the configured backend cannot
+	// assemble objects from parts.
+	ErrMultipartNotSupported = errors.New("storage provider does not support multipart uploads")
+	// ErrDirectUploadNotSupported is returned when clients cannot upload to the
+	// configured backend directly. Encrypted storage never allows it.
+	ErrDirectUploadNotSupported = errors.New("storage provider does not support direct uploads")
+	// ErrObjectNotFound is returned by backends when an object does not exist.
+	ErrObjectNotFound = errors.New("object not found")
+	// ErrStorageClassNotSupported is returned when the configured backend has no
+	// storage classes to move objects between.
+	ErrStorageClassNotSupported = errors.New("storage provider does not support storage classes")
+)
+
 type StorageProvider struct {
-	provider interfaces.Provider
+	provider         interfaces.Provider
+	keyScheme        *KeyScheme
+	uploadTimeout    time.Duration
+	operationTimeout time.Duration
+	cdn              *CDN
 }
 
-func NewProvider(cfg config.StorageConfig) (*StorageProvider, error) {
-	var provider interfaces.Provider
-	var err error
+// NewProvider builds the driver selected by cfg.Provider from the registry,
+// paired with the cold tier driver when cfg.ColdProvider is set.
+func NewProvider(ctx context.Context, cfg config.StorageConfig) (*StorageProvider, error) {
+	provider, err := Open(ctx, cfg.Provider, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.ColdProvider != "" {
+		if cfg.ColdClass != "" {
+			return nil, fmt.Errorf("STORAGE_COLD_CLASS and STORAGE_COLD_PROVIDER cannot both be set")
+		}
+		if cfg.ColdProvider == cfg.Provider {
+			return nil, fmt.Errorf("cold storage provider must differ from %s", cfg.Provider)
+		}
 
-	switch cfg.Provider {
-	case "aws":
-		provider, err = NewAWSProvider(cfg.AWS)
-	default:
-		return nil, fmt.Errorf("unsupported storage provider: %s", cfg.Provider)
+		cold, err := Open(ctx, cfg.ColdProvider, cfg)
+		if err != nil {
+			return nil, err
+		}
+		provider = NewTieredProvider(provider, cold)
 	}
 
+	return NewProviderWith(provider, cfg)
+}
+
+// NewProviderWith wraps an already built backend, applying the rest of the
+// storage configuration. Tests use it to run against a MemoryProvider.
+func NewProviderWith(provider interfaces.Provider, cfg config.StorageConfig) (*StorageProvider, error) {
+	keyScheme, err := NewKeyScheme(cfg.KeyScheme)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize %s provider: %w", cfg.Provider, err)
+		return nil, err
+	}
+
+	if cfg.Encryption.Enabled {
+		provider, err = NewEncryptedProvider(provider, cfg.Encryption)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return &StorageProvider{provider: provider}, nil
+	return &StorageProvider{
+		provider:         provider,
+		keyScheme:        keyScheme,
+		uploadTimeout:    time.Duration(cfg.UploadTimeout) * time.Second,
+		operationTimeout: time.Duration(cfg.OperationTimeout) * time.Second,
+	}, nil
+}
+
+// ObjectKey returns the key for a new object under the configured scheme.
+func (sp *StorageProvider) ObjectKey(params KeyParams) string {
+	return sp.keyScheme.Key(params)
 }
 
-func (sp *StorageProvider) UploadFile(file io.Reader, filename string, contentType string) (string, error) {
-	return sp.provider.UploadFile(file, filename, contentType)
+// KeysPerUser reports whether the configured scheme keys objects by user.
+func (sp *StorageProvider) KeysPerUser() bool {
+	return sp.keyScheme.PerUser()
+}
+
+func (sp *StorageProvider) UploadFile(ctx context.Context, file io.Reader, filename string, contentType string) (string, error) {
+	ctx, cancel := withTimeout(ctx, sp.uploadTimeout)
+	defer cancel()
+	return sp.provider.UploadFile(ctx, file, filename, contentType)
+}
+
+func (sp *StorageProvider) DeleteFile(ctx context.Context, filename string) error {
+	ctx, cancel := withTimeout(ctx, sp.operationTimeout)
+	defer cancel()
+	return sp.provider.DeleteFile(ctx, filename)
+}
+
+func (sp *StorageProvider) GetFileURL(ctx context.Context, filename string) (string, error) {
+	return sp.provider.GetFileURL(ctx, filename)
+}
+
+func (sp *StorageProvider) GeneratePresignedURL(ctx context.Context, filename string, expiresIn int64) (string, error) {
+	ctx, cancel := withTimeout(ctx, sp.operationTimeout)
+	defer cancel()
+	return sp.provider.GeneratePresignedURL(ctx, filename, expiresIn)
+}
+
+func (sp *StorageProvider) CreateMultipartUpload(ctx context.Context, filename string, contentType string) (string, error) {
+	uploader, ok := sp.provider.(interfaces.MultipartUploader)
+	if !ok {
+		return "", ErrMultipartNotSupported
+	}
+
+	ctx, cancel := withTimeout(ctx, sp.operationTimeout)
+	defer cancel()
+	return uploader.CreateMultipartUpload(ctx, filename, contentType)
+}
+
+func (sp *StorageProvider) UploadPart(ctx context.Context, filename string, uploadID string, partNumber int, part io.ReadSeeker, size int64) (string, error) {
+	uploader, ok := sp.provider.(interfaces.MultipartUploader)
+	if !ok {
+		return "", ErrMultipartNotSupported
+	}
+
+	ctx, cancel := withTimeout(ctx, sp.uploadTimeout)
+	defer cancel()
+	return uploader.UploadPart(ctx, filename, uploadID, partNumber, part, size)
+}
+
+func (sp *StorageProvider) CompleteMultipartUpload(ctx context.Context, filename string, uploadID string, contentType string, parts []interfaces.CompletedPart) (string, error) {
+	uploader, ok := sp.provider.(interfaces.MultipartUploader)
+	if !ok {
+		return "", ErrMultipartNotSupported
+	}
+
+	ctx, cancel := withTimeout(ctx, sp.uploadTimeout)
+	defer cancel()
+	return uploader.CompleteMultipartUpload(ctx, filename, uploadID, contentType, parts)
+}
+
+func (sp *StorageProvider) AbortMultipartUpload(ctx context.Context, filename string, uploadID string) error {
+	uploader, ok := sp.provider.(interfaces.MultipartUploader)
+	if !ok {
+		return ErrMultipartNotSupported
+	}
+
+	ctx, cancel := withTimeout(ctx, sp.operationTimeout)
+	defer cancel()
+	return uploader.AbortMultipartUpload(ctx, filename, uploadID)
+}
+
+// PresignUpload returns a request the client can use to upload an object
+// straight to the backend.
+func (sp *StorageProvider) PresignUpload(ctx context.Context, filename string, contentType string, expiresIn int64) (*interfaces.PresignedRequest, error) {
+	uploader, ok := sp.provider.(interfaces.PresignedUploader)
+	if !ok {
+		return nil, ErrDirectUploadNotSupported
+	}
+
+	ctx, cancel := withTimeout(ctx, sp.operationTimeout)
+	defer cancel()
+	return uploader.PresignUpload(ctx, filename, contentType, expiresIn)
+}
+
+func (sp *StorageProvider) PresignUploadPart(ctx context.Context, filename string, uploadID string, partNumber int, expiresIn int64) (*interfaces.PresignedRequest, error) {
+	uploader, ok := sp.provider.(interfaces.PresignedUploader)
+	if !ok {
+		return nil, ErrDirectUploadNotSupported
+	}
+
+	ctx, cancel := withTimeout(ctx, sp.operationTimeout)
+	defer cancel()
+	return uploader.PresignUploadPart(ctx, filename, uploadID, partNumber, expiresIn)
 }
 
-func (sp *StorageProvider) DeleteFile(filename string) error {
-	return sp.provider.DeleteFile(filename)
+func (sp *StorageProvider) Stat(ctx context.Context, filename string) (*interfaces.ObjectInfo, error) {
+	ctx, cancel := withTimeout(ctx, sp.operationTimeout)
+	defer cancel()
+	return sp.provider.Stat(ctx, filename)
 }
 
-func (sp *StorageProvider) GetFileURL(filename string) (string, error) {
-	return sp.provider.GetFileURL(filename)
+// Open reads length bytes of an object starting at offset; a negative length
+// reads to the end. The read is bound to ctx for as long as the body is open.
+func (sp *StorageProvider) Open(ctx context.Context, filename string, offset int64, length int64) (io.ReadCloser, error) {
+	return sp.provider.Open(ctx, filename, offset, length)
 }
 
-func (sp *StorageProvider) GeneratePresignedURL(filename string, expiresIn int64) (string, error) {
-	return sp.provider.GeneratePresignedURL(filename, expiresIn)
+// List returns one page of the objects under prefix. Pass the returned
+// NextToken to fetch the next page; it is empty after the last one.
+func (sp *StorageProvider) List(ctx context.Context, prefix string, token string, limit int) (*interfaces.ObjectPage, error) {
+	ctx, cancel := withTimeout(ctx, sp.operationTimeout)
+	defer cancel()
+	return sp.provider.List(ctx, prefix, token, limit)
+}
+
+// Copy copies an object to a new key inside the backend.
+func (sp *StorageProvider) Copy(ctx context.Context, src string, dst string) error {
+	ctx, cancel := withTimeout(ctx, sp.uploadTimeout)
+	defer cancel()
+	return sp.provider.Copy(ctx, src, dst)
+}
+
+// SetStorageClass moves an object to another storage class of the backend.
+// An empty class moves it back to the default one.
+func (sp *StorageProvider) SetStorageClass(ctx context.Context, filename string, class string) error {
+	classer, ok := sp.provider.(interfaces.StorageClasser)
+	if !ok {
+		return ErrStorageClassNotSupported
+	}
+
+	ctx, cancel := withTimeout(ctx, sp.uploadTimeout)
+	defer cancel()
+	return classer.SetStorageClass(ctx, filename, class)
+}
+
+// Restore starts bringing an archived object back and reports whether it can
+// be read now.
+func (sp *StorageProvider) Restore(ctx context.Context, filename string, days int) (bool, error) {
+	classer, ok := sp.provider.(interfaces.StorageClasser)
+	if !ok {
+		return false, ErrStorageClassNotSupported
+	}
+
+	ctx, cancel := withTimeout(ctx, sp.operationTimeout)
+	defer cancel()
+	return classer.Restore(ctx, filename, days)
+}
+
+// NewObjectReader returns a seekable reader over an object of the given size.
+func (sp *StorageProvider) NewObjectReader(ctx context.Context, filename string, size int64) *ObjectReader {
+	return newObjectReader(ctx, sp.provider, filename, size)
+}
+
+// Mirror returns the underlying MirrorProvider, or nil when another backend is
+// configured.
+func (sp *StorageProvider) Mirror() *MirrorProvider {
+	mirror, _ := findProvider[*MirrorProvider](sp.provider)
+	return mirror
+}
+
+// Encryption returns the EncryptedProvider, or nil when encryption is off.
+func (sp *StorageProvider) Encryption() *EncryptedProvider {
+	encrypted, _ := findProvider[*EncryptedProvider](sp.provider)
+	return encrypted
+}
+
+// SetCDN sets the CDN that serves objects from this backend.
+func (sp *StorageProvider) SetCDN(cdn *CDN) {
+	sp.cdn = cdn
+}
+
+// CDN returns the CDN in front of the backend, or nil when none is configured.
+func (sp *StorageProvider) CDN() *CDN {
+	return sp.cdn
+}
+
+// Close releases resources held by the backend, such as background workers.
+func (sp *StorageProvider) Close() error {
+	if closer, ok := sp.provider.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Tiering returns the TieredProvider, or nil when no cold tier provider is
+// configured.
+func (sp *StorageProvider) Tiering() *TieredProvider {
+	tiered, _ := findProvider[*TieredProvider](sp.provider)
+	return tiered
+}
+
+// Local returns the underlying LocalProvider, or nil when another backend is
+// configured. The cold tier is checked when the hot one is not local.
+func (sp *StorageProvider) Local() *LocalProvider {
+	local, ok := findProvider[*LocalProvider](sp.provider)
+	if !ok {
+		if tiered := sp.Tiering(); tiered != nil {
+			local, _ = findProvider[*LocalProvider](tiered.Cold())
+		}
+	}
+	return local
+}
+
+// findProvider looks for a provider of type T, following providers that wrap
+// another one.
+func findProvider[T interfaces.Provider](provider interfaces.Provider) (T, bool) {
+	for {
+		if found, ok := provider.(T); ok {
+			return found, true
+		}
+
+		wrapper, ok := provider.(interface{ Unwrap() interfaces.Provider })
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		provider = wrapper.Unwrap()
+	}
+}
+
+// withTimeout bounds ctx by timeout; a zero timeout leaves ctx unchanged.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// defaultListLimit is the page size used when List is called without a limit.
+const defaultListLimit = 1000
+
+// paginate sorts objects by key and cuts the first page for backends whose
+// list token is simply the last key returned.
+func paginate(objects []interfaces.ObjectSummary, limit int) *interfaces.ObjectPage {
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+
+	page := &interfaces.ObjectPage{Objects: objects}
+	if len(objects) > limit {
+		page.Objects = objects[:limit]
+		page.NextToken = objects[limit-1].Key
+	}
+	return page
 }
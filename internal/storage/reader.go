@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/interfaces"
+)
+
+// ObjectReader adapts a Provider's ranged reads to io.ReadSeekCloser so that objects can
+// be served with http.ServeContent. Each Seek drops the current stream and the
+// next Read opens a new ranged read at the new position.
+type ObjectReader struct {
+	ctx      context.Context
+	reader   interfaces.Provider
+	filename string
+	size     int64
+	pos      int64
+	body     io.ReadCloser
+}
+
+func newObjectReader(ctx context.Context, reader interfaces.Provider, filename string, size int64) *ObjectReader {
+	return &ObjectReader{
+		ctx:      ctx,
+		reader:   reader,
+		filename: filename,
+		size:     size,
+	}
+}
+
+func (r *ObjectReader) Read(p []byte) (int, error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.body == nil {
+		body, err := r.reader.Open(r.ctx, r.filename, r.pos, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+
+	n, err := r.body.Read(p)
+	r.pos += int64(n)
+	return n, err
+}
+
+func (r *ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = r.pos + offset
+	case io.SeekEnd:
+		pos = r.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if pos < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	if pos != r.pos && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.pos = pos
+	return pos, nil
+}
+
+func (r *ObjectReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
+
+// httpRange formats an HTTP Range header value; a negative length means to the end.
+func httpRange(offset int64, length int64) string {
+	if length < 0 {
+		return fmt.Sprintf("bytes=%d-", offset)
+	}
+	return fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+}
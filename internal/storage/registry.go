@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/config"
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/interfaces"
+)
+
+// Driver describes a storage backend that can be selected with STORAGE_PROVIDER.
+type Driver struct {
+	// Validate reports the settings the backend needs but did not get. It runs
+	// before New so misconfiguration fails fast with a complete list.
+	Validate func(cfg config.StorageConfig) []string
+	// New builds the backend from the storage configuration.
+	New func(ctx context.Context, cfg config.StorageConfig) (interfaces.Provider, error)
+}
+
+// MissingSettingsError is returned when a driver's configuration is incomplete.
+type MissingSettingsError struct {
+	Driver   string
+	Settings []string
+}
+
+func (e *MissingSettingsError) Error() string {
+	return fmt.Sprintf("%s storage provider is missing required settings: %s", e.Driver, strings.Join(e.Settings, ", "))
+}
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]Driver)
+)
+
+// Register makes a storage driver available by name. It is meant to be called
+// from an init function and panics if the name is already taken.
+func Register(name string, driver Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	if driver.New == nil {
+		panic("storage: Register driver factory is nil for " + name)
+	}
+	if _, exists := drivers[name]; exists {
+		panic("storage: Register called twice for driver " + name)
+	}
+	drivers[name] = driver
+}
+
+// Drivers returns the names of the registered drivers in sorted order.
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open validates the configuration for the named driver and builds it.
+func Open(ctx context.Context, name string, cfg config.StorageConfig) (interfaces.Provider, error) {
+	driversMu.RLock()
+	driver, ok := drivers[name]
+	driversMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unsupported storage provider: %s (available: %s)", name, strings.Join(Drivers(), ", "))
+	}
+
+	if driver.Validate != nil {
+		if missing := driver.Validate(cfg); len(missing) > 0 {
+			return nil, &MissingSettingsError{Driver: name, Settings: missing}
+		}
+	}
+
+	provider, err := driver.New(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize %s provider: %w", name, err)
+	}
+	return provider, nil
+}
+
+// setting pairs an environment variable name with its configured value.
+type setting struct {
+	name  string
+	value string
+}
+
+// missingSettings returns the names of the settings that are empty.
+func missingSettings(settings ...setting) []string {
+	var missing []string
+	for _, s := range settings {
+		if strings.TrimSpace(s.value) == "" {
+			missing = append(missing, s.name)
+		}
+	}
+	return missing
+}
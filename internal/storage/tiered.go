@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Shubham-Thakur06/go-streaming-platform/internal/interfaces"
+)
+
+// TieredProvider keeps new objects on a hot backend and lets rarely used ones
+// be moved to a cheaper cold backend. Writes go to the hot tier; reads try the
+// hot tier first and fall back to the cold one.
+type TieredProvider struct {
+	hot  interfaces.Provider
+	cold interfaces.Provider
+}
+
+func NewTieredProvider(hot interfaces.Provider, cold interfaces.Provider) *TieredProvider {
+	return &TieredProvider{
+		hot:  hot,
+		cold: cold,
+	}
+}
+
+// Unwrap returns the hot tier, which takes all writes.
+func (p *TieredProvider) Unwrap() interfaces.Provider {
+	return p.hot
+}
+
+// Hot returns the backend new objects are written to.
+func (p *TieredProvider) Hot() interfaces.Provider {
+	return p.hot
+}
+
+// Cold returns the backend objects are moved to when they cool down.
+func (p *TieredProvider) Cold() interfaces.Provider {
+	return p.cold
+}
+
+// Close closes both tiers.
+func (p *TieredProvider) Close() error {
+	var errs []error
+	for _, provider := range []interfaces.Provider{p.hot, p.cold} {
+		if closer, ok := provider.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// MoveToCold copies an object from the hot tier to the cold one and deletes
+// the hot copy once the sizes match.
+func (p *TieredProvider) MoveToCold(ctx context.Context, filename string) error {
+	return moveObject(ctx, p.hot, p.cold, filename)
+}
+
+// MoveToHot brings an object back from the cold tier.
+func (p *TieredProvider) MoveToHot(ctx context.Context, filename string) error {
+	return moveObject(ctx, p.cold, p.hot, filename)
+}
+
+// moveObject streams an object from src to dst. Moving an object already in
+// dst only removes what is left of it in src.
+func moveObject(ctx context.Context, src interfaces.Provider, dst interfaces.Provider, filename string) error {
+	info, err := src.Stat(ctx, filename)
+	if errors.Is(err, ErrObjectNotFound) {
+		if _, err := dst.Stat(ctx, filename); err != nil {
+			return err
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	body, err := src.Open(ctx, filename, 0, -1)
+	if err != nil {
+		return err
+	}
+	_, err = dst.UploadFile(ctx, body, filename, info.ContentType)
+	body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to copy %s: %w", filename, err)
+	}
+
+	copied, err := dst.Stat(ctx, filename)
+	if err != nil {
+		return fmt.Errorf("failed to verify copy of %s: %w", filename, err)
+	}
+	if copied.Size != info.Size {
+		dst.DeleteFile(context.WithoutCancel(ctx), filename)
+		return fmt.Errorf("copy of %s has %d bytes, expected %d", filename, copied.Size, info.Size)
+	}
+
+	return src.DeleteFile(ctx, filename)
+}
+
+func (p *TieredProvider) UploadFile(ctx context.Context, file io.Reader, filename string, contentType string) (string, error) {
+	return p.hot.UploadFile(ctx, file, filename, contentType)
+}
+
+// DeleteFile deletes the object from both tiers.
+func (p *TieredProvider) DeleteFile(ctx context.Context, filename string) error {
+	if err := p.hot.DeleteFile(ctx, filename); err != nil && !errors.Is(err, ErrObjectNotFound) {
+		return err
+	}
+	if err := p.cold.DeleteFile(ctx, filename); err != nil && !errors.Is(err, ErrObjectNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (p *TieredProvider) GetFileURL(ctx context.Context, filename string) (string, error) {
+	return p.hot.GetFileURL(ctx, filename)
+}
+
+// GeneratePresignedURL signs a URL on the tier holding the object, which
+// takes a Stat of the hot tier first.
+func (p *TieredProvider) GeneratePresignedURL(ctx context.Context, filename string, expiresIn int64) (string, error) {
+	if _, err := p.hot.Stat(ctx, filename); errors.Is(err, ErrObjectNotFound) {
+		if _, err := p.cold.Stat(ctx, filename); err == nil {
+			return p.cold.GeneratePresignedURL(ctx, filename, expiresIn)
+		}
+	}
+	return p.hot.GeneratePresignedURL(ctx, filename, expiresIn)
+}
+
+func (p *TieredProvider) Stat(ctx context.Context, filename string) (*interfaces.ObjectInfo, error) {
+	info, err := p.hot.Stat(ctx, filename)
+	if errors.Is(err, ErrObjectNotFound) {
+		return p.cold.Stat(ctx, filename)
+	}
+	return info, err
+}
+
+func (p *TieredProvider) Open(ctx context.Context, filename string, offset int64, length int64) (io.ReadCloser, error) {
+	body, err := p.hot.Open(ctx, filename, offset, length)
+	if errors.Is(err, ErrObjectNotFound) {
+		return p.cold.Open(ctx, filename, offset, length)
+	}
+	return body, err
+}
+
+// List lists the hot tier only.
+func (p *TieredProvider) List(ctx context.Context, prefix string, token string, limit int) (*interfaces.ObjectPage, error) {
+	return p.hot.List(ctx, prefix, token, limit)
+}
+
+// Copy copies within the hot tier. A source in the cold tier is copied into
+// the hot tier, since copies are new objects.
+func (p *TieredProvider) Copy(ctx context.Context, src string, dst string) error {
+	err := p.hot.Copy(ctx, src, dst)
+	if !errors.Is(err, ErrObjectNotFound) {
+		return err
+	}
+
+	info, err := p.cold.Stat(ctx, src)
+	if err != nil {
+		return err
+	}
+	body, err := p.cold.Open(ctx, src, 0, -1)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	_, err = p.hot.UploadFile(ctx, body, dst, info.ContentType)
+	return err
+}
+
+func (p *TieredProvider) CreateMultipartUpload(ctx context.Context, filename string, contentType string) (string, error) {
+	uploader, ok := p.hot.(interfaces.MultipartUploader)
+	if !ok {
+		return "", ErrMultipartNotSupported
+	}
+	return uploader.CreateMultipartUpload(ctx, filename, contentType)
+}
+
+func (p *TieredProvider) UploadPart(ctx context.Context, filename string, uploadID string, partNumber int, part io.ReadSeeker, size int64) (string, error) {
+	uploader, ok := p.hot.(interfaces.MultipartUploader)
+	if !ok {
+		return "", ErrMultipartNotSupported
+	}
+	return uploader.UploadPart(ctx, filename, uploadID, partNumber, part, size)
+}
+
+func (p *TieredProvider) CompleteMultipartUpload(ctx context.Context, filename string, uploadID string, contentType string, parts []interfaces.CompletedPart) (string, error) {
+	uploader, ok := p.hot.(interfaces.MultipartUploader)
+	if !ok {
+		return "", ErrMultipartNotSupported
+	}
+	return uploader.CompleteMultipartUpload(ctx, filename, uploadID, contentType, parts)
+}
+
+func (p *TieredProvider) AbortMultipartUpload(ctx context.Context, filename string, uploadID string) error {
+	uploader, ok := p.hot.(interfaces.MultipartUploader)
+	if !ok {
+		return ErrMultipartNotSupported
+	}
+	return uploader.AbortMultipartUpload(ctx, filename, uploadID)
+}
+
+func (p *TieredProvider) PresignUpload(ctx context.Context, filename string, contentType string, expiresIn int64) (*interfaces.PresignedRequest, error) {
+	uploader, ok := p.hot.(interfaces.PresignedUploader)
+	if !ok {
+		return nil, ErrDirectUploadNotSupported
+	}
+	return uploader.PresignUpload(ctx, filename, contentType, expiresIn)
+}
+
+func (p *TieredProvider) PresignUploadPart(ctx context.Context, filename string, uploadID string, partNumber int, expiresIn int64) (*interfaces.PresignedRequest, error) {
+	uploader, ok := p.hot.(interfaces.PresignedUploader)
+	if !ok {
+		return nil, ErrDirectUploadNotSupported
+	}
+	return uploader.PresignUploadPart(ctx, filename, uploadID, partNumber, expiresIn)
+}